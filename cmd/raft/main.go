@@ -5,9 +5,12 @@ import "os"
 
 import "github.com/sirgallo/raft/pkg/connpool"
 import "github.com/sirgallo/raft/pkg/service"
+import "github.com/sirgallo/raft/pkg/snapshot"
 import "github.com/sirgallo/raft/pkg/logger"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/tracing"
 import "github.com/sirgallo/raft/pkg/utils"
+import "github.com/sirgallo/raft/pkg/wal"
 
 
 const NAME = "Main"
@@ -18,6 +21,24 @@ func main() {
 	hostname, hostErr := os.Hostname()
 	if hostErr != nil { log.Fatal("unable to get hostname") }
 
+	logOpts, logOptsErr := clog.OptsFromEnv()
+	if logOptsErr != nil { log.Fatal("unable to read logger options: ", logOptsErr.Error()) }
+
+	configureErr := clog.Configure(logOpts)
+	if configureErr != nil { log.Fatal("unable to configure logger: ", configureErr.Error()) }
+
+	traceOpts, traceOptsErr := tracing.OptsFromEnv()
+	if traceOptsErr != nil { log.Fatal("unable to read tracer options: ", traceOptsErr.Error()) }
+
+	traceConfigureErr := tracing.Configure(traceOpts)
+	if traceConfigureErr != nil { log.Fatal("unable to configure tracer: ", traceConfigureErr.Error()) }
+
+	walOpts, walOptsErr := wal.OptsFromEnv()
+	if walOptsErr != nil { log.Fatal("unable to read wal options: ", walOptsErr.Error()) }
+
+	snapshotPolicy, snapshotPolicyErr := snapshot.PolicyFromEnv()
+	if snapshotPolicyErr != nil { log.Fatal("unable to read snapshot policy: ", snapshotPolicyErr.Error()) }
+
 	systemsList := []*system.System{
 		{ Host: "raftsrv1" },
 		{ Host: "raftsrv2" },
@@ -39,6 +60,8 @@ func main() {
 		},
 		SystemsList: otherSystems,
 		ConnPoolOpts: connpool.ConnectionPoolOpts{ MaxConn: 10 },
+		WAL: walOpts,
+		Snapshot: snapshotPolicy,
 	}
 
 	raft := service.NewRaftService(raftOpts)
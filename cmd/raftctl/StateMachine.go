@@ -0,0 +1,170 @@
+package main
+
+import "errors"
+import "flag"
+import "fmt"
+import "os"
+import "path/filepath"
+
+import "github.com/sirgallo/raft/pkg/statemachine"
+
+
+//=========================================== Raft Ctl State Machine
+
+
+/*
+	State Machine
+		inspect, export, and import the collections in the state machine db of a node
+
+		collections
+			the metadata of all collections, with their document counts and indexes
+		count
+			the number of documents in a collection, counted by scanning it
+		dump
+			write every document in a collection as json lines
+		verify
+			check that every document has a matching entry in each index of the collection and that every index entry
+			points to a matching document, for one collection or all collections, exiting with a non zero status if any
+			are inconsistent
+		export
+			write the metadata of a collection followed by its documents as json lines, to stdout or the -file
+		import
+			read a collection written by export from stdin or the -file, creating the collection if it does not exist, under
+			the -collection name if one is passed
+*/
+
+func runStateMachine(args []string) error {
+	if len(args) < 1 { return errors.New("sm subcommand required: collections, count, dump, verify, export, or import") }
+
+	flags := flag.NewFlagSet(StateMachineCommand + " " + args[0], flag.ExitOnError)
+	dbPath := flags.String("db", defaultStateMachinePath(), "path to the state machine db")
+	collection := flags.String("collection", "", "name of the collection, or on import, the name to import the collection as")
+	file := flags.String("file", "", "on export, the file to write to, and on import, the file to read from, instead of stdout or stdin")
+
+	flags.Parse(args[1:])
+
+	readOnly := args[0] != SMImportCommand
+
+	sm, openErr := statemachine.OpenCollectionStoreFile(*dbPath, readOnly)
+	if openErr != nil { return openErr }
+	defer sm.DB.Close()
+
+	switch args[0] {
+		case SMCollectionsCommand:
+			collections, listErr := sm.Collections()
+			if listErr != nil { return listErr }
+
+			return writeJSON(collections)
+		case SMCountCommand:
+			total, countErr := sm.CountDocuments(*collection)
+			if countErr != nil { return countErr }
+
+			return writeJSON(&CollectionCount{ Collection: *collection, Documents: total })
+		case SMDumpCommand:
+			_, dumpErr := sm.DumpCollection(*collection, os.Stdout)
+			return dumpErr
+		case SMVerifyCommand:
+			return verifyCollections(sm, *collection)
+		case SMExportCommand:
+			return exportCollection(sm, *collection, *file)
+		case SMImportCommand:
+			return importCollection(sm, *collection, *file)
+		default:
+			return errors.New("unknown sm subcommand: " + args[0])
+	}
+}
+
+/*
+	Verify Collections
+		verify the collection passed, or every collection if none is passed
+*/
+
+func verifyCollections(sm *statemachine.CollectionStore, collection string) error {
+	names := []string{ collection }
+
+	if collection == "" {
+		collections, listErr := sm.Collections()
+		if listErr != nil { return listErr }
+
+		names = nil
+		for _, info := range collections {
+			names = append(names, info.Name)
+		}
+	}
+
+	consistent := true
+	reports := []*statemachine.CollectionReport{}
+
+	for _, name := range names {
+		report, verifyErr := sm.VerifyCollection(name)
+		if verifyErr != nil { return verifyErr }
+
+		if ! report.IsConsistent() { consistent = false }
+		reports = append(reports, report)
+	}
+
+	writeErr := writeJSON(reports)
+	if writeErr != nil { return writeErr }
+	if ! consistent { return errors.New("state machine is inconsistent") }
+
+	return nil
+}
+
+func exportCollection(sm *statemachine.CollectionStore, collection string, file string) error {
+	if file == "" {
+		_, exportErr := sm.ExportCollection(collection, os.Stdout)
+		return exportErr
+	}
+
+	exportFile, createErr := os.Create(file)
+	if createErr != nil { return createErr }
+
+	total, exportErr := sm.ExportCollection(collection, exportFile)
+	closeErr := exportFile.Close()
+	if exportErr != nil { return exportErr }
+	if closeErr != nil { return closeErr }
+
+	fmt.Fprintln(os.Stderr, "exported", total, "documents to", file)
+	return nil
+}
+
+func importCollection(sm *statemachine.CollectionStore, collection string, file string) error {
+	reader := os.Stdin
+
+	if file != "" {
+		importFile, openErr := os.Open(file)
+		if openErr != nil { return openErr }
+		defer importFile.Close()
+
+		reader = importFile
+	}
+
+	total, importErr := sm.ImportCollection(reader, collection)
+	if importErr != nil { return importErr }
+
+	fmt.Fprintln(os.Stderr, "imported", total, "documents")
+	return nil
+}
+
+func defaultStateMachinePath() string {
+	homedir, homeErr := os.UserHomeDir()
+	if homeErr != nil { return statemachine.DbFileName }
+
+	return filepath.Join(homedir, statemachine.SubDirectory, statemachine.DbFileName)
+}
+
+
+type CollectionCount struct {
+	Collection string `json:"collection"`
+	Documents int `json:"documents"`
+}
+
+
+const (
+	SMCollectionsCommand = "collections"
+	SMCountCommand = "count"
+	SMDumpCommand = "dump"
+	SMVerifyCommand = "verify"
+	SMExportCommand = "export"
+	SMImportCommand = "import"
+)
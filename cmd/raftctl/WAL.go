@@ -0,0 +1,166 @@
+package main
+
+import "encoding/json"
+import "errors"
+import "flag"
+import "fmt"
+import "os"
+import "path/filepath"
+
+import "github.com/sirgallo/raft/pkg/wal"
+
+
+//=========================================== Raft Ctl WAL
+
+
+/*
+	WAL
+		inspect and repair the replicated log in the wal db of a node
+
+		stats
+			the total entries and size of the replicated log, as recorded in the replog stats bucket and as counted
+		verify
+			check the replicated log for gaps, entries that do not decode, a term index that does not match the log, and
+			stats that do not match the log, exiting with a non zero status if any are found
+		dump
+			write the entries in a range as json lines, where the end defaults to the latest entry
+		repair
+			rebuild the term index and recount the stats, and with -truncate, remove all entries after the last valid entry
+		compact
+			copy the db to a fresh file to reclaim the space of pages freed by log compaction, and with -threshold, only if
+			at least that fraction of the file is free
+*/
+
+func runWAL(args []string) error {
+	if len(args) < 1 { return errors.New("wal subcommand required: stats, verify, dump, repair, or compact") }
+
+	flags := flag.NewFlagSet(WALCommand + " " + args[0], flag.ExitOnError)
+	dbPath := flags.String("db", defaultWALPath(), "path to the wal db")
+	start := flags.Int64("start", 0, "first index to dump")
+	end := flags.Int64("end", -1, "last index to dump, or -1 for the latest entry")
+	truncate := flags.Bool("truncate", false, "on repair, remove all entries after the last valid entry")
+	threshold := flags.Float64("threshold", 0, "on compact, the fraction of the file that must be free pages to compact")
+
+	flags.Parse(args[1:])
+
+	if args[0] == WALCompactCommand {
+		sizeBefore, sizeAfter, compactErr := wal.CompactDBFile(*dbPath, *threshold)
+		if compactErr != nil { return compactErr }
+
+		return writeJSON(&WALCompaction{ SizeBefore: sizeBefore, SizeAfter: sizeAfter })
+	}
+
+	readOnly := args[0] != WALRepairCommand
+
+	walDB, openErr := wal.OpenWALFile(*dbPath, readOnly)
+	if openErr != nil { return openErr }
+	defer walDB.Close()
+
+	store := walDB.LogStore.(*wal.BoltLogStore)
+
+	switch args[0] {
+		case WALStatsCommand:
+			report, inspectErr := store.Inspect()
+			if inspectErr != nil { return inspectErr }
+
+			return writeJSON(&WALStats{
+				Entries: report.Entries,
+				SizeInBytes: report.SizeInBytes,
+				StatsEntries: report.StatsEntries,
+				StatsSizeInBytes: report.StatsSizeInBytes,
+				FirstIndex: report.FirstIndex,
+				LastIndex: report.LastIndex,
+			})
+		case WALVerifyCommand:
+			report, inspectErr := store.Inspect()
+			if inspectErr != nil { return inspectErr }
+
+			writeErr := writeJSON(report)
+			if writeErr != nil { return writeErr }
+			if ! report.IsConsistent() { return errors.New("wal is inconsistent") }
+
+			return nil
+		case WALDumpCommand:
+			return dumpWAL(store, *start, *end)
+		case WALRepairCommand:
+			report, repairErr := store.Repair(*truncate)
+			if repairErr != nil { return repairErr }
+
+			return writeJSON(report)
+		default:
+			return errors.New("unknown wal subcommand: " + args[0])
+	}
+}
+
+/*
+	Dump WAL
+		read the range in chunks, so the entire log is never held in memory
+*/
+
+func dumpWAL(store *wal.BoltLogStore, start int64, end int64) error {
+	if end < 0 {
+		latest, latestErr := store.GetLatest()
+		if latestErr != nil { return latestErr }
+		if latest == nil { return nil }
+
+		end = latest.Index
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	for chunkStart := start; chunkStart <= end; chunkStart += DumpChunkSize {
+		chunkEnd := chunkStart + DumpChunkSize - 1
+		if chunkEnd > end { chunkEnd = end }
+
+		entries, rangeErr := store.GetRange(chunkStart, chunkEnd)
+		if rangeErr != nil { return rangeErr }
+
+		for _, entry := range entries {
+			encodeErr := encoder.Encode(wal.Dump(entry))
+			if encodeErr != nil { return encodeErr }
+		}
+	}
+
+	return nil
+}
+
+func defaultWALPath() string {
+	homedir, homeErr := os.UserHomeDir()
+	if homeErr != nil { return wal.FileName }
+
+	return filepath.Join(homedir, wal.SubDirectory, wal.FileName)
+}
+
+func writeJSON(value interface{}) error {
+	encoded, encErr := json.MarshalIndent(value, "", "  ")
+	if encErr != nil { return encErr }
+
+	_, writeErr := fmt.Fprintln(os.Stdout, string(encoded))
+	return writeErr
+}
+
+
+type WALStats struct {
+	Entries int64 `json:"entries"`
+	SizeInBytes int64 `json:"sizeInBytes"`
+	StatsEntries int64 `json:"statsEntries"`
+	StatsSizeInBytes int64 `json:"statsSizeInBytes"`
+	FirstIndex int64 `json:"firstIndex"`
+	LastIndex int64 `json:"lastIndex"`
+}
+
+type WALCompaction struct {
+	SizeBefore int64 `json:"sizeBefore"`
+	SizeAfter int64 `json:"sizeAfter"`
+}
+
+
+const (
+	WALStatsCommand = "stats"
+	WALVerifyCommand = "verify"
+	WALDumpCommand = "dump"
+	WALRepairCommand = "repair"
+	WALCompactCommand = "compact"
+)
+
+const DumpChunkSize = 1000
@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+import "os"
+
+
+//=========================================== Raft Ctl
+
+
+/*
+	raftctl
+		offline tools for the data of a raft node, run against the files of a node that is not running
+
+		usage:
+			raftctl wal <stats | verify | dump | repair | compact> [flags]
+			raftctl sm <collections | count | dump | verify | export | import> [flags]
+*/
+
+func main() {
+	if len(os.Args) < 2 { exitWithUsage() }
+
+	var runErr error
+
+	switch os.Args[1] {
+		case WALCommand:
+			runErr = runWAL(os.Args[2:])
+		case StateMachineCommand:
+			runErr = runStateMachine(os.Args[2:])
+		default:
+			exitWithUsage()
+	}
+
+	if runErr != nil {
+		fmt.Fprintln(os.Stderr, "error:", runErr.Error())
+		os.Exit(1)
+	}
+}
+
+func exitWithUsage() {
+	fmt.Fprintln(os.Stderr, Usage)
+	os.Exit(2)
+}
+
+
+const WALCommand = "wal"
+const StateMachineCommand = "sm"
+
+const Usage = `usage:
+	raftctl wal <stats | verify | dump | repair | compact> [flags]
+	raftctl sm <collections | count | dump | verify | export | import> [flags]
+
+run "raftctl <command> <subcommand> -h" for the flags of a subcommand`
@@ -3,6 +3,8 @@ module github.com/sirgallo/raft
 go 1.20
 
 require (
+	github.com/klauspost/compress v1.17.4
+	github.com/pierrec/lz4/v4 v4.1.18
 	go.etcd.io/bbolt v1.3.7
 	google.golang.org/grpc v1.56.2
 	google.golang.org/protobuf v1.31.0
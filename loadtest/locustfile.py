@@ -21,6 +21,16 @@ class MyUser(FastHttpUser):
   host = HOST
   wait_time = between(0.1, 0.5)  # Random wait time between requests
 
+  def on_start(self):
+    payload = {
+      'action': 'create collection',
+      'payload': {
+        'collection': 'test'
+      }
+    }
+
+    response = self.client.post(ENDPOINT, json=payload, verify=False)
+
   @task(2)
   def insert(self):
     payload = {
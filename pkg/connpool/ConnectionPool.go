@@ -7,6 +7,8 @@ import "google.golang.org/grpc/connectivity"
 import "google.golang.org/grpc/credentials/insecure"
 import "google.golang.org/grpc/encoding/gzip"
 
+import "github.com/sirgallo/raft/pkg/metrics"
+
 
 //=========================================== Connection Pool
 
@@ -69,6 +71,8 @@ func (cp *ConnectionPool) GetConnection(addr string, port string) (*grpc.ClientC
 		connections := emptyConns.([]*grpc.ClientConn)
 		cp.connections.Store(addr, append(connections, newConn))
 	}
+
+	metrics.ConnPoolConnections.WithLabelValues(addr).Inc()
 	
 	return newConn, nil
 }
@@ -109,6 +113,8 @@ func (cp *ConnectionPool) CloseConnections(addr string) (bool, error) {
 		for _, conn := range connections.([]*grpc.ClientConn) {
 			closeErr := conn.Close()
 			if closeErr != nil { return false, closeErr }
+
+			metrics.ConnPoolConnections.WithLabelValues(addr).Dec()
 		}
 	}
 
@@ -5,6 +5,7 @@ import "sync"
 import "sync/atomic"
 
 import "github.com/sirgallo/raft/pkg/lerpc"
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/system"
 import "github.com/sirgallo/raft/pkg/utils"
 
@@ -20,8 +21,8 @@ import "github.com/sirgallo/raft/pkg/utils"
 		2.) send RequestVoteRPCs in parallel
 		3.) if the candidate receives the minimum number of votes required to be a leader (so quorum),
 			the leader updates its state to Leader and immediately sends heartbeats to establish authority. On transition
-			to leader, the new leader will also update the next index of all of the known systems to reflect the last log
-			index on the system
+			to leader, the new leader will also update the next index of all of the known systems to the index after the last log
+			on the system, and reset the match index of all known systems since nothing is known to be replicated yet
 		4.) if a higher term is discovered, update the current term of the candidate to reflect this and revert back to
 			Follower state
 		5.) otherwise, set the system back to Follower, reset the VotedFor field, and reinitialize the
@@ -30,6 +31,8 @@ import "github.com/sirgallo/raft/pkg/utils"
 
 func (leService *LeaderElectionService) Election() error {
 	leService.CurrentSystem.TransitionToCandidate()
+	metrics.ElectionsStarted.Inc()
+
 	leRespChans := leService.createLERespChannels()
 
 	defer close(leRespChans.VotesChan)
@@ -51,6 +54,7 @@ func (leService *LeaderElectionService) Election() error {
 				case <- leRespChans.BroadcastClose:
 					if votesGranted >= int64(minimumVotes) {
 						leService.CurrentSystem.TransitionToLeader()
+						metrics.ElectionsWon.Inc()
 						
 						lastLogIndex, _, lastLogErr := leService.CurrentSystem.DetermineLastLogIdxAndTerm()
 						if lastLogErr != nil { 
@@ -60,7 +64,8 @@ func (leService *LeaderElectionService) Election() error {
 
 						leService.Systems.Range(func(key, value interface{}) bool {
 							sys := value.(*system.System)
-							sys.UpdateNextIndex(lastLogIndex)
+							sys.UpdateNextIndex(lastLogIndex + 1)
+							sys.ResetMatchIndex()
 							
 							return true
 						})
@@ -36,6 +36,7 @@ func (leService *LeaderElectionService) RequestVoteRPC(ctx context.Context, req
 			Host: req.CandidateId,
 			Status: system.Ready,
 			NextIndex: lastLogIndex,
+			MatchIndex: system.DefaultLastLogIndex,
 		}
 
 		leService.Systems.Store(sys.Host, sys)
@@ -45,9 +46,13 @@ func (leService *LeaderElectionService) RequestVoteRPC(ctx context.Context, req
 		sys.UpdateNextIndex(lastLogIndex)
 	}
 
-	leService.Log.Debug("received requestVoteRPC from:", req.CandidateId)
-	leService.Log.Debug("req current term:", req.CurrentTerm, "system current term:", leService.CurrentSystem.CurrentTerm)
-	leService.Log.Debug("latest log index:", lastLogIndex, "req last log index:", req.LastLogIndex)
+	leService.Log.With(
+		"peer", req.CandidateId,
+		"term", req.CurrentTerm,
+		"currentTerm", leService.CurrentSystem.CurrentTerm,
+		"index", req.LastLogIndex,
+		"lastLogIndex", lastLogIndex,
+	).Debug("received requestVoteRPC")
 	
 	if leService.CurrentSystem.VotedFor == utils.GetZero[string]() || leService.CurrentSystem.VotedFor == req.CandidateId {
 		if req.LastLogIndex >= lastLogIndex && req.LastLogTerm >= lastLogTerm {
@@ -63,7 +68,7 @@ func (leService *LeaderElectionService) RequestVoteRPC(ctx context.Context, req
 				VoteGranted: true,
 			}
 
-			leService.Log.Info("vote granted to:", req.CandidateId)
+			leService.Log.With("peer", req.CandidateId, "term", req.CurrentTerm).Info("vote granted")
 			return voteGranted, nil
 		}
 	}
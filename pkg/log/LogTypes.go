@@ -6,5 +6,5 @@ import "github.com/sirgallo/raft/pkg/statemachine"
 type LogEntry struct {
 	Index int64
 	Term int64
-	Command statemachine.StateMachineOperation
+	Command statemachine.Command
 }
\ No newline at end of file
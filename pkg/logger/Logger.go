@@ -1,12 +1,8 @@
 package clog
 
-import "fmt"
 import "os"
-import "strings"
 import "time"
 
-import "github.com/sirgallo/raft/pkg/utils"
-
 
 //=========================================== Logger
 
@@ -17,62 +13,104 @@ func NewCustomLog(name string) *CustomLog {
 	}
 }
 
+/*
+	With:
+		create a child logger that includes the key/value pairs on every line it writes
+			--> pairs are passed as alternating keys and values, for example
+				Log.With("term", term, "peer", host).Info("append entries acknowledged")
+*/
+
+func (cLog *CustomLog) With(keyvals ...interface{}) *CustomLog {
+	fields := append([]Field{}, cLog.fields...)
+
+	for idx := 0; idx < len(keyvals); idx += 2 {
+		key, ok := keyvals[idx].(string)
+		if ! ok { key = "field" }
+
+		var value interface{}
+		if idx + 1 < len(keyvals) { value = keyvals[idx + 1] }
+
+		fields = append(fields, Field{ Key: key, Value: value })
+	}
+
+	return &CustomLog{
+		Name: cLog.Name,
+		fields: fields,
+	}
+}
+
 /*
 	Debug, Error, Info, Warn:
 		different log levels
+
+		lines below the minimum level for the module are dropped before any formatting is done,
+		so debug logging on hot paths like heartbeats is cheap when disabled
 */
 
 func (cLog *CustomLog) Debug(msg ...interface{}) {
-	go cLog.formatOutput(Debug, msg)
-} 
+	cLog.log(Debug, msg)
+}
 
 func (cLog *CustomLog) Error(msg ...interface{}) {
-	go cLog.formatOutput(Error, msg)
-} 
+	cLog.log(Error, msg)
+}
 
 func (cLog *CustomLog) Info(msg ...interface{}) {
-	go cLog.formatOutput(Info, msg)
-} 
+	cLog.log(Info, msg)
+}
 
 func (cLog *CustomLog) Warn(msg ...interface{}) {
-	go cLog.formatOutput(Warn, msg)
+	cLog.log(Warn, msg)
 }
 
 func (cLog *CustomLog) Fatal(msg ...interface{}) {
-	cLog.formatOutput(Error, msg)
+	cLog.write(Error, msg)
 	os.Exit(1)
 }
 
 /*
-	Format Output:
-		helper method for each of the log levels
-		output is
-			(formatted time) [name] Log level: encoded message
+	Enabled:
+		check whether or not a line at the given level would be written for the module
 */
 
-func (cLog *CustomLog) formatOutput(level LogLevel, msg []interface{}) {
-	currTime := time.Now()
-	formattedTime := currTime.Format(TimeFormat)
+func (cLog *CustomLog) Enabled(level LogLevel) bool {
+	return levelPriority[level] >= levelPriority[GetLevel(cLog.Name)]
+}
 
-	encodedMsg := func() string {
-		encodeTransform := func(chunk interface{}) string {
-			encoded, _ := utils.EncodeStructToJSONString[interface{}](chunk)
-			return encoded
-		}
-	
-		encodedChunks := utils.Map[interface{}, string](msg, encodeTransform)
-		return strings.Join(encodedChunks, " ")
-	}()
+func (cLog *CustomLog) log(level LogLevel, msg []interface{}) {
+	if ! cLog.Enabled(level) { return }
+	cLog.write(level, msg)
+}
+
+/*
+	Write:
+		format the line and write it to every configured sink
+
+		lines are formatted and written synchronously while holding the config lock, so output
+		is always in the order that it was logged
+			text --> (formatted time) [name] Log level: encoded message key=value
+			json --> {"time":...,"level":...,"module":...,"msg":...,"key":value}
+			logfmt --> time=... level=... module=... msg=... key=value
+*/
+
+func (cLog *CustomLog) write(level LogLevel, msg []interface{}) {
+	config.Mutex.Lock()
+	defer config.Mutex.Unlock()
+
+	line := func() []byte {
+		currTime := time.Now()
 
-	color := func() LogColor {
-		if level == Debug { 
-			return DebugColor 
-		} else if level == Error { 
-			return ErrorColor
-		} else if level == Info {
-			return InfoColor
-		} else { return WarnColor }
+		switch config.format {
+			case JSONFormat:
+				return cLog.formatJSON(currTime, level, msg)
+			case LogfmtFormat:
+				return cLog.formatLogfmt(currTime, level, msg)
+			default:
+				return cLog.formatText(currTime, level, msg)
+		}
 	}()
 
-	fmt.Printf("%s(%s) [%s] %s: %s\n", color, formattedTime, cLog.Name, Bold + level, Reset + encodedMsg)
-}
\ No newline at end of file
+	for _, sink := range config.sinks {
+		sink.Write(line)
+	}
+}
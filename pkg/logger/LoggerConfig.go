@@ -0,0 +1,177 @@
+package clog
+
+import "errors"
+import "io"
+import "os"
+import "strings"
+
+
+//=========================================== Logger Config
+
+
+/*
+	the logger config is shared by every module logger in the process, so levels, format, and sinks
+	can be changed at runtime without needing a reference to each individual logger
+
+	by default, lines at Info and above are written as colored text to stdout
+*/
+
+var config = &loggerConfig{
+	format: TextFormat,
+	defaultLevel: DefaultLevel,
+	moduleLevels: make(map[string]LogLevel),
+	sinks: []io.Writer{ os.Stdout },
+}
+
+/*
+	Configure:
+		replace the logger config
+			1.) the format is one of text, json, or logfmt
+			2.) the default level applies to any module without its own level set
+			3.) each sink receives every line written, for example stdout and a rotating file
+*/
+
+func Configure(opts LoggerOpts) error {
+	config.Mutex.Lock()
+	defer config.Mutex.Unlock()
+
+	if opts.Format != "" {
+		if opts.Format != TextFormat && opts.Format != JSONFormat && opts.Format != LogfmtFormat {
+			return errors.New("unknown log format: " + opts.Format)
+		}
+
+		config.format = opts.Format
+	}
+
+	if opts.DefaultLevel != "" {
+		level, parseErr := ParseLevel(opts.DefaultLevel)
+		if parseErr != nil { return parseErr }
+
+		config.defaultLevel = level
+	}
+
+	for module, moduleLevel := range opts.ModuleLevels {
+		level, parseErr := ParseLevel(moduleLevel)
+		if parseErr != nil { return parseErr }
+
+		config.moduleLevels[module] = level
+	}
+
+	if opts.Sinks != nil { config.sinks = opts.Sinks }
+
+	return nil
+}
+
+/*
+	Opts From Env:
+		build logger options from the environment
+			LOG_LEVEL --> default minimum level
+			LOG_MODULE_LEVELS --> comma separated module=level pairs, for example "Replicated Log=debug,Snapshot=warn"
+			LOG_FORMAT --> text, json, or logfmt
+			LOG_FILE --> if set, also write to a rotating file at the path
+*/
+
+func OptsFromEnv() (LoggerOpts, error) {
+	opts := LoggerOpts{
+		Format: strings.ToLower(os.Getenv(LogFormatEnv)),
+		DefaultLevel: os.Getenv(LogLevelEnv),
+		ModuleLevels: make(map[string]LogLevel),
+	}
+
+	moduleLevels := os.Getenv(LogModuleLevelsEnv)
+	if moduleLevels != "" {
+		for _, pair := range strings.Split(moduleLevels, ",") {
+			moduleAndLevel := strings.SplitN(pair, "=", 2)
+			if len(moduleAndLevel) != 2 { return opts, errors.New("invalid module level: " + pair) }
+
+			opts.ModuleLevels[strings.TrimSpace(moduleAndLevel[0])] = strings.TrimSpace(moduleAndLevel[1])
+		}
+	}
+
+	logFile := os.Getenv(LogFileEnv)
+	if logFile != "" {
+		fileSink, sinkErr := NewRotatingFileSink(RotatingFileSinkOpts{ FilePath: logFile })
+		if sinkErr != nil { return opts, sinkErr }
+
+		opts.Sinks = []io.Writer{ os.Stdout, fileSink }
+	}
+
+	return opts, nil
+}
+
+/*
+	Set Level:
+		set the minimum level for a single module at runtime
+*/
+
+func SetLevel(module string, level LogLevel) error {
+	parsedLevel, parseErr := ParseLevel(level)
+	if parseErr != nil { return parseErr }
+
+	config.Mutex.Lock()
+	defer config.Mutex.Unlock()
+
+	config.moduleLevels[module] = parsedLevel
+	return nil
+}
+
+/*
+	Set Default Level:
+		set the minimum level for all modules without their own level
+*/
+
+func SetDefaultLevel(level LogLevel) error {
+	parsedLevel, parseErr := ParseLevel(level)
+	if parseErr != nil { return parseErr }
+
+	config.Mutex.Lock()
+	defer config.Mutex.Unlock()
+
+	config.defaultLevel = parsedLevel
+	return nil
+}
+
+/*
+	Get Level:
+		get the minimum level for a module, falling back to the default level
+*/
+
+func GetLevel(module string) LogLevel {
+	config.Mutex.RLock()
+	defer config.Mutex.RUnlock()
+
+	level, ok := config.moduleLevels[module]
+	if ok { return level }
+
+	return config.defaultLevel
+}
+
+/*
+	Get Levels:
+		get the default level and a copy of all module levels
+*/
+
+func GetLevels() (LogLevel, map[string]LogLevel) {
+	config.Mutex.RLock()
+	defer config.Mutex.RUnlock()
+
+	moduleLevels := make(map[string]LogLevel)
+	for module, level := range config.moduleLevels {
+		moduleLevels[module] = level
+	}
+
+	return config.defaultLevel, moduleLevels
+}
+
+/*
+	Parse Level:
+		levels are case insensitive, so "debug", "Debug", and "DEBUG" are all valid
+*/
+
+func ParseLevel(level string) (LogLevel, error) {
+	for knownLevel := range levelPriority {
+		if strings.EqualFold(knownLevel, level) { return knownLevel, nil }
+	}
+
+	return "", errors.New("unknown log level: " + level)
+}
@@ -0,0 +1,137 @@
+package clog
+
+import "encoding/json"
+import "fmt"
+import "strconv"
+import "strings"
+import "time"
+
+import "github.com/sirgallo/raft/pkg/utils"
+
+
+//=========================================== Logger Format
+
+
+/*
+	Format Text:
+		the original colored output, with fields appended as key=value
+			(formatted time) [name] Log level: encoded message key=value
+*/
+
+func (cLog *CustomLog) formatText(currTime time.Time, level LogLevel, msg []interface{}) []byte {
+	formattedTime := currTime.Format(TimeFormat)
+
+	encodedMsg := func() string {
+		encodeTransform := func(chunk interface{}) string {
+			encoded, _ := utils.EncodeStructToJSONString[interface{}](chunk)
+			return encoded
+		}
+
+		encodedChunks := utils.Map[interface{}, string](msg, encodeTransform)
+		return strings.Join(encodedChunks, " ")
+	}()
+
+	color := func() LogColor {
+		if level == Debug {
+			return DebugColor
+		} else if level == Error {
+			return ErrorColor
+		} else if level == Info {
+			return InfoColor
+		} else { return WarnColor }
+	}()
+
+	line := fmt.Sprintf("%s(%s) [%s] %s: %s", color, formattedTime, cLog.Name, Bold + level, Reset + encodedMsg)
+	for _, field := range cLog.fields {
+		line += " " + field.Key + "=" + formatLogfmtValue(field.Value)
+	}
+
+	return []byte(line + "\n")
+}
+
+/*
+	Format JSON:
+		one json object per line, fields are added as top level keys
+			{"time":...,"level":...,"module":...,"msg":...,"key":value}
+*/
+
+func (cLog *CustomLog) formatJSON(currTime time.Time, level LogLevel, msg []interface{}) []byte {
+	var builder strings.Builder
+
+	writePair := func(key string, value interface{}) {
+		encodedKey, _ := json.Marshal(key)
+		encodedValue, encErr := json.Marshal(value)
+		if encErr != nil { encodedValue, _ = json.Marshal(fmt.Sprint(value)) }
+
+		builder.WriteString("," + string(encodedKey) + ":" + string(encodedValue))
+	}
+
+	encodedTime, _ := json.Marshal(currTime.Format(StructuredTimeFormat))
+	builder.WriteString("{\"time\":" + string(encodedTime))
+
+	writePair("level", strings.ToLower(level))
+	writePair("module", cLog.Name)
+	writePair("msg", joinMessage(msg))
+
+	for _, field := range cLog.fields {
+		writePair(field.Key, field.Value)
+	}
+
+	builder.WriteString("}\n")
+	return []byte(builder.String())
+}
+
+/*
+	Format Logfmt:
+		space separated key=value pairs, values are quoted when they contain spaces
+			time=... level=... module=... msg=... key=value
+*/
+
+func (cLog *CustomLog) formatLogfmt(currTime time.Time, level LogLevel, msg []interface{}) []byte {
+	pairs := []string{
+		"time=" + currTime.Format(StructuredTimeFormat),
+		"level=" + strings.ToLower(level),
+		"module=" + formatLogfmtValue(cLog.Name),
+		"msg=" + formatLogfmtValue(joinMessage(msg)),
+	}
+
+	for _, field := range cLog.fields {
+		pairs = append(pairs, field.Key + "=" + formatLogfmtValue(field.Value))
+	}
+
+	return []byte(strings.Join(pairs, " ") + "\n")
+}
+
+/*
+	Join Message:
+		for structured formats, strings are written as is and everything else is json encoded
+*/
+
+func joinMessage(msg []interface{}) string {
+	var chunks []string
+
+	for _, chunk := range msg {
+		str, isString := chunk.(string)
+		if isString {
+			chunks = append(chunks, str)
+		} else {
+			encoded, _ := utils.EncodeStructToJSONString[interface{}](chunk)
+			chunks = append(chunks, encoded)
+		}
+	}
+
+	return strings.Join(chunks, " ")
+}
+
+func formatLogfmtValue(value interface{}) string {
+	str, isString := value.(string)
+	if ! isString {
+		encoded, encErr := utils.EncodeStructToJSONString[interface{}](value)
+		if encErr != nil { encoded = fmt.Sprint(value) }
+
+		str = encoded
+	}
+
+	if str == "" || strings.ContainsAny(str, " =\"\n\t") { return strconv.Quote(str) }
+	return str
+}
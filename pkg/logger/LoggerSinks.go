@@ -0,0 +1,98 @@
+package clog
+
+import "os"
+import "path/filepath"
+import "strconv"
+
+
+//=========================================== Logger Sinks
+
+
+/*
+	Rotating File Sink
+		a file sink that rotates once the current file reaches the max size
+			1.) open the file in append mode, creating the parent directory if it does not exist
+			2.) on each write, if the write would exceed the max size, rotate the file
+			3.) rotation shifts existing backups up by one, dropping the oldest
+				path --> path.1 --> path.2 ... --> path.<max backups>
+*/
+
+func NewRotatingFileSink(opts RotatingFileSinkOpts) (*RotatingFileSink, error) {
+	maxSizeInBytes := opts.MaxSizeInBytes
+	if maxSizeInBytes <= 0 { maxSizeInBytes = DefaultMaxSizeInBytes }
+
+	maxBackups := opts.MaxBackups
+	if maxBackups <= 0 { maxBackups = DefaultMaxBackups }
+
+	sink := &RotatingFileSink{
+		filePath: opts.FilePath,
+		maxSizeInBytes: maxSizeInBytes,
+		maxBackups: maxBackups,
+	}
+
+	openErr := sink.open()
+	if openErr != nil { return nil, openErr }
+
+	return sink, nil
+}
+
+func (sink *RotatingFileSink) Write(line []byte) (int, error) {
+	sink.Mutex.Lock()
+	defer sink.Mutex.Unlock()
+
+	if sink.currentSize + int64(len(line)) > sink.maxSizeInBytes {
+		rotateErr := sink.rotate()
+		if rotateErr != nil { return 0, rotateErr }
+	}
+
+	written, writeErr := sink.file.Write(line)
+	sink.currentSize += int64(written)
+
+	return written, writeErr
+}
+
+func (sink *RotatingFileSink) Close() error {
+	sink.Mutex.Lock()
+	defer sink.Mutex.Unlock()
+
+	return sink.file.Close()
+}
+
+func (sink *RotatingFileSink) open() error {
+	mkdirErr := os.MkdirAll(filepath.Dir(sink.filePath), 0755)
+	if mkdirErr != nil { return mkdirErr }
+
+	file, openErr := os.OpenFile(sink.filePath, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+	if openErr != nil { return openErr }
+
+	info, statErr := file.Stat()
+	if statErr != nil {
+		file.Close()
+		return statErr
+	}
+
+	sink.file = file
+	sink.currentSize = info.Size()
+
+	return nil
+}
+
+func (sink *RotatingFileSink) rotate() error {
+	closeErr := sink.file.Close()
+	if closeErr != nil { return closeErr }
+
+	backupPath := func(backup int) string { return sink.filePath + "." + strconv.Itoa(backup) }
+
+	removeErr := os.Remove(backupPath(sink.maxBackups))
+	if removeErr != nil && ! os.IsNotExist(removeErr) { return removeErr }
+
+	for backup := sink.maxBackups - 1; backup >= 1; backup-- {
+		renameErr := os.Rename(backupPath(backup), backupPath(backup + 1))
+		if renameErr != nil && ! os.IsNotExist(renameErr) { return renameErr }
+	}
+
+	renameErr := os.Rename(sink.filePath, backupPath(1))
+	if renameErr != nil && ! os.IsNotExist(renameErr) { return renameErr }
+
+	return sink.open()
+}
@@ -1,18 +1,71 @@
 package clog
 
+import "io"
+import "sync"
+
 
 type CustomLog struct {
   Name string
+  fields []Field
+}
+
+type Field struct {
+  Key string
+  Value interface{}
 }
 
 type LogLevel = string
-type LogColor = string 
+type LogColor = string
+type LogFormat = string
+
+type LoggerOpts struct {
+  Format LogFormat
+  DefaultLevel LogLevel
+  ModuleLevels map[string]LogLevel
+  Sinks []io.Writer
+}
+
+type loggerConfig struct {
+  Mutex sync.RWMutex
+  format LogFormat
+  defaultLevel LogLevel
+  moduleLevels map[string]LogLevel
+  sinks []io.Writer
+}
+
+type RotatingFileSinkOpts struct {
+  FilePath string
+  MaxSizeInBytes int64
+  MaxBackups int
+}
+
+type RotatingFileSink struct {
+  Mutex sync.Mutex
+  filePath string
+  maxSizeInBytes int64
+  maxBackups int
+  file io.WriteCloser
+  currentSize int64
+}
 
 const (
   Debug LogLevel = "Debug"
-  Error LogLevel = "Error"
   Info LogLevel = "Info"
   Warn LogLevel = "Warn"
+  Error LogLevel = "Error"
+)
+
+var levelPriority = map[LogLevel]int{
+  Debug: 0,
+  Info: 1,
+  Warn: 2,
+  Error: 3,
+}
+
+const (
+  TextFormat LogFormat = "text"
+  JSONFormat LogFormat = "json"
+  LogfmtFormat LogFormat = "logfmt"
 )
 
 const Reset = "\033[0m"
@@ -26,4 +79,16 @@ const (
   WarnColor LogColor = "\033[33m"
 )
 
-const TimeFormat = "2006-01-02 15:04:05.000"
\ No newline at end of file
+const TimeFormat = "2006-01-02 15:04:05.000"
+const StructuredTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+const DefaultLevel = Info
+const DefaultMaxSizeInBytes = 100 * 1024 * 1024
+const DefaultMaxBackups = 5
+
+const (
+  LogLevelEnv = "LOG_LEVEL"
+  LogModuleLevelsEnv = "LOG_MODULE_LEVELS"
+  LogFormatEnv = "LOG_FORMAT"
+  LogFileEnv = "LOG_FILE"
+)
@@ -1,7 +1,106 @@
 package loggertests
 
+import "bytes"
+import "encoding/json"
+import "io"
+import "os"
+import "path/filepath"
+import "strconv"
+import "strings"
 import "testing"
 
+import "github.com/sirgallo/raft/pkg/logger"
+
+
 func TestLog(t *testing.T) {
-	
-}
\ No newline at end of file
+	var buffer bytes.Buffer
+	configureErr := clog.Configure(clog.LoggerOpts{ Format: clog.LogfmtFormat, DefaultLevel: clog.Info, Sinks: []io.Writer{ &buffer } })
+	if configureErr != nil { t.Fatalf("error configuring logger: %s", configureErr.Error()) }
+
+	testLog := clog.NewCustomLog("Test")
+	for idx := 0; idx < 100; idx++ {
+		testLog.With("index", idx).Info("line")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+
+	t.Logf("actual lines: %d, expected lines: %d\n", len(lines), 100)
+	if len(lines) != 100 { t.Fatalf("actual lines not equal to expected: actual(%d), expected(%d)\n", len(lines), 100) }
+
+	for idx, line := range lines {
+		expected := "index=" + strconv.Itoa(idx)
+		if ! strings.HasSuffix(line, expected) { t.Errorf("line out of order: actual(%s), expected suffix(%s)\n", line, expected) }
+	}
+}
+
+func TestJSONFormatWithFields(t *testing.T) {
+	var buffer bytes.Buffer
+	configureErr := clog.Configure(clog.LoggerOpts{ Format: clog.JSONFormat, DefaultLevel: clog.Info, Sinks: []io.Writer{ &buffer } })
+	if configureErr != nil { t.Fatalf("error configuring logger: %s", configureErr.Error()) }
+
+	clog.NewCustomLog("Replicated Log").With("term", 3, "peer", "raftsrv2").Warn("higher term discovered")
+
+	var decoded map[string]interface{}
+	decodeErr := json.Unmarshal(buffer.Bytes(), &decoded)
+	if decodeErr != nil { t.Fatalf("line is not valid json: %s", buffer.String()) }
+
+	t.Logf("decoded line: %v", decoded)
+	if decoded["level"] != "warn" || decoded["module"] != "Replicated Log" || decoded["msg"] != "higher term discovered" || decoded["term"] != float64(3) || decoded["peer"] != "raftsrv2" {
+		t.Errorf("decoded line does not contain expected fields: %v\n", decoded)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buffer bytes.Buffer
+	configureErr := clog.Configure(clog.LoggerOpts{ Format: clog.LogfmtFormat, DefaultLevel: clog.Warn, Sinks: []io.Writer{ &buffer } })
+	if configureErr != nil { t.Fatalf("error configuring logger: %s", configureErr.Error()) }
+
+	defer clog.SetDefaultLevel(clog.Info)
+
+	quietLog := clog.NewCustomLog("Quiet")
+	quietLog.Info("dropped")
+
+	if buffer.Len() != 0 { t.Errorf("info line written below default warn level: %s", buffer.String()) }
+
+	setErr := clog.SetLevel("Quiet", "debug")
+	if setErr != nil { t.Fatalf("error setting module level: %s", setErr.Error()) }
+
+	quietLog.Debug("written")
+	clog.NewCustomLog("Other").Info("dropped")
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+
+	t.Logf("actual lines: %v", lines)
+	if len(lines) != 1 || ! strings.Contains(lines[0], "msg=written") {
+		t.Errorf("expected only the module debug line to be written, actual(%v)\n", lines)
+	}
+
+	_, parseErr := clog.ParseLevel("verbose")
+	if parseErr == nil { t.Errorf("expected error parsing unknown level") }
+}
+
+func TestRotatingFileSink(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "logs", "raft.log")
+
+	sink, sinkErr := clog.NewRotatingFileSink(clog.RotatingFileSinkOpts{ FilePath: filePath, MaxSizeInBytes: 100, MaxBackups: 2 })
+	if sinkErr != nil { t.Fatalf("error creating sink: %s", sinkErr.Error()) }
+
+	defer sink.Close()
+
+	line := []byte(strings.Repeat("a", 59) + "\n")
+	for idx := 0; idx < 5; idx++ {
+		_, writeErr := sink.Write(line)
+		if writeErr != nil { t.Fatalf("error writing to sink: %s", writeErr.Error()) }
+	}
+
+	for _, path := range []string{ filePath, filePath + ".1", filePath + ".2" } {
+		info, statErr := os.Stat(path)
+		if statErr != nil { t.Fatalf("expected file to exist: %s", path) }
+
+		t.Logf("file: %s, size: %d", path, info.Size())
+		if info.Size() != int64(len(line)) { t.Errorf("file size not equal to expected: actual(%d), expected(%d)\n", info.Size(), len(line)) }
+	}
+
+	_, statErr := os.Stat(filePath + ".3")
+	if ! os.IsNotExist(statErr) { t.Errorf("expected oldest backup to be dropped") }
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import "errors"
+import "math"
+import "sort"
+import "strings"
+import "sync/atomic"
+import "time"
+
+
+//=========================================== Metrics
+
+
+/*
+	Registry
+		the registry holds every metric that should be exposed on the metrics endpoint, in the order
+		that they were registered
+
+		the default registry is used by all of the raft modules so that any module can record telemetry
+		without needing a reference passed in through service options
+*/
+
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+/*
+	Register
+		add a metric to the registry
+			--> metric names must be unique, so a duplicate registration returns an error
+*/
+
+func (reg *Registry) Register(metric Metric) error {
+	reg.Mutex.Lock()
+	defer reg.Mutex.Unlock()
+
+	if reg.names[metric.Name()] { return errors.New("metric already registered: " + metric.Name()) }
+
+	reg.names[metric.Name()] = true
+	reg.metrics = append(reg.metrics, metric)
+
+	return nil
+}
+
+/*
+	Expose
+		write all registered metrics in the prometheus text exposition format
+			# HELP <name> <help>
+			# TYPE <name> <type>
+			<name>{<labels>} <value>
+*/
+
+func (reg *Registry) Expose() string {
+	reg.Mutex.Lock()
+	metrics := append([]Metric{}, reg.metrics...)
+	reg.Mutex.Unlock()
+
+	var builder strings.Builder
+
+	for _, metric := range metrics {
+		builder.WriteString("# HELP " + metric.Name() + " " + escapeHelp(metric.Help()) + "\n")
+		builder.WriteString("# TYPE " + metric.Name() + " " + metric.Type() + "\n")
+		metric.expose(&builder)
+	}
+
+	return builder.String()
+}
+
+/*
+	Counter Vec
+		a monotonically increasing value, partitioned by label values
+*/
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	counterVec := &CounterVec{ name: name, help: help, labelNames: labelNames }
+	mustRegister(counterVec)
+
+	return counterVec
+}
+
+func NewCounter(name string, help string) *Counter {
+	return NewCounterVec(name, help).WithLabelValues()
+}
+
+func (counterVec *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	key := strings.Join(labelValues, LabelSeparator)
+	counter, _ := counterVec.series.LoadOrStore(key, &Counter{ labelValues: labelValues })
+
+	return counter.(*Counter)
+}
+
+func (counter *Counter) Inc() {
+	counter.Add(1)
+}
+
+func (counter *Counter) Add(delta float64) {
+	if delta < 0 { return }
+	addFloat(&counter.bits, delta)
+}
+
+func (counter *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&counter.bits))
+}
+
+func (counterVec *CounterVec) Name() string { return counterVec.name }
+func (counterVec *CounterVec) Help() string { return counterVec.help }
+func (counterVec *CounterVec) Type() MetricType { return CounterType }
+
+func (counterVec *CounterVec) expose(builder *strings.Builder) {
+	for _, counter := range sortedSeries[*Counter](&counterVec.series) {
+		writeSample(builder, counterVec.name, counterVec.labelNames, counter.labelValues, nil, counter.Value())
+	}
+}
+
+/*
+	Gauge Vec
+		a value that can go up and down, partitioned by label values
+*/
+
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	gaugeVec := &GaugeVec{ name: name, help: help, labelNames: labelNames }
+	mustRegister(gaugeVec)
+
+	return gaugeVec
+}
+
+func NewGauge(name string, help string) *Gauge {
+	return NewGaugeVec(name, help).WithLabelValues()
+}
+
+func (gaugeVec *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	key := strings.Join(labelValues, LabelSeparator)
+	gauge, _ := gaugeVec.series.LoadOrStore(key, &Gauge{ labelValues: labelValues })
+
+	return gauge.(*Gauge)
+}
+
+func (gauge *Gauge) Set(value float64) {
+	atomic.StoreUint64(&gauge.bits, math.Float64bits(value))
+}
+
+func (gauge *Gauge) Add(delta float64) {
+	addFloat(&gauge.bits, delta)
+}
+
+func (gauge *Gauge) Inc() {
+	gauge.Add(1)
+}
+
+func (gauge *Gauge) Dec() {
+	gauge.Add(-1)
+}
+
+func (gauge *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&gauge.bits))
+}
+
+func (gaugeVec *GaugeVec) Name() string { return gaugeVec.name }
+func (gaugeVec *GaugeVec) Help() string { return gaugeVec.help }
+func (gaugeVec *GaugeVec) Type() MetricType { return GaugeType }
+
+func (gaugeVec *GaugeVec) expose(builder *strings.Builder) {
+	for _, gauge := range sortedSeries[*Gauge](&gaugeVec.series) {
+		writeSample(builder, gaugeVec.name, gaugeVec.labelNames, gauge.labelValues, nil, gauge.Value())
+	}
+}
+
+/*
+	Histogram Vec
+		observations are counted into cumulative buckets, partitioned by label values
+			--> buckets are upper bounds, and an implicit +Inf bucket always exists
+*/
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sortedBuckets := append([]float64{}, buckets...)
+	sort.Float64s(sortedBuckets)
+
+	histogramVec := &HistogramVec{ name: name, help: help, buckets: sortedBuckets, labelNames: labelNames }
+	mustRegister(histogramVec)
+
+	return histogramVec
+}
+
+func NewHistogram(name string, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).WithLabelValues()
+}
+
+func (histogramVec *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	key := strings.Join(labelValues, LabelSeparator)
+
+	histogram, _ := histogramVec.series.LoadOrStore(key, &Histogram{
+		buckets: histogramVec.buckets,
+		counts: make([]uint64, len(histogramVec.buckets)),
+		labelValues: labelValues,
+	})
+
+	return histogram.(*Histogram)
+}
+
+func (histogram *Histogram) Observe(value float64) {
+	histogram.Mutex.Lock()
+	defer histogram.Mutex.Unlock()
+
+	for idx, upperBound := range histogram.buckets {
+		if value <= upperBound { histogram.counts[idx]++ }
+	}
+
+	histogram.sum += value
+	histogram.count++
+}
+
+/*
+	Observe Since
+		helper for timing an operation, meant to be deferred
+			defer histogram.ObserveSince(time.Now())
+*/
+
+func (histogram *Histogram) ObserveSince(start time.Time) {
+	histogram.Observe(time.Since(start).Seconds())
+}
+
+func (histogramVec *HistogramVec) Name() string { return histogramVec.name }
+func (histogramVec *HistogramVec) Help() string { return histogramVec.help }
+func (histogramVec *HistogramVec) Type() MetricType { return HistogramType }
+
+func (histogramVec *HistogramVec) expose(builder *strings.Builder) {
+	for _, histogram := range sortedSeries[*Histogram](&histogramVec.series) {
+		histogram.Mutex.Lock()
+
+		for idx, upperBound := range histogram.buckets {
+			le := &labelPair{ name: "le", value: formatFloat(upperBound) }
+			writeSample(builder, histogramVec.name + "_bucket", histogramVec.labelNames, histogram.labelValues, le, float64(histogram.counts[idx]))
+		}
+
+		inf := &labelPair{ name: "le", value: "+Inf" }
+		writeSample(builder, histogramVec.name + "_bucket", histogramVec.labelNames, histogram.labelValues, inf, float64(histogram.count))
+		writeSample(builder, histogramVec.name + "_sum", histogramVec.labelNames, histogram.labelValues, nil, histogram.sum)
+		writeSample(builder, histogramVec.name + "_count", histogramVec.labelNames, histogram.labelValues, nil, float64(histogram.count))
+
+		histogram.Mutex.Unlock()
+	}
+}
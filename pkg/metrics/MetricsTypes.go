@@ -0,0 +1,81 @@
+package metrics
+
+import "strings"
+import "sync"
+
+
+type MetricType = string
+
+type Metric interface {
+	Name() string
+	Help() string
+	Type() MetricType
+	expose(builder *strings.Builder)
+}
+
+type Registry struct {
+	Mutex sync.Mutex
+	metrics []Metric
+	names map[string]bool
+}
+
+type Counter struct {
+	bits uint64
+	labelValues []string
+}
+
+type CounterVec struct {
+	name string
+	help string
+	labelNames []string
+	series sync.Map
+}
+
+type Gauge struct {
+	bits uint64
+	labelValues []string
+}
+
+type GaugeVec struct {
+	name string
+	help string
+	labelNames []string
+	series sync.Map
+}
+
+type Histogram struct {
+	Mutex sync.Mutex
+	buckets []float64
+	counts []uint64
+	sum float64
+	count uint64
+	labelValues []string
+}
+
+type HistogramVec struct {
+	name string
+	help string
+	buckets []float64
+	labelNames []string
+	series sync.Map
+}
+
+type labelPair struct {
+	name string
+	value string
+}
+
+
+const NAME = "Metrics"
+
+const (
+	CounterType MetricType = "counter"
+	GaugeType MetricType = "gauge"
+	HistogramType MetricType = "histogram"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+const LabelSeparator = "\xff"
+
+var DefaultLatencyBuckets = []float64{ .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10 }
+var DefaultSizeBuckets = []float64{ 1 << 10, 1 << 14, 1 << 18, 1 << 20, 1 << 24, 1 << 27, 1 << 30, 1 << 33 }
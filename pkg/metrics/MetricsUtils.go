@@ -0,0 +1,96 @@
+package metrics
+
+import "math"
+import "sort"
+import "strconv"
+import "strings"
+import "sync"
+import "sync/atomic"
+
+
+//=========================================== Metrics Utils
+
+
+/*
+	Must Register
+		metrics are declared as package level variables, so a duplicate name is a programming error
+*/
+
+func mustRegister(metric Metric) {
+	regErr := DefaultRegistry.Register(metric)
+	if regErr != nil { panic(regErr) }
+}
+
+/*
+	Add Float
+		atomically add to a float64 stored as bits, retrying until the compare and swap succeeds
+*/
+
+func addFloat(bits *uint64, delta float64) {
+	for {
+		oldBits := atomic.LoadUint64(bits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + delta)
+		if atomic.CompareAndSwapUint64(bits, oldBits, newBits) { return }
+	}
+}
+
+/*
+	Sorted Series
+		series are stored in a sync map, so sort by key to keep the exposition output stable
+*/
+
+func sortedSeries[T any](series *sync.Map) []T {
+	var keys []string
+	values := make(map[string]T)
+
+	series.Range(func(key, value interface{}) bool {
+		keys = append(keys, key.(string))
+		values[key.(string)] = value.(T)
+
+		return true
+	})
+
+	sort.Strings(keys)
+
+	var sorted []T
+	for _, key := range keys {
+		sorted = append(sorted, values[key])
+	}
+
+	return sorted
+}
+
+func writeSample(builder *strings.Builder, name string, labelNames []string, labelValues []string, extra *labelPair, value float64) {
+	builder.WriteString(name)
+
+	var pairs []string
+	for idx, labelName := range labelNames {
+		labelValue := ""
+		if idx < len(labelValues) { labelValue = labelValues[idx] }
+
+		pairs = append(pairs, labelName + "=\"" + escapeLabelValue(labelValue) + "\"")
+	}
+
+	if extra != nil { pairs = append(pairs, extra.name + "=\"" + extra.value + "\"") }
+	if len(pairs) > 0 { builder.WriteString("{" + strings.Join(pairs, ",") + "}") }
+
+	builder.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) { return "+Inf" }
+	if math.IsInf(value, -1) { return "-Inf" }
+	if math.IsNaN(value) { return "NaN" }
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeLabelValue(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+	return replacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+	return replacer.Replace(help)
+}
@@ -0,0 +1,139 @@
+package metrics
+
+
+//=========================================== Raft Metrics
+
+
+/*
+	Raft Metrics
+		all operational telemetry exposed by a raft node
+
+		leader election
+			--> elections started and won by this node, and term changes observed
+		replicated log
+			--> AppendEntryRPC latency and failures per peer
+			--> entries appended to the replicated log, committed, and applied to the state machine
+			--> lag between the commit index and the last applied index
+		storage
+			--> bolt transaction durations for both the wal and the state machine dbs
+			--> fsync durations for the segment files of the wal
+			--> hits and misses of the cache of recent entries in front of the wal
+		snapshot
+			--> size of the latest snapshot and time taken to create it
+			--> snapshots taken by what triggered them, and snapshots sent to followers behind the log
+		connection pool
+			--> open grpc connections per host
+		request service
+			--> http request latency by command type
+*/
+
+var ElectionsStarted = NewCounter(
+	"raft_elections_started_total",
+	"Total number of elections started by this node.",
+)
+
+var ElectionsWon = NewCounter(
+	"raft_elections_won_total",
+	"Total number of elections won by this node.",
+)
+
+var TermChanges = NewCounter(
+	"raft_term_changes_total",
+	"Total number of times the current term on this node has changed.",
+)
+
+var CurrentTerm = NewGauge(
+	"raft_current_term",
+	"Current term of this node.",
+)
+
+var AppendEntryRPCLatency = NewHistogramVec(
+	"raft_append_entry_rpc_duration_seconds",
+	"Latency of AppendEntryRPCs sent to each peer, including retries.",
+	DefaultLatencyBuckets,
+	"peer",
+)
+
+var AppendEntryRPCFailures = NewCounterVec(
+	"raft_append_entry_rpc_failures_total",
+	"Total number of AppendEntryRPCs to each peer that failed after all retries.",
+	"peer",
+)
+
+var EntriesAppended = NewCounter(
+	"raft_entries_appended_total",
+	"Total number of entries appended to the replicated log on this node.",
+)
+
+var EntriesCommitted = NewCounter(
+	"raft_entries_committed_total",
+	"Total number of entries committed on this node.",
+)
+
+var EntriesApplied = NewCounter(
+	"raft_entries_applied_total",
+	"Total number of entries applied to the state machine on this node.",
+)
+
+var CommitApplyLag = NewGauge(
+	"raft_commit_apply_lag_entries",
+	"Number of committed entries not yet applied to the state machine.",
+)
+
+var BoltTxDuration = NewHistogramVec(
+	"raft_bolt_tx_duration_seconds",
+	"Duration of bolt transactions by db and transaction type.",
+	DefaultLatencyBuckets,
+	"db", "op",
+)
+
+var WALFsyncDuration = NewHistogram(
+	"raft_wal_fsync_duration_seconds",
+	"Duration of fsyncs of wal segment files.",
+	DefaultLatencyBuckets,
+)
+
+var WALCacheHits = NewCounter(
+	"raft_wal_cache_hits_total",
+	"Total number of wal reads served from the cache of recent entries.",
+)
+
+var WALCacheMisses = NewCounter(
+	"raft_wal_cache_misses_total",
+	"Total number of wal reads that missed the cache of recent entries and were read from the log store.",
+)
+
+var SnapshotSizeBytes = NewGauge(
+	"raft_snapshot_size_bytes",
+	"Size of the latest snapshot taken on this node.",
+)
+
+var SnapshotDuration = NewHistogram(
+	"raft_snapshot_duration_seconds",
+	"Time taken to snapshot the state machine.",
+	[]float64{ .01, .05, .1, .5, 1, 5, 10, 30, 60, 300 },
+)
+
+var SnapshotTriggers = NewCounterVec(
+	"raft_snapshot_triggers_total",
+	"Total number of snapshots taken on this node by the snapshot policy threshold or manual request that triggered them.",
+	"trigger",
+)
+
+var SnapshotsInstalled = NewCounter(
+	"raft_snapshots_installed_total",
+	"Total number of snapshots sent by this node to followers that had fallen behind the first entry in its replicated log.",
+)
+
+var ConnPoolConnections = NewGaugeVec(
+	"raft_connpool_connections",
+	"Number of open grpc connections in the connection pools per host.",
+	"host",
+)
+
+var HTTPRequestLatency = NewHistogramVec(
+	"raft_http_request_duration_seconds",
+	"Latency of requests to the command route by command type.",
+	DefaultLatencyBuckets,
+	"action",
+)
@@ -0,0 +1,79 @@
+package metricstests
+
+import "strings"
+import "testing"
+
+import "github.com/sirgallo/raft/pkg/metrics"
+
+
+func TestCounterExposition(t *testing.T) {
+	counterVec := metrics.NewCounterVec("test_counter_total", "test counter", "peer")
+	counterVec.WithLabelValues("raftsrv1").Inc()
+	counterVec.WithLabelValues("raftsrv1").Add(2)
+	counterVec.WithLabelValues("raftsrv2").Inc()
+
+	exposed := metrics.DefaultRegistry.Expose()
+
+	expected := []string{
+		"# TYPE test_counter_total counter",
+		"test_counter_total{peer=\"raftsrv1\"} 3",
+		"test_counter_total{peer=\"raftsrv2\"} 1",
+	}
+
+	for _, line := range expected {
+		t.Logf("expecting line: %s", line)
+		if ! strings.Contains(exposed, line + "\n") {
+			t.Errorf("exposition missing expected line: %s\n", line)
+		}
+	}
+}
+
+func TestGaugeSetAndAdd(t *testing.T) {
+	gauge := metrics.NewGauge("test_gauge", "test gauge")
+	gauge.Set(10)
+	gauge.Add(-3)
+	gauge.Inc()
+
+	expected := float64(8)
+
+	t.Logf("actual value: %v, expected value: %v\n", gauge.Value(), expected)
+	if gauge.Value() != expected {
+		t.Errorf("actual gauge value not equal to expected: actual(%v), expected(%v)\n", gauge.Value(), expected)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	histogram := metrics.NewHistogram("test_histogram_seconds", "test histogram", []float64{ 1, 0.1, 0.5 })
+	histogram.Observe(0.05)
+	histogram.Observe(0.3)
+	histogram.Observe(2)
+
+	exposed := metrics.DefaultRegistry.Expose()
+
+	expected := []string{
+		"test_histogram_seconds_bucket{le=\"0.1\"} 1",
+		"test_histogram_seconds_bucket{le=\"0.5\"} 2",
+		"test_histogram_seconds_bucket{le=\"1\"} 2",
+		"test_histogram_seconds_bucket{le=\"+Inf\"} 3",
+		"test_histogram_seconds_sum 2.35",
+		"test_histogram_seconds_count 3",
+	}
+
+	for _, line := range expected {
+		t.Logf("expecting line: %s", line)
+		if ! strings.Contains(exposed, line + "\n") {
+			t.Errorf("exposition missing expected line: %s\n", line)
+		}
+	}
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counterVec := metrics.NewCounterVec("test_duplicate_total", "test duplicate")
+
+	firstErr := registry.Register(counterVec)
+	if firstErr != nil { t.Errorf("unexpected error on first registration: %s", firstErr.Error()) }
+
+	secondErr := registry.Register(counterVec)
+	if secondErr == nil { t.Errorf("expected error on duplicate registration") }
+}
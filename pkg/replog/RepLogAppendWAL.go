@@ -1,7 +1,11 @@
 package replog 
 
+import "time"
+
 import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/statemachine"
+import "github.com/sirgallo/raft/pkg/tracing"
 
 
 //=========================================== RepLog Append WAL
@@ -9,9 +13,18 @@ import "github.com/sirgallo/raft/pkg/statemachine"
 
 /*
 	As new requests are received, append the logs in order to the replicated log/WAL
+
+	the command is stamped with the clock of the leader, so state machines that depend on time apply the command with
+	the same time on every system
+
+	if the command is traced, the append is recorded as a span and a replication span is opened for the new entry
 */
 
-func (rlService *ReplicatedLogService) AppendWALSync(cmd *statemachine.StateMachineOperation) error {
+func (rlService *ReplicatedLogService) AppendWALSync(cmd *statemachine.Command) error {
+	var walSpan *tracing.Span
+	if cmd.TraceParent != "" { walSpan = tracing.StartSpan(WALAppendSpan, tracing.ParseTraceParent(cmd.TraceParent)) }
+	defer walSpan.End()
+
 	lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
 	if lastLogErr != nil { return lastLogErr }
 
@@ -23,11 +36,19 @@ func (rlService *ReplicatedLogService) AppendWALSync(cmd *statemachine.StateMach
 		Command: *cmd,
 	}
 
+	newLog.Command.Timestamp = time.Now().UnixMilli()
+
+	walSpan.SetAttribute("raft.index", nextIndex)
+
 	appendErr := rlService.CurrentSystem.WAL.Append(newLog)
 	if appendErr != nil {
 		rlService.Log.Error("append error:", appendErr.Error())
+		walSpan.SetError(appendErr)
 		return appendErr 
 	}
 
+	metrics.EntriesAppended.Inc()
+	if walSpan != nil { rlService.startReplicationSpan(nextIndex, walSpan.SpanContext()) }
+
 	return nil
 }
\ No newline at end of file
@@ -1,30 +1,89 @@
 package replog
 
+import "sort"
+
 import "github.com/sirgallo/raft/pkg/log"
 import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/tracing"
 import "github.com/sirgallo/raft/pkg/utils"
 
 
 //=========================================== RepLog Commit
 
 
+/*
+	Advance Commit Index:
+		determine the highest log index that is safe to commit on the leader
+			1.) collect the match index of every known system in the cluster, including dead systems, along with the last log
+				index of the leader itself
+			2.) sort the match indexes in descending order and take the median, which is the highest index replicated
+				on a majority of the cluster
+			3.) only commit if the entry at the median is from the current term of the leader. Entries from previous terms are
+				never committed by counting replicas, and are instead committed indirectly once an entry from the current term
+				is committed on top of them
+*/
+
+func (rlService *ReplicatedLogService) AdvanceCommitIndex() (bool, error) {
+	lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
+	if lastLogErr != nil { return false, lastLogErr }
+
+	matchIndexes := []int64{ lastLogIndex }
+
+	rlService.Systems.Range(func(key, value interface{}) bool {
+		sys := value.(*system.System)
+		matchIndexes = append(matchIndexes, sys.GetMatchIndex())
+
+		return true
+	})
+
+	sort.Slice(matchIndexes, func(i, j int) bool { return matchIndexes[i] > matchIndexes[j] })
+	majorityMatchIndex := matchIndexes[len(matchIndexes) / 2]
+
+	if majorityMatchIndex <= rlService.CurrentSystem.CommitIndex { return false, nil }
+
+	entry, readErr := rlService.CurrentSystem.WAL.Read(majorityMatchIndex)
+	if readErr != nil { return false, readErr }
+	if entry == nil || entry.Term != rlService.CurrentSystem.CurrentTerm { return false, nil }
+
+	rlService.CurrentSystem.UpdateCommitIndex(majorityMatchIndex)
+
+	return true, nil
+}
+
 /*
 	shared apply log utility function
-		1.) transform the logs to pass to the state machine
-		2.) pass the transformed entries into the bulk apply function of the state machine, which will perform 
-			the state machine operations while applying the logs, returning back the responses to the clients' 
-			commands
+		1.) filter out no-op entries, which have no command data, and transform the remaining logs to the commands to pass
+			to the state machine, which carry the timestamp from the leader and the index of their log entry along with the
+			opaque command data
+		2.) pass the commands into the apply function of the state machine, which will perform the state machine
+			operations while applying the logs, returning back a result for each command to the clients
 		3.) block until completed and failed entries are returned
-		4.) for all responses:
-			if the commit failed: throw an error since the the state machine was incorrectly committed to
-			if the commit completed: update the last applied field on the system to the index of the log
-				entry
+		4.) if the batch fails with a command error, apply each command individually so a bad command fails alone, and
+			answer it with the error instead of retrying it forever
+		5.) publish the changes made by each command to the change stream, tagged with the index of its log entry
+		6.) return the result or error for each command to the client and update the last applied field on the system to
+			the index of the last log entry, which always advances past the batch
+		
+		if applying fails with any other error, the state machine failed on this system, like on a disk error, so the
+		command is not skipped. The commands before it are answered, and the last applied index is set to the entry before
+		it, or to the applied index stored by the state machine if it is later, so applying resumes from the failed
+		command on the next attempt
+
+	each traced command in the batch gets a span covering the apply, so the trace for a command ends with
+	the state machine on every node that applies it
+
+	the apply lock on the system is held while applying, so a snapshot being taken or installed pauses applying
+	until the state machine and last applied index are consistent with the snapshot
 */
 
 func (rlService *ReplicatedLogService) ApplyLogs() error {
+	rlService.CurrentSystem.ApplyMutex.Lock()
+	defer rlService.CurrentSystem.ApplyMutex.Unlock()
+
 	start := rlService.CurrentSystem.LastApplied + 1 // next to apply after last known applied
 	end := rlService.CurrentSystem.CommitIndex  // include up to committed
+	if start > end { return nil } // already applied, for example by a snapshot that was installed
 
 	var logsToBeApplied []*log.LogEntry
 	
@@ -45,23 +104,125 @@ func (rlService *ReplicatedLogService) ApplyLogs() error {
 
 	lastLogToBeApplied := logsToBeApplied[len(logsToBeApplied) - 1]
 	
-	transform := func(logEntry *log.LogEntry) *statemachine.StateMachineOperation { 
-		command := logEntry.Command 
-		return &command
-	}
+	isCommand := func(logEntry *log.LogEntry) bool { return len(logEntry.Command.Data) > 0 }
+	commandEntries := utils.Filter[*log.LogEntry](logsToBeApplied, isCommand)
+
+	if len(commandEntries) > 0 {
+		transform := func(logEntry *log.LogEntry) *statemachine.Command {
+			command := logEntry.Command
+			command.Index = logEntry.Index
+
+			return &command
+		}
+		commands := utils.Map[*log.LogEntry, *statemachine.Command](commandEntries, transform)
+
+		applySpans := make([]*tracing.Span, len(commandEntries))
+		for idx, entry := range commandEntries {
+			if entry.Command.TraceParent == "" { continue }
+
+			applySpan := tracing.StartSpan(ApplySpan, tracing.ParseTraceParent(entry.Command.TraceParent))
+			applySpan.SetAttribute("raft.index", entry.Index)
+			applySpan.SetAttribute("raft.batch_size", len(commands))
+			applySpans[idx] = applySpan
+		}
+
+		results, changes, applyErr := statemachine.ApplyCommands(rlService.CurrentSystem.StateMachine, commands)
+		applyErrs := make([]error, len(commands))
+		applied := len(commands)
+
+		var systemErr error
+
+		if applyErr != nil && ! statemachine.IsCommandError(applyErr) {
+			applied = 0
+			systemErr = applyErr
+		} else if applyErr != nil {
+			rlService.Log.Warn("error applying batch to state machine, applying commands individually:", applyErr.Error())
+			results, changes, applyErrs, applied, systemErr = rlService.applyIndividually(commands)
+		}
+
+		if rlService.CurrentSystem.Changes != nil {
+			for idx, entry := range commandEntries[:applied] {
+				if idx < len(changes) { rlService.CurrentSystem.Changes.Publish(entry.Index, changes[idx]) }
+			}
+		}
+
+		for idx, applySpan := range applySpans {
+			if applySpan == nil { continue }
+
+			if idx < applied {
+				applySpan.SetError(applyErrs[idx])
+			} else { applySpan.SetError(systemErr) }
+
+			applySpan.End()
+		}
 
-	logApplyEntries := utils.Map[*log.LogEntry, *statemachine.StateMachineOperation](logsToBeApplied, transform)
+		if rlService.CurrentSystem.State == system.Leader {
+			for idx, entry := range commandEntries[:applied] {
+				if entry.Command.RequestID == "" { continue } // appended by the leader itself, like expire commands
 
-	bulkApplyResps, bulkInserErr := rlService.CurrentSystem.StateMachine.BulkApply(logApplyEntries)
-	if bulkInserErr != nil { return bulkInserErr }
+				resp := &statemachine.Response{ RequestID: entry.Command.RequestID }
+				if idx < len(results) { resp.Data = results[idx] }
+				if applyErrs[idx] != nil { resp.Error = applyErrs[idx].Error() }
 
-	if rlService.CurrentSystem.State == system.Leader {
-		for _, resp := range bulkApplyResps {
-			rlService.StateMachineResponseChannel <- resp
+				rlService.StateMachineResponseChannel <- resp
+			}
 		}
-	} 
+
+		if systemErr != nil {
+			rlService.Log.Error("error applying command to state machine, stopping at index:", commandEntries[applied].Index, systemErr.Error())
+			rlService.CurrentSystem.UpdateLastApplied(rlService.lastAppliedOnFailure(commandEntries[applied].Index - 1, end))
+
+			return systemErr
+		}
+	}
 	
 	rlService.CurrentSystem.UpdateLastApplied(lastLogToBeApplied.Index)
 
 	return nil
-}
\ No newline at end of file
+}
+
+/*
+	Apply Individually:
+		fallback for a batch that failed to apply, where each command is applied to the state machine on its own
+			--> a command that fails with a command error is answered with its error, and the commands after it are still
+				applied
+			--> every system applies the same commands in the same order, so the same commands fail on every system
+			--> on any other error, stop and return the number of commands applied before it, along with the error
+*/
+
+func (rlService *ReplicatedLogService) applyIndividually(commands []*statemachine.Command) ([][]byte, [][]*statemachine.Change, []error, int, error) {
+	results := make([][]byte, len(commands))
+	changes := make([][]*statemachine.Change, len(commands))
+	applyErrs := make([]error, len(commands))
+
+	for idx, command := range commands {
+		result, commandChanges, applyErr := statemachine.ApplyCommands(rlService.CurrentSystem.StateMachine, []*statemachine.Command{ command })
+		if applyErr != nil && ! statemachine.IsCommandError(applyErr) { return results, changes, applyErrs, idx, applyErr }
+
+		if applyErr != nil {
+			rlService.Log.Error("error applying command to state machine:", applyErr.Error())
+			applyErrs[idx] = applyErr
+			continue
+		}
+
+		if len(result) > 0 { results[idx] = result[0] }
+		if len(commandChanges) > 0 { changes[idx] = commandChanges[0] }
+	}
+
+	return results, changes, applyErrs, len(commands), nil
+}
+
+/*
+	Last Applied On Failure:
+		the last applied index after the state machine failed to apply a command, which is the entry before the failed
+		command, unless the state machine stored a later applied index, since it may have durably applied part of the batch
+		before failing
+*/
+
+func (rlService *ReplicatedLogService) lastAppliedOnFailure(beforeFailed int64, end int64) int64 {
+	appliedIndex, appliedErr := statemachine.AppliedIndex(rlService.CurrentSystem.StateMachine)
+	if appliedErr != nil || appliedIndex <= beforeFailed { return beforeFailed }
+	if appliedIndex > end { return end }
+
+	return appliedIndex
+}
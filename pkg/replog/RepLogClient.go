@@ -3,10 +3,13 @@ package replog
 import "context"
 import "sync"
 import "sync/atomic"
+import "time"
 import "google.golang.org/grpc"
 
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/replogrpc"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/tracing"
 import "github.com/sirgallo/raft/pkg/utils"
 
 
@@ -86,7 +89,8 @@ func (rlService *ReplicatedLogService) Heartbeat() error {
 		2.) prepare AppendEntryRPCs for each system in the Systems Map
 			--> determine the next index of the system that the rpc is prepared for from the system object at NextIndex
 		3.) on responses
-			--> if the Leader receives a success signal from the majority of the nodes in the cluster, apply the logs to the state machine
+			--> on each success signal, attempt to advance the commit index to the highest index replicated on a majority of the
+				cluster that is from the current term, and apply newly committed logs to the state machine
 			--> if a response with a higher term than its own, revert to Follower state
 			--> if a response with a last log index less than current log index on leader, sync logs until up to date
 */
@@ -105,6 +109,7 @@ func (rlService *ReplicatedLogService) ReplicateLogs() error {
 
 	requests := []ReplicatedLogRequest{}
 	successfulResps := int64(0)
+	replicationSpanContext := rlService.replicationSpanContext()
 
 	for _, sys := range aliveSystems {
 		preparedEntries, prepareErr := rlService.PrepareAppendEntryRPC(lastLogIndex, sys.NextIndex, false)
@@ -116,6 +121,7 @@ func (rlService *ReplicatedLogService) ReplicateLogs() error {
 		request := ReplicatedLogRequest{
 			Host: sys.Host,
 			AppendEntry: preparedEntries,
+			SpanContext: replicationSpanContext,
 		}
 
 		requests = append(requests, request)
@@ -135,19 +141,27 @@ func (rlService *ReplicatedLogService) ReplicateLogs() error {
 				case <- rlRespChans.SuccessChan:	
 					atomic.AddInt64(&successfulResps, 1)
 
-					if successfulResps >= int64(minSuccessfulResps) { 
-						rlService.Log.Info("at least minimum successful responses received:", successfulResps)
-						rlService.Log.Info("applying logs to state machine and appending to write ahead log")
-	
-						rlService.CurrentSystem.UpdateCommitIndex(lastLogIndex)
+					committed, commitErr := rlService.AdvanceCommitIndex()
+					if commitErr != nil { 
+						rlService.Log.Error("error advancing commit index:", commitErr.Error())
+						return
+					}
+
+					if committed {
+						commitIndex := rlService.CurrentSystem.CommitIndex
+						rlService.Log.With("term", rlService.CurrentSystem.CurrentTerm, "index", commitIndex, "responses", successfulResps).Info("entries replicated on majority of cluster, applying logs to state machine")
+
+						rlService.endReplicationSpans(commitIndex)
+
 						applyErr := rlService.ApplyLogs()
 						if applyErr != nil { rlService.Log.Error("error applying command to state machine:", applyErr.Error()) }
-						
-						return
 					}
+
+					if rlService.CurrentSystem.CommitIndex >= lastLogIndex { return }
 				case term :=<- rlRespChans.HigherTermDiscovered:
 					rlService.Log.Warn("higher term discovered.")
 					rlService.CurrentSystem.TransitionToFollower(system.StateTransitionOpts{ CurrentTerm: &term })
+					rlService.abortReplicationSpans()
 					rlService.attemptLeadAckSignal()
 					return
 			}
@@ -221,13 +235,13 @@ func (rlService *ReplicatedLogService) broadcastAppendEntryRPC(requestsPerHost [
 						rlRespChans.SuccessChan <- 1
 					} else {
 						if res.Term > rlService.CurrentSystem.CurrentTerm {
-							rlService.Log.Warn("higher term found on response for AppendEntryRPC:", res.Term)
+							rlService.Log.With("term", res.Term, "peer", sys.Host).Warn("higher term found on response for AppendEntryRPC")
 							rlService.CurrentSystem.TransitionToFollower(system.StateTransitionOpts{ CurrentTerm: &res.Term })
 
 							rlRespChans.HigherTermDiscovered <- res.Term
 							cancel()
 						} else {
-							rlService.Log.Warn("preparing to sync logs for:", sys.Host)
+							rlService.Log.With("peer", sys.Host, "nextIndex", res.NextLogIndex).Warn("preparing to sync logs")
 							sys.SetStatus(system.Busy)
 							rlService.SyncLogChannel <- sys.Host
 						}
@@ -247,8 +261,12 @@ func (rlService *ReplicatedLogService) broadcastAppendEntryRPC(requestsPerHost [
 	Client Append Entry RPC:
 		helper method for making individual rpc calls
 
+		if the request is part of a traced round of replication, the rpc is recorded as a span and the trace context is
+		passed to the follower in the request metadata
+
 		perform exponential backoff
-		--> success: update system NextIndex and return result
+		--> success: return result, and if the entries were accepted, update the system MatchIndex to the last entry sent and 
+			NextIndex to the entry after it, otherwise if the logs conflict, update the system NextIndex from the conflict in the result
 		--> error: remove system from system map and close all open connections
 */
 
@@ -259,13 +277,24 @@ func (rlService *ReplicatedLogService) clientAppendEntryRPC(
 ) (*replogrpc.AppendEntryResponse, error) {
 	client := replogrpc.NewRepLogServiceClient(conn)
 
+	var rpcSpan *tracing.Span
+	if req.SpanContext.IsValid() {
+		rpcSpan = tracing.StartSpan(AppendEntryRPCClientSpan, req.SpanContext)
+		rpcSpan.SetAttribute("raft.peer", sys.Host)
+		rpcSpan.SetAttribute("raft.entries", len(req.AppendEntry.Entries))
+	}
+
+	defer rpcSpan.End()
+
 	appendEntryRPC := func() (*replogrpc.AppendEntryResponse, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
 		defer cancel()
 
+		ctx = tracing.InjectMetadata(ctx, rpcSpan.SpanContext())
+
 		res, err := client.AppendEntryRPC(ctx, req.AppendEntry)
 		if err != nil {
-			rlService.Log.Error("exp backoff attempt err:", err.Error())
+			rlService.Log.With("peer", sys.Host).Debug("exp backoff attempt err:", err.Error())
 			return utils.GetZero[*replogrpc.AppendEntryResponse](), err 
 		}
 
@@ -276,9 +305,14 @@ func (rlService *ReplicatedLogService) clientAppendEntryRPC(
 	expOpts := utils.ExpBackoffOpts{ MaxRetries: &maxRetries, TimeoutInMilliseconds: 10 }
 	expBackoff := utils.NewExponentialBackoffStrat[*replogrpc.AppendEntryResponse](expOpts)
 
+	rpcStart := time.Now()
 	res, err := expBackoff.PerformBackoff(appendEntryRPC)
+	metrics.AppendEntryRPCLatency.WithLabelValues(sys.Host).ObserveSince(rpcStart)
+
 	if err != nil {
-		rlService.Log.Warn("system", sys.Host, "unreachable, setting status to dead")
+		metrics.AppendEntryRPCFailures.WithLabelValues(sys.Host).Inc()
+		rpcSpan.SetError(err)
+		rlService.Log.With("peer", sys.Host).Warn("system unreachable, setting status to dead")
 
 		sys.SetStatus(system.Dead)
 		rlService.ConnectionPool.CloseConnections(sys.Host)
@@ -286,7 +320,21 @@ func (rlService *ReplicatedLogService) clientAppendEntryRPC(
 		return nil, err
 	}
 
-	sys.UpdateNextIndex(res.NextLogIndex)
+	if res.Success {
+		matchIndex := req.AppendEntry.PrevLogIndex + int64(len(req.AppendEntry.Entries))
+
+		sys.UpdateMatchIndex(matchIndex)
+		sys.UpdateNextIndex(matchIndex + 1)
+	} else if res.Term <= rlService.CurrentSystem.CurrentTerm {
+		nextIndex, nextIndexErr := rlService.determineNextIndexOnConflict(res)
+		if nextIndexErr != nil { 
+			rlService.Log.Error("error determining next index on conflict:", nextIndexErr.Error())
+			nextIndex = res.ConflictIndex
+		}
+
+		sys.UpdateNextIndex(nextIndex)
+	}
+	rpcSpan.SetAttribute("raft.success", res.Success)
 
 	return res, nil
 }
@@ -4,9 +4,11 @@ import "context"
 import "errors"
 
 import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/replogrpc"
 import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/tracing"
 import "github.com/sirgallo/raft/pkg/utils"
 
 
@@ -19,23 +21,25 @@ import "github.com/sirgallo/raft/pkg/utils"
 
 		when an AppendEntryRPC is made to the appendEntry server
 			1.) if the host of the incoming request is not in the systems map, store it
-			2.) reset the election timeout regardless of success or failure response
-			3.) if the request has a term lower than the current term of the system
-				--> return a failure response with the term of the system
-			4.) if the term of the replicated log on the system is not the term of the request or is not present
-				--> return a failure response, with the earliest known index for the term, or from the latest term known on the 
-					follower to update NextIndex
-			5.) acknowledge that the request is legitimate and send signal to reset the leader election timeout
+			2.) if the request has a term lower than the current term of the system
+				--> return a failure response with the term of the system, so the stale leader steps down
+			3.) if the request has a higher term than the current term of the system, update the term and revert to follower,
+				and if the system is a candidate for the same term, revert to follower since a leader has already been elected
+			4.) acknowledge that the request is legitimate and send signal to reset the leader election timeout
+			5.) if the log on the system does not contain an entry at the previous log index with the previous log term
+				--> return a failure response with the conflicting term and the first index known for that term, or if there is no entry
+					at the previous log index, the index after the last log on the system, so the leader can skip back over the entire
+					conflicting term instead of one entry per request
 			6.) for all of the entries of the incoming request
-				--> if the term of the replicated log associated with the index of the incoming entry is not the same
-					as the request, remove up to the entry in the log on the system and begin appending logs
-				--> otherwise, just prepare the batch of logs to be range appended to the WAL
-			7.) if the commit index of the incoming request is higher than on the system, commit logs up to the commit index from
-					last applied for the state machine on the system
-			8.) if logs are at least up to date with the leader's commit index:
-				--> return a success response with the index of the latest log applied to the replicated log
-					else:
-				--> return a failed response so the follower can sync itself up to the leader if inconsistent log length
+				--> if an existing entry conflicts with a new one (same index but different term), truncate the replicated log from
+					the conflicting entry forward and append all new entries from there
+				--> entries already present with the same term are skipped
+				--> if the conflicting entry is at or below the commit index of the system, the log has diverged from committed
+					entries, which no entries from the leader can repair, so return an error instead of a failed response, which
+					the leader would otherwise retry forever
+			7.) if the commit index of the incoming request is higher than on the system, commit logs up to the minimum of the leader
+				commit index and the index of the last new entry
+			8.) return a success response with the index after the last new entry
 
 		The AppendEntryRPC server can process requests asynchronously, but when appending to the replicated log, the request must pass
 		the log entries into a buffer where they will be appended/processed synchronously in a separate go routine. For requests like heartbeats,
@@ -45,6 +49,8 @@ import "github.com/sirgallo/raft/pkg/utils"
 		For applying logs to the statemachine, a separate go routine is also utilized. A signal is attempted with the current request leader
 		commit index, and is dropped if the go routine is already in the process of applying logs to the state machine. I guess this could be 
 		considered an "opportunistic" approach to state machine application. The above algorithm for application does not change.
+
+		If the leader passed a trace context in the request metadata, the request is recorded as a span under the leader's rpc span.
 */
 
 func (rlService *ReplicatedLogService) AppendEntryRPC(ctx context.Context, req *replogrpc.AppendEntry) (*replogrpc.AppendEntryResponse, error) {
@@ -53,6 +59,7 @@ func (rlService *ReplicatedLogService) AppendEntryRPC(ctx context.Context, req *
 		sys := &system.System{
 			Host: req.LeaderId,
 			Status: system.Ready,
+			MatchIndex: system.DefaultLastLogIndex,
 		}
 
 		rlService.Systems.Store(sys.Host, sys)
@@ -61,144 +68,99 @@ func (rlService *ReplicatedLogService) AppendEntryRPC(ctx context.Context, req *
 		sys.SetStatus(system.Ready)
 	}
 
-	rlService.attemptLeadAckSignal()
+	var rpcSpan *tracing.Span
+	parentSpanContext := tracing.ExtractMetadata(ctx)
+	if parentSpanContext.IsValid() {
+		rpcSpan = tracing.StartSpan(AppendEntryRPCServerSpan, parentSpanContext)
+		rpcSpan.SetAttribute("raft.leader", req.LeaderId)
+		rpcSpan.SetAttribute("raft.entries", len(req.Entries))
+	}
 
+	defer rpcSpan.End()
 
-	resultsChan := make(chan *replogrpc.AppendEntryResponse)
-	errorChan := make(chan error)
+	resultsChan := make(chan *replogrpc.AppendEntryResponse, 1)
+	errorChan := make(chan error, 1)
 
 	go func() {
-		total, totalErr := rlService.CurrentSystem.WAL.GetTotal()
-		if totalErr != nil { 
-			rlService.Log.Error("get total error:", totalErr.Error())
-			resultsChan <- nil
-			return
-		}
-	
-		latestKnownLogTerm := int64(0)
-	
-		lastLog, getLastLogErr := rlService.CurrentSystem.WAL.GetLatest()
-		if getLastLogErr != nil { 
-			rlService.Log.Error("get last log error:", totalErr.Error())
-			errorChan <- totalErr
+		if req.Term < rlService.CurrentSystem.CurrentTerm {
+			rlService.Log.With("term", req.Term, "peer", req.LeaderId).Warn("request term lower than current term, returning failed response")
+			resultsChan <- rlService.generateResponse(req.PrevLogIndex + 1, false)
 			return
 		}
-	
-		if lastLog != nil { latestKnownLogTerm = lastLog.Term }
-		
-		failedIndexToFetch := req.PrevLogIndex - 1
-	
-		lastIndexedLog, lastIndexedErr := rlService.CurrentSystem.WAL.GetIndexedEntryForTerm(latestKnownLogTerm)
-		if lastIndexedErr != nil { 
-			rlService.Log.Error("get last log index error:", lastIndexedErr.Error())
-			errorChan <- lastIndexedErr
-			return
-		}
-	
-		if lastIndexedLog != nil { failedIndexToFetch = lastIndexedLog.Index }
-	
-		failedNextIndex, failedIndexErr := func() (int64, error) {
-			if total == 0 || failedIndexToFetch < 0 { return 0, nil }
-			return failedIndexToFetch, nil
-		}()
-	
-		if failedIndexErr != nil { 
-			errorChan <- failedIndexErr
-			return
-		}
-	
-		handleReqTerm := func() bool { return req.Term >= rlService.CurrentSystem.CurrentTerm }
-		handleReqValidTermAtIndex := func() (bool, error) {
-			currEntry, readErr := rlService.CurrentSystem.WAL.Read(req.PrevLogIndex)
-			if readErr != nil { return false, readErr }
-	
-			if total == 0 || req.Entries == nil { return true, nil } // special case for when a system has empty replicated log or hearbeats where we don't check
-			return currEntry != nil && currEntry.Term == req.PrevLogTerm, nil
-		}
-	
-		reqTermOk := handleReqTerm()
-		if ! reqTermOk {
-			rlService.Log.Warn("request term lower than current term, returning failed response")
-			resultsChan <- rlService.generateResponse(failedNextIndex, false)
-			return
+
+		if req.Term > rlService.CurrentSystem.CurrentTerm {
+			rlService.CurrentSystem.TransitionToFollower(system.StateTransitionOpts{ CurrentTerm: &req.Term })
+		} else if rlService.CurrentSystem.State == system.Candidate {
+			votedFor := rlService.CurrentSystem.VotedFor
+			rlService.CurrentSystem.TransitionToFollower(system.StateTransitionOpts{ VotedFor: &votedFor })
 		}
-	
+
+		rlService.attemptLeadAckSignal()
 		rlService.CurrentSystem.SetCurrentLeader(req.LeaderId)
-	
-		reqTermValid, readErr := handleReqValidTermAtIndex()
-		if readErr != nil { 
-			rlService.Log.Error("read error:", readErr.Error())
-			resultsChan <- rlService.generateResponse(failedNextIndex, false)
-			return
-		}
-		
-		if ! reqTermValid {
-			rlService.Log.Warn("log at request previous index has mismatched term or does not exist, returning failed response")
-			resultsChan <- rlService.generateResponse(failedNextIndex, false)
-		}
-	
-		ok, repLogErr := rlService.HandleReplicateLogs(req)
-		if repLogErr != nil { 
-			rlService.Log.Error("rep log handle error:", repLogErr.Error())
-			resultsChan <- rlService.generateResponse(failedNextIndex, false)
+
+		consistent, conflictTerm, conflictIndex, consistencyErr := rlService.checkLogConsistency(req.PrevLogIndex, req.PrevLogTerm)
+		if consistencyErr != nil {
+			rlService.Log.Error("log consistency check error:", consistencyErr.Error())
+			errorChan <- consistencyErr
 			return
 		}
 
-		if ! ok { resultsChan <- rlService.generateResponse(failedNextIndex, false) }
-	
-		lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
-		if lastLogErr != nil { 
-			rlService.Log.Error("error getting last log index", lastLogErr.Error())
-			resultsChan <- rlService.generateResponse(failedNextIndex, false)
+		if ! consistent {
+			rlService.Log.With("prevLogIndex", req.PrevLogIndex, "conflictTerm", conflictTerm, "conflictIndex", conflictIndex).Warn("log at request previous index has mismatched term or does not exist, returning failed response")
+			resultsChan <- rlService.generateConflictResponse(conflictTerm, conflictIndex)
 			return
 		}
-	
-		nextLogIndex := lastLogIndex + 1
-	
+
+		_, repLogErr := rlService.HandleReplicateLogs(req)
 		if repLogErr != nil {
-			rlService.Log.Error("replog err:", repLogErr.Error())
-			resultsChan <- rlService.generateResponse(nextLogIndex, false)
-			return
-		}
-	
-		if lastLogIndex < req.LeaderCommitIndex && req.Entries != nil {
-			rlService.Log.Warn("log length inconsistent with leader log length")
-			resultsChan <- rlService.generateResponse(nextLogIndex, false)
+			rlService.Log.Error("rep log handle error:", repLogErr.Error())
+			errorChan <- repLogErr
 			return
 		}
-	
+
+		nextLogIndex := req.PrevLogIndex + int64(len(req.Entries)) + 1
+
 		successfulResp := rlService.generateResponse(nextLogIndex, true)
-		rlService.Log.Info("leader", req.LeaderId, "acknowledged and returning successful response:", successfulResp)
+		rlService.Log.With("term", req.Term, "peer", req.LeaderId, "index", nextLogIndex).Debug("leader acknowledged, returning successful response")
 	
 		resultsChan <- successfulResp
 	}()
 
 	select {
 		case result :=<- resultsChan:
+			if result != nil { rpcSpan.SetAttribute("raft.success", result.Success) }
 			return result, nil
 		case appendEntryRPCError :=<- errorChan:
+			rpcSpan.SetError(appendEntryRPCError)
 			return nil, appendEntryRPCError
 		case <- ctx.Done():
+			rpcSpan.SetError(ctx.Err())
 			return nil, ctx.Err()
 	}
 }
 
 /*
 	Handle Replicate Logs:
-		For incoming requests, if request contains log entries, pipe into buffer to be processed
-		otherwise, attempt signalling to log application channel to update state machine
+		For incoming requests, if request contains log entries, pipe into buffer to be processed, and return the error if
+		the entries could not be appended
+		then attempt signalling to log application channel to update state machine up to the leader's commit index, or
+		the last new entry if it is less than the leader's commit index, since entries after it on the system have not been
+		checked against the leader's log
 */
 
 func (rlService *ReplicatedLogService) HandleReplicateLogs(req *replogrpc.AppendEntry) (bool, error) {
 	if req.Entries != nil {
 		rlService.AppendLogsFollowerChannel <- req
-		ok :=<- rlService.AppendLogsFollowerRespChannel
-		
-		return ok, nil
+		appendErr :=<- rlService.AppendLogsFollowerRespChannel
+		if appendErr != nil { return false, appendErr }
 	}
 
+	commitIndex := req.LeaderCommitIndex
+	lastNewEntryIndex := req.PrevLogIndex + int64(len(req.Entries))
+	if lastNewEntryIndex < commitIndex { commitIndex = lastNewEntryIndex }
+
 	select {
-		case rlService.ApplyLogsFollowerChannel <- req.LeaderCommitIndex:
+		case rlService.ApplyLogsFollowerChannel <- commitIndex:
 		default:
 	}
 	
@@ -209,16 +171,24 @@ func (rlService *ReplicatedLogService) HandleReplicateLogs(req *replogrpc.Append
 	Process Logs Follower:
 		helper method used for replicating the logs to the follower's replicated log
 
+		1.) skip all entries that are already present on the system with the same term
+		2.) on the first entry that conflicts with an existing entry (same index but different term), truncate the replicated log from
+			that index forward, since all following entries are also invalid
+			--> committed entries are never truncated, so a conflict at or below the commit index is returned as an error
+		3.) append all remaining entries
+
 		instead of appending one at a time, we can batch all of the log entries into a single bolt db transaction to reduce 
 		overhead and total transactions performed on the db, which should improve performance
 
 		this is run in a separate go routine so that requests can be processed asynchronously, but logs can be processed synchronously
 		as they enter the buffer
+
+		appending logs does not commit them, the commit index on the follower is only advanced from the leader's commit index
 */
 
 func (rlService *ReplicatedLogService) ProcessLogsFollower(req *replogrpc.AppendEntry) (bool, error) {
 	logTransform := func(entry *replogrpc.LogEntry) *log.LogEntry {
-		cmd, decErr := utils.DecodeStringToStruct[statemachine.StateMachineOperation](entry.Command)
+		cmd, decErr := utils.DecodeStringToStruct[statemachine.Command](entry.Command)
 		if decErr != nil {
 			rlService.Log.Error("error on decode -->", decErr.Error())
 			return nil
@@ -231,39 +201,45 @@ func (rlService *ReplicatedLogService) ProcessLogsFollower(req *replogrpc.Append
 		}
 	}
 
-	var logsToAppend []*log.LogEntry
-
-	appendLogToReplicatedLog := func(entry *replogrpc.LogEntry) error {
-		newLog := logTransform(entry)
-		if newLog == nil { return errors.New("log transform failed, new log is null") }
-		
-		logsToAppend = append(logsToAppend, newLog)
-
-		return nil
-	}
+	firstNewEntry := len(req.Entries)
 
 	for idx, entry := range req.Entries {
 		currEntry, readErr := rlService.CurrentSystem.WAL.Read(entry.Index)
 		if readErr != nil { return false, readErr }
 
-		if currEntry != nil {
-			if currEntry.Term != entry.Term {
-				transformedLogs := utils.Map[*replogrpc.LogEntry, *log.LogEntry](req.Entries[:idx + 1], logTransform)
-				rangeUpdateErr := rlService.CurrentSystem.WAL.RangeAppend(transformedLogs)
-				if rangeUpdateErr != nil { return false, rangeUpdateErr }
-			}
-		} else {
-			appendErr := appendLogToReplicatedLog(entry)
-			if appendErr != nil { return false, appendErr }
+		if currEntry == nil {
+			firstNewEntry = idx
+			break
+		}
+
+		if currEntry.Term != entry.Term {
+			if entry.Index <= rlService.CurrentSystem.CommitIndex { return false, ErrCommittedEntryConflict }
+
+			rlService.Log.With("index", entry.Index, "term", currEntry.Term, "leaderTerm", entry.Term).Warn("conflicting entry found, truncating replicated log")
+
+			_, _, truncateErr := rlService.CurrentSystem.WAL.TruncateFrom(entry.Index)
+			if truncateErr != nil { return false, truncateErr }
+
+			firstNewEntry = idx
+			break
 		}
 	}
 
-	rlService.CurrentSystem.WAL.RangeAppend(logsToAppend)
+	var logsToAppend []*log.LogEntry
 
-	latestLog, latestErr := rlService.CurrentSystem.WAL.GetLatest()
-	if latestErr != nil { return false, latestErr }
+	for _, entry := range req.Entries[firstNewEntry:] {
+		newLog := logTransform(entry)
+		if newLog == nil { return false, errors.New("log transform failed, new log is null") }
 
-	rlService.CurrentSystem.UpdateCommitIndex(latestLog.Index)
+		logsToAppend = append(logsToAppend, newLog)
+	}
+
+	if len(logsToAppend) == 0 { return true, nil }
+
+	rangeAppendErr := rlService.CurrentSystem.WAL.RangeAppend(logsToAppend)
+	if rangeAppendErr != nil { return false, rangeAppendErr }
+
+	metrics.EntriesAppended.Add(float64(len(logsToAppend)))
 
 	return true, nil
 }
@@ -282,29 +258,77 @@ func (rlService *ReplicatedLogService) ApplyLogsToStateMachineFollower(leaderCom
 		return idx2
 	}
 
-	logAtCommitIndex, readErr := rlService.CurrentSystem.WAL.Read(rlService.CurrentSystem.CommitIndex)
-	if readErr != nil { return readErr }
+	if leaderCommitIndex > rlService.CurrentSystem.CommitIndex {
+		lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
+		if lastLogErr != nil { return lastLogErr }
+	
+		minCommitIndex := min(leaderCommitIndex, lastLogIndex)
+		if minCommitIndex <= rlService.CurrentSystem.CommitIndex { return nil }
 
-	if logAtCommitIndex != nil {
-		if leaderCommitIndex > rlService.CurrentSystem.CommitIndex {
-			lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
-			if lastLogErr != nil { return lastLogErr }
+		rlService.CurrentSystem.UpdateCommitIndex(minCommitIndex)
 		
-			minCommitIndex := min(leaderCommitIndex, lastLogIndex)
-			rlService.CurrentSystem.CommitIndex = minCommitIndex
-			
-			applyErr := rlService.ApplyLogs()
-			if applyErr != nil { return applyErr }
-		}
+		applyErr := rlService.ApplyLogs()
+		if applyErr != nil { return applyErr }
 	}
 
 	return nil
 }
 
-func (rlService *ReplicatedLogService) generateResponse(lastLogIndex int64, success bool) *replogrpc.AppendEntryResponse {
+/*
+	Check Log Consistency:
+		helper method for the consistency check on AppendEntryRPCs
+
+		the log is consistent if the system contains an entry at the previous log index with the previous log term
+			1.) a previous log index of -1 means the entries start at the beginning of the log, which is always consistent
+			2.) if the previous entry was compacted into the latest snapshot on the system, it is committed and therefore consistent
+			3.) if there is no entry at the previous log index
+				--> return the index after the last log on the system as the conflict index, with no conflict term
+			4.) if the entry has a different term
+				--> return the term of the entry as the conflict term and the first index known for the term as the conflict index
+*/
+
+func (rlService *ReplicatedLogService) checkLogConsistency(prevLogIndex int64, prevLogTerm int64) (bool, int64, int64, error) {
+	if prevLogIndex <= system.DefaultLastLogIndex { return true, 0, 0, nil }
+
+	prevEntry, readErr := rlService.CurrentSystem.WAL.Read(prevLogIndex)
+	if readErr != nil { return false, 0, 0, readErr }
+
+	if prevEntry == nil {
+		snapshotEntry, snapshotErr := rlService.CurrentSystem.WAL.GetSnapshot()
+		if snapshotErr != nil { return false, 0, 0, snapshotErr }
+		if snapshotEntry != nil && prevLogIndex <= snapshotEntry.LastIncludedIndex { return true, 0, 0, nil }
+
+		lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
+		if lastLogErr != nil { return false, 0, 0, lastLogErr }
+
+		return false, 0, lastLogIndex + 1, nil
+	}
+
+	if prevEntry.Term == prevLogTerm { return true, 0, 0, nil }
+
+	conflictIndex := prevLogIndex
+
+	firstEntryForTerm, indexErr := rlService.CurrentSystem.WAL.GetIndexedEntryForTerm(prevEntry.Term)
+	if indexErr != nil { return false, 0, 0, indexErr }
+	if firstEntryForTerm != nil { conflictIndex = firstEntryForTerm.Index }
+
+	return false, prevEntry.Term, conflictIndex, nil
+}
+
+func (rlService *ReplicatedLogService) generateResponse(nextLogIndex int64, success bool) *replogrpc.AppendEntryResponse {
 	return &replogrpc.AppendEntryResponse{
 		Term: rlService.CurrentSystem.CurrentTerm,
-		NextLogIndex: lastLogIndex,
+		NextLogIndex: nextLogIndex,
 		Success: success,
 	}
+}
+
+func (rlService *ReplicatedLogService) generateConflictResponse(conflictTerm int64, conflictIndex int64) *replogrpc.AppendEntryResponse {
+	return &replogrpc.AppendEntryResponse{
+		Term: rlService.CurrentSystem.CurrentTerm,
+		NextLogIndex: conflictIndex,
+		Success: false,
+		ConflictTerm: conflictTerm,
+		ConflictIndex: conflictIndex,
+	}
 }
\ No newline at end of file
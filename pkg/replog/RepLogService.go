@@ -24,16 +24,16 @@ func NewReplicatedLogService(opts *ReplicatedLogOpts) *ReplicatedLogService {
 		ConnectionPool: opts.ConnectionPool,
 		CurrentSystem: opts.CurrentSystem,
 		Systems: opts.Systems,
-		AppendLogSignal: make(chan *statemachine.StateMachineOperation, AppendLogBuffSize),
-		ReadChannel: make(chan *statemachine.StateMachineOperation, AppendLogBuffSize),
-		WriteChannel: make(chan *statemachine.StateMachineOperation, AppendLogBuffSize),
+		AppendLogSignal: make(chan *statemachine.Command, AppendLogBuffSize),
+		ReadChannel: make(chan *statemachine.Command, AppendLogBuffSize),
+		WriteChannel: make(chan *statemachine.Command, AppendLogBuffSize),
 		LeaderAcknowledgedSignal: make(chan bool),
 		ForceHeartbeatSignal: make(chan bool),
 		SyncLogChannel: make(chan string),
 		SendSnapshotToSystemSignal: make(chan string),
-		StateMachineResponseChannel: make(chan *statemachine.StateMachineResponse, ResponseBuffSize),
+		StateMachineResponseChannel: make(chan *statemachine.Response, ResponseBuffSize),
 		AppendLogsFollowerChannel: make(chan *replogrpc.AppendEntry, AppendLogBuffSize),
-		AppendLogsFollowerRespChannel: make(chan bool),
+		AppendLogsFollowerRespChannel: make(chan error),
 		ApplyLogsFollowerChannel: make(chan int64),
 		Log: *clog.NewCustomLog(NAME),
 	}
@@ -79,9 +79,11 @@ func (rlService *ReplicatedLogService) StartReplicatedLogTimeout() {
 				--> wait for timer to drain, signal to replicate logs to followers, and reset timer
 			3.) heartbeat
 				--> on a set interval, heartbeat all of the followers in the cluster if leader
+				--> on election, append a no-op entry (a command with no data) for the new term before heartbeating, so that
+					entries from previous terms are committed once the no-op is replicated to a majority of the cluster
 			4.) append log signal
-				--> on incoming logs from the request module, determine if the log is a read or write op
-					and handle accordingly
+				--> on incoming commands from the request module, route commands classified as read only by the
+					state machine to the read handler, and all other commands to the write handler
 			5.) read operation handler
 				--> on read operations, do not apply to replicated log and instead read directly from 
 					db -- since data is not modified, this is an optimization to improve latency on reads
@@ -92,6 +94,9 @@ func (rlService *ReplicatedLogService) StartReplicatedLogTimeout() {
 			8.) sync logs
 				--> for systems with inconsistent replicated logs, start a separate go routine to sync
 					them back up to the leader
+			9.) expire
+				--> on a set interval, ask the state machine if anything is due to expire by the clock of the leader, and
+					if so, append the expire command from the state machine to the replicated log
 */
 
 func (rlService *ReplicatedLogService) LeaderGoRoutines() {
@@ -125,12 +130,14 @@ func (rlService *ReplicatedLogService) LeaderGoRoutines() {
 			select {
 				case <- timeoutChan:
 					if rlService.CurrentSystem.State == system.Leader {
-						rlService.Log.Info("sending heartbeats...")
+						rlService.Log.Debug("sending heartbeats...")
 						rlService.Heartbeat()
 					}
 				case <- rlService.ForceHeartbeatSignal:
 					if rlService.CurrentSystem.State == system.Leader {
 						rlService.attemptResetTimeout()
+						rlService.WriteChannel <- &statemachine.Command{}
+
 						rlService.Log.Info("sending heartbeats after election...")
 						rlService.Heartbeat()
 					}
@@ -141,11 +148,7 @@ func (rlService *ReplicatedLogService) LeaderGoRoutines() {
 	go func() {
 		for newCmd := range rlService.AppendLogSignal {
 			if rlService.CurrentSystem.State == system.Leader { 
-				isReadOperation := func() bool {
-					return newCmd.Action == statemachine.FIND || newCmd.Action == statemachine.LISTCOLLECTIONS
-				}()
-
-				if isReadOperation {
+				if newCmd.ReadOnly {
 					rlService.ReadChannel <- newCmd
 				}	else { rlService.WriteChannel <- newCmd  }
 			}
@@ -154,8 +157,13 @@ func (rlService *ReplicatedLogService) LeaderGoRoutines() {
 
 	go func() {
 		for readCmd := range rlService.ReadChannel {
-			resp, readErr := rlService.CurrentSystem.StateMachine.Read(readCmd)
-			if readErr != nil { rlService.Log.Error("error reading:", readErr.Error()) }
+			resp := &statemachine.Response{ RequestID: readCmd.RequestID }
+
+			data, readErr := rlService.CurrentSystem.StateMachine.Read(readCmd.Data)
+			if readErr != nil { 
+				rlService.Log.Error("error reading:", readErr.Error())
+				resp.Error = readErr.Error()
+			} else { resp.Data = data }
 			
 			rlService.StateMachineResponseChannel <- resp
 		}
@@ -177,6 +185,18 @@ func (rlService *ReplicatedLogService) LeaderGoRoutines() {
 		}
 	}()
 
+	go func() {
+		expireTicker := time.NewTicker(ExpireInterval)
+		defer expireTicker.Stop()
+
+		for range expireTicker.C {
+			if rlService.CurrentSystem.State == system.Leader {
+				expireCmd := statemachine.ExpireCommand(rlService.CurrentSystem.StateMachine, time.Now().UnixMilli())
+				if expireCmd != nil { rlService.WriteChannel <- &statemachine.Command{ Data: expireCmd } }
+			}
+		}
+	}()
+
 	go func() {
 		for host := range rlService.SyncLogChannel {
 			go func(host string) {
@@ -192,7 +212,7 @@ func (rlService *ReplicatedLogService) LeaderGoRoutines() {
 		separate go routines:
 			1.) process logs
 				--> as logs are received from AppendEntryRPCs from the leader, process the logs synchronously 
-				and signal to the request when complete
+				and signal to the request when complete, with the error if the logs could not be processed
 			2.) apply logs to state machine
 				--> when signalled by a request, and available, apply logs to the state machine up to the request
 					commit index
@@ -202,12 +222,9 @@ func (rlService *ReplicatedLogService) FollowerGoRoutines() {
 	go func() {
 		for req := range rlService.AppendLogsFollowerChannel {
 			_, appendErr := rlService.ProcessLogsFollower(req)
-			if appendErr != nil { 
-				rlService.Log.Error("error appending logs to follower:", appendErr.Error()) 
-				rlService.AppendLogsFollowerRespChannel <- false
-			} else {
-				rlService.AppendLogsFollowerRespChannel <- true
-			}
+			if appendErr != nil { rlService.Log.Error("error appending logs to follower:", appendErr.Error()) }
+			
+			rlService.AppendLogsFollowerRespChannel <- appendErr
 		}
 	}()
 
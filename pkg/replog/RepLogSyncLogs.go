@@ -1,5 +1,7 @@
 package replog
 
+import "time"
+
 import "github.com/sirgallo/raft/pkg/system"
 
 
@@ -11,13 +13,20 @@ import "github.com/sirgallo/raft/pkg/system"
 		helper method for handling syncing followers who have inconsistent logs
 
 		while unsuccessful response:
-			send AppendEntryRPC to follower with logs starting at the follower's NextIndex
-			if error: return false, error
-			on success: return true, nil --> the log is now up to date with the leader
-		
-		if the earliest log on the leader is greater then the next index of the system, 
-		send a signal to send the latest snapshot to the follower and perform log replication,
-		since this means that follower was not in the cluster during the latest log compaction event
+			if the earliest log on the leader is greater then the next index of the system, send a signal to send the 
+			latest snapshot to the follower, since the entries the follower needs were compacted into the snapshot. Log 
+			replication continues from the snapshot once it is installed
+			otherwise:
+				send AppendEntryRPC to follower with logs starting at the follower's NextIndex, which moves back on each failed
+				response using the conflict returned by the follower
+				if the follower responds with a higher term, revert to follower and stop syncing
+				if the next index does not move back on a failed response, wait with exponential backoff before retrying, and
+					after the max stalled attempts, set the follower back to ready and stop syncing, so the follower is retried on
+					the next round of replication instead of in a tight loop
+				if error: return false, error --> this includes a follower whose log diverged from committed entries
+				on success: return true, nil --> the log is now up to date with the leader
+
+		this is the only case where a snapshot is sent between systems, since every system snapshots its own state independently
 */
 
 func (rlService *ReplicatedLogService) SyncLogs(host string) (bool, error) {
@@ -30,10 +39,20 @@ func (rlService *ReplicatedLogService) SyncLogs(host string) (bool, error) {
 		return false, connErr
 	}
 
+	backoff := SyncLogsBackoff
+	stalledAttempts := 0
+
 	for {
 		earliestLog, earliestErr := rlService.CurrentSystem.WAL.GetEarliest()
 		if earliestErr != nil { return false, earliestErr }
 
+		if earliestLog != nil && sys.NextIndex < earliestLog.Index {
+			rlService.Log.With("peer", sys.Host, "nextIndex", sys.NextIndex, "firstIndex", earliestLog.Index).Warn("follower behind first log index, sending snapshot")
+			rlService.ConnectionPool.PutConnection(sys.Host, conn)
+			rlService.SendSnapshotToSystemSignal <- sys.Host
+
+			return true, nil
+		}
 
 		lastLogIndex, _, lastLogErr := rlService.CurrentSystem.DetermineLastLogIdxAndTerm()
 		if lastLogErr != nil { return false, lastLogErr }
@@ -46,17 +65,42 @@ func (rlService *ReplicatedLogService) SyncLogs(host string) (bool, error) {
 			AppendEntry: preparedEntries,
 		}
 
+		previousNextIndex := sys.NextIndex
+
 		res, rpcErr := rlService.clientAppendEntryRPC(conn, sys, req)
 		if rpcErr != nil { return false, rpcErr }
 
+		if res.Term > rlService.CurrentSystem.CurrentTerm {
+			rlService.CurrentSystem.TransitionToFollower(system.StateTransitionOpts{ CurrentTerm: &res.Term })
+			rlService.attemptLeadAckSignal()
+			rlService.ConnectionPool.PutConnection(sys.Host, conn)
+
+			return false, nil
+		}
+
 		if res.Success {
 			sys.SetStatus(system.Ready)
 			rlService.ConnectionPool.PutConnection(sys.Host, conn)
 
-			return true, nil
-		} else if earliestLog != nil && sys.NextIndex < earliestLog.Index {
-			rlService.SendSnapshotToSystemSignal <- sys.Host
 			return true, nil
 		}
+
+		if sys.NextIndex < previousNextIndex {
+			backoff = SyncLogsBackoff
+			stalledAttempts = 0
+			continue
+		}
+
+		stalledAttempts++
+		if stalledAttempts >= SyncLogsMaxStalledAttempts {
+			rlService.Log.With("peer", sys.Host, "nextIndex", sys.NextIndex).Error("next index did not move back on conflict, stopping sync")
+			sys.SetStatus(system.Ready)
+			rlService.ConnectionPool.PutConnection(sys.Host, conn)
+
+			return false, ErrSyncLogsStalled
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+package replog
+
+import "errors"
+
+import "github.com/sirgallo/raft/pkg/tracing"
+
+
+//=========================================== RepLog Tracing
+
+
+/*
+	Start Replication Span:
+		once a traced command is appended to the leader's replicated log, a span is opened for the entry and held until
+		the entry is committed, covering the time spent replicating to a majority of the cluster
+*/
+
+func (rlService *ReplicatedLogService) startReplicationSpan(index int64, parent tracing.SpanContext) {
+	replicationSpan := tracing.StartSpan(ReplicateSpan, parent)
+	if replicationSpan == nil { return }
+
+	replicationSpan.SetAttribute("raft.index", index)
+	replicationSpan.SetAttribute("raft.term", rlService.CurrentSystem.CurrentTerm)
+
+	rlService.ReplicationSpans.Store(index, replicationSpan)
+}
+
+/*
+	Replication Span Context:
+		get the context of the oldest uncommitted traced entry, which AppendEntryRPCs for the current round of
+		replication are parented under, or the zero context if no traced entries are waiting on commit
+*/
+
+func (rlService *ReplicatedLogService) replicationSpanContext() tracing.SpanContext {
+	oldestIndex := int64(-1)
+	var oldestSpan *tracing.Span
+
+	rlService.ReplicationSpans.Range(func(key, value any) bool {
+		index := key.(int64)
+		if oldestIndex == -1 || index < oldestIndex {
+			oldestIndex = index
+			oldestSpan = value.(*tracing.Span)
+		}
+
+		return true
+	})
+
+	return oldestSpan.SpanContext()
+}
+
+/*
+	End Replication Spans:
+		end the spans for all traced entries up to and including the new commit index
+*/
+
+func (rlService *ReplicatedLogService) endReplicationSpans(commitIndex int64) {
+	rlService.ReplicationSpans.Range(func(key, value any) bool {
+		if key.(int64) <= commitIndex {
+			value.(*tracing.Span).End()
+			rlService.ReplicationSpans.Delete(key)
+		}
+
+		return true
+	})
+}
+
+/*
+	Abort Replication Spans:
+		when the leader steps down, traced entries will not be committed in this term, so end all pending spans with an error
+*/
+
+func (rlService *ReplicatedLogService) abortReplicationSpans() {
+	rlService.ReplicationSpans.Range(func(key, value any) bool {
+		replicationSpan := value.(*tracing.Span)
+		replicationSpan.SetError(errors.New("leader stepped down before entry was committed"))
+		replicationSpan.End()
+
+		rlService.ReplicationSpans.Delete(key)
+		return true
+	})
+}
@@ -1,5 +1,6 @@
 package replog
 
+import "errors"
 import "sync"
 import "time"
 
@@ -8,6 +9,7 @@ import "github.com/sirgallo/raft/pkg/connpool"
 import "github.com/sirgallo/raft/pkg/replogrpc"
 import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/tracing"
 
 
 type ReplicatedLogOpts struct {
@@ -30,25 +32,28 @@ type ReplicatedLogService struct {
 	HeartBeatTimer *time.Timer
 	ReplicateLogsTimer *time.Timer
 
-	AppendLogSignal chan *statemachine.StateMachineOperation
-	ReadChannel chan *statemachine.StateMachineOperation
-	WriteChannel chan *statemachine.StateMachineOperation
+	AppendLogSignal chan *statemachine.Command
+	ReadChannel chan *statemachine.Command
+	WriteChannel chan *statemachine.Command
 	LeaderAcknowledgedSignal chan bool
 	ResetTimeoutSignal chan bool
 	ForceHeartbeatSignal chan bool
 	SyncLogChannel chan string
 	SendSnapshotToSystemSignal chan string
-	StateMachineResponseChannel chan *statemachine.StateMachineResponse
+	StateMachineResponseChannel chan *statemachine.Response
 	ApplyLogsFollowerChannel chan int64
-	AppendLogsFollowerRespChannel chan bool
+	AppendLogsFollowerRespChannel chan error
 	AppendLogsFollowerChannel chan *replogrpc.AppendEntry
 
+	ReplicationSpans sync.Map
+
 	Log clog.CustomLog
 }
 
 type ReplicatedLogRequest struct {
 	Host string
 	AppendEntry *replogrpc.AppendEntry
+	SpanContext tracing.SpanContext
 }
 
 type RLResponseChannels struct {
@@ -58,9 +63,22 @@ type RLResponseChannels struct {
 }
 
 
+var ErrCommittedEntryConflict = errors.New("entry conflicts with an entry at or below the commit index, log diverged from committed entries")
+var ErrSyncLogsStalled = errors.New("next index of follower did not move back on conflict")
+
+
 const NAME = "Replicated Log"
 const HeartbeatInterval = 50 * time.Millisecond
 const RepLogInterval = 150 * time.Millisecond
 const RPCTimeout = 200 * time.Millisecond
 const AppendLogBuffSize = 1000000
-const ResponseBuffSize = 100000
\ No newline at end of file
+const ResponseBuffSize = 100000
+const ExpireInterval = 1 * time.Second
+const SyncLogsBackoff = 10 * time.Millisecond
+const SyncLogsMaxStalledAttempts = 3
+
+const WALAppendSpan = "wal.append"
+const ReplicateSpan = "replog.replicate"
+const AppendEntryRPCClientSpan = "replog.AppendEntryRPC.client"
+const AppendEntryRPCServerSpan = "replog.AppendEntryRPC.server"
+const ApplySpan = "statemachine.apply"
\ No newline at end of file
@@ -24,6 +24,8 @@ func (rlService *ReplicatedLogService) determineBatchSize() int {
 
 /*
 	prepare an AppendEntryRPC:
+		--> determine the previous log index and term from the next log index for that particular system, which is also done for
+			heartbeats so the system can check its log for consistency
 		--> determine what entries to get, which will be the next log index forward for that particular system
 		--> batch the entries
 		--> encode the command entries to string
@@ -32,7 +34,7 @@ func (rlService *ReplicatedLogService) determineBatchSize() int {
 
 func (rlService *ReplicatedLogService) PrepareAppendEntryRPC(lastLogIndex int64, nextIndex int64, isHeartbeat bool) (*replogrpc.AppendEntry, error) {
 	transformLogEntry := func(logEntry *log.LogEntry) *replogrpc.LogEntry {
-		cmd, encErr := utils.EncodeStructToString[statemachine.StateMachineOperation](logEntry.Command)
+		cmd, encErr := utils.EncodeStructToString[statemachine.Command](logEntry.Command)
 		if encErr != nil { 
 			rlService.Log.Error("error encoding log struct to string") 
 			return nil
@@ -45,37 +47,12 @@ func (rlService *ReplicatedLogService) PrepareAppendEntryRPC(lastLogIndex int64,
 		}
 	}
 
-	var previousLogIndex, previousLogTerm int64
-	var entries []*replogrpc.LogEntry
-
-	lastLog, lastLogErr := rlService.CurrentSystem.WAL.Read(lastLogIndex)
-	if lastLogErr != nil { return nil, lastLogErr }
-
-	if isHeartbeat {
-		if lastLogIndex >= 0 {
-			previousLogIndex = lastLogIndex
-		} else { previousLogIndex = utils.GetZero[int64]() }
+	previousLogIndex, previousLogTerm, previousLogErr := rlService.determinePreviousLogIdxAndTerm(nextIndex)
+	if previousLogErr != nil { return nil, previousLogErr }
 
-		if lastLog == nil {
-			lastLog = &log.LogEntry{
-				Term: utils.GetZero[int64](),
-			}
-		}
-		
-		previousLogTerm = lastLog.Term
-		entries = nil
-	} else {
-		previousLog, readErr := rlService.CurrentSystem.WAL.Read(nextIndex - 1)
-		if readErr != nil { return nil, readErr }
-
-		if previousLog != nil {
-			previousLogIndex = previousLog.Index
-			previousLogTerm = previousLog.Term
-		} else {
-			previousLogIndex = utils.GetZero[int64]()
-			previousLogTerm = utils.GetZero[int64]()
-		}
+	var entries []*replogrpc.LogEntry
 
+	if ! isHeartbeat {
 		entriesToSend, entriesErr := func() ([]*log.LogEntry, error) {
 			batchSize := rlService.determineBatchSize()
 			totalToSend := lastLogIndex - nextIndex
@@ -111,6 +88,52 @@ func (rlService *ReplicatedLogService) PrepareAppendEntryRPC(lastLogIndex int64,
 	return appendEntry, nil
 }
 
+/*
+	Determine Previous Log Idx And Term:
+		get the index and term of the entry before the next index of a system, which the system checks its own log against
+			1.) if the next index is the start of the log, there is no previous entry, so -1 is used for the index
+			2.) if the entry is in the replicated log, use its index and term
+			3.) if the entry was compacted and is the last entry included in the latest snapshot, use the snapshot index and term
+			4.) otherwise the entry is unknown, so use a term of 0, which never matches an entry on the system, so the consistency
+				check fails and the system responds with where the logs conflict
+*/
+
+func (rlService *ReplicatedLogService) determinePreviousLogIdxAndTerm(nextIndex int64) (int64, int64, error) {
+	previousIndex := nextIndex - 1
+	if previousIndex < 0 { return system.DefaultLastLogIndex, system.DefaultLastLogTerm, nil }
+
+	previousLog, readErr := rlService.CurrentSystem.WAL.Read(previousIndex)
+	if readErr != nil { return 0, 0, readErr }
+	if previousLog != nil { return previousLog.Index, previousLog.Term, nil }
+
+	snapshotEntry, snapshotErr := rlService.CurrentSystem.WAL.GetSnapshot()
+	if snapshotErr != nil { return 0, 0, snapshotErr }
+
+	if snapshotEntry != nil && snapshotEntry.LastIncludedIndex == previousIndex {
+		return snapshotEntry.LastIncludedIndex, snapshotEntry.LastIncludedTerm, nil
+	}
+
+	return previousIndex, system.DefaultLastLogTerm, nil
+}
+
+/*
+	Determine Next Index On Conflict:
+		on a failed AppendEntryRPC, use the conflict in the response to skip back over all conflicting entries at once
+			1.) if the system has no entry at the previous index, the conflict index is the index after the last log on the system
+			2.) if the leader has entries for the conflicting term, the next index is the index after the last entry in the term
+			3.) otherwise, the next index is the first index for the conflicting term on the system
+*/
+
+func (rlService *ReplicatedLogService) determineNextIndexOnConflict(res *replogrpc.AppendEntryResponse) (int64, error) {
+	if res.ConflictTerm == system.DefaultLastLogTerm { return res.ConflictIndex, nil }
+
+	lastEntryForTerm, lastEntryErr := rlService.CurrentSystem.WAL.GetLastEntryForTerm(res.ConflictTerm)
+	if lastEntryErr != nil { return 0, lastEntryErr }
+	if lastEntryForTerm != nil { return lastEntryForTerm.Index + 1, nil }
+
+	return res.ConflictIndex, nil
+}
+
 /*
 	Get Alive Systems And Min Success Resps:
 		helper method for both determining the current alive systems in the cluster and also the minimum successful responses
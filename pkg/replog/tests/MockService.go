@@ -1,34 +1,42 @@
 package replogtests
 
+import "errors"
+import "io"
+import "net"
 import "os"
+import "path/filepath"
 import "sync"
+import "testing"
+import "google.golang.org/grpc"
 
-// import "github.com/sirgallo/raft/pkg/log"
 import "github.com/sirgallo/raft/pkg/logger"
 import "github.com/sirgallo/raft/pkg/connpool"
+import "github.com/sirgallo/raft/pkg/log"
 import "github.com/sirgallo/raft/pkg/replog"
+import "github.com/sirgallo/raft/pkg/replogrpc"
+import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
-// import "github.com/sirgallo/raft/pkg/wal"
+import "github.com/sirgallo/raft/pkg/wal"
 
 
 const NAME = "Mock Replog Service"
 var Log = clog.NewCustomLog(NAME)
 
-func SetupMockReplogService() *replog.ReplicatedLogService[string] {
+func SetupMockReplogService(t *testing.T) *replog.ReplicatedLogService {
 	hostname, hostErr := os.Hostname()
 	if hostErr != nil { Log.Fatal("unable to get hostname") }
 
-	currentSystem := &system.System[string]{
+	currentSystem := &system.System{
 		Host: hostname,
 		CurrentTerm: 1,
 		CommitIndex: 4,
 		LastApplied: 4,
 		Status: system.Ready,
 		State: system.Follower,
-		// WAL: wal,
+		WAL: NewMockWAL(t, NewMockEntries(0, 4, 1)),
 	}
 
-	systemsList := []*system.System[string]{
+	systemsList := []*system.System{
 		{ Host: "1", NextIndex: 4, Status: system.Ready },
 		{ Host: "2", NextIndex: 4, Status: system.Ready },
 		{ Host: "3", NextIndex: 4, Status: system.Ready },
@@ -38,17 +46,151 @@ func SetupMockReplogService() *replog.ReplicatedLogService[string] {
 	connpoolOpts := connpool.ConnectionPoolOpts{ MaxConn: 10 }
 	rlConnPool := connpool.NewConnectionPool(connpoolOpts)
 
-	sysMap := &sync.Map{} 
+	sysMap := &sync.Map{}
 	for _, sys := range systemsList {
 		sysMap.Store(sys.Host, sys)
 	}
 
-	rlOpts := &replog.ReplicatedLogOpts[string]{
+	rlOpts := &replog.ReplicatedLogOpts{
 		Port:	54322,
 		ConnectionPool: rlConnPool,
 		CurrentSystem: currentSystem,
 		Systems: sysMap,
 	}
 
-	return replog.NewReplicatedLogService[string](rlOpts)
-}
\ No newline at end of file
+	return replog.NewReplicatedLogService(rlOpts)
+}
+
+/*
+	Setup Mock Sync Services:
+		create a leader and a follower with their own wal, where the follower is served over grpc with its follower go
+		routines running, and the leader knows the follower as a system with a next index after the last log on the leader
+*/
+
+func SetupMockSyncServices(t *testing.T, leaderEntries []*log.LogEntry, followerEntries []*log.LogEntry, followerCommitIndex int64) (*replog.ReplicatedLogService, *replog.ReplicatedLogService, *system.System) {
+	currentTerm := leaderEntries[len(leaderEntries) - 1].Term
+
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil { t.Fatalf("error listening: %s", listenErr.Error()) }
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	follower := replog.NewReplicatedLogService(&replog.ReplicatedLogOpts{
+		Port: port,
+		CurrentSystem: &system.System{
+			Host: "follower",
+			CurrentTerm: currentTerm,
+			CommitIndex: followerCommitIndex,
+			LastApplied: followerCommitIndex,
+			State: system.Follower,
+			WAL: NewMockWAL(t, followerEntries),
+		},
+		Systems: &sync.Map{},
+	})
+
+	follower.FollowerGoRoutines()
+
+	srv := grpc.NewServer()
+	replogrpc.RegisterRepLogServiceServer(srv, follower)
+	go srv.Serve(listener)
+
+	t.Cleanup(srv.Stop)
+
+	followerSystem := &system.System{
+		Host: "127.0.0.1",
+		Status: system.Busy,
+		NextIndex: leaderEntries[len(leaderEntries) - 1].Index + 1,
+		MatchIndex: system.DefaultLastLogIndex,
+	}
+
+	systems := &sync.Map{}
+	systems.Store(followerSystem.Host, followerSystem)
+
+	leader := replog.NewReplicatedLogService(&replog.ReplicatedLogOpts{
+		Port: port,
+		ConnectionPool: connpool.NewConnectionPool(connpool.ConnectionPoolOpts{ MaxConn: 10 }),
+		CurrentSystem: &system.System{
+			Host: "leader",
+			CurrentTerm: currentTerm,
+			CommitIndex: system.DefaultLastLogIndex,
+			LastApplied: system.DefaultLastLogIndex,
+			State: system.Leader,
+			WAL: NewMockWAL(t, leaderEntries),
+		},
+		Systems: systems,
+	})
+
+	return leader, follower, followerSystem
+}
+
+/*
+	New Mock WAL:
+		open a wal in a new temporary home directory with the entries appended to it
+*/
+
+func NewMockWAL(t *testing.T, entries []*log.LogEntry) *wal.WAL {
+	homedir := t.TempDir()
+	t.Setenv("HOME", homedir)
+
+	mkdirErr := os.MkdirAll(filepath.Join(homedir, wal.SubDirectory), 0755)
+	if mkdirErr != nil { t.Fatalf("error creating wal directory: %s", mkdirErr.Error()) }
+
+	mockWAL, walErr := wal.NewWAL(wal.WALOpts{})
+	if walErr != nil { t.Fatalf("error creating wal: %s", walErr.Error()) }
+
+	t.Cleanup(func() { mockWAL.DB.Close() })
+
+	if len(entries) > 0 {
+		appendErr := mockWAL.RangeAppend(entries)
+		if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+	}
+
+	return mockWAL
+}
+
+func NewMockEntries(start int64, end int64, term int64) []*log.LogEntry {
+	var entries []*log.LogEntry
+	for idx := start; idx <= end; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: term })
+	}
+
+	return entries
+}
+
+/*
+	Mock State Machine:
+		applies batches of commands all or nothing, where a command with the data "fail" fails the batch with a command
+		error, and a command with the data "disk" fails the batch with a system error while the disk is failing
+*/
+
+type MockStateMachine struct {
+	DiskFailing bool
+	Applied []string
+}
+
+func (sm *MockStateMachine) Apply(commands [][]byte) ([][]byte, error) {
+	for _, command := range commands {
+		if string(command) == "fail" { return nil, &statemachine.CommandError{ Err: errors.New("command failed") } }
+		if string(command) == "disk" && sm.DiskFailing { return nil, errors.New("disk failed") }
+	}
+
+	results := make([][]byte, len(commands))
+	for idx, command := range commands {
+		sm.Applied = append(sm.Applied, string(command))
+		results[idx] = command
+	}
+
+	return results, nil
+}
+
+func (sm *MockStateMachine) Read(query []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (sm *MockStateMachine) Snapshot(writer io.Writer) error {
+	return nil
+}
+
+func (sm *MockStateMachine) Restore(reader io.Reader) error {
+	return nil
+}
@@ -1,7 +1,15 @@
 package replogtests
 
+import "strconv"
+import "strings"
+import "sync"
 import "testing"
 
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/replog"
+import "github.com/sirgallo/raft/pkg/statemachine"
+import "github.com/sirgallo/raft/pkg/system"
+
 
 func TestCommitLogsForLeader(t *testing.T) {
 
@@ -17,4 +25,96 @@ func TestCommitErrorForLeader(t *testing.T) {
 
 func TestCommitErrorForFollower(t *testing.T) {
 
-} 
\ No newline at end of file
+}
+
+func TestAdvanceCommitIndex(t *testing.T) {
+	peers := make([]*system.System, 4)
+	systems := &sync.Map{}
+
+	for idx := range peers {
+		peers[idx] = &system.System{ Host: strconv.Itoa(idx), Status: system.Ready, MatchIndex: system.DefaultLastLogIndex }
+		systems.Store(peers[idx].Host, peers[idx])
+	}
+
+	leader := replog.NewReplicatedLogService(&replog.ReplicatedLogOpts{
+		CurrentSystem: &system.System{
+			Host: "leader",
+			CurrentTerm: 2,
+			CommitIndex: system.DefaultLastLogIndex,
+			LastApplied: system.DefaultLastLogIndex,
+			State: system.Leader,
+			WAL: NewMockWAL(t, append(NewMockEntries(0, 2, 1), NewMockEntries(3, 5, 2)...)),
+		},
+		Systems: systems,
+	})
+
+	advance := func(matchIndexes ...int64) bool {
+		for idx, matchIndex := range matchIndexes {
+			peers[idx].UpdateMatchIndex(matchIndex)
+		}
+
+		committed, commitErr := leader.AdvanceCommitIndex()
+		if commitErr != nil { t.Fatalf("error advancing commit index: %s", commitErr.Error()) }
+
+		return committed
+	}
+
+	t.Run("entry from previous term", func(t *testing.T) {
+		if advance(2, 2, 0, -1) { t.Error("expected entry from previous term not to be committed by counting replicas") }
+		if leader.CurrentSystem.CommitIndex != system.DefaultLastLogIndex { t.Errorf("expected commit index to stay at -1, got %d", leader.CurrentSystem.CommitIndex) }
+	})
+
+	t.Run("median of match indexes", func(t *testing.T) {
+		if ! advance(4, 3, 1, 0) { t.Error("expected commit index to advance") }
+		if leader.CurrentSystem.CommitIndex != 3 { t.Errorf("expected commit index at median match index 3, got %d", leader.CurrentSystem.CommitIndex) }
+	})
+
+	t.Run("median behind commit index", func(t *testing.T) {
+		for _, peer := range peers { peer.ResetMatchIndex() }
+
+		if advance(3, 0, 0, 0) { t.Error("expected commit index not to move back") }
+		if leader.CurrentSystem.CommitIndex != 3 { t.Errorf("expected commit index to stay at 3, got %d", leader.CurrentSystem.CommitIndex) }
+	})
+
+	t.Run("majority at last log", func(t *testing.T) {
+		if ! advance(5, 5, 0, 0) { t.Error("expected commit index to advance") }
+		if leader.CurrentSystem.CommitIndex != 5 { t.Errorf("expected commit index at 5, got %d", leader.CurrentSystem.CommitIndex) }
+	})
+}
+
+func TestApplyLogsErrorIsolation(t *testing.T) {
+	var entries []*log.LogEntry
+	for idx, data := range []string{ "a", "fail", "b", "disk", "c" } {
+		entries = append(entries, &log.LogEntry{ Index: int64(idx), Term: 1, Command: statemachine.Command{ Data: []byte(data) } })
+	}
+
+	sm := &MockStateMachine{ DiskFailing: true }
+
+	follower := replog.NewReplicatedLogService(&replog.ReplicatedLogOpts{
+		CurrentSystem: &system.System{
+			Host: "follower",
+			CurrentTerm: 1,
+			CommitIndex: 4,
+			LastApplied: system.DefaultLastLogIndex,
+			State: system.Follower,
+			WAL: NewMockWAL(t, entries),
+			StateMachine: sm,
+		},
+		Systems: &sync.Map{},
+	})
+
+	applyErr := follower.ApplyLogs()
+	if applyErr == nil { t.Fatal("expected error from failed disk") }
+	if statemachine.IsCommandError(applyErr) { t.Errorf("expected system error, got command error: %s", applyErr.Error()) }
+
+	if follower.CurrentSystem.LastApplied != 2 { t.Errorf("expected last applied before failed command at 2, got %d", follower.CurrentSystem.LastApplied) }
+	if strings.Join(sm.Applied, ",") != "a,b" { t.Errorf("expected failed command to be skipped, got %v", sm.Applied) }
+
+	sm.DiskFailing = false
+
+	retryErr := follower.ApplyLogs()
+	if retryErr != nil { t.Fatalf("error applying logs: %s", retryErr.Error()) }
+
+	if follower.CurrentSystem.LastApplied != 4 { t.Errorf("expected last applied at 4, got %d", follower.CurrentSystem.LastApplied) }
+	if strings.Join(sm.Applied, ",") != "a,b,disk,c" { t.Errorf("expected command to be applied on retry, got %v", sm.Applied) }
+}
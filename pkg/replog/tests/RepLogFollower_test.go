@@ -1,14 +1,47 @@
 package replogtests
 
+import "context"
 import "testing"
 
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/replog"
+import "github.com/sirgallo/raft/pkg/replogrpc"
+import "github.com/sirgallo/raft/pkg/statemachine"
+import "github.com/sirgallo/raft/pkg/utils"
+
 
 func TestHandleReqWithLowerTerm(t *testing.T) {
 
 }
 
 func TestRequestMismatchedTerms(t *testing.T) {
+	_, follower, _ := SetupMockSyncServices(t, NewMockEntries(0, 5, 3), append(NewMockEntries(0, 1, 1), NewMockEntries(2, 4, 2)...), 1)
+
+	appendEntry := func(prevLogIndex int64, prevLogTerm int64) *replogrpc.AppendEntryResponse {
+		res, rpcErr := follower.AppendEntryRPC(context.Background(), &replogrpc.AppendEntry{
+			Term: 3,
+			LeaderId: "leader",
+			PrevLogIndex: prevLogIndex,
+			PrevLogTerm: prevLogTerm,
+			LeaderCommitIndex: 1,
+		})
+
+		if rpcErr != nil { t.Fatalf("error on AppendEntryRPC: %s", rpcErr.Error()) }
+		return res
+	}
 
+	missing := appendEntry(5, 3)
+	if missing.Success || missing.ConflictTerm != 0 || missing.ConflictIndex != 5 {
+		t.Errorf("expected conflict at index after last log with no term, got %+v", missing)
+	}
+
+	mismatched := appendEntry(4, 3)
+	if mismatched.Success || mismatched.ConflictTerm != 2 || mismatched.ConflictIndex != 2 {
+		t.Errorf("expected conflict at first index of term 2, got %+v", mismatched)
+	}
+
+	matched := appendEntry(1, 1)
+	if ! matched.Success { t.Errorf("expected success for matching previous entry, got %+v", matched) }
 }
 
 func TestLeaderAck(t *testing.T) {
@@ -21,4 +54,62 @@ func TestHandleReplicateLogs(t *testing.T) {
 
 func TestSuccessfulAppendEntry(t *testing.T) {
 	
-}
\ No newline at end of file
+}
+
+func TestProcessLogsFollowerTruncation(t *testing.T) {
+	_, follower, _ := SetupMockSyncServices(t, NewMockEntries(0, 3, 3), append(NewMockEntries(0, 1, 1), NewMockEntries(2, 6, 2)...), 1)
+
+	ok, processErr := follower.ProcessLogsFollower(&replogrpc.AppendEntry{
+		Term: 3,
+		PrevLogIndex: -1,
+		Entries: toRPCEntries(append(NewMockEntries(0, 1, 1), NewMockEntries(2, 3, 3)...)),
+	})
+
+	if processErr != nil || ! ok { t.Fatalf("error processing logs: %v", processErr) }
+
+	latest, latestErr := follower.CurrentSystem.WAL.GetLatest()
+	if latestErr != nil { t.Fatalf("error getting latest: %s", latestErr.Error()) }
+	if latest.Index != 3 || latest.Term != 3 { t.Errorf("expected log to end at 3 with term 3, got %d with term %d", latest.Index, latest.Term) }
+
+	kept, _ := follower.CurrentSystem.WAL.Read(1)
+	if kept == nil || kept.Term != 1 { t.Errorf("expected matching entry at 1 to be kept, got %+v", kept) }
+
+	truncated, _ := follower.CurrentSystem.WAL.Read(4)
+	if truncated != nil { t.Errorf("expected conflicting suffix to be removed, got %+v", truncated) }
+
+	firstForTerm, termErr := follower.CurrentSystem.WAL.GetIndexedEntryForTerm(2)
+	if termErr != nil { t.Fatalf("error getting entry for term: %s", termErr.Error()) }
+	if firstForTerm != nil { t.Errorf("expected no entries indexed for truncated term, got %+v", firstForTerm) }
+}
+
+func TestProcessLogsFollowerCommittedConflict(t *testing.T) {
+	_, follower, _ := SetupMockSyncServices(t, NewMockEntries(0, 3, 3), append(NewMockEntries(0, 1, 1), NewMockEntries(2, 4, 2)...), 3)
+
+	req := &replogrpc.AppendEntry{
+		Term: 3,
+		LeaderId: "leader",
+		PrevLogIndex: 1,
+		PrevLogTerm: 1,
+		Entries: toRPCEntries(NewMockEntries(2, 3, 3)),
+	}
+
+	_, processErr := follower.ProcessLogsFollower(req)
+	if processErr != replog.ErrCommittedEntryConflict { t.Errorf("expected committed entry conflict, got %v", processErr) }
+
+	_, rpcErr := follower.AppendEntryRPC(context.Background(), req)
+	if rpcErr == nil { t.Error("expected AppendEntryRPC to return an error instead of a conflict") }
+
+	committed, _ := follower.CurrentSystem.WAL.Read(2)
+	if committed == nil || committed.Term != 2 { t.Errorf("expected committed entry to be kept, got %+v", committed) }
+}
+
+func toRPCEntries(entries []*log.LogEntry) []*replogrpc.LogEntry {
+	encodedNoOp, _ := utils.EncodeStructToString[statemachine.Command](statemachine.Command{})
+
+	var rpcEntries []*replogrpc.LogEntry
+	for _, entry := range entries {
+		rpcEntries = append(rpcEntries, &replogrpc.LogEntry{ Index: entry.Index, Term: entry.Term, Command: encodedNoOp })
+	}
+
+	return rpcEntries
+}
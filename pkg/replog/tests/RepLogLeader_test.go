@@ -2,6 +2,8 @@ package replogtests
 
 import "testing"
 
+import "github.com/sirgallo/raft/pkg/system"
+
 
 func TestHeartbeat(t *testing.T) {
 
@@ -12,5 +14,34 @@ func TestReplicateLogs(t *testing.T) {
 }
 
 func TestSyncLogs(t *testing.T) {
-	
-}
\ No newline at end of file
+	leaderEntries := append(append(NewMockEntries(0, 1, 1), NewMockEntries(2, 3, 2)...), NewMockEntries(4, 5, 3)...)
+	followerEntries := append(NewMockEntries(0, 1, 1), NewMockEntries(2, 4, 2)...)
+	leader, follower, followerSystem := SetupMockSyncServices(t, leaderEntries, followerEntries, 1)
+
+	ok, syncErr := leader.SyncLogs(followerSystem.Host)
+	if syncErr != nil || ! ok { t.Fatalf("error syncing logs: %v", syncErr) }
+
+	for _, expected := range leaderEntries {
+		entry, readErr := follower.CurrentSystem.WAL.Read(expected.Index)
+		if readErr != nil { t.Fatalf("error reading entry: %s", readErr.Error()) }
+		if entry == nil || entry.Term != expected.Term { t.Errorf("expected entry %d with term %d, got %+v", expected.Index, expected.Term, entry) }
+	}
+
+	if followerSystem.NextIndex != 6 || followerSystem.GetMatchIndex() != 5 {
+		t.Errorf("expected next index 6 and match index 5, got %d and %d", followerSystem.NextIndex, followerSystem.GetMatchIndex())
+	}
+
+	if followerSystem.Status != system.Ready { t.Errorf("expected follower to be ready, got %d", followerSystem.Status) }
+}
+
+func TestSyncLogsCommittedConflict(t *testing.T) {
+	leaderEntries := append(NewMockEntries(0, 1, 1), NewMockEntries(2, 3, 3)...)
+	followerEntries := append(NewMockEntries(0, 1, 1), NewMockEntries(2, 4, 2)...)
+	leader, follower, followerSystem := SetupMockSyncServices(t, leaderEntries, followerEntries, 4)
+
+	ok, syncErr := leader.SyncLogs(followerSystem.Host)
+	if syncErr == nil || ok { t.Fatalf("expected sync to stop with an error for a follower with conflicting committed entries") }
+
+	committed, _ := follower.CurrentSystem.WAL.Read(4)
+	if committed == nil || committed.Term != 2 { t.Errorf("expected committed entry to be kept, got %+v", committed) }
+}
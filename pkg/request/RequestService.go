@@ -14,7 +14,9 @@ import "github.com/sirgallo/raft/pkg/utils"
 /*
 	create a new service instance with passable options
 	--> initialize the mux server and register route handlers on it, in this case the command route
-		for sending operations to perform on the state machine
+		for sending operations to perform on the state machine, the metrics route for scraping telemetry, the
+		log level route for adjusting log levels at runtime, the watch route for streaming changes, and the snapshot
+		route for snapshotting the node on request
 */
 
 func NewRequestService(opts *RequestServiceOpts) *RequestService {
@@ -24,13 +26,18 @@ func NewRequestService(opts *RequestServiceOpts) *RequestService {
 		Mux: mux,
 		Port: utils.NormalizePort(opts.Port),
 		CurrentSystem: opts.CurrentSystem,
-		RequestChannel: make(chan *statemachine.StateMachineOperation, RequestChannelSize),
-		ResponseChannel: make(chan *statemachine.StateMachineResponse, ResponseChannelSize),
+		RequestChannel: make(chan *statemachine.Command, RequestChannelSize),
+		ResponseChannel: make(chan *statemachine.Response, ResponseChannelSize),
 		ClientMappedResponseChannels: sync.Map{},
+		SnapshotRequestChannel: make(chan chan error),
 		Log: *clog.NewCustomLog(NAME),
 	}
 
 	reqService.RegisterCommandRoute()
+	reqService.RegisterMetricsRoute()
+	reqService.RegisterLogLevelRoute()
+	reqService.RegisterWatchRoute()
+	reqService.RegisterSnapshotRoute()
 
 	return reqService
 }
@@ -56,11 +63,11 @@ func (reqService *RequestService) StartRequestService() {
 
 	go func() {
 		for response := range reqService.ResponseChannel {
-			go func(response *statemachine.StateMachineResponse) {
+			go func(response *statemachine.Response) {
 				c, ok := reqService.ClientMappedResponseChannels.Load(response.RequestID)
 
 				if ok {
-					clientChannel := c.(chan *statemachine.StateMachineResponse)
+					clientChannel := c.(chan *statemachine.Response)
 					clientChannel <- response
 				} else { reqService.Log.Warn("no channel for resp associated with req id:", response.RequestID) }
 			}(response)
@@ -2,13 +2,20 @@ package request
 
 import "encoding/json"
 import "errors"
+import "fmt"
 import "io"
 import "net/http"
 import "net/url"
+import "strconv"
+import "time"
 
+import "github.com/sirgallo/raft/pkg/logger"
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/tracing"
 import "github.com/sirgallo/raft/pkg/utils"
+import "github.com/sirgallo/raft/pkg/watch"
 
 
 //=========================================== Snapshot Service Handlers
@@ -19,24 +26,30 @@ import "github.com/sirgallo/raft/pkg/utils"
 		method: POST
 
 		request body:
-			{
-				action: "string",
-				payload: {
-					collection: "string",
-					value: "string"
+			the command for the state machine, which is opaque to raft. For the default collection store:
+				{
+					action: "string",
+					payload: {
+						collection: "string",
+						value: "string"
+					}
 				}
-			}
 
 		response body:
-			{
-				collection: "string",
-				key: "string" | nil,
-				value: "string" | nil
-			}
+			the result returned by the state machine for the command. For the default collection store:
+				{
+					collection: "string",
+					key: "string" | nil,
+					value: "string" | nil,
+					error: "string" | nil
+				}
 
 	ingest requests and pass from the HTTP Service to the replicated log service if leader,
 	or the relay service if a follower.
-		1.) append a both a unique identifier for the request as well as the current node that the request was sent to.
+		1.) wrap the command with a unique identifier for the request, and whether or not the state machine classifies the
+			command as read only, so reads can be served by the leader without being appended to the replicated log.
+			if tracing is enabled, the trace context for the command is also attached, continuing the trace from an incoming
+			traceparent header if present, so it can be followed through the replicated log and state machine
 		2.) a channel for the request to be returned is created and mapped to the request id in the mapping of response channels
 		2.) A context with timeout is initialized and the route either receives the response back and returns to the client,
 			or the timeout is exceeded and failure is retuned to the client
@@ -44,47 +57,65 @@ import "github.com/sirgallo/raft/pkg/utils"
 
 func (reqService *RequestService) RegisterCommandRoute() {
 	handler := func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+
 		if r.Method == http.MethodPost { 
 			if reqService.CurrentSystem.State == system.Leader {
-				var requestData *statemachine.StateMachineOperation
-
-				decodeErr := json.NewDecoder(r.Body).Decode(&requestData)
-				if decodeErr != nil {
-					http.Error(w, "failed to parse JSON request body", http.StatusBadRequest)
+				command, readErr := io.ReadAll(r.Body)
+				if readErr != nil || len(command) == 0 {
+					http.Error(w, "failed to read command from request body", http.StatusBadRequest)
 					return
 				}
 
+				readOnly := statemachine.IsReadOnly(reqService.CurrentSystem.StateMachine, command)
+				
+				commandType := func() string {
+					if readOnly { return ReadCommand }
+					return WriteCommand
+				}()
+
+				defer metrics.HTTPRequestLatency.WithLabelValues(commandType).ObserveSince(requestStart)
+
+				commandSpan := tracing.StartSpan(CommandSpan, tracing.ParseTraceParent(r.Header.Get(tracing.TraceParentHeader)))
+				commandSpan.SetAttribute("raft.command_type", commandType)
+				commandSpan.SetAttribute("raft.command_bytes", len(command))
+				defer commandSpan.End()
+
 				hash, hashErr := utils.GenerateRandomSHA256Hash()
 				if hashErr != nil {
 					http.Error(w, "error producing hash for request id", http.StatusBadRequest)
 					return
 				}
 
-				clientResponseChannel := make(chan *statemachine.StateMachineResponse)
+				clientResponseChannel := make(chan *statemachine.Response)
 				reqService.ClientMappedResponseChannels.Store(hash, clientResponseChannel)
 
-				requestData.RequestID = hash
+				reqService.RequestChannel <- &statemachine.Command{
+					RequestID: hash,
+					TraceParent: commandSpan.SpanContext().TraceParent(),
+					ReadOnly: readOnly,
+					Data: command,
+				}
 
-				reqService.RequestChannel <- requestData
-				responseData :=<- clientResponseChannel
+				response :=<- clientResponseChannel
 
 				reqService.ClientMappedResponseChannels.Delete(hash)
 
-				response := &statemachine.StateMachineResponse{
-					Collection: responseData.Collection,
-					Key: responseData.Key,
-					Value: responseData.Value,
-				}
-
-				responseJSON, encErr := json.Marshal(response)
-				if encErr != nil {
-					http.Error(w, "Failed to encode JSON response", http.StatusInternalServerError)
+				if response.Error != utils.GetZero[string]() {
+					commandSpan.SetError(errors.New(response.Error))
+					http.Error(w, response.Error, http.StatusInternalServerError)
 					return
 				}
 
 				w.Header().Set("Content-Type", "application/json")
-				w.Write(responseJSON)
+				w.Write(response.Data)
 			} else {
+				defer metrics.HTTPRequestLatency.WithLabelValues(RedirectAction).ObserveSince(requestStart)
+
+				redirectSpan := tracing.StartSpan(RedirectSpan, tracing.ParseTraceParent(r.Header.Get(tracing.TraceParentHeader)))
+				redirectSpan.SetAttribute("raft.leader", reqService.CurrentSystem.CurrentLeader)
+				defer redirectSpan.End()
+
 				redirectRequest := func() (bool, error) {
 					if reqService.CurrentSystem.CurrentLeader != utils.GetZero[string]() {
 						location := func () string { 
@@ -101,6 +132,8 @@ func (reqService *RequestService) RegisterCommandRoute() {
 							Body:   r.Body,
 						}
 
+						if redirectSpan != nil { newReq.Header.Set(tracing.TraceParentHeader, redirectSpan.SpanContext().TraceParent()) }
+
 						client := &http.Client{}
 						resp, postErr := client.Do(newReq)
 						if postErr != nil { return false, postErr }
@@ -123,6 +156,7 @@ func (reqService *RequestService) RegisterCommandRoute() {
 
 				_, redirectErr := expBackoff.PerformBackoff(redirectRequest)
 				if redirectErr != nil { 
+					redirectSpan.SetError(redirectErr)
 					http.Error(w, "current leader not found", http.StatusInternalServerError)
 					return
 				}
@@ -131,4 +165,277 @@ func (reqService *RequestService) RegisterCommandRoute() {
 	}
 
 	reqService.Mux.HandleFunc(CommandRoute, handler)
-}
\ No newline at end of file
+}
+
+/*
+	Register Metrics Route
+		path: /metrics
+		method: GET
+
+		response body:
+			all raft telemetry in the prometheus text exposition format, to be scraped by prometheus
+			or any compatible collector
+*/
+
+func (reqService *RequestService) RegisterMetricsRoute() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", metrics.ContentType)
+			w.Write([]byte(metrics.DefaultRegistry.Expose()))
+		} else { http.Error(w, "method not allowed", http.StatusMethodNotAllowed) }
+	}
+
+	reqService.Mux.HandleFunc(MetricsRoute, handler)
+}
+
+/*
+	Register Log Level Route
+		path: /loglevel
+		method: GET | POST
+
+		request body (POST):
+			{
+				module: "string" | nil,
+				level: "debug" | "info" | "warn" | "error"
+			}
+
+		response body:
+			{
+				default: "string",
+				modules: { [module: string]: "string" }
+			}
+
+	adjust the minimum log level at runtime, either for a single module (for example "Replicated Log") or,
+	if no module is provided, the default level for all modules without their own level
+*/
+
+func (reqService *RequestService) RegisterLogLevelRoute() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var requestData *LogLevelRequest
+
+			decodeErr := json.NewDecoder(r.Body).Decode(&requestData)
+			if decodeErr != nil {
+				http.Error(w, "failed to parse JSON request body", http.StatusBadRequest)
+				return
+			}
+
+			setErr := func() error {
+				if requestData.Module == utils.GetZero[string]() { return clog.SetDefaultLevel(requestData.Level) }
+				return clog.SetLevel(requestData.Module, requestData.Level)
+			}()
+
+			if setErr != nil {
+				http.Error(w, setErr.Error(), http.StatusBadRequest)
+				return
+			}
+		} else if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		defaultLevel, moduleLevels := clog.GetLevels()
+		response := &LogLevelResponse{
+			Default: defaultLevel,
+			Modules: moduleLevels,
+		}
+
+		responseJSON, encErr := json.Marshal(response)
+		if encErr != nil {
+			http.Error(w, "Failed to encode JSON response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(responseJSON)
+	}
+
+	reqService.Mux.HandleFunc(LogLevelRoute, handler)
+}
+
+/*
+	Register Watch Route
+		path: /watch
+		method: GET
+
+		query parameters:
+			collection: "string" | nil --> only changes to the collection
+			prefix: "string" | nil --> only changes to keys starting with the prefix
+			fromIndex: number | nil --> replay changes from the log index before streaming new changes
+
+		response body:
+			a stream of server-sent events, one per change applied to the state machine, where the id is the log index of
+			the command that made the change and the event is the type of the change:
+				id: number
+				event: "insert" | "update" | "delete" | "drop"
+				data: {
+					index: number,
+					type: "string",
+					collection: "string",
+					key: "string" | nil,
+					value: json | nil,
+					version: number | nil
+				}
+
+	stream changes applied to the state machine on this system, in log order
+		1.) every system applies the same log, so watches are served by any system, including followers
+		2.) to resume a stream, pass the index after the last received event as fromIndex, or reconnect with the
+			Last-Event-ID header, which resumes after the last event id received. If the index is no longer in the change
+			history, 410 is returned and the client needs to read the current state before watching again
+		3.) a client that falls behind the stream is disconnected, and can resume the same way
+		4.) when the system restores its state machine from a snapshot, every stream is disconnected, and resuming from an index
+			at or before the snapshot returns 410, since the changes in the snapshot were never published
+*/
+
+func (reqService *RequestService) RegisterWatchRoute() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		changes := reqService.CurrentSystem.Changes
+		flusher, canFlush := w.(http.Flusher)
+		if changes == nil || ! canFlush {
+			http.Error(w, "watch not supported", http.StatusNotImplemented)
+			return
+		}
+
+		opts := watch.SubscribeOpts{
+			Collection: r.URL.Query().Get("collection"),
+			Prefix: r.URL.Query().Get("prefix"),
+		}
+
+		parseIndex := func(value string, offset int64) (*int64, error) {
+			if value == utils.GetZero[string]() { return nil, nil }
+
+			index, parseErr := strconv.ParseInt(value, 10, 64)
+			if parseErr != nil { return nil, parseErr }
+
+			index += offset
+			return &index, nil
+		}
+
+		var parseErr error
+		opts.FromIndex, parseErr = parseIndex(r.URL.Query().Get("fromIndex"), 0)
+		if opts.FromIndex == nil && parseErr == nil { opts.FromIndex, parseErr = parseIndex(r.Header.Get(LastEventIDHeader), 1) }
+
+		if parseErr != nil {
+			http.Error(w, "invalid index to watch from", http.StatusBadRequest)
+			return
+		}
+
+		sub, subErr := changes.Subscribe(opts)
+		if errors.Is(subErr, watch.ErrIndexCompacted) {
+			http.Error(w, subErr.Error(), http.StatusGone)
+			return
+		}
+
+		defer changes.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(WatchKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+				case <- r.Context().Done():
+					return
+				case <- keepAlive.C:
+					fmt.Fprint(w, ": keep-alive\n\n")
+					flusher.Flush()
+				case event, ok :=<- sub.Events:
+					if ! ok { 
+						if sub.Compacted {
+							reqService.Log.Warn("state machine restored from a snapshot, closing watch stream")
+						} else { reqService.Log.Warn("watch subscriber fell behind the change stream, closing stream") }
+
+						return
+					}
+
+					eventJSON, encErr := json.Marshal(event)
+					if encErr != nil { return }
+
+					fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Index, event.Type, eventJSON)
+					flusher.Flush()
+			}
+		}
+	}
+
+	reqService.Mux.HandleFunc(WatchRoute, handler)
+}
+
+/*
+	Register Snapshot Route
+		path: /snapshot
+		method: GET | POST
+
+		response body:
+			{
+				lastIncludedIndex: int64,
+				lastIncludedTerm: int64
+			}
+
+	on POST, snapshot the state machine and compact the replicated log on this node immediately, regardless of the
+	thresholds in the snapshot policy, and wait for the snapshot to complete. Any node can be snapshotted, since each
+	node snapshots independently. On GET, or once the snapshot completes, return the latest snapshot on the node, where
+	-1 means the node has no snapshot
+*/
+
+func (reqService *RequestService) RegisterSnapshotRoute() {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			reply := make(chan error, 1)
+
+			select {
+				case reqService.SnapshotRequestChannel <- reply:
+				case <- time.After(SnapshotTimeout):
+					http.Error(w, "snapshot already in progress", http.StatusServiceUnavailable)
+					return
+			}
+
+			select {
+				case snapshotErr := <- reply:
+					if snapshotErr != nil {
+						http.Error(w, snapshotErr.Error(), http.StatusInternalServerError)
+						return
+					}
+				case <- time.After(SnapshotTimeout):
+					http.Error(w, "timed out waiting for snapshot", http.StatusGatewayTimeout)
+					return
+			}
+		} else if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		snapshotEntry, getErr := reqService.CurrentSystem.WAL.GetSnapshot()
+		if getErr != nil {
+			http.Error(w, getErr.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := &SnapshotResponse{ LastIncludedIndex: -1, LastIncludedTerm: -1 }
+		if snapshotEntry != nil {
+			response.LastIncludedIndex = snapshotEntry.LastIncludedIndex
+			response.LastIncludedTerm = snapshotEntry.LastIncludedTerm
+			response.Codec = snapshotEntry.Codec
+		}
+
+		responseJSON, encErr := json.Marshal(response)
+		if encErr != nil {
+			http.Error(w, "Failed to encode JSON response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(responseJSON)
+	}
+
+	reqService.Mux.HandleFunc(SnapshotRoute, handler)
+}
@@ -21,16 +21,46 @@ type RequestService struct {
 
 	CurrentSystem *system.System
 	
-	RequestChannel chan *statemachine.StateMachineOperation
-	ResponseChannel chan *statemachine.StateMachineResponse
+	RequestChannel chan *statemachine.Command
+	ResponseChannel chan *statemachine.Response
 	ClientMappedResponseChannels sync.Map
+	SnapshotRequestChannel chan chan error
 
 	Log clog.CustomLog
 }
 
+type SnapshotResponse struct {
+	LastIncludedIndex int64 `json:"lastIncludedIndex"`
+	LastIncludedTerm int64 `json:"lastIncludedTerm"`
+	Codec string `json:"codec,omitempty"`
+}
+
+type LogLevelRequest struct {
+	Module string `json:"module"`
+	Level clog.LogLevel `json:"level"`
+}
+
+type LogLevelResponse struct {
+	Default clog.LogLevel `json:"default"`
+	Modules map[string]clog.LogLevel `json:"modules"`
+}
+
 
 const NAME = "HTTP Service"
 const CommandRoute = "/command"
+const MetricsRoute = "/metrics"
+const LogLevelRoute = "/loglevel"
+const WatchRoute = "/watch"
+const SnapshotRoute = "/snapshot"
+const RedirectAction = "redirect"
+const ReadCommand = "read"
+const WriteCommand = "write"
+
+const CommandSpan = "http.command"
+const RedirectSpan = "http.redirect"
 const RequestChannelSize = 1000000
 const ResponseChannelSize = 1000000
-const HTTPTimeout = 2 * time.Second
\ No newline at end of file
+const HTTPTimeout = 2 * time.Second
+const SnapshotTimeout = 5 * time.Minute
+const WatchKeepAliveInterval = 15 * time.Second
+const LastEventIDHeader = "Last-Event-ID"
\ No newline at end of file
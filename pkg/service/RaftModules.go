@@ -47,6 +47,9 @@ func (raft *RaftService) StartModules() {
 		go routine 4:
 			on signal from the replicated log module that a follower needs the most up
 			to date snapshot, signal the snapshot module to send to that follower
+		go routine 5:
+			on manual snapshot requests from the request module, signal the snapshot module
+			to snapshot, which replies to the request with the result
 */
 
 func (raft *RaftService) StartModulePassThroughs() {
@@ -80,7 +83,13 @@ func (raft *RaftService) StartModulePassThroughs() {
 
 	go func() {
 		for host := range raft.ReplicatedLog.SendSnapshotToSystemSignal {
-			raft.ReplicatedLog.SendSnapshotToSystemSignal <- host
+			raft.Snapshot.UpdateSnapshotForSystemSignal <- host
+		}
+	}()
+
+	go func() {
+		for reply := range raft.RequestService.SnapshotRequestChannel {
+			raft.Snapshot.ManualSnapshotSignal <- reply
 		}
 	}()
 }
\ No newline at end of file
@@ -12,6 +12,7 @@ import "github.com/sirgallo/raft/pkg/snapshot"
 import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
 import "github.com/sirgallo/raft/pkg/wal"
+import "github.com/sirgallo/raft/pkg/watch"
 
 
 //=========================================== Raft Service
@@ -23,17 +24,27 @@ var Log = clog.NewCustomLog(NAME)
 
 /*
 	initialize sub modules under the same raft service and link together
+		--> the wal is opened with the log store backend from the options, which is bolt if not provided
+		--> if no state machine is provided in the options, the default collection store is used
+		--> changes applied to the state machine are published to the change stream on the system, keeping the watch
+			history size from the options, or the default if not provided
+		--> the snapshot policy from the options is evaluated on every node, where unset thresholds use the defaults
 */
 
 func NewRaftService(opts RaftServiceOpts) *RaftService {
 	hostname, hostErr := os.Hostname()
 	if hostErr != nil { Log.Fatal("unable to get hostname") }
 
-	wal, walErr := wal.NewWAL()
-	if walErr != nil { Log.Fatal("unable to create or open WAL") }
+	wal, walErr := wal.NewWAL(opts.WAL)
+	if walErr != nil { Log.Fatal("unable to create or open WAL:", walErr.Error()) }
 
-	sm, smErr := statemachine.NewStateMachine()
-	if smErr != nil { Log.Fatal("unable to create or open State Machine") }
+	sm := opts.StateMachine
+	if sm == nil {
+		collectionStore, smErr := statemachine.NewCollectionStore()
+		if smErr != nil { Log.Fatal("unable to create or open State Machine") }
+
+		sm = collectionStore
+	}
 
 	currentSystem := &system.System{
 		Host: hostname,
@@ -45,6 +56,8 @@ func NewRaftService(opts RaftServiceOpts) *RaftService {
 		StateMachine: sm,
 	}
 
+	currentSystem.Changes = watch.NewChangeStream(opts.WatchHistorySize, currentSystem.LastApplied)
+
 	raft := &RaftService{
 		Protocol: opts.Protocol,
 		Systems: &sync.Map{},
@@ -53,6 +66,7 @@ func NewRaftService(opts RaftServiceOpts) *RaftService {
 
 	for _, sys := range opts.SystemsList {
 		sys.UpdateNextIndex(0)
+		sys.ResetMatchIndex()
 		sys.SetStatus(system.Ready)
 		
 		raft.Systems.Store(sys.Host, sys)
@@ -84,6 +98,7 @@ func NewRaftService(opts RaftServiceOpts) *RaftService {
 	snpOpts := &snapshot.SnapshotServiceOpts{
 		Port: opts.Ports.Snapshot,
 		ConnectionPool: snpConnPool,
+		Policy: opts.Snapshot,
 		CurrentSystem: currentSystem,
 		Systems: raft.Systems,
 	}
@@ -7,7 +7,9 @@ import "github.com/sirgallo/raft/pkg/request"
 import "github.com/sirgallo/raft/pkg/leaderelection"
 import "github.com/sirgallo/raft/pkg/replog"
 import "github.com/sirgallo/raft/pkg/snapshot"
+import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/wal"
 
 
 type RaftPortOpts struct {
@@ -22,6 +24,10 @@ type RaftServiceOpts struct {
 	Ports RaftPortOpts
 	SystemsList []*system.System
 	ConnPoolOpts connpool.ConnectionPoolOpts
+	StateMachine statemachine.StateMachine
+	WatchHistorySize int
+	WAL wal.WALOpts
+	Snapshot snapshot.SnapshotPolicy
 }
 
 type RaftService struct {
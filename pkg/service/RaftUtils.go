@@ -1,5 +1,7 @@
 package service
 
+import "github.com/sirgallo/raft/pkg/snapshot"
+import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/stats"
 
 
@@ -9,40 +11,68 @@ import "github.com/sirgallo/raft/pkg/stats"
 /*
 	Update RepLog On Startup:
 		on system startup or restart replay the WAL
-			1.) get the latest log from the WAL on disk
-			2.) update commit index to last log index from synced WAL --> WAL only contains committed logs
-			3.) update current term to term of last log
+			1.) get the applied index stored by the state machine, which is -1 if the state machine does not store it
+			2.) if there is a snapshot that is ahead of the applied index, restore the state machine from it and set the commit
+				index and last applied index to the last included index, so entries in the snapshot are not applied again
+			3.) otherwise, if the state machine already contains applied entries, keep its state and set the commit index and 
+				last applied index to the applied index, so entries the state machine already contains are not applied again
+			4.) compact the change stream up to the last applied index, since changes that were already applied are never
+				published
+			5.) get the total entries in the WAL on disk
+		
+		the commit index is not raised to the last log in the WAL, since the WAL also contains entries that were appended
+		but never committed, which a later leader may overwrite. Entries after the snapshot are committed and applied once
+		the commit index is raised by the leader, or by the leader itself once an entry from its term is replicated on a
+		majority of the cluster
 */
 
 func (raft *RaftService) UpdateRepLogOnStartup() (bool, error) {
 	snapshotEntry, snapshotErr := raft.CurrentSystem.WAL.GetSnapshot()
 	if snapshotErr != nil { return false, snapshotErr }
 
-	if snapshotEntry != nil { 
-		replayErr := raft.CurrentSystem.StateMachine.ReplaySnapshot(snapshotEntry.SnapshotFilePath) 
+	appliedIndex, appliedErr := statemachine.AppliedIndex(raft.CurrentSystem.StateMachine)
+	if appliedErr != nil { return false, appliedErr }
+
+	if snapshotEntry != nil && snapshotEntry.LastIncludedIndex > appliedIndex { 
+		replayErr := raft.ReplaySnapshot(snapshotEntry.SnapshotFilePath) 
 		if replayErr != nil { return false, replayErr }
+
+		appliedIndex = snapshotEntry.LastIncludedIndex
+
 		Log.Info("latest snapshot found and replayed successfully")
 	}
 
-	lastLog, latestErr := raft.CurrentSystem.WAL.GetLatest()
+	if appliedIndex > DefaultLastApplied {
+		raft.CurrentSystem.UpdateCommitIndex(appliedIndex)
+		raft.CurrentSystem.UpdateLastApplied(appliedIndex)
+		if raft.CurrentSystem.Changes != nil { raft.CurrentSystem.Changes.Compact(appliedIndex) }
 
-	if latestErr != nil {
-		return false, latestErr
-	} else if lastLog != nil {
-		raft.CurrentSystem.CommitIndex = lastLog.Index
-
-		applyErr := raft.ReplicatedLog.ApplyLogs()
-		if applyErr != nil { return false, applyErr }
+		Log.Info("resuming from applied index:", appliedIndex)
+	}
 
-		total, totalErr := raft.CurrentSystem.WAL.GetTotal()
-		if totalErr != nil { return false , totalErr }
+	total, totalErr := raft.CurrentSystem.WAL.GetTotal()
+	if totalErr != nil { return false , totalErr }
 
-		Log.Info("total entries on startup:", total)
-	}
+	Log.Info("total entries on startup:", total, "commit index:", raft.CurrentSystem.CommitIndex)
 
 	return true, nil
 }
 
+/*
+	Replay Snapshot:
+		open the latest snapshot file and restore the state machine from it, decompressed with the codec in the header of
+		the file as it is read
+*/
+
+func (raft *RaftService) ReplaySnapshot(snapshotPath string) error {
+	snapshotReader, _, openErr := snapshot.OpenSnapshot(snapshotPath)
+	if openErr != nil { return openErr }
+	
+	defer snapshotReader.Close()
+
+	return raft.CurrentSystem.StateMachine.Restore(snapshotReader)
+}
+
 func (raft *RaftService) InitStats() error {
 	initStatObj, calcErr := stats.CalculateCurrentStats()
 	if calcErr != nil {
@@ -1,15 +1,16 @@
 package snapshot
 
 import "context"
-import "errors"
 import "io"
 import "os"
-import "sync/atomic"
-import "sync"
+import "time"
 
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/snapshotrpc"
 import "github.com/sirgallo/raft/pkg/system"
 import "github.com/sirgallo/raft/pkg/stats"
+import "github.com/sirgallo/raft/pkg/utils"
 import "github.com/sirgallo/raft/pkg/wal"
 
 
@@ -18,38 +19,80 @@ import "github.com/sirgallo/raft/pkg/wal"
 
 /*
 	Snapshot the current state of of the state machine and the replicated log
-		1.) get the latest known log entry, to set on the snapshotrpc for last included index and term
+		1.) get the last applied log entry, to set on the snapshotrpc for last included index and term
 			of logs in the snapshot
+			--> only one snapshot is taken at a time, and there is nothing to snapshot until an entry is applied
+			--> applying entries is paused until the state machine is snapshotted, so the snapshot contains exactly 
+				the entries up to the last applied entry
 		2.) snapshot the current state machine 
-			--> since the db is a boltdb instance, we'll take a backup of the data and gzipped, returning 
-			the filepath where the snapshot is stored on the system as a reference
+			--> the state machine writes its full state to a new snapshot file, compressed with the codec from the
+			snapshot policy, returning the filepath where the snapshot is stored on the system as a reference
 		3.) set the snapshot entry in the replicated log db in an index
-			--> the entry contains last included index, last included term, and the filepath on the system
+			--> the entry contains last included index, last included term, the codec, and the filepath on the system
 				to the latest snapshot --> snapshots are stored durably and snapshot entry can be seen as a pointer
-		4.) broadcast the new snapshot to all other systems. so send the entry with the filepath and file compressed
-				to byte representation
-		5.) if the broadcast was successful, delete all logs in the replicated log up to the last included log
-			--> so we compact the log only when we know the broadcast received the minimum number of successful 
-				responses in the quorum
+			--> the file for the previous snapshot is removed once no stream to a follower is reading it
+		4.) delete all logs in the replicated log up to the last included log, and record the snapshot for the
+			snapshot policy
+
+	every system snapshots its own applied state independently, so the snapshot is not sent to other systems. The
+	leader only sends its latest snapshot to a follower that has fallen behind the first entry in its replicated log,
+	see Update Individual System
 */
 
-func (snpService *SnapshotService) Snapshot() error {
-	lastAppliedLog, readErr := snpService.CurrentSystem.WAL.Read(snpService.CurrentSystem.LastApplied)
-	if readErr != nil { return readErr }
+func (snpService *SnapshotService) Snapshot(trigger SnapshotTrigger) error {
+	snpService.SnapshotMutex.Lock()
+	defer snpService.SnapshotMutex.Unlock()
+
+	snpService.CurrentSystem.ApplyMutex.Lock()
+
+	lastAppliedLog, snapshotFile, codec, snapshotErr := func() (*log.LogEntry, string, SnapshotCodec, error) {
+		defer snpService.CurrentSystem.ApplyMutex.Unlock()
+
+		if snpService.CurrentSystem.LastApplied < 0 { return nil, utils.GetZero[string](), NoneCodec, ErrNoAppliedEntries }
+
+		lastAppliedLog, readErr := snpService.CurrentSystem.WAL.Read(snpService.CurrentSystem.LastApplied)
+		if readErr != nil { return nil, utils.GetZero[string](), NoneCodec, readErr }
+		if lastAppliedLog == nil { return nil, utils.GetZero[string](), NoneCodec, ErrNoAppliedEntries }
+
+		snpService.Log.Info("snapshot triggered by:", trigger)
+
+		snapshotStart := time.Now()
+
+		snapshotFile, codec, snapshotErr := snpService.snapshotStateMachine()
+		if snapshotErr != nil { return nil, utils.GetZero[string](), NoneCodec, snapshotErr }
+
+		metrics.SnapshotDuration.ObserveSince(snapshotStart)
+		return lastAppliedLog, snapshotFile, codec, nil
+	}()
 
-	snapshotFile, snapshotErr := snpService.CurrentSystem.StateMachine.SnapshotStateMachine()
 	if snapshotErr != nil { return snapshotErr }
 	
-	snpService.Log.Info("snapshot created with filepath:", snapshotFile)
+	snpService.Log.Info("snapshot created with filepath:", snapshotFile, "and codec:", codec)
+
+	snapshotInfo, statErr := os.Stat(snapshotFile)
+	if statErr != nil { return statErr }
+
+	metrics.SnapshotSizeBytes.Set(float64(snapshotInfo.Size()))
 
 	snapshotEntry := &wal.SnapshotEntry{
 		LastIncludedIndex: lastAppliedLog.Index,
 		LastIncludedTerm: lastAppliedLog.Term,
 		SnapshotFilePath: snapshotFile,
+		Codec: codec,
 	}
 
+	previousEntry, getErr := snpService.CurrentSystem.WAL.GetSnapshot()
+	if getErr != nil { return getErr }
+
 	setErr := snpService.CurrentSystem.WAL.SetSnapshot(snapshotEntry)
-	if setErr != nil { return setErr }
+	if setErr != nil { 
+		os.Remove(snapshotFile)
+		return setErr 
+	}
+
+	if previousEntry != nil && previousEntry.SnapshotFilePath != snapshotFile { 
+		snpService.retireSnapshotFile(previousEntry.SnapshotFilePath) 
+	}
 
 	snpService.Log.Debug("attempting to compact log from start to index:", lastAppliedLog.Index - 1)
 
@@ -61,35 +104,33 @@ func (snpService *SnapshotService) Snapshot() error {
 
 	snpService.Log.Debug("total bytes removed:", totBytesRem, "total keys removed:", totKeysRem)
 
-	initSnapShotRPC := &snapshotrpc.SnapshotChunk{
-		LastIncludedIndex: lastAppliedLog.Index,
-		LastIncludedTerm: lastAppliedLog.Term,
-		SnapshotFilePath: snapshotFile,
-	}
-
-	ok, rpcErr := snpService.BroadcastSnapshotRPC(initSnapShotRPC)
-	if rpcErr != nil { return rpcErr }
-	if ! ok { return errors.New("snapshot not received and processed by min followers") }
+	snpService.lastSnapshotIndex = lastAppliedLog.Index
+	snpService.lastSnapshotTime = time.Now()
+	metrics.SnapshotTriggers.WithLabelValues(trigger).Inc()
 
 	statObj, calcErr := stats.CalculateCurrentStats()
 	if calcErr != nil { return calcErr }
 
 	setStatErr := snpService.CurrentSystem.WAL.SetStat(*statObj)
 	if setStatErr != nil { return setStatErr }
-
-	snpService.CurrentSystem.SetStatus(system.Ready)
 	
 	return nil
 }
 
 /*
 	Update Individual System
-		when a node restarts and rejoins the cluster or a new node is added
+		when a follower has fallen behind the first entry in the replicated log of the leader, for example when a node
+		restarts and rejoins the cluster after the leader compacted its log or a new node is added
 			1.) set the node to send to busy so interactions with other followers continue
-			2.) create a snapshotrpc for the node that contains the last snapshot
-			2.) send the rpc to the node
-			3. if successful, update the next index for the node to the last included index
-				and set the system status to ready
+			2.) create a snapshotrpc for the node that contains the latest snapshot on the leader, with the total size and
+				sha256 checksum of the snapshot file so the follower can verify it
+				--> the snapshot file is held until the stream ends, so it is not removed if a newer snapshot is taken meanwhile
+			3.) stream the snapshot to the node with exponential backoff, where each retry resumes from the offset the follower 
+				has already written instead of the start of the file
+			4.) if successful, update the next index for the node to the entry after the last included index, so log
+				replication continues from the snapshot, and set the system status to ready
+			--> on failure, the system is also set back to ready, so the next AppendEntryRPC finds the follower behind 
+				and the snapshot is sent again
 */
 
 func (snpService *SnapshotService) UpdateIndividualSystem(host string) error {
@@ -97,76 +138,64 @@ func (snpService *SnapshotService) UpdateIndividualSystem(host string) error {
 	sys := s.(*system.System)
 
 	sys.SetStatus(system.Busy)
+	defer sys.SetStatus(system.Ready)
 
 	snpService.Log.Info("updating snapshot for system:", sys.Host)
 
-	snapshot, getErr := snpService.CurrentSystem.WAL.GetSnapshot()
+	snapshot, getErr := snpService.acquireLatestSnapshot()
 	if getErr != nil { 
 		snpService.Log.Error("error getting snapshot for system")
 		return getErr 
 	}
 
+	if snapshot == nil { return ErrNoSnapshot }
+
+	defer snpService.releaseSnapshotFile(snapshot.SnapshotFilePath)
+
+	checksum, totalSize, checksumErr := checksumSnapshotFile(snapshot.SnapshotFilePath)
+	if checksumErr != nil { return checksumErr }
+
 	snaprpc := &snapshotrpc.SnapshotChunk{
 		LastIncludedIndex: snapshot.LastIncludedIndex,
 		LastIncludedTerm: snapshot.LastIncludedTerm,
 		SnapshotFilePath: snapshot.SnapshotFilePath,
+		TotalSize: totalSize,
+		Checksum: checksum,
 	}
 
-	_, rpcErr := snpService.ClientSnapshotRPC(sys, snaprpc)
-	if rpcErr != nil { 
-		snpService.Log.Error("rpc error when sending snapshot:", rpcErr.Error())
-		return rpcErr
-	}
-
-	sys.UpdateNextIndex(snapshot.LastIncludedIndex)
-	sys.SetStatus(system.Ready)
+	offset := int64(0)
 
-	return nil
-}
+	maxRetries := SnapshotMaxRetries
+	expOpts := utils.ExpBackoffOpts{ MaxRetries: &maxRetries, TimeoutInMilliseconds: SnapshotRetryTimeoutInMilliseconds }
+	expBackoff := utils.NewExponentialBackoffStrat[*snapshotrpc.SnapshotStreamResponse](expOpts)
 
-/*
-	Shared Broadcast RPC function:
-		for requests to be broadcasted:
-			1.) send SnapshotRPCs in parallel to each follower in the cluster
-			2.) in each go routine handling each request, perform exponential backoff on failed requests until max retries
-			3.)
-				if err: remove system from system map and close all connections -- it has failed
-				if res:
-					if success:
-						--> update total successful replies
-			4.) if total successful responses are greater than minimum, return success, otherwise failed
-*/
+	streamSnapshot := func() (*snapshotrpc.SnapshotStreamResponse, error) {
+		res, sent, rpcErr := snpService.ClientSnapshotRPC(sys, snaprpc, offset)
+		if rpcErr != nil { 
+			snpService.Log.With("peer", sys.Host, "offset", sent).Warn("rpc error when sending snapshot:", rpcErr.Error())
+			offset = sent
+			return nil, rpcErr
+		}
 
-func (snpService *SnapshotService) BroadcastSnapshotRPC(snapshot *snapshotrpc.SnapshotChunk) (bool, error) {
-	aliveSystems, minResps := snpService.GetAliveSystemsAndMinSuccessResps()
-	successfulResps := int64(0)
+		if ! res.Success {
+			snpService.Log.With("peer", sys.Host, "offset", res.NextOffset).Warn("snapshot not installed, resuming from offset")
+			offset = res.NextOffset
+			return nil, ErrSnapshotNotInstalled
+		}
 
-	var snapshotWG sync.WaitGroup
+		return res, nil
+	}
 
-	for _, sys := range aliveSystems {
-		snapshotWG.Add(1)
-		go func (sys *system.System) {
-			defer snapshotWG.Done()
-	
-			res, rpcErr := snpService.ClientSnapshotRPC(sys, snapshot)
-			if rpcErr != nil { 
-				snpService.Log.Error("rpc error when sending snapshot:", rpcErr.Error())
-				return
-			}
-
-			if res.Success { atomic.AddInt64(&successfulResps, 1) }
-		}(sys)
+	_, streamErr := expBackoff.PerformBackoff(streamSnapshot)
+	if streamErr != nil { 
+		snpService.Log.Error("error sending snapshot:", streamErr.Error())
+		return streamErr
 	}
 
-	snapshotWG.Wait()
+	sys.UpdateNextIndex(snapshot.LastIncludedIndex + 1)
+	metrics.SnapshotsInstalled.Inc()
 
-	if successfulResps >= int64(minResps) {
-		snpService.Log.Info("minimum successful responses received on snapshot broadcast", successfulResps)
-		return true, nil
-	} else { 
-		snpService.Log.Warn("minimum successful responses not received on snapshot broadcast", successfulResps)
-		return false, nil 
-	}
+	return nil
 }
 
 /*
@@ -174,74 +203,93 @@ func (snpService *SnapshotService) BroadcastSnapshotRPC(snapshot *snapshotrpc.Sn
 		helper method for making individual rpc calls
 
 		a grpc stream is used here
-			--> open the file and read the snapshot file in chunks, passing the chunks into the snapshot stream channel
-			--> as new chunks enter the channel, send them to the target follower
-			--> close the snapshot stream when the file has been read, finish passing the rest of the chunks, 
-				and return the response from closing the stream
+			--> open the file at the offset to start from and read the snapshot file in chunks, sending each chunk to the
+				target follower with its offset in the file
+			--> the last chunk is marked as done and carries the checksum of the full file
+			--> close the snapshot stream when the file has been read, and return the response from closing the stream
+			--> the follower may close the stream early if the offset does not match what it has written, in which case the
+				response contains the offset to resume from
+		
+		along with the response, the offset of the end of the last chunk sent is returned, so a failed stream can be resumed
 */
 
-func (snpService *SnapshotService) ClientSnapshotRPC(sys *system.System, initSnapshotShotReq *snapshotrpc.SnapshotChunk) (*snapshotrpc.SnapshotStreamResponse, error) {
+func (snpService *SnapshotService) ClientSnapshotRPC(sys *system.System, initSnapshotShotReq *snapshotrpc.SnapshotChunk, offset int64) (*snapshotrpc.SnapshotStreamResponse, int64, error) {
 	conn, connErr := snpService.ConnectionPool.GetConnection(sys.Host, snpService.Port)
 	if connErr != nil {
 		snpService.Log.Error("Failed to connect to", sys.Host + snpService.Port, ":", connErr.Error())
-		return nil, connErr
+		return nil, offset, connErr
 	}
 
 	client := snapshotrpc.NewSnapshotServiceClient(conn)
 	stream, openStreamerr := client.StreamSnapshotRPC(context.Background())
-	if openStreamerr != nil { return nil, openStreamerr }
-	
-	snapshotStreamChannel := make(chan []byte, 100000)
+	if openStreamerr != nil { return nil, offset, openStreamerr }
 
-	go func() {
-		snpService.ReadSnapshotContentStream(initSnapshotShotReq.SnapshotFilePath, snapshotStreamChannel)
-		close(snapshotStreamChannel)
-	}()
+	sent := offset
+
+	sendSnapshotChunk := func(chunk []byte, chunkOffset int64) error {
+		done := chunkOffset + int64(len(chunk)) == initSnapshotShotReq.TotalSize
 
-	sendSnapshotChunk := func(chunk []byte) error {
 		snapshotWithChunk := &snapshotrpc.SnapshotChunk{
 			LastIncludedIndex: initSnapshotShotReq.LastIncludedIndex,
 			LastIncludedTerm: initSnapshotShotReq.LastIncludedTerm,
 			SnapshotFilePath: initSnapshotShotReq.SnapshotFilePath,
 			SnapshotChunk: chunk,
+			Offset: chunkOffset,
+			TotalSize: initSnapshotShotReq.TotalSize,
+			Done: done,
 		}
 
+		if done { snapshotWithChunk.Checksum = initSnapshotShotReq.Checksum }
+
 		streamErr := stream.Send(snapshotWithChunk)
 		if streamErr != nil { return streamErr }
 
+		sent = chunkOffset + int64(len(chunk))
 		return nil
 	}
-	
-	for chunk := range snapshotStreamChannel {
-		streamErr := sendSnapshotChunk(chunk)
-		if streamErr != nil { return nil, streamErr }
-	}
+
+	readErr := snpService.ReadSnapshotContentStream(initSnapshotShotReq.SnapshotFilePath, offset, sendSnapshotChunk)
+	if readErr != nil && readErr != io.EOF { return nil, sent, readErr }
 
 	res, resErr := stream.CloseAndRecv()
-	if resErr != nil { return nil, resErr }
+	if resErr != nil { return nil, sent, resErr }
 
-	snpService.Log.Debug("result from stream received for:", sys.Host, ",returning success")
-	return res, nil
+	snpService.Log.Debug("result from stream received for:", sys.Host, ",returning success:", res.Success)
+	return res, sent, nil
 }
 
 /*
 	Read Snapshot Content Stream
-		when sending the snapshot, read the current snapshot file in chunks to create a read stream
+		when sending the snapshot, read the current snapshot file in chunks starting at the offset to create a read stream
+			--> only the bytes read are passed on, so the last chunk is not padded to the chunk size
+			--> an empty snapshot file is sent as a single empty chunk, so the stream is still marked as done
+			--> if the follower closes the stream early, sending returns io.EOF and reading stops
 */
 
-func (snpService *SnapshotService) ReadSnapshotContentStream(snapshotFilePath string, snapshotStreamChannel chan []byte) error {
+func (snpService *SnapshotService) ReadSnapshotContentStream(snapshotFilePath string, offset int64, sendChunk func(chunk []byte, chunkOffset int64) error) error {
 	snapshotFile, openErr := os.Open(snapshotFilePath)
 	if openErr != nil { return openErr }
 
 	defer snapshotFile.Close()
 
+	_, seekErr := snapshotFile.Seek(offset, io.SeekStart)
+	if seekErr != nil { return seekErr }
+
+	buffer := make([]byte, ChunkSize)
+	chunkOffset := offset
+	sentChunk := false
+
 	for {
-		buffer := make([]byte, ChunkSize)
+		n, readErr := io.ReadFull(snapshotFile, buffer)
+		if n > 0 || (! sentChunk && readErr == io.EOF) {
+			sendErr := sendChunk(buffer[:n], chunkOffset)
+			if sendErr != nil { return sendErr }
 
-		_, readErr := snapshotFile.Read(buffer)
-		if readErr == io.EOF { return nil }
-		if readErr != nil { return readErr }
+			chunkOffset += int64(n)
+			sentChunk = true
+		}
 
-		snapshotStreamChannel <- buffer
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF { return nil }
+		if readErr != nil { return readErr }
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,170 @@
+package snapshot
+
+import "bufio"
+import "bytes"
+import "compress/gzip"
+import "io"
+import "os"
+
+import "github.com/klauspost/compress/zstd"
+import "github.com/pierrec/lz4/v4"
+
+
+//=========================================== Snapshot Codec
+
+
+/*
+	Snapshot files start with a header, followed by the state machine compressed with the codec named in the header:
+		magic (8 bytes) | codec name length (1 byte) | codec name
+
+	the state machine is compressed as it is written to the snapshot file and decompressed as it is read from the file,
+	so no uncompressed copy of the state machine is ever written to disk. Snapshot files without the header were written
+	before snapshots were compressed, and are read as the raw state machine
+*/
+
+
+/*
+	Parse Snapshot Codec
+		get the codec for a name, where an empty name uses the default codec
+*/
+
+func ParseSnapshotCodec(name string) (SnapshotCodec, error) {
+	switch name {
+		case "":
+			return DefaultSnapshotCodec, nil
+		case NoneCodec, GzipCodec, ZstdCodec, Lz4Codec:
+			return name, nil
+		default:
+			return NoneCodec, ErrUnknownSnapshotCodec
+	}
+}
+
+/*
+	New Snapshot Writer
+		write the header for the codec to the snapshot file, and return a writer that compresses everything written to it
+		into the file
+			--> the writer must be closed to flush the compressed stream, which does not close the file
+*/
+
+func NewSnapshotWriter(writer io.Writer, codec SnapshotCodec) (io.WriteCloser, error) {
+	_, parseErr := ParseSnapshotCodec(codec)
+	if parseErr != nil { return nil, parseErr }
+
+	header := append([]byte(SnapshotHeaderMagic), byte(len(codec)))
+	header = append(header, codec...)
+
+	_, headerErr := writer.Write(header)
+	if headerErr != nil { return nil, headerErr }
+
+	switch codec {
+		case GzipCodec:
+			return gzip.NewWriter(writer), nil
+		case ZstdCodec:
+			return zstd.NewWriter(writer)
+		case Lz4Codec:
+			return lz4.NewWriter(writer), nil
+		default:
+			return nopWriteCloser{ writer }, nil
+	}
+}
+
+/*
+	New Snapshot Reader
+		read the header of the snapshot file and return a reader that decompresses the state machine from the file with the
+		codec in the header, along with the codec
+			--> if the file does not start with the header, the file is read as is
+*/
+
+func NewSnapshotReader(reader io.Reader) (io.ReadCloser, SnapshotCodec, error) {
+	bufferedReader := bufio.NewReader(reader)
+
+	codec, headerErr := readSnapshotHeader(bufferedReader)
+	if headerErr != nil { return nil, NoneCodec, headerErr }
+
+	switch codec {
+		case GzipCodec:
+			gzipReader, gzipErr := gzip.NewReader(bufferedReader)
+			if gzipErr != nil { return nil, codec, gzipErr }
+
+			return gzipReader, codec, nil
+		case ZstdCodec:
+			zstdReader, zstdErr := zstd.NewReader(bufferedReader)
+			if zstdErr != nil { return nil, codec, zstdErr }
+
+			return zstdReader.IOReadCloser(), codec, nil
+		case Lz4Codec:
+			return io.NopCloser(lz4.NewReader(bufferedReader)), codec, nil
+		default:
+			return io.NopCloser(bufferedReader), codec, nil
+	}
+}
+
+/*
+	Open Snapshot
+		open a snapshot file and return a reader that decompresses the state machine from it
+			--> closing the reader also closes the file
+*/
+
+func OpenSnapshot(snapshotPath string) (io.ReadCloser, SnapshotCodec, error) {
+	snapshotFile, openErr := os.Open(snapshotPath)
+	if openErr != nil { return nil, NoneCodec, openErr }
+
+	snapshotReader, codec, readerErr := NewSnapshotReader(snapshotFile)
+	if readerErr != nil {
+		snapshotFile.Close()
+		return nil, codec, readerErr
+	}
+
+	return &snapshotFileReader{ ReadCloser: snapshotReader, file: snapshotFile }, codec, nil
+}
+
+/*
+	Snapshot File Codec
+		get the codec of a snapshot file from its header, without reading the rest of the file
+*/
+
+func SnapshotFileCodec(snapshotPath string) (SnapshotCodec, error) {
+	snapshotFile, openErr := os.Open(snapshotPath)
+	if openErr != nil { return NoneCodec, openErr }
+
+	defer snapshotFile.Close()
+
+	return readSnapshotHeader(bufio.NewReader(snapshotFile))
+}
+
+/*
+	Read Snapshot Header
+		peek at the start of the snapshot file for the magic, and if it is there, read the header and return the codec
+*/
+
+func readSnapshotHeader(reader *bufio.Reader) (SnapshotCodec, error) {
+	magic, peekErr := reader.Peek(len(SnapshotHeaderMagic))
+	if peekErr == io.EOF || (peekErr == nil && ! bytes.Equal(magic, []byte(SnapshotHeaderMagic))) { return NoneCodec, nil }
+	if peekErr != nil { return NoneCodec, peekErr }
+
+	_, discardErr := reader.Discard(len(SnapshotHeaderMagic))
+	if discardErr != nil { return NoneCodec, discardErr }
+
+	codecLength, lengthErr := reader.ReadByte()
+	if lengthErr != nil { return NoneCodec, lengthErr }
+
+	codecName := make([]byte, codecLength)
+
+	_, readErr := io.ReadFull(reader, codecName)
+	if readErr != nil { return NoneCodec, readErr }
+	if len(codecName) == 0 { return NoneCodec, ErrUnknownSnapshotCodec }
+
+	return ParseSnapshotCodec(string(codecName))
+}
+
+func (reader *snapshotFileReader) Close() error {
+	closeErr := reader.ReadCloser.Close()
+	closeFileErr := reader.file.Close()
+	if closeErr != nil { return closeErr }
+
+	return closeFileErr
+}
+
+func (writer nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package snapshot
+
+import "os"
+import "strconv"
+import "time"
+
+
+//=========================================== Snapshot Policy
+
+
+/*
+	Snapshot Policy
+		when a system snapshots its state machine and compacts its replicated log. The policy is evaluated by every system
+		in the cluster independently on the check interval, against its own applied entries and log
+			--> entries: snapshot once this many entries have been applied since the last snapshot
+			--> log size: snapshot once the replicated log is at least this many bytes
+			--> interval: snapshot once this much time has passed since the last snapshot
+
+		a snapshot is only triggered if at least one entry has been applied since the last snapshot. For each threshold, 0
+		uses the default and a negative value disables it, where the default log size is a fraction of the available disk
+		space from the latest system stats
+
+		the policy also sets the codec the state machine is compressed with when it is written to a snapshot, zstd by default
+*/
+
+func DefaultSnapshotPolicy() SnapshotPolicy {
+	return SnapshotPolicy{
+		Entries: SnapshotTriggerAppliedIndex,
+		Interval: DefaultSnapshotInterval,
+		CheckInterval: DefaultSnapshotCheckInterval,
+		Codec: DefaultSnapshotCodec,
+	}
+}
+
+/*
+	Policy From Env
+		read the snapshot policy from the environment, where unset values use the defaults
+			--> SNAPSHOT_ENTRIES: the number of entries applied since the last snapshot to trigger a snapshot
+			--> SNAPSHOT_LOG_SIZE: the size in bytes of the replicated log to trigger a snapshot
+			--> SNAPSHOT_INTERVAL: a duration, like 1h, since the last snapshot to trigger a snapshot
+			--> SNAPSHOT_CHECK_INTERVAL: a duration, like 10s, between evaluations of the policy
+			--> SNAPSHOT_CODEC: the codec to compress snapshots with, one of none, gzip, zstd, or lz4
+*/
+
+func PolicyFromEnv() (SnapshotPolicy, error) {
+	policy := SnapshotPolicy{}
+
+	entries := os.Getenv(SnapshotEntriesEnv)
+	if entries != "" {
+		parsedEntries, parseErr := strconv.ParseInt(entries, 10, 64)
+		if parseErr != nil { return policy, parseErr }
+
+		policy.Entries = parsedEntries
+	}
+
+	logSize := os.Getenv(SnapshotLogSizeEnv)
+	if logSize != "" {
+		parsedSize, parseErr := strconv.ParseInt(logSize, 10, 64)
+		if parseErr != nil { return policy, parseErr }
+
+		policy.LogSizeInBytes = parsedSize
+	}
+
+	interval := os.Getenv(SnapshotIntervalEnv)
+	if interval != "" {
+		parsedInterval, parseErr := time.ParseDuration(interval)
+		if parseErr != nil { return policy, parseErr }
+
+		policy.Interval = parsedInterval
+	}
+
+	checkInterval := os.Getenv(SnapshotCheckIntervalEnv)
+	if checkInterval != "" {
+		parsedInterval, parseErr := time.ParseDuration(checkInterval)
+		if parseErr != nil { return policy, parseErr }
+
+		policy.CheckInterval = parsedInterval
+	}
+
+	codec, parseErr := ParseSnapshotCodec(os.Getenv(SnapshotCodecEnv))
+	if parseErr != nil { return policy, parseErr }
+
+	policy.Codec = codec
+
+	return policy.WithDefaults(), nil
+}
+
+/*
+	With Defaults
+		fill in the thresholds that are 0 and an empty codec with the defaults
+*/
+
+func (policy SnapshotPolicy) WithDefaults() SnapshotPolicy {
+	defaults := DefaultSnapshotPolicy()
+
+	if policy.Entries == 0 { policy.Entries = defaults.Entries }
+	if policy.Interval == 0 { policy.Interval = defaults.Interval }
+	if policy.CheckInterval <= 0 { policy.CheckInterval = defaults.CheckInterval }
+	if policy.Codec == "" { policy.Codec = defaults.Codec }
+
+	return policy
+}
+
+/*
+	Evaluate
+		get the threshold that triggers a snapshot, if any, in order of entries, log size, and interval
+			--> the log size threshold passed is the threshold from the policy, or the default if the policy uses the default
+*/
+
+func (policy SnapshotPolicy) Evaluate(entriesSinceSnapshot int64, logSizeInBytes int64, logSizeThreshold int64, sinceSnapshot time.Duration) SnapshotTrigger {
+	if entriesSinceSnapshot <= 0 { return NoTrigger }
+
+	if policy.Entries > 0 && entriesSinceSnapshot >= policy.Entries { return EntriesTrigger }
+	if logSizeThreshold > 0 && logSizeInBytes >= logSizeThreshold { return LogSizeTrigger }
+	if policy.Interval > 0 && sinceSnapshot >= policy.Interval { return IntervalTrigger }
+
+	return NoTrigger
+}
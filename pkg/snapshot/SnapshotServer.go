@@ -2,6 +2,8 @@ package snapshot
 
 import "io"
 import "os"
+import "path/filepath"
+import "time"
 
 import "github.com/sirgallo/raft/pkg/snapshotrpc"
 import "github.com/sirgallo/raft/pkg/wal"
@@ -15,22 +17,49 @@ import "github.com/sirgallo/raft/pkg/wal"
 		grpc server implementation
 
 		as snapshot chunks enter the stream
-			1.) if first chunk, set the metadata for the snapshot (last included index, term, and file path) and open the file
-				to stream the compressed chunks into
-			2.) for each chunk, write to the snapshot file
-			3.) on stream end, break
-			4.) index the snapshot in the wal db
-			5.) compact the logs up to the last included log
-			6.) return a successful response to the leader
+			1.) if first chunk, set the metadata for the snapshot (last included index, term, and total size) and open the
+				temporary file in the snapshot directory of this system to stream the chunks into, at the offset of the chunk
+				--> if the offset can not be resumed from, close the stream early with the offset the leader should resume from
+			2.) for each chunk, check that it starts where the last chunk ended and write to the temporary file
+			3.) on the chunk marked done, break
+				--> if the stream ends before the last chunk, the temporary file is kept so the next stream can resume from it
+			4.) verify the size and sha256 checksum of the temporary file against the snapshot on the leader, and if they do not
+				match, remove the file and respond with an offset of 0 so the leader starts over
+			5.) if the snapshot indexed on this system already includes the last included index, the snapshot was resent after
+				a retry, so remove the temporary file and return a successful response without installing it
+				--> this is checked before the rename, since the snapshot file is named by its checksum, and the same snapshot
+					would otherwise replace the file that is already indexed
+			6.) rename the temporary file to the snapshot file, named by its checksum
+			7.) install the snapshot with the codec from the header of the file, restoring the state machine from it
+			8.) return a successful response to the leader
+
+		the leader only sends a snapshot when the follower has fallen behind the first entry in the leader's log
 */
 
 func (snpService *SnapshotService) StreamSnapshotRPC(stream snapshotrpc.SnapshotService_StreamSnapshotRPCServer) error {
-	var snapshotFile *os.File
+	var partialFile *os.File
+	var partialPath string
+	var written int64
 	
 	var lastIncludedIndex int64
 	var lastIncludedTerm int64
-	var snapshotFilePath string
-  var firstChunkReceived bool
+	var totalSize int64
+	var checksum string
+	var done bool
+
+	closePartialFile := func() {
+		if partialFile != nil { 
+			partialFile.Close()
+			partialFile = nil
+		}
+	}
+
+	defer closePartialFile()
+
+	resume := func(nextOffset int64) error {
+		snpService.Log.Warn("snapshot chunk out of order, requesting resume from offset:", nextOffset)
+		return stream.SendAndClose(&snapshotrpc.SnapshotStreamResponse{ Success: false, NextOffset: nextOffset })
+	}
 	
 	for {
 		snapshotChunk, streamErr := stream.Recv()
@@ -40,53 +69,92 @@ func (snpService *SnapshotService) StreamSnapshotRPC(stream snapshotrpc.Snapshot
 			return streamErr 
 		}
 
-		if ! firstChunkReceived {
-			snapshotFilePath = snapshotChunk.SnapshotFilePath
+		if partialFile == nil {
 			lastIncludedIndex = snapshotChunk.LastIncludedIndex
 			lastIncludedTerm = snapshotChunk.LastIncludedTerm
-			firstChunkReceived = true
-			
+			totalSize = snapshotChunk.TotalSize
+
 			var openErr error
-			snapshotFile, openErr = os.Create(snapshotFilePath)
+			partialFile, partialPath, written, openErr = openPartialSnapshot(snapshotChunk)
 			if openErr != nil { return openErr }
-			
-			defer snapshotFile.Close()
+			if partialFile == nil { return resume(written) }
 		}
 
-		_, writeErr := snapshotFile.Write(snapshotChunk.SnapshotChunk)
+		if snapshotChunk.Offset != written { return resume(written) }
+
+		n, writeErr := partialFile.Write(snapshotChunk.SnapshotChunk)
 		if writeErr != nil { 
 			snpService.Log.Error("error writing to snapshot file:", writeErr.Error())
 			return writeErr
 		}
+
+		written += int64(n)
+
+		if snapshotChunk.Done {
+			checksum = snapshotChunk.Checksum
+			done = true
+			break
+		}
 	}
 
-	snpService.Log.Info("snapshot written, updating index and compacting logs")
+	if ! done { 
+		snpService.Log.Warn("snapshot stream ended before the last chunk, keeping", written, "bytes to resume from")
+		return ErrIncompleteSnapshot
+	}
 
-	snapshotEntry := &wal.SnapshotEntry{
-		LastIncludedIndex: lastIncludedIndex,
-		LastIncludedTerm: lastIncludedTerm,
-		SnapshotFilePath: snapshotFilePath,
+	syncErr := partialFile.Sync()
+	if syncErr != nil { return syncErr }
+
+	closePartialFile()
+
+	received, receivedSize, checksumErr := checksumSnapshotFile(partialPath)
+	if checksumErr != nil { return checksumErr }
+
+	if received != checksum || receivedSize != totalSize {
+		snpService.Log.Error(ErrSnapshotChecksumMismatch.Error(), "removing snapshot and restarting stream")
+		os.Remove(partialPath)
+
+		return stream.SendAndClose(&snapshotrpc.SnapshotStreamResponse{ Success: false, NextOffset: 0 })
 	}
 
-	setErr := snpService.CurrentSystem.WAL.SetSnapshot(snapshotEntry)
-	if setErr != nil { 
-		snpService.Log.Error("error setting snapshot index:", setErr.Error())
-		return setErr 
+	indexedEntry, getErr := snpService.CurrentSystem.WAL.GetSnapshot()
+	if getErr != nil { return getErr }
+
+	if indexedEntry != nil && lastIncludedIndex <= indexedEntry.LastIncludedIndex {
+		snpService.Log.Warn("snapshot at", lastIncludedIndex, "already indexed at", indexedEntry.LastIncludedIndex, "removing received snapshot")
+		os.Remove(partialPath)
+
+		return stream.SendAndClose(&snapshotrpc.SnapshotStreamResponse{ Success: true, NextOffset: totalSize })
 	}
 
-	snpService.Log.Debug("attempting to compact from start to index:", lastIncludedIndex - 1)
+	snapshotFilePath := filepath.Join(filepath.Dir(partialPath), FileNamePrefix + "_" + checksum)
 
-	totBytesRem, totKeysRem, delErr := snpService.CurrentSystem.WAL.DeleteLogsUpToLastIncluded(lastIncludedIndex - 1)
-	if delErr != nil { 
-		snpService.Log.Error("error compacting logs:", delErr.Error())
-		return delErr 
+	renameErr := os.Rename(partialPath, snapshotFilePath)
+	if renameErr != nil { return renameErr }
+
+	codec, codecErr := SnapshotFileCodec(snapshotFilePath)
+	if codecErr != nil { return codecErr }
+
+	snpService.Log.Info("snapshot written and verified, installing snapshot with codec:", codec)
+
+	installErr := snpService.InstallSnapshot(&wal.SnapshotEntry{
+		LastIncludedIndex: lastIncludedIndex,
+		LastIncludedTerm: lastIncludedTerm,
+		SnapshotFilePath: snapshotFilePath,
+		Codec: codec,
+	})
+
+	if installErr != nil { 
+		snpService.Log.Error("error installing snapshot:", installErr.Error())
+		return installErr 
 	}
 
-	snpService.Log.Debug("total bytes removed:", totBytesRem, "total keys removed:", totKeysRem)
+	removeErr := removePartialSnapshots()
+	if removeErr != nil { snpService.Log.Warn("error removing partial snapshots:", removeErr.Error()) }
 
-	snpService.Log.Info("snapshot processed log compacted, returning successful response to leader")
+	snpService.Log.Info("snapshot installed, returning successful response to leader")
 
-	res := &snapshotrpc.SnapshotStreamResponse{ Success: true }
+	res := &snapshotrpc.SnapshotStreamResponse{ Success: true, NextOffset: totalSize }
 	retStreamErr := stream.SendAndClose(res)
 	if retStreamErr != nil { 
 		snpService.Log.Error("error sending and closing stream:", retStreamErr.Error())
@@ -94,4 +162,78 @@ func (snpService *SnapshotService) StreamSnapshotRPC(stream snapshotrpc.Snapshot
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+/*
+	Install Snapshot
+		replace the state of this system with a snapshot received from the leader
+			1.) take the snapshot lock, so the install does not interleave with a local snapshot, and the apply lock, so no
+				entries are applied to the state machine while it is replaced
+			2.) if the system has already applied the last included entry, the snapshot is stale, so remove it and keep the
+				current state
+				--> the file is never removed if it is the file of the indexed snapshot
+			3.) restore the state machine from the snapshot file, which swaps the state machine db for the snapshot
+			4.) index the snapshot in the wal db, and remove the file for the previous snapshot
+			5.) if the log contains the last included entry, compact the log up to it and keep the entries after it, since they
+				follow the snapshot. Otherwise the snapshot is ahead of or conflicts with the log, so discard the log entirely
+			6.) set the commit index and last applied index to the last included index, so applying resumes from the entry
+				after the snapshot, and compact the change stream up to the last included index, closing current watches
+			7.) record the snapshot for the snapshot policy, so the system does not snapshot again until new entries are applied
+*/
+
+func (snpService *SnapshotService) InstallSnapshot(snapshotEntry *wal.SnapshotEntry) error {
+	snpService.SnapshotMutex.Lock()
+	defer snpService.SnapshotMutex.Unlock()
+
+	snpService.CurrentSystem.ApplyMutex.Lock()
+	defer snpService.CurrentSystem.ApplyMutex.Unlock()
+
+	previousEntry, getErr := snpService.CurrentSystem.WAL.GetSnapshot()
+	if getErr != nil { return getErr }
+
+	if snapshotEntry.LastIncludedIndex <= snpService.CurrentSystem.LastApplied {
+		snpService.Log.Warn("snapshot at", snapshotEntry.LastIncludedIndex, "already applied, last applied is", snpService.CurrentSystem.LastApplied)
+		if previousEntry != nil && previousEntry.SnapshotFilePath == snapshotEntry.SnapshotFilePath { return nil }
+		
+		return os.Remove(snapshotEntry.SnapshotFilePath)
+	}
+
+	restoreErr := snpService.restoreStateMachine(snapshotEntry.SnapshotFilePath)
+	if restoreErr != nil { return restoreErr }
+
+	setErr := snpService.CurrentSystem.WAL.SetSnapshot(snapshotEntry)
+	if setErr != nil { return setErr }
+
+	if previousEntry != nil && previousEntry.SnapshotFilePath != snapshotEntry.SnapshotFilePath { 
+		snpService.retireSnapshotFile(previousEntry.SnapshotFilePath) 
+	}
+
+	includedEntry, readErr := snpService.CurrentSystem.WAL.Read(snapshotEntry.LastIncludedIndex)
+	if readErr != nil { return readErr }
+
+	if includedEntry != nil && includedEntry.Term == snapshotEntry.LastIncludedTerm {
+		snpService.Log.Debug("attempting to compact from start to index:", snapshotEntry.LastIncludedIndex - 1)
+
+		totBytesRem, totKeysRem, delErr := snpService.CurrentSystem.WAL.DeleteLogsUpToLastIncluded(snapshotEntry.LastIncludedIndex - 1)
+		if delErr != nil { return delErr }
+
+		snpService.Log.Debug("total bytes removed:", totBytesRem, "total keys removed:", totKeysRem)
+	} else {
+		totBytesRem, totKeysRem, truncateErr := snpService.CurrentSystem.WAL.TruncateFrom(0)
+		if truncateErr != nil { return truncateErr }
+
+		snpService.Log.Info("snapshot ahead of log, discarded log with total bytes:", totBytesRem, "total keys:", totKeysRem)
+	}
+
+	if snapshotEntry.LastIncludedIndex > snpService.CurrentSystem.CommitIndex { 
+		snpService.CurrentSystem.UpdateCommitIndex(snapshotEntry.LastIncludedIndex)
+	}
+
+	snpService.CurrentSystem.UpdateLastApplied(snapshotEntry.LastIncludedIndex)
+	if snpService.CurrentSystem.Changes != nil { snpService.CurrentSystem.Changes.Compact(snapshotEntry.LastIncludedIndex) }
+
+	snpService.lastSnapshotIndex = snapshotEntry.LastIncludedIndex
+	snpService.lastSnapshotTime = time.Now()
+
+	return nil
+}
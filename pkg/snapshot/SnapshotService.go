@@ -15,19 +15,31 @@ import "github.com/sirgallo/raft/pkg/utils"
 
 /*
 	create a new service instance with passable options
+	--> the snapshot policy from the options is filled in with the defaults, see SnapshotPolicy.go
+	--> the policy is evaluated from the latest snapshot on the system, if there is one
 */
 
 func NewSnapshotService(opts *SnapshotServiceOpts) *SnapshotService {
 	snpService := &SnapshotService{
 		Port: utils.NormalizePort(opts.Port),
 		ConnectionPool: opts.ConnectionPool,
+		Policy: opts.Policy.WithDefaults(),
 		CurrentSystem: opts.CurrentSystem,
 		Systems: opts.Systems,
-		SnapshotStartSignal: make(chan bool),
+		lastSnapshotIndex: DefaultLastSnapshotIndex,
+		lastSnapshotTime: time.Now(),
+		snapshotFileReaders: make(map[string]int),
+		retiredSnapshotFiles: make(map[string]bool),
+		SnapshotStartSignal: make(chan SnapshotTrigger),
+		ManualSnapshotSignal: make(chan chan error),
 		UpdateSnapshotForSystemSignal: make(chan string),
 		Log: *clog.NewCustomLog(NAME),
 	}
 
+	snapshotEntry, getErr := opts.CurrentSystem.WAL.GetSnapshot()
+	if getErr != nil { snpService.Log.Error("error getting latest snapshot:", getErr.Error()) }
+	if snapshotEntry != nil { snpService.lastSnapshotIndex = snapshotEntry.LastIncludedIndex }
+
 	return snpService
 }
 
@@ -55,16 +67,18 @@ func (snpService *SnapshotService) StartSnapshotService(listener *net.Listener)
 		separate go routines:
 			1.) attempt snapshot timer
 				--> wait for timer to drain, signal attempt snapshot, and reset timer
-			1.) snapshot signal
-				--> if current leader, snapshot the state machine and then signal complete 
-			2.) update snapshot for node
+			2.) snapshot signal
+				--> snapshot the state machine and compact the log for the trigger from the snapshot policy
+			3.) manual snapshot signal
+				--> snapshot the state machine and compact the log on request, and reply with the result
+			4.) update snapshot for node
 				--> if leader, send the latest snapshot on the system to the target follower
-			3.) attempt trigger snapshot
-				--> on interval, check if we can begin the snapshot process
+			5.) attempt trigger snapshot
+				--> on interval, evaluate the snapshot policy on every system, regardless of state
 */
 
 func (snpService *SnapshotService) StartSnapshotListener() {
-	snpService.AttemptSnapshotTimer = time.NewTimer(AttemptSnapshotInterval)
+	snpService.AttemptSnapshotTimer = time.NewTimer(snpService.Policy.CheckInterval)
 
 	timeoutChan := make(chan bool)
 
@@ -76,11 +90,15 @@ func (snpService *SnapshotService) StartSnapshotListener() {
 	}()
 
 	go func() {
-		for range snpService.SnapshotStartSignal {
-			if snpService.CurrentSystem.State == system.Leader { 
-				snapshotErr := snpService.Snapshot() 
-				if snapshotErr != nil { snpService.Log.Error("error snapshotting state and broadcasting to followers:", snapshotErr.Error()) }
-			}
+		for trigger := range snpService.SnapshotStartSignal {
+			snapshotErr := snpService.Snapshot(trigger)
+			if snapshotErr != nil { snpService.Log.Error("error snapshotting state machine:", snapshotErr.Error()) }
+		}
+	}()
+
+	go func() {
+		for reply := range snpService.ManualSnapshotSignal {
+			reply <- snpService.Snapshot(ManualTrigger)
 		}
 	}()
 
@@ -97,49 +115,55 @@ func (snpService *SnapshotService) StartSnapshotListener() {
 
 	go func() {
 		for range timeoutChan {
-			if snpService.CurrentSystem.State == system.Leader && snpService.CurrentSystem.Status != system.Busy {
-				_, attemptTriggerErr := snpService.AttemptTriggerSnapshot()
-				if attemptTriggerErr != nil { snpService.Log.Error("error attempting to snapshot:", attemptTriggerErr.Error()) }
-			}
+			_, attemptTriggerErr := snpService.AttemptTriggerSnapshot()
+			if attemptTriggerErr != nil { snpService.Log.Error("error attempting to snapshot:", attemptTriggerErr.Error()) }
 		}
 	}()
 }
 
 /*
 	Attempt Trigger Snapshot
-		if the size of the replicated log has exceeded the threshold determined dynamically by available space
-		in the current mount and the current node is the leader, trigger a snapshot event to take a snapshot of
-		the current state to store and broadcast to all followers, also pause the replicated log and let buffer 
-		until the snapshot is complete. If a snapshot is performed, calculate the current system stats to update the
-		dynamic threshold for snapshotting
+		evaluate the snapshot policy against the entries applied since the last snapshot, the size of the replicated log,
+		and the time since the last snapshot, and trigger a snapshot if any threshold is met
+			--> if a snapshot is already in progress, the policy is evaluated again on the next check
+			--> if the policy uses the default log size, the threshold is determined dynamically by the available space in
+				the current mount from the latest system stats
 */
 
-func (snpService *SnapshotService) AttemptTriggerSnapshot() (bool, error) {
+func (snpService *SnapshotService) AttemptTriggerSnapshot() (SnapshotTrigger, error) {
+	if ! snpService.SnapshotMutex.TryLock() { return NoTrigger, nil }
+
+	lastSnapshotIndex := snpService.lastSnapshotIndex
+	lastSnapshotTime := snpService.lastSnapshotTime
+
+	snpService.SnapshotMutex.Unlock()
+
 	bucketSizeInBytes, getSizeErr := snpService.CurrentSystem.WAL.GetBucketSizeInBytes()
 	if getSizeErr != nil { 
 		snpService.Log.Error("error fetching bucket size:", getSizeErr.Error())
-		return false, getSizeErr
+		return NoTrigger, getSizeErr
 	}
 
-	triggerSnapshot := func() bool { 
+	logSizeThreshold := snpService.Policy.LogSizeInBytes
+	if logSizeThreshold == 0 {
 		statsArr, getStatsErr := snpService.CurrentSystem.WAL.GetStats()
-		if statsArr == nil || getStatsErr != nil { return false }
+		if getStatsErr != nil { return NoTrigger, getStatsErr }
 
-		latestObj := statsArr[len(statsArr) - 1]
-		thresholdInBytes := latestObj.AvailableDiskSpaceInBytes / FractionOfAvailableSizeToTake // let's keep this small for now
+		if len(statsArr) > 0 {
+			latestObj := statsArr[len(statsArr) - 1]
+			logSizeThreshold = latestObj.AvailableDiskSpaceInBytes / FractionOfAvailableSizeToTake // let's keep this small for now
+		}
+	}
 
-		lastAppliedAtThreshold := bucketSizeInBytes >= thresholdInBytes
-		systemAbleToSnapshot := snpService.CurrentSystem.State == system.Leader && snpService.CurrentSystem.Status != system.Busy
-		return lastAppliedAtThreshold && systemAbleToSnapshot
-	}()
+	entriesSinceSnapshot := snpService.CurrentSystem.LastApplied - lastSnapshotIndex
+	trigger := snpService.Policy.Evaluate(entriesSinceSnapshot, bucketSizeInBytes, logSizeThreshold, time.Since(lastSnapshotTime))
 
-	if triggerSnapshot { 
-		snpService.CurrentSystem.SetStatus(system.Busy)
+	if trigger != NoTrigger { 
 		select {
-			case snpService.SnapshotStartSignal <- true:
+			case snpService.SnapshotStartSignal <- trigger:
 			default:
 		}
 	}
 
-	return true, nil
-}
\ No newline at end of file
+	return trigger, nil
+}
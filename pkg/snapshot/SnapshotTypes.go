@@ -1,5 +1,8 @@
 package snapshot
 
+import "errors"
+import "io"
+import "os"
 import "sync"
 import "time"
 
@@ -12,32 +15,103 @@ import "github.com/sirgallo/raft/pkg/system"
 type SnapshotServiceOpts struct {
 	Port int
 	ConnectionPool *connpool.ConnectionPool
+	Policy SnapshotPolicy
 
 	CurrentSystem *system.System
 	Systems *sync.Map
 }
 
+type SnapshotPolicy struct {
+	Entries int64
+	LogSizeInBytes int64
+	Interval time.Duration
+	CheckInterval time.Duration
+	Codec SnapshotCodec
+}
+
 type SnapshotService struct {
 	snapshotrpc.UnimplementedSnapshotServiceServer
 	Port string
 	ConnectionPool *connpool.ConnectionPool
+	Policy SnapshotPolicy
 
 	CurrentSystem *system.System
 	Systems *sync.Map
 
 	AttemptSnapshotTimer *time.Timer
+	SnapshotMutex sync.Mutex
+	lastSnapshotIndex int64
+	lastSnapshotTime time.Time
+	FileMutex sync.Mutex
+	snapshotFileReaders map[string]int
+	retiredSnapshotFiles map[string]bool
 
-	SnapshotStartSignal chan bool
+	SnapshotStartSignal chan SnapshotTrigger
+	ManualSnapshotSignal chan chan error
 	UpdateSnapshotForSystemSignal chan string
 	ProcessIncomingSnapshotSignal chan *snapshotrpc.SnapshotChunk
 
 	Log clog.CustomLog
 }
 
+type SnapshotTrigger = string
+
+type SnapshotCodec = string
+
+type snapshotFileReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+
+var ErrNoAppliedEntries = errors.New("no entries applied to the state machine to snapshot")
+var ErrNoSnapshot = errors.New("no snapshot on the system to send")
+var ErrSnapshotNotInstalled = errors.New("snapshot not installed by system")
+var ErrIncompleteSnapshot = errors.New("snapshot stream ended before the last chunk")
+var ErrSnapshotChecksumMismatch = errors.New("snapshot does not match the checksum from the leader")
+var ErrUnknownSnapshotCodec = errors.New("unknown snapshot codec, expected one of none, gzip, zstd, lz4")
+
+
 const NAME = "Snapshot"
+const SubDirectory = "raft/statemachine"
+const FileNamePrefix = "statemachine"
 const RPCTimeout = 200 * time.Millisecond
-const AttemptSnapshotInterval = 1 * time.Minute
 const SnapshotTriggerAppliedIndex = 10000
+const DefaultSnapshotInterval = 1 * time.Hour
+const DefaultSnapshotCheckInterval = 10 * time.Second
+const DefaultLastSnapshotIndex = -1
 
 const ChunkSize = 1000000	// we will stream 1MB chunks
-const FractionOfAvailableSizeToTake = 1000 // let's take consistent snapshots
\ No newline at end of file
+const PartialSnapshotSuffix = ".partial"
+const SnapshotMaxRetries = 5
+const SnapshotRetryTimeoutInMilliseconds = 100
+const FractionOfAvailableSizeToTake = 1000 // let's take consistent snapshots
+const SnapshotHeaderMagic = "RAFTSNAP"
+const DefaultSnapshotCodec = ZstdCodec
+
+const (
+	NoTrigger SnapshotTrigger = ""
+	EntriesTrigger SnapshotTrigger = "entries"
+	LogSizeTrigger SnapshotTrigger = "log_size"
+	IntervalTrigger SnapshotTrigger = "interval"
+	ManualTrigger SnapshotTrigger = "manual"
+)
+
+const (
+	NoneCodec SnapshotCodec = "none"
+	GzipCodec SnapshotCodec = "gzip"
+	ZstdCodec SnapshotCodec = "zstd"
+	Lz4Codec SnapshotCodec = "lz4"
+)
+
+const (
+	SnapshotEntriesEnv = "SNAPSHOT_ENTRIES"
+	SnapshotLogSizeEnv = "SNAPSHOT_LOG_SIZE"
+	SnapshotIntervalEnv = "SNAPSHOT_INTERVAL"
+	SnapshotCheckIntervalEnv = "SNAPSHOT_CHECK_INTERVAL"
+	SnapshotCodecEnv = "SNAPSHOT_CODEC"
+)
@@ -1,38 +1,25 @@
 package snapshot
 
-import "github.com/sirgallo/raft/pkg/system"
+import "crypto/sha256"
+import "encoding/hex"
+import "io"
+import "os"
+import "path/filepath"
+import "strconv"
 
+import "github.com/sirgallo/raft/pkg/snapshotrpc"
+import "github.com/sirgallo/raft/pkg/utils"
+import "github.com/sirgallo/raft/pkg/wal"
 
-//=========================================== Snapshot Utils
-
-
-/*
-	Get Alive Systems And Min Success Resps:
-		helper method for both determining the current alive systems in the cluster and also the minimum successful responses
-		needed for committing logs to the state machine
-
-		--> minimum is found by floor(total alive systems / 2) + 1
-*/
 
-func (snpService *SnapshotService) GetAliveSystemsAndMinSuccessResps() ([]*system.System, int) {
-	var aliveSystems []*system.System
-
-	snpService.Systems.Range(func(key, value interface{}) bool {
-		sys := value.(*system.System)
-		if sys.Status == system.Ready { aliveSystems = append(aliveSystems, sys) }
-
-		return true
-	})
+//=========================================== Snapshot Utils
 
-	totAliveSystems := len(aliveSystems) + 1
-	return aliveSystems, (totAliveSystems / 2) + 1
-}
 
 /*
 	Reset Attempt Snapshot Timer:
 		used to reset the attempt snapshot timer:
 			--> if unable to stop the timer, drain the timer
-			--> reset the timer with the heartbeat interval
+			--> reset the timer with the check interval from the snapshot policy
 */
 
 func (snpService *SnapshotService) resetAttemptSnapshotTimer() {
@@ -43,5 +30,215 @@ func (snpService *SnapshotService) resetAttemptSnapshotTimer() {
 		}
 	}
 
-	snpService.AttemptSnapshotTimer.Reset(AttemptSnapshotInterval)
-}
\ No newline at end of file
+	snpService.AttemptSnapshotTimer.Reset(snpService.Policy.CheckInterval)
+}
+
+/*
+	Snapshot State Machine
+		1.) generate the name for the snapshot file, which is the snapshot prefix and a unique id
+		2.) open a new file for the snapshot to be written to
+		3.) write the header for the codec from the snapshot policy, and have the state machine write its full state to the
+			file through the codec, so the state is compressed as it is written
+		4.) if successful, return the snapshot path and the codec
+*/
+
+func (snpService *SnapshotService) snapshotStateMachine() (string, SnapshotCodec, error) {
+	homedir, homeErr := os.UserHomeDir()
+	if homeErr != nil { return utils.GetZero[string](), NoneCodec, homeErr }
+
+	hash, hashErr := utils.GenerateRandomSHA256Hash()
+	if hashErr != nil { return utils.GetZero[string](), NoneCodec, hashErr }
+
+	snapshotPath := filepath.Join(homedir, SubDirectory, FileNamePrefix + "_" + hash)
+	codec := snpService.Policy.Codec
+
+	snapshotFile, fCreateErr := os.Create(snapshotPath)
+	if fCreateErr != nil { return utils.GetZero[string](), NoneCodec, fCreateErr }
+	
+	defer snapshotFile.Close()
+
+	snapshotWriter, writerErr := NewSnapshotWriter(snapshotFile, codec)
+	if writerErr != nil { return utils.GetZero[string](), NoneCodec, writerErr }
+
+	snapshotErr := snpService.CurrentSystem.StateMachine.Snapshot(snapshotWriter)
+	closeWriterErr := snapshotWriter.Close()
+	if snapshotErr != nil { return utils.GetZero[string](), NoneCodec, snapshotErr }
+	if closeWriterErr != nil { return utils.GetZero[string](), NoneCodec, closeWriterErr }
+
+	return snapshotPath, codec, nil
+}
+
+/*
+	Restore State Machine
+		open a snapshot file and have the state machine replace its full state with the state in the snapshot, decompressed
+		with the codec in the header of the file
+*/
+
+func (snpService *SnapshotService) restoreStateMachine(snapshotPath string) error {
+	snapshotReader, _, openErr := OpenSnapshot(snapshotPath)
+	if openErr != nil { return openErr }
+
+	defer snapshotReader.Close()
+
+	return snpService.CurrentSystem.StateMachine.Restore(snapshotReader)
+}
+
+/*
+	Checksum Snapshot File
+		get the hex encoded sha256 checksum and the size of a snapshot file, which the system receiving the snapshot uses to 
+		verify the file it wrote
+*/
+
+func checksumSnapshotFile(snapshotFilePath string) (string, int64, error) {
+	snapshotFile, openErr := os.Open(snapshotFilePath)
+	if openErr != nil { return utils.GetZero[string](), 0, openErr }
+
+	defer snapshotFile.Close()
+
+	hasher := sha256.New()
+
+	totalSize, copyErr := io.Copy(hasher, snapshotFile)
+	if copyErr != nil { return utils.GetZero[string](), 0, copyErr }
+
+	return hex.EncodeToString(hasher.Sum(nil)), totalSize, nil
+}
+
+/*
+	Open Partial Snapshot
+		open the temporary file that a snapshot being received is written to, in the snapshot directory of this system
+			1.) the file is named by the last included index, term, and total size of the snapshot, so a stream that failed
+				part way through can be resumed by the next stream for the same snapshot
+			2.) if the offset is 0, start the file over
+			3.) if the file already holds at least offset bytes, drop anything after the offset and continue writing from it
+			4.) otherwise the offset can not be resumed from, so return the size of the file, or 0 if it does not exist, as
+				the offset the leader should resume from, with no file
+*/
+
+func openPartialSnapshot(chunk *snapshotrpc.SnapshotChunk) (*os.File, string, int64, error) {
+	homedir, homeErr := os.UserHomeDir()
+	if homeErr != nil { return nil, utils.GetZero[string](), 0, homeErr }
+
+	partialName := FileNamePrefix + "_" + strconv.FormatInt(chunk.LastIncludedIndex, 10) + "_" + 
+		strconv.FormatInt(chunk.LastIncludedTerm, 10) + "_" + strconv.FormatInt(chunk.TotalSize, 10) + PartialSnapshotSuffix
+	partialPath := filepath.Join(homedir, SubDirectory, partialName)
+
+	if chunk.Offset == 0 {
+		mkdirErr := os.MkdirAll(filepath.Dir(partialPath), 0700)
+		if mkdirErr != nil { return nil, partialPath, 0, mkdirErr }
+
+		partialFile, createErr := os.Create(partialPath)
+		if createErr != nil { return nil, partialPath, 0, createErr }
+
+		return partialFile, partialPath, 0, nil
+	}
+
+	info, statErr := os.Stat(partialPath)
+	if os.IsNotExist(statErr) { return nil, partialPath, 0, nil }
+	if statErr != nil { return nil, partialPath, 0, statErr }
+	if info.Size() < chunk.Offset { return nil, partialPath, info.Size(), nil }
+
+	partialFile, openErr := os.OpenFile(partialPath, os.O_WRONLY, 0644)
+	if openErr != nil { return nil, partialPath, 0, openErr }
+
+	truncateErr := partialFile.Truncate(chunk.Offset)
+	if truncateErr != nil {
+		partialFile.Close()
+		return nil, partialPath, 0, truncateErr
+	}
+
+	_, seekErr := partialFile.Seek(chunk.Offset, io.SeekStart)
+	if seekErr != nil {
+		partialFile.Close()
+		return nil, partialPath, 0, seekErr
+	}
+
+	return partialFile, partialPath, chunk.Offset, nil
+}
+
+/*
+	Remove Partial Snapshots
+		once a snapshot is installed, remove the temporary files left by streams for older snapshots that never completed
+*/
+
+func removePartialSnapshots() error {
+	homedir, homeErr := os.UserHomeDir()
+	if homeErr != nil { return homeErr }
+
+	partialPaths, globErr := filepath.Glob(filepath.Join(homedir, SubDirectory, FileNamePrefix + "_*" + PartialSnapshotSuffix))
+	if globErr != nil { return globErr }
+
+	for _, partialPath := range partialPaths {
+		removeErr := os.Remove(partialPath)
+		if removeErr != nil && ! os.IsNotExist(removeErr) { return removeErr }
+	}
+
+	return nil
+}
+
+/*
+	Acquire Latest Snapshot
+		get the latest snapshot entry and hold its file for reading, so it is not removed while it is streamed to a follower
+			--> the entry is read under the file mutex, so a snapshot retired at the same time is either held here first or
+				has already been replaced by the newer entry
+*/
+
+func (snpService *SnapshotService) acquireLatestSnapshot() (*wal.SnapshotEntry, error) {
+	snpService.FileMutex.Lock()
+	defer snpService.FileMutex.Unlock()
+
+	snapshotEntry, getErr := snpService.CurrentSystem.WAL.GetSnapshot()
+	if getErr != nil { return nil, getErr }
+	if snapshotEntry == nil { return nil, nil }
+
+	snpService.snapshotFileReaders[snapshotEntry.SnapshotFilePath]++
+
+	return snapshotEntry, nil
+}
+
+/*
+	Release Snapshot File
+		stop holding a snapshot file, and remove it if it was retired while it was held and nothing else is reading it
+*/
+
+func (snpService *SnapshotService) releaseSnapshotFile(snapshotFilePath string) {
+	snpService.FileMutex.Lock()
+	defer snpService.FileMutex.Unlock()
+
+	snpService.snapshotFileReaders[snapshotFilePath]--
+	if snpService.snapshotFileReaders[snapshotFilePath] > 0 { return }
+
+	delete(snpService.snapshotFileReaders, snapshotFilePath)
+
+	if snpService.retiredSnapshotFiles[snapshotFilePath] {
+		delete(snpService.retiredSnapshotFiles, snapshotFilePath)
+		snpService.removeSnapshotFile(snapshotFilePath)
+	}
+}
+
+/*
+	Retire Snapshot File
+		once a newer snapshot is indexed, remove the file for the previous snapshot, or if a stream to a follower is still
+		reading it, remove it when the last stream releases it
+*/
+
+func (snpService *SnapshotService) retireSnapshotFile(snapshotFilePath string) {
+	snpService.FileMutex.Lock()
+	defer snpService.FileMutex.Unlock()
+
+	if snpService.snapshotFileReaders[snapshotFilePath] > 0 {
+		snpService.retiredSnapshotFiles[snapshotFilePath] = true
+		return
+	}
+
+	snpService.removeSnapshotFile(snapshotFilePath)
+}
+
+func (snpService *SnapshotService) removeSnapshotFile(snapshotFilePath string) {
+	removeErr := os.Remove(snapshotFilePath)
+	if removeErr != nil && ! os.IsNotExist(removeErr) { 
+		snpService.Log.Warn("unable to remove snapshot file", snapshotFilePath, ":", removeErr.Error()) 
+		return
+	}
+
+	snpService.Log.Debug("removed previous snapshot file:", snapshotFilePath)
+}
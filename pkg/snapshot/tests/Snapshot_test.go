@@ -0,0 +1,482 @@
+package snapshottest
+
+import "bytes"
+import "context"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/json"
+import "fmt"
+import "io"
+import "net"
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+import "time"
+import "google.golang.org/grpc"
+
+import "github.com/sirgallo/raft/pkg/connpool"
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/snapshot"
+import "github.com/sirgallo/raft/pkg/snapshotrpc"
+import "github.com/sirgallo/raft/pkg/statemachine"
+import "github.com/sirgallo/raft/pkg/system"
+import "github.com/sirgallo/raft/pkg/wal"
+
+
+func TestPolicyWithDefaults(t *testing.T) {
+	policy := snapshot.SnapshotPolicy{ LogSizeInBytes: -1, Interval: -1 }.WithDefaults()
+
+	if policy.Entries != snapshot.SnapshotTriggerAppliedIndex { t.Errorf("expected default entries, got %d", policy.Entries) }
+	if policy.LogSizeInBytes != -1 { t.Errorf("expected log size to stay disabled, got %d", policy.LogSizeInBytes) }
+	if policy.Interval != -1 { t.Errorf("expected interval to stay disabled, got %s", policy.Interval) }
+	if policy.CheckInterval != snapshot.DefaultSnapshotCheckInterval { t.Errorf("expected default check interval, got %s", policy.CheckInterval) }
+	if policy.Codec != snapshot.DefaultSnapshotCodec { t.Errorf("expected default codec, got %q", policy.Codec) }
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy := snapshot.SnapshotPolicy{ Entries: 100, Interval: time.Minute }.WithDefaults()
+
+	cases := []struct {
+		name string
+		entries int64
+		logSize int64
+		logSizeThreshold int64
+		since time.Duration
+		expected snapshot.SnapshotTrigger
+	}{
+		{ "no new entries", 0, 1000, 10, time.Hour, snapshot.NoTrigger },
+		{ "below thresholds", 10, 5, 10, time.Second, snapshot.NoTrigger },
+		{ "entries", 100, 5, 10, time.Second, snapshot.EntriesTrigger },
+		{ "log size", 10, 10, 10, time.Second, snapshot.LogSizeTrigger },
+		{ "log size disabled", 10, 10, 0, time.Second, snapshot.NoTrigger },
+		{ "interval", 1, 5, 10, time.Minute, snapshot.IntervalTrigger },
+	}
+
+	for _, c := range cases {
+		trigger := policy.Evaluate(c.entries, c.logSize, c.logSizeThreshold, c.since)
+		if trigger != c.expected { t.Errorf("%s: expected trigger %q, got %q", c.name, c.expected, trigger) }
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv(snapshot.SnapshotEntriesEnv, "500")
+	t.Setenv(snapshot.SnapshotLogSizeEnv, "-1")
+	t.Setenv(snapshot.SnapshotIntervalEnv, "30m")
+	t.Setenv(snapshot.SnapshotCheckIntervalEnv, "")
+	t.Setenv(snapshot.SnapshotCodecEnv, snapshot.Lz4Codec)
+
+	policy, policyErr := snapshot.PolicyFromEnv()
+	if policyErr != nil { t.Fatalf("error reading policy: %s", policyErr.Error()) }
+
+	if policy.Entries != 500 { t.Errorf("expected 500 entries, got %d", policy.Entries) }
+	if policy.LogSizeInBytes != -1 { t.Errorf("expected log size disabled, got %d", policy.LogSizeInBytes) }
+	if policy.Interval != 30 * time.Minute { t.Errorf("expected 30m interval, got %s", policy.Interval) }
+	if policy.CheckInterval != snapshot.DefaultSnapshotCheckInterval { t.Errorf("expected default check interval, got %s", policy.CheckInterval) }
+	if policy.Codec != snapshot.Lz4Codec { t.Errorf("expected lz4 codec, got %q", policy.Codec) }
+
+	t.Setenv(snapshot.SnapshotCodecEnv, "brotli")
+
+	_, codecErr := snapshot.PolicyFromEnv()
+	if codecErr != snapshot.ErrUnknownSnapshotCodec { t.Errorf("expected unknown codec error, got %v", codecErr) }
+
+	t.Setenv(snapshot.SnapshotCodecEnv, "")
+	t.Setenv(snapshot.SnapshotIntervalEnv, "soon")
+
+	_, invalidErr := snapshot.PolicyFromEnv()
+	if invalidErr == nil { t.Error("expected error for invalid interval") }
+}
+
+func TestSnapshotCodecs(t *testing.T) {
+	_, content := newTestSnapshotFile(t, TestSnapshotDocuments)
+
+	for _, codec := range []snapshot.SnapshotCodec{ snapshot.NoneCodec, snapshot.GzipCodec, snapshot.ZstdCodec, snapshot.Lz4Codec } {
+		snapshotFilePath := filepath.Join(t.TempDir(), "snapshot_" + codec)
+
+		snapshotFile, createErr := os.Create(snapshotFilePath)
+		if createErr != nil { t.Fatalf("error creating snapshot file: %s", createErr.Error()) }
+
+		snapshotWriter, writerErr := snapshot.NewSnapshotWriter(snapshotFile, codec)
+		if writerErr != nil { t.Fatalf("%s: error creating snapshot writer: %s", codec, writerErr.Error()) }
+
+		_, writeErr := snapshotWriter.Write(content)
+		if writeErr != nil { t.Fatalf("%s: error writing snapshot: %s", codec, writeErr.Error()) }
+
+		closeWriterErr := snapshotWriter.Close()
+		if closeWriterErr != nil { t.Fatalf("%s: error closing snapshot writer: %s", codec, closeWriterErr.Error()) }
+
+		snapshotFile.Close()
+
+		info, statErr := os.Stat(snapshotFilePath)
+		if statErr != nil { t.Fatalf("error reading snapshot file: %s", statErr.Error()) }
+		if codec != snapshot.NoneCodec && info.Size() >= int64(len(content)) {
+			t.Errorf("%s: expected snapshot smaller than %d bytes, got %d", codec, len(content), info.Size())
+		}
+
+		fileCodec, fileCodecErr := snapshot.SnapshotFileCodec(snapshotFilePath)
+		if fileCodecErr != nil { t.Fatalf("%s: error reading snapshot header: %s", codec, fileCodecErr.Error()) }
+		if fileCodec != codec { t.Errorf("expected codec %q in header, got %q", codec, fileCodec) }
+
+		assertSnapshotContent(t, snapshotFilePath, codec, content)
+	}
+
+	legacyFilePath := filepath.Join(t.TempDir(), "snapshot_legacy")
+	writeErr := os.WriteFile(legacyFilePath, content, 0600)
+	if writeErr != nil { t.Fatalf("error writing snapshot: %s", writeErr.Error()) }
+
+	assertSnapshotContent(t, legacyFilePath, snapshot.NoneCodec, content)
+
+	_, unknownErr := snapshot.NewSnapshotWriter(&bytes.Buffer{}, "brotli")
+	if unknownErr != snapshot.ErrUnknownSnapshotCodec { t.Errorf("expected unknown codec error, got %v", unknownErr) }
+}
+
+func TestStreamSnapshotRPC(t *testing.T) {
+	snapshotFilePath, content := newTestSnapshotFile(t, TestSnapshotDocuments)
+	if len(content) <= snapshot.ChunkSize * 2 { t.Fatalf("expected snapshot of more than 2 chunks, got %d bytes", len(content)) }
+	leader, follower, sys := newTestSnapshotServices(t)
+
+	sum := sha256.Sum256(content)
+	newReq := func(lastIncludedIndex int64, checksum string) *snapshotrpc.SnapshotChunk {
+		return &snapshotrpc.SnapshotChunk{
+			LastIncludedIndex: lastIncludedIndex,
+			LastIncludedTerm: 2,
+			SnapshotFilePath: snapshotFilePath,
+			TotalSize: int64(len(content)),
+			Checksum: checksum,
+		}
+	}
+
+	req := newReq(10, hex.EncodeToString(sum[:]))
+
+	t.Run("resume without partial", func(t *testing.T) {
+		res, _, rpcErr := leader.ClientSnapshotRPC(sys, req, snapshot.ChunkSize)
+		if rpcErr != nil { t.Fatalf("error sending snapshot: %s", rpcErr.Error()) }
+		if res.Success || res.NextOffset != 0 { t.Errorf("expected resume from 0, got success %t offset %d", res.Success, res.NextOffset) }
+	})
+
+	t.Run("resume after interrupted stream", func(t *testing.T) {
+		conn, connErr := leader.ConnectionPool.GetConnection(sys.Host, leader.Port)
+		if connErr != nil { t.Fatalf("error connecting: %s", connErr.Error()) }
+
+		stream, streamErr := snapshotrpc.NewSnapshotServiceClient(conn).StreamSnapshotRPC(context.Background())
+		if streamErr != nil { t.Fatalf("error opening stream: %s", streamErr.Error()) }
+
+		firstChunk := newReq(10, req.Checksum)
+		firstChunk.SnapshotChunk = content[:snapshot.ChunkSize]
+
+		sendErr := stream.Send(firstChunk)
+		if sendErr != nil { t.Fatalf("error sending chunk: %s", sendErr.Error()) }
+
+		_, closeErr := stream.CloseAndRecv()
+		if closeErr == nil { t.Fatal("expected error for stream without last chunk") }
+
+		res, sent, rpcErr := leader.ClientSnapshotRPC(sys, req, snapshot.ChunkSize)
+		if rpcErr != nil { t.Fatalf("error sending snapshot: %s", rpcErr.Error()) }
+		if ! res.Success { t.Fatalf("expected snapshot to be installed, resume from %d", res.NextOffset) }
+		if sent != int64(len(content)) { t.Errorf("expected %d bytes sent, got %d", len(content), sent) }
+
+		snapshotEntry, getErr := follower.CurrentSystem.WAL.GetSnapshot()
+		if getErr != nil { t.Fatalf("error getting snapshot: %s", getErr.Error()) }
+		if snapshotEntry.LastIncludedIndex != 10 || snapshotEntry.LastIncludedTerm != 2 { 
+			t.Errorf("unexpected snapshot entry: %+v", snapshotEntry) 
+		}
+
+		if filepath.Base(snapshotEntry.SnapshotFilePath) != snapshot.FileNamePrefix + "_" + req.Checksum {
+			t.Errorf("expected snapshot named by checksum, got %s", snapshotEntry.SnapshotFilePath)
+		}
+
+		installed, readErr := os.ReadFile(snapshotEntry.SnapshotFilePath)
+		if readErr != nil { t.Fatalf("error reading installed snapshot: %s", readErr.Error()) }
+		if ! bytes.Equal(installed, content) { t.Error("installed snapshot does not match") }
+
+		if follower.CurrentSystem.LastApplied != 10 || follower.CurrentSystem.CommitIndex != 10 {
+			t.Errorf("expected commit and last applied at 10, got %d and %d", follower.CurrentSystem.CommitIndex, follower.CurrentSystem.LastApplied)
+		}
+
+		assertDocuments(t, follower.CurrentSystem.StateMachine, TestSnapshotDocuments)
+
+		partials, _ := filepath.Glob(filepath.Join(filepath.Dir(snapshotEntry.SnapshotFilePath), "*" + snapshot.PartialSnapshotSuffix))
+		if len(partials) != 0 { t.Errorf("expected partial snapshots to be removed, got %v", partials) }
+	})
+
+	t.Run("resend installed snapshot", func(t *testing.T) {
+		res, _, rpcErr := leader.ClientSnapshotRPC(sys, req, 0)
+		if rpcErr != nil { t.Fatalf("error sending snapshot: %s", rpcErr.Error()) }
+		if ! res.Success { t.Fatalf("expected resent snapshot to succeed, resume from %d", res.NextOffset) }
+
+		snapshotEntry, _ := follower.CurrentSystem.WAL.GetSnapshot()
+		if snapshotEntry.LastIncludedIndex != 10 { t.Errorf("expected snapshot to stay at 10, got %d", snapshotEntry.LastIncludedIndex) }
+
+		installed, readErr := os.ReadFile(snapshotEntry.SnapshotFilePath)
+		if readErr != nil { t.Fatalf("expected indexed snapshot to remain: %s", readErr.Error()) }
+		if ! bytes.Equal(installed, content) { t.Error("indexed snapshot does not match") }
+
+		installErr := follower.InstallSnapshot(snapshotEntry)
+		if installErr != nil { t.Fatalf("error installing indexed snapshot: %s", installErr.Error()) }
+
+		_, statErr := os.Stat(snapshotEntry.SnapshotFilePath)
+		if statErr != nil { t.Errorf("expected indexed snapshot to remain after stale install: %s", statErr.Error()) }
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		mismatched := newReq(20, hex.EncodeToString(make([]byte, sha256.Size)))
+
+		res, _, rpcErr := leader.ClientSnapshotRPC(sys, mismatched, 0)
+		if rpcErr != nil { t.Fatalf("error sending snapshot: %s", rpcErr.Error()) }
+		if res.Success || res.NextOffset != 0 { t.Errorf("expected restart from 0, got success %t offset %d", res.Success, res.NextOffset) }
+
+		snapshotEntry, _ := follower.CurrentSystem.WAL.GetSnapshot()
+		if snapshotEntry.LastIncludedIndex != 10 { t.Errorf("expected snapshot to stay at 10, got %d", snapshotEntry.LastIncludedIndex) }
+	})
+}
+
+func newTestSnapshotServices(t *testing.T) (*snapshot.SnapshotService, *snapshot.SnapshotService, *system.System) {
+	homedir := t.TempDir()
+	t.Setenv("HOME", homedir)
+
+	for _, subDirectory := range []string{ wal.SubDirectory, statemachine.SubDirectory } {
+		mkdirErr := os.MkdirAll(filepath.Join(homedir, subDirectory), 0755)
+		if mkdirErr != nil { t.Fatalf("error creating directory: %s", mkdirErr.Error()) }
+	}
+
+	testWAL, walErr := wal.NewWAL(wal.WALOpts{})
+	if walErr != nil { t.Fatalf("error creating wal: %s", walErr.Error()) }
+
+	sm, smErr := statemachine.NewCollectionStore()
+	if smErr != nil { t.Fatalf("error creating collection store: %s", smErr.Error()) }
+
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil { t.Fatalf("error listening: %s", listenErr.Error()) }
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	follower := snapshot.NewSnapshotService(&snapshot.SnapshotServiceOpts{
+		Port: port,
+		CurrentSystem: &system.System{ 
+			Host: "follower", 
+			CommitIndex: -1, 
+			LastApplied: -1, 
+			WAL: testWAL, 
+			StateMachine: sm,
+		},
+	})
+
+	srv := grpc.NewServer()
+	snapshotrpc.RegisterSnapshotServiceServer(srv, follower)
+	go srv.Serve(listener)
+
+	leader := snapshot.NewSnapshotService(&snapshot.SnapshotServiceOpts{
+		Port: port,
+		ConnectionPool: connpool.NewConnectionPool(connpool.ConnectionPoolOpts{ MaxConn: 10 }),
+		CurrentSystem: &system.System{ Host: "leader", WAL: testWAL },
+	})
+
+	t.Cleanup(func() { 
+		srv.Stop()
+		testWAL.DB.Close()
+		sm.DB.Close()
+	})
+
+	return leader, follower, &system.System{ Host: "127.0.0.1" }
+}
+
+func TestSnapshotRemovesPreviousFile(t *testing.T) {
+	_, follower, _ := newTestSnapshotServices(t)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 10; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 })
+	}
+
+	appendErr := follower.CurrentSystem.WAL.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	var snapshotFiles []string
+	for _, lastApplied := range []int64{ 4, 8 } {
+		follower.CurrentSystem.UpdateLastApplied(lastApplied)
+
+		snapshotErr := follower.Snapshot(snapshot.ManualTrigger)
+		if snapshotErr != nil { t.Fatalf("error taking snapshot: %s", snapshotErr.Error()) }
+
+		snapshotEntry, getErr := follower.CurrentSystem.WAL.GetSnapshot()
+		if getErr != nil { t.Fatalf("error getting snapshot: %s", getErr.Error()) }
+
+		snapshotFiles = append(snapshotFiles, snapshotEntry.SnapshotFilePath)
+	}
+
+	homedir, _ := os.UserHomeDir()
+	remaining, globErr := filepath.Glob(filepath.Join(homedir, snapshot.SubDirectory, snapshot.FileNamePrefix + "_*"))
+	if globErr != nil { t.Fatalf("error listing snapshots: %s", globErr.Error()) }
+
+	if len(remaining) != 1 || remaining[0] != snapshotFiles[1] {
+		t.Errorf("expected only the latest snapshot %s to remain, got %v", snapshotFiles[1], remaining)
+	}
+}
+
+func TestInstallSnapshot(t *testing.T) {
+	snapshotFilePath, _ := newTestSnapshotFile(t, 1)
+	_, follower, _ := newTestSnapshotServices(t)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 16; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 2 })
+	}
+
+	appendErr := follower.CurrentSystem.WAL.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	install := func(lastIncludedIndex int64, lastIncludedTerm int64) string {
+		installPath := filepath.Join(t.TempDir(), "snapshot")
+
+		content, readErr := os.ReadFile(snapshotFilePath)
+		if readErr != nil { t.Fatalf("error reading snapshot: %s", readErr.Error()) }
+
+		writeErr := os.WriteFile(installPath, content, 0600)
+		if writeErr != nil { t.Fatalf("error writing snapshot: %s", writeErr.Error()) }
+
+		installErr := follower.InstallSnapshot(&wal.SnapshotEntry{ 
+			LastIncludedIndex: lastIncludedIndex, 
+			LastIncludedTerm: lastIncludedTerm, 
+			SnapshotFilePath: installPath,
+		})
+
+		if installErr != nil { t.Fatalf("error installing snapshot: %s", installErr.Error()) }
+		return installPath
+	}
+
+	var installedPath string
+
+	t.Run("log follows snapshot", func(t *testing.T) {
+		installedPath = install(10, 2)
+
+		earliest, _ := follower.CurrentSystem.WAL.GetEarliest()
+		latest, _ := follower.CurrentSystem.WAL.GetLatest()
+		if earliest.Index != 10 || latest.Index != 15 { t.Errorf("expected log from 10 to 15, got %d to %d", earliest.Index, latest.Index) }
+		if follower.CurrentSystem.LastApplied != 10 { t.Errorf("expected last applied at 10, got %d", follower.CurrentSystem.LastApplied) }
+
+		assertDocuments(t, follower.CurrentSystem.StateMachine, 1)
+	})
+
+	t.Run("stale snapshot", func(t *testing.T) {
+		installPath := install(5, 2)
+
+		_, statErr := os.Stat(installPath)
+		if ! os.IsNotExist(statErr) { t.Error("expected stale snapshot to be removed") }
+
+		snapshotEntry, _ := follower.CurrentSystem.WAL.GetSnapshot()
+		if snapshotEntry.LastIncludedIndex != 10 { t.Errorf("expected snapshot to stay at 10, got %d", snapshotEntry.LastIncludedIndex) }
+	})
+
+	t.Run("snapshot ahead of log", func(t *testing.T) {
+		install(20, 3)
+
+		_, statErr := os.Stat(installedPath)
+		if ! os.IsNotExist(statErr) { t.Error("expected previous snapshot to be removed") }
+
+		total, _ := follower.CurrentSystem.WAL.GetTotal()
+		if total != 0 { t.Errorf("expected log to be discarded, got %d entries", total) }
+
+		lastLogIndex, lastLogTerm, lastLogErr := follower.CurrentSystem.DetermineLastLogIdxAndTerm()
+		if lastLogErr != nil { t.Fatalf("error getting last log: %s", lastLogErr.Error()) }
+		if lastLogIndex != 20 || lastLogTerm != 3 { t.Errorf("expected last log at snapshot 20 term 3, got %d term %d", lastLogIndex, lastLogTerm) }
+
+		if follower.CurrentSystem.LastApplied != 20 || follower.CurrentSystem.CommitIndex != 20 {
+			t.Errorf("expected commit and last applied at 20, got %d and %d", follower.CurrentSystem.CommitIndex, follower.CurrentSystem.LastApplied)
+		}
+	})
+}
+
+func newTestSnapshotFile(t *testing.T, documents int) (string, []byte) {
+	homedir := t.TempDir()
+	t.Setenv("HOME", homedir)
+
+	mkdirErr := os.MkdirAll(filepath.Join(homedir, statemachine.SubDirectory), 0755)
+	if mkdirErr != nil { t.Fatalf("error creating state machine directory: %s", mkdirErr.Error()) }
+
+	sm, smErr := statemachine.NewCollectionStore()
+	if smErr != nil { t.Fatalf("error creating collection store: %s", smErr.Error()) }
+
+	defer sm.DB.Close()
+
+	commands := [][]byte{ encodeOperation(t, statemachine.CREATECOLLECTION, nil) }
+	for idx := 0; idx < documents; idx++ {
+		commands = append(commands, encodeOperation(t, statemachine.INSERT, testDocument(idx)))
+	}
+
+	results, applyErr := sm.Apply(commands)
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	for _, result := range results {
+		resp := decodeResponse(t, result)
+		if resp.Error != "" { t.Fatalf("error applying command: %s", resp.Error) }
+	}
+
+	var content bytes.Buffer
+	snapshotErr := sm.Snapshot(&content)
+	if snapshotErr != nil { t.Fatalf("error taking snapshot: %s", snapshotErr.Error()) }
+
+	snapshotFilePath := filepath.Join(t.TempDir(), "leader_snapshot")
+	writeErr := os.WriteFile(snapshotFilePath, content.Bytes(), 0600)
+	if writeErr != nil { t.Fatalf("error writing snapshot: %s", writeErr.Error()) }
+
+	return snapshotFilePath, content.Bytes()
+}
+
+func assertSnapshotContent(t *testing.T, snapshotFilePath string, codec snapshot.SnapshotCodec, content []byte) {
+	snapshotReader, readerCodec, openErr := snapshot.OpenSnapshot(snapshotFilePath)
+	if openErr != nil { t.Fatalf("%s: error opening snapshot: %s", codec, openErr.Error()) }
+
+	defer snapshotReader.Close()
+
+	if readerCodec != codec { t.Errorf("expected codec %q, got %q", codec, readerCodec) }
+
+	restored, readErr := io.ReadAll(snapshotReader)
+	if readErr != nil { t.Fatalf("%s: error reading snapshot: %s", codec, readErr.Error()) }
+	if ! bytes.Equal(restored, content) { t.Errorf("%s: expected restored snapshot to match the state machine", codec) }
+}
+
+func assertDocuments(t *testing.T, sm statemachine.StateMachine, documents int) {
+	for idx := 0; idx < documents; idx++ {
+		result, readErr := sm.Read(encodeOperation(t, statemachine.FIND, testDocument(idx)))
+		if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+
+		resp := decodeResponse(t, result)
+		if resp.Error != "" || len(resp.Value) == 0 { t.Errorf("expected document %d in restored state machine, got error %q", idx, resp.Error) }
+	}
+}
+
+func decodeResponse(t *testing.T, result []byte) *statemachine.StateMachineResponse {
+	var resp *statemachine.StateMachineResponse
+
+	decodeErr := json.Unmarshal(result, &resp)
+	if decodeErr != nil { t.Fatalf("error decoding response: %s", decodeErr.Error()) }
+
+	return resp
+}
+
+func testDocument(idx int) string {
+	return strings.Repeat(fmt.Sprintf("%05d", idx), TestDocumentSize / 5) // values are indexed, so keep them under the max bolt key size
+}
+
+func encodeOperation(t *testing.T, action statemachine.Action, value interface{}) []byte {
+	op := &statemachine.StateMachineOperation{
+		Action: action,
+		Payload: statemachine.StateMachineOpPayload{ Collection: "snapshots" },
+	}
+
+	if value != nil {
+		encodedValue, encErr := json.Marshal(value)
+		if encErr != nil { t.Fatalf("error encoding value: %s", encErr.Error()) }
+
+		op.Payload.Value = encodedValue
+	}
+
+	encoded, encErr := json.Marshal(op)
+	if encErr != nil { t.Fatalf("error encoding operation: %s", encErr.Error()) }
+
+	return encoded
+}
+
+
+const TestDocumentSize = 16000
+const TestSnapshotDocuments = 200 // enough documents for a snapshot of more than 2 chunks
@@ -1,10 +1,13 @@
 package statemachine
 
+import "errors"
 import "os"
 import "path/filepath"
+import "time"
 import bolt "go.etcd.io/bbolt"
 
 import "github.com/sirgallo/raft/pkg/logger"
+import "github.com/sirgallo/raft/pkg/metrics"
 
 
 //=========================================== State Machine
@@ -14,14 +17,90 @@ var Log = clog.NewCustomLog(NAME)
 
 
 /*
-	State Machine
+	Is Read Only:
+		a command is only served outside of the replicated log if the state machine classifies it as read only
+*/
+
+func IsReadOnly(sm StateMachine, command []byte) bool {
+	classifier, ok := sm.(ReadOnlyClassifier)
+	return ok && classifier.IsReadOnly(command)
+}
+
+/*
+	Apply Commands:
+		apply a batch of commands from the log, along with the changes made by each command if the state machine
+		reports them. State machines that do not implement the command applier are only passed the command data
+*/
+
+func ApplyCommands(sm StateMachine, commands []*Command) ([][]byte, [][]*Change, error) {
+	applier, ok := sm.(CommandApplier)
+	if ok { return applier.ApplyCommands(commands) }
+
+	data := make([][]byte, len(commands))
+	for idx, command := range commands {
+		data[idx] = command.Data
+	}
+
+	results, applyErr := sm.Apply(data)
+	if applyErr != nil { return nil, nil, applyErr }
+
+	return results, make([][]*Change, len(commands)), nil
+}
+
+/*
+	Is Command Error:
+		whether an error from applying commands was caused by a command, and not by the system applying it
+*/
+
+func IsCommandError(err error) bool {
+	var commandErr *CommandError
+	return errors.As(err, &commandErr)
+}
+
+func (err *CommandError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *CommandError) Unwrap() error {
+	return err.Err
+}
+
+/*
+	Expire Command:
+		get the command to append to the log to expire data on the state machine, or nil if there is nothing to expire
+*/
+
+func ExpireCommand(sm StateMachine, now int64) []byte {
+	expirer, ok := sm.(Expirer)
+	if ! ok { return nil }
+
+	return expirer.ExpireCommand(now)
+}
+
+/*
+	Applied Index:
+		get the index of the last command applied to the state machine, or -1 if the state machine does not store it, in
+		which case every committed entry after the latest snapshot is applied on startup
+*/
+
+func AppliedIndex(sm StateMachine) (int64, error) {
+	indexer, ok := sm.(AppliedIndexer)
+	if ! ok { return NoAppliedIndex, nil }
+
+	return indexer.AppliedIndex()
+}
+
+/*
+	Collection Store
+		the default state machine, a document store of collections and indexes on top of bolt
 		1.) open the db using the filepath 
 		2.) create the root bucket for the state machine
 		3.) create the collections for both storing all collection names and index names
-			associated with the collection.
+			associated with the collection, and the buckets for document expiry and locks
+		4.) migrate the db to the current format version, see StateMachineFormat.go
 */
 
-func NewStateMachine() (*StateMachine, error) {
+func NewCollectionStore() (*CollectionStore, error) {
 	homedir, homeErr := os.UserHomeDir()
 	if homeErr != nil { return nil, homeErr }
 
@@ -39,6 +118,14 @@ func NewStateMachine() (*StateMachine, error) {
 		_, createColErr := rootBucket.CreateBucketIfNotExists(collectiontName)
 		if createColErr != nil { return createColErr }
 
+		expiryName := []byte(ExpiryBucket)
+		_, createExpiryErr := rootBucket.CreateBucketIfNotExists(expiryName)
+		if createExpiryErr != nil { return createExpiryErr }
+
+		lockName := []byte(LockBucket)
+		_, createLockErr := rootBucket.CreateBucketIfNotExists(lockName)
+		if createLockErr != nil { return createLockErr }
+
 		indexName := []byte(IndexBucket)
 		_, createIndexErr := rootBucket.CreateBucketIfNotExists(indexName)
 		if createIndexErr != nil { return createIndexErr }
@@ -48,8 +135,37 @@ func NewStateMachine() (*StateMachine, error) {
 	bucketErrInit := db.Update(initTransaction)
 	if bucketErrInit != nil { return nil, bucketErrInit }
 
-  return &StateMachine{ 
+	migrateErr := migrateFormat(db)
+	if migrateErr != nil { 
+		db.Close()
+		return nil, migrateErr 
+	}
+
+	return &CollectionStore{
 		DBFile: dbPath,
 		DB: db,
 	}, nil
+}
+
+/*
+	Timed Update, Timed View
+		wrap bolt read-write and read transactions to record the transaction duration
+			--> every transaction holds the db mutex shared, so restoring a snapshot waits for open transactions to finish
+				before the db is closed and swapped
+*/
+
+func (sm *CollectionStore) timedUpdate(transaction func(tx *bolt.Tx) error) error {
+	sm.Mutex.RLock()
+	defer sm.Mutex.RUnlock()
+
+	defer metrics.BoltTxDuration.WithLabelValues(FileNamePrefix, TxUpdate).ObserveSince(time.Now())
+	return sm.DB.Update(transaction)
+}
+
+func (sm *CollectionStore) timedView(transaction func(tx *bolt.Tx) error) error {
+	sm.Mutex.RLock()
+	defer sm.Mutex.RUnlock()
+
+	defer metrics.BoltTxDuration.WithLabelValues(FileNamePrefix, TxView).ObserveSince(time.Now())
+	return sm.DB.View(transaction)
 }
\ No newline at end of file
@@ -0,0 +1,174 @@
+package statemachine
+
+import "bytes"
+import "encoding/json"
+import "strings"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Collection
+
+
+/*
+	Create Collection
+		collections are created explicitly, with options that are stored as metadata in the collection bucket
+			--> indexes: secondary indexes to create along with the collection, which can be unique or multi-valued
+			--> max document size: the maximum size in bytes of a document in the collection, unlimited if 0
+			--> default ttl: the default time to live in seconds for documents in the collection, no expiry if 0
+
+		1.) validate the collection name and options
+		2.) if the collection already exists, creating it again with the same options is a no-op, but different options
+			is an error
+		3.) create the collection bucket and the index on the whole value, and register both in root
+		4.) create the secondary indexes from the options
+*/
+
+func (sm *CollectionStore) createCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	options := CollectionOptions{}
+	if payload.Options != nil { options = *payload.Options }
+
+	validationErr := validateCollection(payload.Collection, &options)
+	if validationErr != "" { return &StateMachineResponse{ Collection: payload.Collection, Error: validationErr }, nil }
+
+	existing := sm.getCollectionMetadata(bucket, payload.Collection)
+	if existing != nil {
+		if ! equalOptions(&existing.Options, &options) {
+			return &StateMachineResponse{ Collection: payload.Collection, Error: "collection already exists with different options" }, nil
+		}
+
+		return &StateMachineResponse{ Collection: payload.Collection, Value: encodeJSONString("exists") }, nil
+	}
+
+	collectionName := []byte(payload.Collection)
+
+	_, createErr := bucket.CreateBucketIfNotExists(collectionName)
+	if createErr != nil { return nil, createErr }
+
+	indexName, createIndexErr := sm.createIndex(bucket, payload.Collection)
+	if createIndexErr != nil { return nil, createIndexErr }
+
+	metadata, encErr := json.Marshal(&CollectionMetadata{ Name: payload.Collection, Options: options })
+	if encErr != nil { return nil, encErr }
+
+	collectionBucketName := []byte(CollectionBucket)
+	collectionBucket := bucket.Bucket(collectionBucketName)
+
+	putCollectionErr := collectionBucket.Put(collectionName, metadata)
+	if putCollectionErr != nil { return nil, putCollectionErr }
+
+	indexBucketName := []byte(IndexBucket)
+	indexBucket := bucket.Bucket(indexBucketName)
+
+	putIndexErr := indexBucket.Put(indexName, indexName)
+	if putIndexErr != nil { return nil, putIndexErr }
+
+	for _, indexOptions := range options.Indexes {
+		indexPayload := &StateMachineOpPayload{ Collection: payload.Collection, Field: indexOptions.Field, Unique: indexOptions.Unique }
+
+		_, createSecondaryErr := sm.createSecondaryIndex(bucket, indexPayload)
+		if createSecondaryErr != nil { return nil, createSecondaryErr }
+	}
+
+	return &StateMachineResponse{ Collection: payload.Collection, Value: encodeJSONString("created") }, nil
+}
+
+/*
+	Get Collection Metadata
+		get the metadata for a collection from the collection bucket, or nil if the collection does not exist
+			--> collections created before metadata was stored only have the collection name, so they have default options
+*/
+
+func (sm *CollectionStore) getCollectionMetadata(bucket *bolt.Bucket, collection string) *CollectionMetadata {
+	if collection == "" { return nil }
+
+	collectionBucketName := []byte(CollectionBucket)
+	collectionBucket := bucket.Bucket(collectionBucketName)
+
+	val := collectionBucket.Get([]byte(collection))
+	if val == nil { return nil }
+
+	return decodeCollectionMetadata(collection, val)
+}
+
+/*
+	List Collections
+		get the metadata for all collections, along with the number of documents and the names of all indexes
+*/
+
+func (sm *CollectionStore) listCollections(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	collections := []*CollectionInfo{}
+
+	collectionBucketName := []byte(CollectionBucket)
+	collectionBucket := bucket.Bucket(collectionBucketName)
+
+	cursor := collectionBucket.Cursor()
+
+	for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+		metadata := decodeCollectionMetadata(string(key), val)
+
+		info := &CollectionInfo{
+			Name: metadata.Name,
+			Indexes: []string{ metadata.Name + IndexSuffix },
+			Options: metadata.Options,
+		}
+
+		collection := bucket.Bucket(key)
+		if collection != nil { info.Documents = collection.Stats().KeyN }
+
+		definitions, getErr := sm.getSecondaryIndexes(bucket, metadata.Name)
+		if getErr != nil { return nil, getErr }
+
+		for _, definition := range definitions {
+			info.Indexes = append(info.Indexes, secondaryIndexName(definition.Collection, definition.Field))
+		}
+
+		collections = append(collections, info)
+	}
+
+	return &StateMachineResponse{ Collections: collections }, nil
+}
+
+/*
+	All functions below are helper functions for collections
+*/
+
+func validateCollection(collection string, options *CollectionOptions) string {
+	if collection == "" { return "collection required" }
+	if collection == RootBucket || collection == CollectionBucket || collection == IndexBucket || collection == ExpiryBucket || collection == LockBucket || collection == FormatVersionKey || collection == AppliedIndexKey {
+		return "collection name is reserved: " + collection
+	}
+	if strings.Contains(collection, IndexSuffix) { return "collection name cannot contain " + IndexSuffix }
+
+	if options.MaxDocumentSize < 0 { return "max document size cannot be negative" }
+	if options.DefaultTTLSeconds < 0 { return "default ttl cannot be negative" }
+
+	fields := make(map[string]bool)
+	for _, indexOptions := range options.Indexes {
+		if indexOptions == nil || indexOptions.Field == "" { return "field required for each index" }
+		if fields[indexOptions.Field] { return "duplicate index on field: " + indexOptions.Field }
+
+		fields[indexOptions.Field] = true
+	}
+
+	return ""
+}
+
+func equalOptions(existing *CollectionOptions, options *CollectionOptions) bool {
+	encodedExisting, _ := json.Marshal(existing)
+	encodedOptions, _ := json.Marshal(options)
+
+	return bytes.Equal(encodedExisting, encodedOptions)
+}
+
+func decodeCollectionMetadata(collection string, val []byte) *CollectionMetadata {
+	var metadata *CollectionMetadata
+
+	decodeErr := json.Unmarshal(val, &metadata)
+	if decodeErr != nil || metadata == nil { return &CollectionMetadata{ Name: collection } }
+
+	return metadata
+}
+
+func collectionNotFound(collection string) *StateMachineResponse {
+	return &StateMachineResponse{ Collection: collection, Error: "collection not found: " + collection }
+}
@@ -0,0 +1,182 @@
+package statemachine
+
+import "encoding/binary"
+import "encoding/json"
+import "strconv"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Expiry
+
+
+/*
+	Document Expiry
+		documents can be written with a time to live in seconds, or inherit the default time to live of their collection.
+		The expiry is the timestamp of the log entry that wrote the document plus the time to live, in unix milliseconds,
+		so it is the same on every system
+
+		each document with an expiry has an entry in the expiry bucket in root, where the key is:
+			the expiry as 8 big endian bytes, the length of the collection name as 4 big endian bytes, the collection name,
+			and the key of the document
+
+		so the expiry bucket is sorted by expiry, and all documents that are due are found at the start of the bucket
+*/
+
+func documentExpiry(payload *StateMachineOpPayload, metadata *CollectionMetadata, timestamp int64) (int64, string) {
+	if payload.TTLSeconds < 0 { return 0, "ttl cannot be negative" }
+
+	ttlSeconds := payload.TTLSeconds
+	if ttlSeconds == 0 { ttlSeconds = metadata.Options.DefaultTTLSeconds }
+	if ttlSeconds == 0 || timestamp == 0 { return 0, "" }
+
+	return timestamp + ttlSeconds * 1000, ""
+}
+
+/*
+	Expire Command
+		implements the expirer interface for the collection store. If the earliest expiry in the expiry bucket is due by
+		the clock of the leader, return an expire command to append to the log
+*/
+
+func (sm *CollectionStore) ExpireCommand(now int64) []byte {
+	isDue := false
+
+	transaction := func(tx *bolt.Tx) error {
+		rootName := []byte(RootBucket)
+		root := tx.Bucket(rootName)
+
+		expiry := root.Bucket([]byte(ExpiryBucket))
+		if expiry == nil { return nil }
+
+		first, _ := expiry.Cursor().First()
+		if first == nil { return nil }
+
+		expiresAt, _, _, ok := decodeExpiryKey(first)
+		isDue = ! ok || expiresAt <= now
+
+		return nil
+	}
+
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil {
+		Log.Error("error checking for expired documents:", viewErr.Error())
+		return nil
+	}
+
+	if ! isDue { return nil }
+
+	command, encErr := json.Marshal(&StateMachineOperation{ Action: EXPIRE })
+	if encErr != nil { return nil }
+
+	return command
+}
+
+/*
+	Expire Documents
+		delete the documents that expired at or before the timestamp of the expire command, in order of expiry, up to the
+		max number of documents per command. If more are due, the leader appends another expire command on its next check
+			--> entries for documents that were dropped along with their collection, or rewritten with a different expiry,
+				are removed without deleting anything
+			--> entries for locks release the lock, see StateMachineLock.go
+*/
+
+func (sm *CollectionStore) expireDocuments(bucket *bolt.Bucket, timestamp int64) (*StateMachineResponse, error) {
+	if timestamp == 0 { return &StateMachineResponse{ Error: "timestamp required to expire documents" }, nil }
+
+	response := &StateMachineResponse{ Value: json.RawMessage("0") }
+
+	expiry := bucket.Bucket([]byte(ExpiryBucket))
+	if expiry == nil { return response, nil }
+
+	var entries [][]byte
+	cursor := expiry.Cursor()
+
+	for entry, _ := cursor.First(); entry != nil && len(entries) < MaxExpiredPerCommand; entry, _ = cursor.Next() {
+		expiresAt, _, _, ok := decodeExpiryKey(entry)
+		if ok && expiresAt > timestamp { break }
+
+		entries = append(entries, copyBytes(entry))
+	}
+
+	expired := 0
+
+	for _, entry := range entries {
+		delErr := expiry.Delete(entry)
+		if delErr != nil { return nil, delErr }
+
+		expiresAt, collection, key, ok := decodeExpiryKey(entry)
+		if ! ok { continue }
+
+		if collection == LockBucket {
+			change, expireErr := sm.expireLock(bucket, key, expiresAt)
+			if expireErr != nil { return nil, expireErr }
+			if change == nil { continue }
+
+			response.changes = append(response.changes, change)
+			expired++
+			continue
+		}
+
+		collectionBucket := bucket.Bucket([]byte(collection))
+		if collectionBucket == nil { continue }
+
+		stored := collectionBucket.Get(key)
+		if stored == nil || decodeDocumentExpiry(stored) != expiresAt { continue }
+
+		removeResp, removeErr := sm.removeDocument(bucket, collection, key)
+		if removeErr != nil { return nil, removeErr }
+
+		for _, change := range removeResp.changes {
+			change.Type = ExpireChange
+			response.changes = append(response.changes, change)
+		}
+
+		expired++
+	}
+
+	response.Value = json.RawMessage(strconv.Itoa(expired))
+
+	return response, nil
+}
+
+/*
+	All functions below are helper functions for document expiry
+*/
+
+func putExpiryEntry(bucket *bolt.Bucket, collection string, key []byte, expiresAt int64) error {
+	if expiresAt == 0 { return nil }
+
+	expiry, createErr := bucket.CreateBucketIfNotExists([]byte(ExpiryBucket))
+	if createErr != nil { return createErr }
+
+	return expiry.Put(encodeExpiryKey(expiresAt, collection, key), []byte{})
+}
+
+func deleteExpiryEntry(bucket *bolt.Bucket, collection string, key []byte, expiresAt int64) error {
+	if expiresAt == 0 { return nil }
+
+	expiry := bucket.Bucket([]byte(ExpiryBucket))
+	if expiry == nil { return nil }
+
+	return expiry.Delete(encodeExpiryKey(expiresAt, collection, key))
+}
+
+func encodeExpiryKey(expiresAt int64, collection string, key []byte) []byte {
+	encoded := make([]byte, 12, 12 + len(collection) + len(key))
+	binary.BigEndian.PutUint64(encoded, uint64(expiresAt))
+	binary.BigEndian.PutUint32(encoded[8:], uint32(len(collection)))
+
+	encoded = append(encoded, collection...)
+	return append(encoded, key...)
+}
+
+func decodeExpiryKey(encoded []byte) (int64, string, []byte, bool) {
+	if len(encoded) < 12 { return 0, "", nil, false }
+
+	expiresAt := int64(binary.BigEndian.Uint64(encoded[:8]))
+	collectionLength := int(binary.BigEndian.Uint32(encoded[8:12]))
+	if len(encoded) < 12 + collectionLength { return 0, "", nil, false }
+
+	collection := string(encoded[12:12 + collectionLength])
+	return expiresAt, collection, encoded[12 + collectionLength:], true
+}
@@ -0,0 +1,187 @@
+package statemachine
+
+import "encoding/binary"
+import "errors"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Format
+
+
+/*
+	Format Version
+		the version of the on disk format of the collection store, stored under the format version key in the root bucket
+			--> 0: dbs written before the format was versioned, where documents may be stored as the raw json value, with a
+				header of only the version as 8 big endian bytes, or with the current header
+			--> 1: every document is stored with a header of the version and the expiry as 8 big endian bytes each, followed
+				by the json value
+			--> 2: entries in the index on the whole value are keyed by the json value and the document key, instead of only
+				the json value, so documents with the same value each have an entry
+
+	Migrate Format
+		bring the db up to the current format version, in a single transaction so a migration is never partially applied
+			1.) read the format version, where a db without the key is version 0
+			2.) a db written by a newer format version can not be read, so it is refused
+			3.) for version 0, rewrite every document with the current header
+			4.) for versions before 2, rebuild the index on the whole value of every collection from its documents
+			5.) set the format version to the current version
+
+		the db is migrated when it is opened and when it is restored from a snapshot, since the snapshot may have been taken
+		by a system running an older version
+*/
+
+func migrateFormat(db *bolt.DB) error {
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(RootBucket))
+		if bucket == nil || bucket.Bucket([]byte(CollectionBucket)) == nil { return ErrMissingRootBucket }
+
+		version := getFormatVersion(bucket)
+		if version > FormatVersion { return ErrUnsupportedFormatVersion }
+		if version == FormatVersion { return nil }
+
+		if version < DocumentHeaderFormatVersion {
+			rewriteErr := rewriteDocumentHeaders(bucket)
+			if rewriteErr != nil { return rewriteErr }
+		}
+
+		if version < WholeValueIndexFormatVersion {
+			rebuildErr := rebuildWholeValueIndexes(bucket)
+			if rebuildErr != nil { return rebuildErr }
+		}
+
+		return putFormatVersion(bucket, FormatVersion)
+	}
+
+	return db.Update(transaction)
+}
+
+/*
+	Check Format
+		for a db opened read only, which can not be migrated, check that the db is already at the current format version
+*/
+
+func checkFormat(tx *bolt.Tx) error {
+	bucket := tx.Bucket([]byte(RootBucket))
+	if bucket == nil { return ErrMissingRootBucket }
+
+	version := getFormatVersion(bucket)
+	if version > FormatVersion { return ErrUnsupportedFormatVersion }
+	if version < FormatVersion { return ErrFormatMigrationRequired }
+
+	return nil
+}
+
+/*
+	Rewrite Document Headers
+		rewrite every document in every collection that is not stored with the current header
+			--> documents are collected per collection and written after the cursor is done, since bolt does not support
+				writing to a bucket while iterating over it
+*/
+
+func rewriteDocumentHeaders(bucket *bolt.Bucket) error {
+	collections := getCollectionNames(bucket)
+
+	for _, name := range collections {
+		collection := bucket.Bucket(name)
+		if collection == nil { continue }
+
+		var keys [][]byte
+		var rewritten [][]byte
+
+		cursor := collection.Cursor()
+		for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+			upgraded, changed := upgradeStoredDocument(val)
+			if ! changed { continue }
+
+			keys = append(keys, copyBytes(key))
+			rewritten = append(rewritten, upgraded)
+		}
+
+		for idx, key := range keys {
+			putErr := collection.Put(key, rewritten[idx])
+			if putErr != nil { return putErr }
+		}
+
+		if len(keys) > 0 { Log.Info("rewrote", len(keys), "documents in collection", string(name), "to the current format") }
+	}
+
+	return nil
+}
+
+/*
+	Rebuild Whole Value Indexes
+		recreate the index on the whole value of every collection, with an entry for each document keyed by its value and key
+*/
+
+func rebuildWholeValueIndexes(bucket *bolt.Bucket) error {
+	collections := getCollectionNames(bucket)
+
+	for _, name := range collections {
+		collection := bucket.Bucket(name)
+		if collection == nil { continue }
+
+		indexName := append(copyBytes(name), IndexSuffix...)
+
+		delErr := bucket.DeleteBucket(indexName)
+		if delErr != nil && ! errors.Is(delErr, bolt.ErrBucketNotFound) { return delErr }
+
+		index, createErr := bucket.CreateBucket(indexName)
+		if createErr != nil { return createErr }
+
+		cursor := collection.Cursor()
+		for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+			_, value := decodeStoredDocument(val)
+
+			putErr := index.Put(wholeValueIndexKey(value, key), copyBytes(key))
+			if putErr != nil { return putErr }
+		}
+	}
+
+	return nil
+}
+
+/*
+	Upgrade Stored Document
+		detect the format of a document from before the format was versioned and encode it with the current header
+			--> a json value never starts with a zero byte, while a header always does, since versions are far below 2^56,
+				so a document that does not start with a zero byte is the raw json value, and is given version 1
+			--> in the current header, the expiry follows the version and also starts with a zero byte, so a document with a
+				header where the 9th byte is not zero has the json value directly after the version, with no expiry
+*/
+
+func upgradeStoredDocument(stored []byte) ([]byte, bool) {
+	if len(stored) == 0 { return nil, false }
+	if stored[0] != 0 { return encodeStoredDocument(1, 0, stored), true }
+
+	if len(stored) > VersionHeaderBytes && stored[VersionHeaderBytes] != 0 {
+		version := int64(binary.BigEndian.Uint64(stored[:VersionHeaderBytes]))
+		return encodeStoredDocument(version, 0, stored[VersionHeaderBytes:]), true
+	}
+
+	return nil, false
+}
+
+func getCollectionNames(bucket *bolt.Bucket) [][]byte {
+	var collections [][]byte
+
+	cursor := bucket.Bucket([]byte(CollectionBucket)).Cursor()
+	for name, _ := cursor.First(); name != nil; name, _ = cursor.Next() {
+		collections = append(collections, copyBytes(name))
+	}
+
+	return collections
+}
+
+func getFormatVersion(bucket *bolt.Bucket) int64 {
+	val := bucket.Get([]byte(FormatVersionKey))
+	if len(val) != 8 { return 0 }
+
+	return int64(binary.BigEndian.Uint64(val))
+}
+
+func putFormatVersion(bucket *bolt.Bucket, version int64) error {
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, uint64(version))
+
+	return bucket.Put([]byte(FormatVersionKey), val)
+}
@@ -0,0 +1,408 @@
+package statemachine
+
+import "bytes"
+import "encoding/binary"
+import "encoding/json"
+import "errors"
+import "math"
+import "strings"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Index
+
+
+/*
+	Secondary Indexes
+		documents are json values, and secondary indexes can be declared on fields of the documents in a collection
+		using a dot separated path, for example "address.city"
+
+		each secondary index is a bucket in root named <collection>_index_<field>, registered in the index bucket with
+		its definition. For every document that contains the indexed field, an entry is kept in the index where:
+			key --> the encoded value of the field, followed by the key of the document
+			value --> the key of the document
+
+		field values are encoded so that the byte order of the encoded values matches the order of the values themselves,
+		and so that an encoded value is never a prefix of another encoded value. So all documents with the same value for
+		a field are grouped together in the index, and can be found with a prefix scan on the encoded value:
+			null < false < true < numbers < strings
+
+		objects and arrays are not indexed, and neither are values that are not valid json
+*/
+
+/*
+	Create Secondary Index
+		1.) if the index already exists, creating it again with the same options is a no-op
+		2.) collect the index entries for all documents already in the collection. If the index is unique and two documents
+			have the same value for the field, the index is not created
+		3.) create the index bucket, register the definition in the index bucket, and backfill the index
+*/
+
+func (sm *CollectionStore) createSecondaryIndex(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	if payload.Field == "" { return &StateMachineResponse{ Collection: payload.Collection, Error: "field required to create index" }, nil }
+
+	indexName := []byte(secondaryIndexName(payload.Collection, payload.Field))
+	created := encodeJSONString("created")
+
+	indexBucketName := []byte(IndexBucket)
+	indexBucket := bucket.Bucket(indexBucketName)
+
+	if bucket.Bucket(indexName) != nil {
+		var existing *IndexDefinition
+		decodeErr := json.Unmarshal(indexBucket.Get(indexName), &existing)
+		if decodeErr != nil { return nil, decodeErr }
+		if existing != nil && existing.Unique != payload.Unique {
+			return &StateMachineResponse{ Collection: payload.Collection, Error: "index already exists on field with different options" }, nil
+		}
+
+		return &StateMachineResponse{ Collection: payload.Collection, Key: string(indexName), Value: created }, nil
+	}
+
+	collectionName := []byte(payload.Collection)
+	collection := bucket.Bucket(collectionName)
+
+	seen := make(map[string]bool)
+	var entries [][]byte
+	var entryKeys [][]byte
+
+	cursor := collection.Cursor()
+
+	for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+		_, value := decodeStoredDocument(val)
+
+		document, decodeErr := decodeDocument(value)
+		if decodeErr != nil { continue }
+
+		fieldValue, ok := extractField(document, payload.Field)
+		if ! ok { continue }
+
+		encoded, indexable := encodeIndexValue(fieldValue)
+		if ! indexable { continue }
+
+		if payload.Unique {
+			if seen[string(encoded)] {
+				return &StateMachineResponse{ Collection: payload.Collection, Error: "duplicate values exist for unique index on field: " + payload.Field }, nil
+			}
+
+			seen[string(encoded)] = true
+		}
+
+		entries = append(entries, append(encoded, key...))
+		entryKeys = append(entryKeys, append([]byte{}, key...))
+	}
+
+	index, createErr := bucket.CreateBucket(indexName)
+	if createErr != nil { return nil, createErr }
+
+	definition, encErr := json.Marshal(&IndexDefinition{ Collection: payload.Collection, Field: payload.Field, Unique: payload.Unique })
+	if encErr != nil { return nil, encErr }
+
+	putDefinitionErr := indexBucket.Put(indexName, definition)
+	if putDefinitionErr != nil { return nil, putDefinitionErr }
+
+	for idx, entry := range entries {
+		putErr := index.Put(entry, entryKeys[idx])
+		if putErr != nil { return nil, putErr }
+	}
+
+	return &StateMachineResponse{ Collection: payload.Collection, Key: string(indexName), Value: created }, nil
+}
+
+/*
+	Get Secondary Indexes
+		all secondary index definitions for a collection are registered in the index bucket under the
+		<collection>_index_ prefix
+*/
+
+func (sm *CollectionStore) getSecondaryIndexes(bucket *bolt.Bucket, collection string) ([]*IndexDefinition, error) {
+	var definitions []*IndexDefinition
+
+	indexBucketName := []byte(IndexBucket)
+	indexBucket := bucket.Bucket(indexBucketName)
+
+	prefix := []byte(collection + SecondaryIndexInfix)
+	cursor := indexBucket.Cursor()
+
+	for key, val := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, val = cursor.Next() {
+		var definition *IndexDefinition
+		decodeErr := json.Unmarshal(val, &definition)
+		if decodeErr != nil { return nil, decodeErr }
+		if definition.Collection != collection { continue }
+
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, nil
+}
+
+/*
+	Insert Into Secondary Indexes, Delete From Secondary Indexes
+		maintain all secondary indexes on a collection as documents are inserted and deleted
+*/
+
+func (sm *CollectionStore) insertIntoSecondaryIndexes(bucket *bolt.Bucket, collection string, key []byte, value []byte) error {
+	definitions, getErr := sm.getSecondaryIndexes(bucket, collection)
+	if getErr != nil { return getErr }
+	if len(definitions) == 0 { return nil }
+
+	document, decodeErr := decodeDocument(value)
+	if decodeErr != nil { return nil }
+
+	for _, definition := range definitions {
+		index := bucket.Bucket([]byte(secondaryIndexName(collection, definition.Field)))
+		if index == nil { continue }
+
+		putErr := putSecondaryIndexEntry(index, definition.Field, document, key)
+		if putErr != nil { return putErr }
+	}
+
+	return nil
+}
+
+func (sm *CollectionStore) deleteFromSecondaryIndexes(bucket *bolt.Bucket, collection string, key []byte, value []byte) error {
+	definitions, getErr := sm.getSecondaryIndexes(bucket, collection)
+	if getErr != nil { return getErr }
+	if len(definitions) == 0 { return nil }
+
+	document, decodeErr := decodeDocument(value)
+	if decodeErr != nil { return nil }
+
+	for _, definition := range definitions {
+		index := bucket.Bucket([]byte(secondaryIndexName(collection, definition.Field)))
+		if index == nil { continue }
+
+		fieldValue, ok := extractField(document, definition.Field)
+		if ! ok { continue }
+
+		encoded, indexable := encodeIndexValue(fieldValue)
+		if ! indexable { continue }
+
+		delErr := index.Delete(append(encoded, key...))
+		if delErr != nil { return delErr }
+	}
+
+	return nil
+}
+
+/*
+	Check Unique Indexes
+		before writing a document, check that no other document has the same value for any field with a unique index,
+		returning the first field that would be violated
+			--> the document being replaced under the same key does not count as a violation
+*/
+
+func (sm *CollectionStore) checkUniqueIndexes(bucket *bolt.Bucket, collection string, key []byte, value []byte) (string, error) {
+	definitions, getErr := sm.getSecondaryIndexes(bucket, collection)
+	if getErr != nil { return "", getErr }
+
+	document, decodeErr := decodeDocument(value)
+	if decodeErr != nil { return "", nil }
+
+	for _, definition := range definitions {
+		if ! definition.Unique { continue }
+
+		index := bucket.Bucket([]byte(secondaryIndexName(collection, definition.Field)))
+		if index == nil { continue }
+
+		fieldValue, ok := extractField(document, definition.Field)
+		if ! ok { continue }
+
+		encoded, indexable := encodeIndexValue(fieldValue)
+		if ! indexable { continue }
+
+		cursor := index.Cursor()
+
+		for indexKey, docKey := cursor.Seek(encoded); indexKey != nil && bytes.HasPrefix(indexKey, encoded); indexKey, docKey = cursor.Next() {
+			if ! bytes.Equal(docKey, key) { return definition.Field, nil }
+		}
+	}
+
+	return "", nil
+}
+
+/*
+	Drop Secondary Indexes
+		remove all secondary index buckets and definitions for a collection
+*/
+
+func (sm *CollectionStore) dropSecondaryIndexes(bucket *bolt.Bucket, collection string) error {
+	definitions, getErr := sm.getSecondaryIndexes(bucket, collection)
+	if getErr != nil { return getErr }
+
+	indexBucketName := []byte(IndexBucket)
+	indexBucket := bucket.Bucket(indexBucketName)
+
+	for _, definition := range definitions {
+		indexName := []byte(secondaryIndexName(collection, definition.Field))
+
+		delIndexErr := bucket.DeleteBucket(indexName)
+		if delIndexErr != nil && ! errors.Is(delIndexErr, bolt.ErrBucketNotFound) { return delIndexErr }
+
+		delDefinitionErr := indexBucket.Delete(indexName)
+		if delDefinitionErr != nil { return delDefinitionErr }
+	}
+
+	return nil
+}
+
+/*
+	Find By Field
+		find all documents in a collection where the field equals the value in the payload
+			--> if there is a secondary index on the field, do a prefix scan on the index for the encoded value
+			--> otherwise, scan the full collection and compare the field on each document
+*/
+
+func (sm *CollectionStore) findByField(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	response := &StateMachineResponse{ Collection: payload.Collection, Documents: []*Document{} }
+
+	collectionName := []byte(payload.Collection)
+	collection := bucket.Bucket(collectionName)
+	if collection == nil { return response, nil }
+
+	target, decodeErr := decodeDocument(payload.Value)
+	if decodeErr != nil { return &StateMachineResponse{ Collection: payload.Collection, Error: decodeErr.Error() }, nil }
+
+	encodedTarget, indexable := encodeIndexValue(target)
+	if ! indexable {
+		return &StateMachineResponse{ Collection: payload.Collection, Error: "only null, boolean, number, and string values can be queried by field" }, nil
+	}
+
+	index := bucket.Bucket([]byte(secondaryIndexName(payload.Collection, payload.Field)))
+
+	if index != nil {
+		cursor := index.Cursor()
+
+		for key, val := cursor.Seek(encodedTarget); key != nil && bytes.HasPrefix(key, encodedTarget); key, val = cursor.Next() {
+			documentValue := collection.Get(val)
+			if documentValue == nil { continue }
+
+			response.Documents = append(response.Documents, newDocument(val, documentValue))
+		}
+
+		return response, nil
+	}
+
+	cursor := collection.Cursor()
+
+	for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+		_, value := decodeStoredDocument(val)
+
+		document, decodeErr := decodeDocument(value)
+		if decodeErr != nil { continue }
+
+		fieldValue, ok := extractField(document, payload.Field)
+		if ! ok { continue }
+
+		encoded, indexable := encodeIndexValue(fieldValue)
+		if indexable && bytes.Equal(encoded, encodedTarget) { response.Documents = append(response.Documents, newDocument(key, val)) }
+	}
+
+	return response, nil
+}
+
+/*
+	All functions below are helper functions for secondary indexes
+*/
+
+func putSecondaryIndexEntry(index *bolt.Bucket, field string, document interface{}, key []byte) error {
+	fieldValue, ok := extractField(document, field)
+	if ! ok { return nil }
+
+	encoded, indexable := encodeIndexValue(fieldValue)
+	if ! indexable { return nil }
+
+	return index.Put(append(encoded, key...), key)
+}
+
+/*
+	Extract Field
+		walk the dot separated path through the nested objects of the document
+*/
+
+func extractField(document interface{}, path string) (interface{}, bool) {
+	current := document
+
+	for _, segment := range strings.Split(path, FieldPathSeparator) {
+		object, isObject := current.(map[string]interface{})
+		if ! isObject { return nil, false }
+
+		next, ok := object[segment]
+		if ! ok { return nil, false }
+
+		current = next
+	}
+
+	return current, true
+}
+
+/*
+	Encode Index Value
+		--> null, false, true: the type tag only
+		--> numbers: the type tag, followed by the big endian float64 bits, where the sign bit is flipped for positive
+			numbers and all bits are flipped for negative numbers so that the bytes sort in numeric order
+		--> strings: the type tag, followed by the string where 0x00 is escaped as 0x00 0xFF, terminated by 0x00 0x01
+*/
+
+func encodeIndexValue(value interface{}) ([]byte, bool) {
+	switch typedValue := value.(type) {
+		case nil:
+			return []byte{ IndexNullTag }, true
+		case bool:
+			if typedValue { return []byte{ IndexTrueTag }, true }
+			return []byte{ IndexFalseTag }, true
+		case float64:
+			bits := math.Float64bits(typedValue)
+			if bits & (1 << 63) != 0 {
+				bits = ^bits
+			} else { bits |= 1 << 63 }
+
+			encoded := make([]byte, 9)
+			encoded[0] = IndexNumberTag
+			binary.BigEndian.PutUint64(encoded[1:], bits)
+
+			return encoded, true
+		case string:
+			return append(encodeIndexStringPrefix(typedValue), IndexEscapeByte, IndexStringTerminator), true
+		default:
+			return nil, false
+	}
+}
+
+/*
+	Encode Index String Prefix
+		the encoded string without the terminator, so all encoded strings starting with the string share the prefix
+*/
+
+func encodeIndexStringPrefix(value string) []byte {
+	encoded := []byte{ IndexStringTag }
+	for _, b := range []byte(value) {
+		encoded = append(encoded, b)
+		if b == IndexEscapeByte { encoded = append(encoded, IndexEscapedNull) }
+	}
+
+	return encoded
+}
+
+func decodeDocument(value []byte) (interface{}, error) {
+	var document interface{}
+
+	decodeErr := json.Unmarshal(value, &document)
+	if decodeErr != nil { return nil, decodeErr }
+
+	return document, nil
+}
+
+func newDocument(key []byte, stored []byte) *Document {
+	version, value := decodeStoredDocument(stored)
+
+	return &Document{
+		Key: string(key),
+		Value: json.RawMessage(copyBytes(value)),
+		Version: version,
+		ExpiresAt: decodeDocumentExpiry(stored),
+	}
+}
+
+func secondaryIndexName(collection string, field string) string {
+	return collection + SecondaryIndexInfix + field
+}
@@ -0,0 +1,420 @@
+package statemachine
+
+import "bufio"
+import "bytes"
+import "encoding/json"
+import "errors"
+import "io"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Inspect
+
+
+/*
+	Open Collection Store File
+		open the state machine db at a path offline, for inspection, export, and import of the collections of a node that
+		is not running
+			--> the db is opened read only unless it is being imported into, and no buckets are created, so a missing bucket
+				is reported instead of hidden
+			--> a db opened read only must already be at the current format version, and is otherwise migrated to it
+*/
+
+func OpenCollectionStoreFile(dbPath string, readOnly bool) (*CollectionStore, error) {
+	db, openErr := bolt.Open(dbPath, 0600, &bolt.Options{ ReadOnly: readOnly, Timeout: InspectOpenTimeout })
+	if openErr != nil { return nil, openErr }
+
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(RootBucket))
+		if bucket == nil || bucket.Bucket([]byte(CollectionBucket)) == nil || bucket.Bucket([]byte(IndexBucket)) == nil {
+			return ErrMissingRootBucket
+		}
+
+		return nil
+	}
+
+	viewErr := db.View(transaction)
+	if viewErr != nil {
+		db.Close()
+		return nil, viewErr
+	}
+
+	var formatErr error
+	if readOnly {
+		formatErr = db.View(checkFormat)
+	} else { formatErr = migrateFormat(db) }
+
+	if formatErr != nil {
+		db.Close()
+		return nil, formatErr
+	}
+
+	return &CollectionStore{
+		DBFile: dbPath,
+		DB: db,
+	}, nil
+}
+
+/*
+	Collections
+		the metadata of all collections, along with the number of documents and the names of all indexes
+*/
+
+func (sm *CollectionStore) Collections() ([]*CollectionInfo, error) {
+	var collections []*CollectionInfo
+
+	transaction := func(tx *bolt.Tx) error {
+		resp, listErr := sm.listCollections(tx.Bucket([]byte(RootBucket)), &StateMachineOpPayload{})
+		if listErr != nil { return listErr }
+
+		collections = resp.Collections
+		return nil
+	}
+
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil { return nil, viewErr }
+
+	return collections, nil
+}
+
+/*
+	Count Documents
+		count the documents in a collection by scanning it, instead of relying on the bucket stats
+*/
+
+func (sm *CollectionStore) CountDocuments(collection string) (int, error) {
+	total := 0
+
+	transaction := func(tx *bolt.Tx) error {
+		collectionBucket, getErr := getCollectionBucket(tx, collection)
+		if getErr != nil { return getErr }
+
+		cursor := collectionBucket.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			total++
+		}
+
+		return nil
+	}
+
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil { return 0, viewErr }
+
+	return total, nil
+}
+
+/*
+	Dump Collection
+		write every document in a collection to the writer as json lines, in key order
+*/
+
+func (sm *CollectionStore) DumpCollection(collection string, writer io.Writer) (int, error) {
+	total := 0
+	encoder := json.NewEncoder(writer)
+
+	transaction := func(tx *bolt.Tx) error {
+		collectionBucket, getErr := getCollectionBucket(tx, collection)
+		if getErr != nil { return getErr }
+
+		cursor := collectionBucket.Cursor()
+		for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+			encodeErr := encoder.Encode(newDocument(key, val))
+			if encodeErr != nil { return encodeErr }
+
+			total++
+		}
+
+		return nil
+	}
+
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil { return 0, viewErr }
+
+	return total, nil
+}
+
+/*
+	Export Collection
+		write a collection to the writer as json lines, where the first line is the metadata of the collection and every
+		line after it is a document, in the same format as dump
+			--> the metadata carries the options of the collection, including its secondary indexes, so import can recreate
+				the collection as it was
+*/
+
+func (sm *CollectionStore) ExportCollection(collection string, writer io.Writer) (int, error) {
+	var metadata *CollectionMetadata
+
+	transaction := func(tx *bolt.Tx) error {
+		metadata = sm.getCollectionMetadata(tx.Bucket([]byte(RootBucket)), collection)
+		if metadata == nil { return errors.New("collection not found: " + collection) }
+
+		return nil
+	}
+
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil { return 0, viewErr }
+
+	encodeErr := json.NewEncoder(writer).Encode(metadata)
+	if encodeErr != nil { return 0, encodeErr }
+
+	return sm.DumpCollection(collection, writer)
+}
+
+/*
+	Import Collection
+		read a collection exported with export collection and write it to the db in a single transaction, so either all
+		documents are imported or none are
+			1.) read the metadata line, and create the collection with its options if it does not exist, under the name
+				passed if there is one
+			2.) write each document under its key with its version and expiry, replacing any existing document with the
+				same key and maintaining all indexes
+				--> documents that are not valid json, or that violate a unique index, abort the import
+
+		import writes directly to the db and bypasses the replicated log, so it is only for loading a db that is not part
+		of a running cluster, like the state machine of a new cluster before any system starts
+*/
+
+func (sm *CollectionStore) ImportCollection(reader io.Reader, collection string) (int, error) {
+	total := 0
+
+	decoder := json.NewDecoder(bufio.NewReader(reader))
+
+	var metadata *CollectionMetadata
+	decodeMetadataErr := decoder.Decode(&metadata)
+	if decodeMetadataErr != nil { return 0, decodeMetadataErr }
+	if metadata == nil || metadata.Name == "" { return 0, errors.New("export is missing collection metadata") }
+
+	if collection != "" { metadata.Name = collection }
+
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(RootBucket))
+
+		created, createErr := sm.createCollection(bucket, &StateMachineOpPayload{ Collection: metadata.Name, Options: &metadata.Options })
+		if createErr != nil { return createErr }
+		if created.Error != "" { return errors.New(created.Error) }
+
+		for {
+			var document *Document
+
+			decodeErr := decoder.Decode(&document)
+			if decodeErr == io.EOF { return nil }
+			if decodeErr != nil { return decodeErr }
+
+			importErr := sm.importDocument(bucket, metadata.Name, document)
+			if importErr != nil { return importErr }
+
+			total++
+		}
+	}
+
+	updateErr := sm.timedUpdate(transaction)
+	if updateErr != nil { return 0, updateErr }
+
+	return total, nil
+}
+
+/*
+	Verify Collection
+		check that the indexes of a collection match its documents, in both directions
+			1.) every document decodes, and has its own entry in the index on the whole value, keyed by its value and key
+			2.) every entry in the index on the whole value points to a document with the value of the entry
+			3.) every document with an indexable value for the field of a secondary index has an entry in the index, and every
+				entry in the secondary index points to a document with the value of the entry
+*/
+
+func (sm *CollectionStore) VerifyCollection(collection string) (*CollectionReport, error) {
+	report := &CollectionReport{ Collection: collection }
+
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(RootBucket))
+
+		collectionBucket, getErr := getCollectionBucket(tx, collection)
+		if getErr != nil { return getErr }
+
+		indexName := collection + IndexSuffix
+		indexReport := &IndexReport{ Index: indexName }
+		report.Indexes = append(report.Indexes, indexReport)
+
+		index := bucket.Bucket([]byte(indexName))
+		if index == nil { report.Errors = append(report.Errors, "index bucket not found: " + indexName) }
+
+		cursor := collectionBucket.Cursor()
+		for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+			report.Documents++
+
+			_, value := decodeStoredDocument(val)
+			if len(val) < DocumentHeaderBytes || ! json.Valid(value) {
+				report.InvalidDocuments = append(report.InvalidDocuments, string(key))
+				continue
+			}
+
+			if index == nil { continue }
+			if ! bytes.Equal(index.Get(wholeValueIndexKey(value, key)), key) {
+				indexReport.Missing = append(indexReport.Missing, string(key))
+			}
+		}
+
+		if index != nil {
+			indexCursor := index.Cursor()
+			for entry, docKey := indexCursor.First(); entry != nil; entry, docKey = indexCursor.Next() {
+				indexReport.Entries++
+
+				value := splitWholeValueIndexKey(entry)
+				if ! bytes.Equal(entry, wholeValueIndexKey(value, docKey)) || ! matchesStoredValue(collectionBucket, docKey, value) { 
+					indexReport.Orphaned = append(indexReport.Orphaned, string(docKey)) 
+				}
+			}
+		}
+
+		definitions, definitionsErr := sm.getSecondaryIndexes(bucket, collection)
+		if definitionsErr != nil { return definitionsErr }
+
+		for _, definition := range definitions {
+			secondaryName := secondaryIndexName(collection, definition.Field)
+
+			secondary := bucket.Bucket([]byte(secondaryName))
+			if secondary == nil {
+				report.Errors = append(report.Errors, "index bucket not found: " + secondaryName)
+				continue
+			}
+
+			report.Indexes = append(report.Indexes, verifySecondaryIndex(collectionBucket, secondary, secondaryName, definition.Field))
+		}
+
+		return nil
+	}
+
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil { return nil, viewErr }
+
+	return report, nil
+}
+
+/*
+	Is Consistent
+		every document decodes, every index exists, and no index has missing or orphaned entries
+*/
+
+func (report *CollectionReport) IsConsistent() bool {
+	if len(report.InvalidDocuments) > 0 || len(report.Errors) > 0 { return false }
+
+	for _, index := range report.Indexes {
+		if len(index.Missing) > 0 || len(index.Orphaned) > 0 { return false }
+	}
+
+	return true
+}
+
+/*
+	All functions below are helper functions for inspection
+*/
+
+/*
+	Import Document
+		write an exported document as is, keeping its version and expiry instead of starting a new version
+*/
+
+func (sm *CollectionStore) importDocument(bucket *bolt.Bucket, collection string, document *Document) error {
+	if document == nil || document.Key == "" { return errors.New("document key required") }
+	if ! json.Valid(document.Value) { return errors.New("document is not valid json: " + document.Key) }
+
+	key := []byte(document.Key)
+	value := []byte(document.Value)
+
+	violatedField, uniqueErr := sm.checkUniqueIndexes(bucket, collection, key, value)
+	if uniqueErr != nil { return uniqueErr }
+	if violatedField != "" { return errors.New("duplicate value for unique index on field " + violatedField + ": " + document.Key) }
+
+	collectionBucket := bucket.Bucket([]byte(collection))
+
+	stored := collectionBucket.Get(key)
+	if stored != nil {
+		_, currentValue := decodeStoredDocument(stored)
+
+		removeErr := sm.removeIndexEntries(bucket, collection, key, copyBytes(currentValue))
+		if removeErr != nil { return removeErr }
+
+		delExpiryErr := deleteExpiryEntry(bucket, collection, key, decodeDocumentExpiry(stored))
+		if delExpiryErr != nil { return delExpiryErr }
+	}
+
+	version := document.Version
+	if version < 1 { version = 1 }
+
+	putErr := collectionBucket.Put(key, encodeStoredDocument(version, document.ExpiresAt, value))
+	if putErr != nil { return putErr }
+
+	putExpiryErr := putExpiryEntry(bucket, collection, key, document.ExpiresAt)
+	if putExpiryErr != nil { return putExpiryErr }
+
+	index := bucket.Bucket([]byte(collection + IndexSuffix))
+	if index != nil {
+		putIndexErr := index.Put(wholeValueIndexKey(value, key), key)
+		if putIndexErr != nil { return putIndexErr }
+	}
+
+	return sm.insertIntoSecondaryIndexes(bucket, collection, key, value)
+}
+
+func verifySecondaryIndex(collection *bolt.Bucket, index *bolt.Bucket, indexName string, field string) *IndexReport {
+	report := &IndexReport{ Index: indexName }
+
+	cursor := collection.Cursor()
+	for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+		encoded, ok := encodeDocumentField(val, field)
+		if ! ok { continue }
+
+		if ! bytes.Equal(index.Get(append(encoded, key...)), key) { report.Missing = append(report.Missing, string(key)) }
+	}
+
+	indexCursor := index.Cursor()
+	for entry, docKey := indexCursor.First(); entry != nil; entry, docKey = indexCursor.Next() {
+		report.Entries++
+
+		stored := collection.Get(docKey)
+		if stored == nil {
+			report.Orphaned = append(report.Orphaned, string(docKey))
+			continue
+		}
+
+		encoded, ok := encodeDocumentField(stored, field)
+		if ! ok || ! bytes.Equal(entry, append(encoded, docKey...)) { report.Orphaned = append(report.Orphaned, string(docKey)) }
+	}
+
+	return report
+}
+
+func encodeDocumentField(stored []byte, field string) ([]byte, bool) {
+	_, value := decodeStoredDocument(stored)
+
+	document, decodeErr := decodeDocument(value)
+	if decodeErr != nil { return nil, false }
+
+	fieldValue, ok := extractField(document, field)
+	if ! ok { return nil, false }
+
+	return encodeIndexValue(fieldValue)
+}
+
+func matchesStoredValue(collection *bolt.Bucket, key []byte, value []byte) bool {
+	if key == nil { return false }
+
+	stored := collection.Get(key)
+	if stored == nil { return false }
+
+	_, storedValue := decodeStoredDocument(stored)
+	return bytes.Equal(storedValue, value)
+}
+
+func getCollectionBucket(tx *bolt.Tx, collection string) (*bolt.Bucket, error) {
+	notFoundErr := errors.New("collection not found: " + collection)
+	if collection == "" { return nil, notFoundErr }
+
+	bucket := tx.Bucket([]byte(RootBucket))
+	if bucket.Bucket([]byte(CollectionBucket)).Get([]byte(collection)) == nil { return nil, notFoundErr }
+
+	collectionBucket := bucket.Bucket([]byte(collection))
+	if collectionBucket == nil { return nil, notFoundErr }
+
+	return collectionBucket, nil
+}
@@ -0,0 +1,301 @@
+package statemachine
+
+import "bytes"
+import "crypto/sha256"
+import "encoding/binary"
+import "encoding/hex"
+import "strconv"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Keys
+
+
+/*
+	Keyed Documents
+		every document in a collection is stored under a key, along with a version number that starts at 1 and is
+		incremented on every write to the key. The stored value is a header with the version and the expiry of the
+		document as 8 big endian bytes each, followed by the json document
+
+		keys are either supplied by the client, or for inserts, derived from the document itself, so the same command always
+		produces the same key on every system in the cluster
+
+		GET
+			get the document for a key
+
+		PUT
+			create or replace the document for a key
+			--> if a version is passed, the put only succeeds if it matches the current version of the document
+
+		UPDATE
+			replace the document for a key that already exists
+			--> if a version is passed, the update only succeeds if it matches the current version of the document
+
+		COMPARE AND SWAP
+			replace the document for a key only if the current version of the document matches the version passed, where
+			version 0 means the key does not exist yet
+
+		DELETE
+			if a key is passed, delete the document for the key
+			--> if a version is passed, the delete only succeeds if it matches the current version of the document
+*/
+
+func (sm *CollectionStore) getByKey(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	if payload.Key == "" { return &StateMachineResponse{ Collection: payload.Collection, Error: "key required" }, nil }
+
+	collectionName := []byte(payload.Collection)
+	collection := bucket.Bucket(collectionName)
+
+	stored := collection.Get([]byte(payload.Key))
+	if stored == nil { return &StateMachineResponse{ Collection: payload.Collection, Key: payload.Key }, nil }
+
+	version, value := decodeStoredDocument(stored)
+
+	return &StateMachineResponse{
+		Collection: payload.Collection,
+		Key: payload.Key,
+		Value: copyBytes(value),
+		Version: version,
+		ExpiresAt: decodeDocumentExpiry(stored),
+	}, nil
+}
+
+func (sm *CollectionStore) putByKey(
+	bucket *bolt.Bucket, payload *StateMachineOpPayload, metadata *CollectionMetadata, action Action, timestamp int64,
+) (*StateMachineResponse, error) {
+	if action == CAS && payload.Version == nil {
+		return &StateMachineResponse{ Collection: payload.Collection, Key: payload.Key, Error: "version required for compare and swap" }, nil
+	}
+
+	expiresAt, ttlErr := documentExpiry(payload, metadata, timestamp)
+	if ttlErr != "" { return &StateMachineResponse{ Collection: payload.Collection, Key: payload.Key, Error: ttlErr }, nil }
+
+	return sm.writeDocument(bucket, metadata, []byte(payload.Key), payload.Value, payload.Version, action == UPDATE, expiresAt)
+}
+
+func (sm *CollectionStore) deleteByKey(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	collectionName := []byte(payload.Collection)
+	collection := bucket.Bucket(collectionName)
+
+	key := []byte(payload.Key)
+
+	if payload.Version != nil {
+		var currentVersion int64
+		stored := collection.Get(key)
+		if stored != nil { currentVersion, _ = decodeStoredDocument(stored) }
+
+		if currentVersion != *payload.Version { return versionMismatch(payload.Collection, payload.Key, *payload.Version, currentVersion), nil }
+	}
+
+	return sm.removeDocument(bucket, payload.Collection, key)
+}
+
+/*
+	Write Document
+		shared write path for all operations that write a document
+			1.) validate the key, the value, and the size of the document against the collection options
+			2.) check the current version of the document against the expected version, if one is passed
+			3.) check unique indexes, ignoring the document being replaced
+			4.) remove the index and expiry entries for the current document, if it exists
+			5.) write the document with the next version and its expiry, and add the index and expiry entries for the new
+				document
+*/
+
+func (sm *CollectionStore) writeDocument(
+	bucket *bolt.Bucket, metadata *CollectionMetadata, key []byte, value []byte, expectedVersion *int64, mustExist bool, expiresAt int64,
+) (*StateMachineResponse, error) {
+	if len(key) == 0 { return &StateMachineResponse{ Collection: metadata.Name, Error: "key required" }, nil }
+	if len(value) == 0 { return &StateMachineResponse{ Collection: metadata.Name, Key: string(key), Error: "value required" }, nil }
+
+	maxDocumentSize := metadata.Options.MaxDocumentSize
+	if maxDocumentSize > 0 && len(value) > maxDocumentSize {
+		return &StateMachineResponse{
+			Collection: metadata.Name,
+			Key: string(key),
+			Error: "document exceeds max document size of " + strconv.Itoa(maxDocumentSize) + " bytes",
+		}, nil
+	}
+
+	collectionName := []byte(metadata.Name)
+	collection := bucket.Bucket(collectionName)
+
+	var currentVersion int64
+	var currentValue []byte
+
+	stored := collection.Get(key)
+	if stored != nil { currentVersion, currentValue = decodeStoredDocument(stored) }
+
+	if mustExist && stored == nil { return &StateMachineResponse{ Collection: metadata.Name, Key: string(key), Error: "key not found" }, nil }
+	if expectedVersion != nil && *expectedVersion != currentVersion {
+		return versionMismatch(metadata.Name, string(key), *expectedVersion, currentVersion), nil
+	}
+
+	violatedField, uniqueErr := sm.checkUniqueIndexes(bucket, metadata.Name, key, value)
+	if uniqueErr != nil { return nil, uniqueErr }
+	if violatedField != "" {
+		return &StateMachineResponse{ Collection: metadata.Name, Key: string(key), Error: "duplicate value for unique index on field: " + violatedField }, nil
+	}
+
+	if stored != nil {
+		removeErr := sm.removeIndexEntries(bucket, metadata.Name, key, copyBytes(currentValue))
+		if removeErr != nil { return nil, removeErr }
+
+		delExpiryErr := deleteExpiryEntry(bucket, metadata.Name, key, decodeDocumentExpiry(stored))
+		if delExpiryErr != nil { return nil, delExpiryErr }
+	}
+
+	version := currentVersion + 1
+
+	changeType := InsertChange
+	if stored != nil { changeType = UpdateChange }
+
+	putErr := collection.Put(key, encodeStoredDocument(version, expiresAt, value))
+	if putErr != nil { return nil, putErr }
+
+	putExpiryErr := putExpiryEntry(bucket, metadata.Name, key, expiresAt)
+	if putExpiryErr != nil { return nil, putExpiryErr }
+
+	index := bucket.Bucket([]byte(metadata.Name + IndexSuffix))
+	if index != nil {
+		putIndexErr := index.Put(wholeValueIndexKey(value, key), key)
+		if putIndexErr != nil { return nil, putIndexErr }
+	}
+
+	insertSecondaryErr := sm.insertIntoSecondaryIndexes(bucket, metadata.Name, key, value)
+	if insertSecondaryErr != nil { return nil, insertSecondaryErr }
+
+	return &StateMachineResponse{
+		Collection: metadata.Name,
+		Key: string(key),
+		Value: value,
+		Version: version,
+		ExpiresAt: expiresAt,
+		changes: []*Change{ { Type: changeType, Collection: metadata.Name, Key: string(key), Value: value, Version: version } },
+	}, nil
+}
+
+/*
+	Remove Document
+		remove the index entries for a document and delete it from the collection
+*/
+
+func (sm *CollectionStore) removeDocument(bucket *bolt.Bucket, collection string, key []byte) (*StateMachineResponse, error) {
+	collectionName := []byte(collection)
+	collectionBucket := bucket.Bucket(collectionName)
+
+	stored := collectionBucket.Get(key)
+	if stored == nil { return &StateMachineResponse{ Collection: collection, Key: string(key) }, nil }
+
+	version, storedValue := decodeStoredDocument(stored)
+	value := copyBytes(storedValue)
+
+	removeErr := sm.removeIndexEntries(bucket, collection, key, value)
+	if removeErr != nil { return nil, removeErr }
+
+	delExpiryErr := deleteExpiryEntry(bucket, collection, key, decodeDocumentExpiry(stored))
+	if delExpiryErr != nil { return nil, delExpiryErr }
+
+	delErr := collectionBucket.Delete(key)
+	if delErr != nil { return nil, delErr }
+
+	return &StateMachineResponse{
+		Collection: collection,
+		Key: string(key),
+		Value: value,
+		Version: version,
+		changes: []*Change{ { Type: DeleteChange, Collection: collection, Key: string(key), Version: version } },
+	}, nil
+}
+
+/*
+	Remove Index Entries
+		remove a document from all secondary indexes and from the index on the whole value, where the entry for the document
+		is keyed by both the value and the key of the document, so documents with the same value keep their own entries
+*/
+
+func (sm *CollectionStore) removeIndexEntries(bucket *bolt.Bucket, collection string, key []byte, value []byte) error {
+	delSecondaryErr := sm.deleteFromSecondaryIndexes(bucket, collection, key, value)
+	if delSecondaryErr != nil { return delSecondaryErr }
+
+	index := bucket.Bucket([]byte(collection + IndexSuffix))
+	if index == nil { return nil }
+
+	return index.Delete(wholeValueIndexKey(value, key))
+}
+
+/*
+	All functions below are helper functions for keyed documents
+*/
+
+func generateDocumentKey(value []byte) []byte {
+	hash := sha256.Sum256(value)
+	return []byte(hex.EncodeToString(hash[:]))
+}
+
+/*
+	Whole Value Index Key
+		entries in the index on the whole value are keyed by the json value, followed by a zero byte and the key of the
+		document, like the secondary indexes
+			--> json never contains a zero byte, so the entries for a value are found with a prefix scan on the value and the
+				separator, and values keep the same order as the json values themselves
+*/
+
+func wholeValueIndexKey(value []byte, key []byte) []byte {
+	return append(wholeValueIndexPrefix(value), key...)
+}
+
+func wholeValueIndexPrefix(value []byte) []byte {
+	prefix := make([]byte, 0, len(value) + 1)
+	prefix = append(prefix, value...)
+	return append(prefix, WholeValueIndexSeparator)
+}
+
+/*
+	Split Whole Value Index Key
+		get the json value from an entry in the index on the whole value, where the key of the document is the value of
+		the entry
+*/
+
+func splitWholeValueIndexKey(entry []byte) []byte {
+	separator := bytes.IndexByte(entry, WholeValueIndexSeparator)
+	if separator < 0 { return entry }
+
+	return entry[:separator]
+}
+
+func encodeStoredDocument(version int64, expiresAt int64, value []byte) []byte {
+	stored := make([]byte, DocumentHeaderBytes + len(value))
+	binary.BigEndian.PutUint64(stored, uint64(version))
+	binary.BigEndian.PutUint64(stored[8:], uint64(expiresAt))
+	copy(stored[DocumentHeaderBytes:], value)
+
+	return stored
+}
+
+/*
+	Decode Stored Document
+		split a stored document into its version and json value
+*/
+
+func decodeStoredDocument(stored []byte) (int64, []byte) {
+	if len(stored) < DocumentHeaderBytes { return 0, stored }
+	return int64(binary.BigEndian.Uint64(stored[:8])), stored[DocumentHeaderBytes:]
+}
+
+func decodeDocumentExpiry(stored []byte) int64 {
+	if len(stored) < DocumentHeaderBytes { return 0 }
+	return int64(binary.BigEndian.Uint64(stored[8:DocumentHeaderBytes]))
+}
+
+func versionMismatch(collection string, key string, expected int64, current int64) *StateMachineResponse {
+	return &StateMachineResponse{
+		Collection: collection,
+		Key: key,
+		Version: current,
+		Error: "version mismatch: expected " + strconv.FormatInt(expected, 10) + ", current " + strconv.FormatInt(current, 10),
+	}
+}
+
+func copyBytes(value []byte) []byte {
+	return append([]byte{}, value...)
+}
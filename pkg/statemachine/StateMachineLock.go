@@ -0,0 +1,224 @@
+package statemachine
+
+import "encoding/json"
+import "strconv"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Lock
+
+
+/*
+	Locks
+		named locks with a time to live, held by an owner. Locks are stored in the lock bucket in root as json, keyed by
+		the name of the lock
+
+		the fencing token of a lock is the index of the log entry that acquired it, so it is the same on every system and
+		increases every time the lock changes hands. Holders pass the token along to the resources they write to, which can
+		reject writes with a token lower than one they have already seen
+
+		the expiry of a lock is the timestamp of the log entry that acquired or renewed it plus the time to live, and locks
+		are released on expiry by the expire commands appended by the leader, so all systems agree on when a lock is free.
+		A lock that has expired but not yet been released can still be acquired by another owner
+
+		ACQUIRE LOCK
+			acquire the lock for the name, if it is free, expired, or already held by the owner
+			--> acquiring a lock already held by the owner extends it and keeps its token
+
+		RENEW LOCK
+			extend the expiry of a lock held by the owner, optionally with a new time to live
+			--> if a token is passed, it must match the token of the lock
+
+		RELEASE LOCK
+			release a lock held by the owner
+			--> if a token is passed, it must match the token of the lock
+
+		GET LOCK
+			get the current holder of the lock, if any
+*/
+
+func (sm *CollectionStore) acquireLock(bucket *bolt.Bucket, payload *StateMachineOpPayload, timestamp int64, index int64) (*StateMachineResponse, error) {
+	validateErr := validateLockOperation(payload, timestamp)
+	if validateErr != "" { return lockError(payload.Key, validateErr), nil }
+
+	locks, createErr := bucket.CreateBucketIfNotExists([]byte(LockBucket))
+	if createErr != nil { return nil, createErr }
+
+	current, decodeErr := getLockEntry(locks, payload.Key)
+	if decodeErr != nil { return nil, decodeErr }
+
+	held := current != nil && current.ExpiresAt > timestamp
+	if held && current.Owner != payload.Owner {
+		return &StateMachineResponse{ Key: payload.Key, Lock: current, Error: "lock held by " + current.Owner + ": " + payload.Key }, nil
+	}
+
+	ttlSeconds := payload.TTLSeconds
+	if ttlSeconds == 0 { ttlSeconds = DefaultLockTTLSeconds }
+
+	lock := &Lock{ Name: payload.Key, Owner: payload.Owner, Token: index, TTLSeconds: ttlSeconds }
+	if held { lock.Token = current.Token }
+
+	changeType := InsertChange
+	if held { changeType = UpdateChange }
+
+	return sm.writeLock(bucket, locks, current, lock, timestamp, changeType)
+}
+
+func (sm *CollectionStore) renewLock(bucket *bolt.Bucket, payload *StateMachineOpPayload, timestamp int64) (*StateMachineResponse, error) {
+	validateErr := validateLockOperation(payload, timestamp)
+	if validateErr != "" { return lockError(payload.Key, validateErr), nil }
+
+	locks := bucket.Bucket([]byte(LockBucket))
+	if locks == nil { return lockError(payload.Key, "lock not held: " + payload.Key), nil }
+
+	current, decodeErr := getLockEntry(locks, payload.Key)
+	if decodeErr != nil { return nil, decodeErr }
+
+	if current == nil || current.ExpiresAt <= timestamp { return lockError(payload.Key, "lock not held: " + payload.Key), nil }
+
+	holderErr := checkLockHolder(current, payload)
+	if holderErr != "" { return &StateMachineResponse{ Key: payload.Key, Lock: current, Error: holderErr }, nil }
+
+	lock := *current
+	if payload.TTLSeconds > 0 { lock.TTLSeconds = payload.TTLSeconds }
+
+	return sm.writeLock(bucket, locks, current, &lock, timestamp, UpdateChange)
+}
+
+func (sm *CollectionStore) releaseLock(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	if payload.Key == "" { return lockError(payload.Key, "lock name required"), nil }
+	if payload.Owner == "" { return lockError(payload.Key, "owner required"), nil }
+
+	locks := bucket.Bucket([]byte(LockBucket))
+	if locks == nil { return lockError(payload.Key, "lock not held: " + payload.Key), nil }
+
+	current, decodeErr := getLockEntry(locks, payload.Key)
+	if decodeErr != nil { return nil, decodeErr }
+
+	if current == nil { return lockError(payload.Key, "lock not held: " + payload.Key), nil }
+
+	holderErr := checkLockHolder(current, payload)
+	if holderErr != "" { return &StateMachineResponse{ Key: payload.Key, Lock: current, Error: holderErr }, nil }
+
+	removeErr := removeLockEntry(bucket, locks, current)
+	if removeErr != nil { return nil, removeErr }
+
+	return &StateMachineResponse{
+		Key: payload.Key,
+		Lock: current,
+		changes: []*Change{ lockChange(DeleteChange, current) },
+	}, nil
+}
+
+func (sm *CollectionStore) getLock(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	if payload.Key == "" { return lockError(payload.Key, "lock name required"), nil }
+
+	locks := bucket.Bucket([]byte(LockBucket))
+	if locks == nil { return &StateMachineResponse{ Key: payload.Key }, nil }
+
+	current, decodeErr := getLockEntry(locks, payload.Key)
+	if decodeErr != nil { return nil, decodeErr }
+
+	return &StateMachineResponse{ Key: payload.Key, Lock: current }, nil
+}
+
+/*
+	Expire Lock
+		release a lock from an expire command, if the expiry entry still matches the expiry of the lock. Locks that were
+		renewed have a newer expiry entry and are left in place
+*/
+
+func (sm *CollectionStore) expireLock(bucket *bolt.Bucket, name []byte, expiresAt int64) (*Change, error) {
+	locks := bucket.Bucket([]byte(LockBucket))
+	if locks == nil { return nil, nil }
+
+	current, decodeErr := getLockEntry(locks, string(name))
+	if decodeErr != nil { return nil, decodeErr }
+	if current == nil || current.ExpiresAt != expiresAt { return nil, nil }
+
+	delErr := locks.Delete(name)
+	if delErr != nil { return nil, delErr }
+
+	return lockChange(ExpireChange, current), nil
+}
+
+/*
+	Write Lock
+		write the lock with a new expiry from the timestamp of the log entry, replacing the expiry entry of the current
+		lock if there is one
+*/
+
+func (sm *CollectionStore) writeLock(
+	bucket *bolt.Bucket, locks *bolt.Bucket, current *Lock, lock *Lock, timestamp int64, changeType ChangeType,
+) (*StateMachineResponse, error) {
+	if current != nil {
+		removeErr := removeLockEntry(bucket, locks, current)
+		if removeErr != nil { return nil, removeErr }
+	}
+
+	lock.ExpiresAt = timestamp + lock.TTLSeconds * 1000
+
+	encoded, encErr := json.Marshal(lock)
+	if encErr != nil { return nil, encErr }
+
+	putErr := locks.Put([]byte(lock.Name), encoded)
+	if putErr != nil { return nil, putErr }
+
+	expiryErr := putExpiryEntry(bucket, LockBucket, []byte(lock.Name), lock.ExpiresAt)
+	if expiryErr != nil { return nil, expiryErr }
+
+	return &StateMachineResponse{
+		Key: lock.Name,
+		Lock: lock,
+		changes: []*Change{ lockChange(changeType, lock) },
+	}, nil
+}
+
+/*
+	All functions below are helper functions for locks
+*/
+
+func validateLockOperation(payload *StateMachineOpPayload, timestamp int64) string {
+	if payload.Key == "" { return "lock name required" }
+	if payload.Owner == "" { return "owner required" }
+	if payload.TTLSeconds < 0 { return "ttl cannot be negative" }
+	if timestamp == 0 { return "timestamp required for lock operations" }
+
+	return ""
+}
+
+func checkLockHolder(lock *Lock, payload *StateMachineOpPayload) string {
+	if lock.Owner != payload.Owner { return "lock held by " + lock.Owner + ": " + lock.Name }
+	if payload.Token != 0 && payload.Token != lock.Token {
+		return "token mismatch for lock " + lock.Name + ": expected " + strconv.FormatInt(payload.Token, 10) + ", current " + strconv.FormatInt(lock.Token, 10)
+	}
+
+	return ""
+}
+
+func getLockEntry(locks *bolt.Bucket, name string) (*Lock, error) {
+	stored := locks.Get([]byte(name))
+	if stored == nil { return nil, nil }
+
+	lock := &Lock{}
+	decodeErr := json.Unmarshal(stored, lock)
+	if decodeErr != nil { return nil, decodeErr }
+
+	return lock, nil
+}
+
+func removeLockEntry(bucket *bolt.Bucket, locks *bolt.Bucket, lock *Lock) error {
+	delErr := locks.Delete([]byte(lock.Name))
+	if delErr != nil { return delErr }
+
+	return deleteExpiryEntry(bucket, LockBucket, []byte(lock.Name), lock.ExpiresAt)
+}
+
+func lockChange(changeType ChangeType, lock *Lock) *Change {
+	encoded, _ := json.Marshal(lock)
+	return &Change{ Type: changeType, Collection: LockBucket, Key: lock.Name, Value: encoded, Version: lock.Token }
+}
+
+func lockError(name string, err string) *StateMachineResponse {
+	return &StateMachineResponse{ Key: name, Error: err }
+}
@@ -1,6 +1,9 @@
 package statemachine
 
-import "strings"
+import "bytes"
+import "encoding/binary"
+import "encoding/json"
+import "errors"
 import bolt "go.etcd.io/bbolt"
 
 import "github.com/sirgallo/raft/pkg/utils"
@@ -9,31 +12,160 @@ import "github.com/sirgallo/raft/pkg/utils"
 //=========================================== State Machine Operations
 
 
+/*
+	Apply
+		implements the state machine interface for the collection store
+			1.) decode each command as a json state machine operation. A command that cannot be decoded is still
+				part of the log, so it is answered with an error response instead of failing the batch
+			2.) bulk apply the decoded operations in a single transaction
+			3.) encode each response as json, in the same order as the commands
+*/
+
+func (sm *CollectionStore) Apply(commands [][]byte) ([][]byte, error) {
+	fullCommands := make([]*Command, len(commands))
+	for idx, command := range commands {
+		fullCommands[idx] = &Command{ Data: command }
+	}
+
+	results, _, applyErr := sm.ApplyCommands(fullCommands)
+	return results, applyErr
+}
+
+/*
+	Apply Commands
+		implements the command applier interface for the collection store, returning the documents inserted, updated,
+		deleted, and expired, and the collections dropped, by each command along with its result
+			--> the timestamp of each command is used as the time of its operation, so the expiry of documents written with
+				a ttl is the same on every system. Commands without a timestamp, like those passed to apply, do not expire
+			--> the log index of each command is used as the fencing token of locks acquired by its operation
+*/
+
+func (sm *CollectionStore) ApplyCommands(commands []*Command) ([][]byte, [][]*Change, error) {
+	var ops []*StateMachineOperation
+	var opIndexes []int
+
+	responses := make([]*StateMachineResponse, len(commands))
+
+	for idx, command := range commands {
+		op, decodeErr := DecodeOperation(command.Data)
+		if decodeErr != nil {
+			responses[idx] = &StateMachineResponse{ Error: decodeErr.Error() }
+			continue
+		}
+
+		op.timestamp = command.Timestamp
+		op.index = command.Index
+		ops = append(ops, op)
+		opIndexes = append(opIndexes, idx)
+	}
+
+	if len(ops) > 0 {
+		bulkApplyResps, bulkApplyErr := sm.BulkApply(ops)
+		if bulkApplyErr != nil { return nil, nil, bulkApplyErr }
+
+		for idx, resp := range bulkApplyResps {
+			responses[opIndexes[idx]] = resp
+		}
+	}
+
+	results := make([][]byte, len(responses))
+	changes := make([][]*Change, len(responses))
+
+	for idx, resp := range responses {
+		encoded, encErr := json.Marshal(resp)
+		if encErr != nil { return nil, nil, encErr }
+
+		results[idx] = encoded
+		changes[idx] = resp.changes
+	}
+
+	return results, changes, nil
+}
+
+/*
+	Read
+		implements the state machine interface for the collection store, decoding the query as a json state machine
+		operation and returning the json encoded response
+*/
+
+func (sm *CollectionStore) Read(query []byte) ([]byte, error) {
+	op, decodeErr := DecodeOperation(query)
+	if decodeErr != nil { return nil, decodeErr }
+
+	resp, readErr := sm.ReadOperation(op)
+	if readErr != nil { return nil, readErr }
+
+	return json.Marshal(resp)
+}
+
+/*
+	Is Read Only
+		find, get, range, list collections, and get lock do not modify the state machine, so they can be served by the leader without
+		being appended to the replicated log
+*/
+
+func (sm *CollectionStore) IsReadOnly(command []byte) bool {
+	op, decodeErr := DecodeOperation(command)
+	if decodeErr != nil { return false }
+
+	return op.Action == FIND || op.Action == GET || op.Action == RANGE || op.Action == LISTCOLLECTIONS || op.Action == GETLOCK
+}
+
 /*
 	Bulk Apply
 		operation to apply logs to the state machine and perform operations on it
 			--> the process of applying log entries from the replicated log performs the operation on the state machine,
 				which will also return a response back to the client that issued the command included in the log entry
+			--> exactly one response is returned per operation, in the same order as the operations
+			--> an operation that fails is answered with an error response and does not affect the other operations, so
+				operations are never retried and the state machine always advances past them
+			--> if the bolt transaction itself fails, like on a disk error, the error is returned instead, since the operations
+				did not fail on their own and must be applied again
 			
 		The operation is a struct which contains both the operation to perform and the payload included
 			--> the payload includes the collection to be operated on as well as the value to update
 
 		FIND
 			perform a lookup on a value. The key does not need to be known, and the value to look for is passed in the payload
-			--> the value is indexed in a separate collection, which points to the key that is associated with the value. Keys are dynamically 
-					generated on inserts and do not need be known to the user. The key can be seen more as a unique identifier
+			--> the value is indexed in a separate collection, which points to the key that is associated with the value. Keys are generated
+					from the value on inserts and do not need be known to the user. The key can be seen more as a unique identifier
+			--> if a field is passed in the payload, all documents where the field equals the value are returned instead, using the
+				secondary index on the field if one exists
+
+		CREATE COLLECTION
+			create a collection, along with its index and any secondary indexes in the options
+			--> creating a collection that already exists with the same options is a no-op, while different options is an error
+			--> all other operations, except for list collections, return an error if the collection does not exist
+
+		CREATE INDEX
+			create a secondary index on a field of the documents in a collection, which can be unique
+			--> the index is backfilled with all existing documents in the collection, and maintained on every insert and delete
+
+		RANGE
+			perform a range query over an index of a collection, returning the documents in index order
+			--> results are paginated with a limit and an opaque cursor to continue from
+
+		GET, PUT, UPDATE, COMPARE AND SWAP
+			operations on documents by a key supplied by the client, where every document has a version that is incremented on
+			each write
+			--> documents written with a ttl, or in a collection with a default ttl, expire after the ttl
+			--> see StateMachineKeys.go
 
 		INSERT
-			perform an insert for a value in a collection
-			--> on inserts, first a hash is generated as the key for the value in the collection. Then, values are inserted into appropriate
+			perform an insert for a json value in a collection
+			--> on inserts, first the sha256 hash of the value is generated as the key for the value in the collection, so the key is the
+				same on every system that applies the insert. Then, values are inserted into appropriate
 				indexes. Since BoltDb utilizes a B+ tree as its primary data structure, key-value pairs are sorts by default. We can utilize this to
 				create indexes for our collections, where values become the primary key and the value becomes the id of the object in the collection,
 				so essentially we can point directly to the location in the collection from a given index
+			--> the document is also inserted into all secondary indexes on the collection
+			--> the insert is rejected if the document exceeds the max document size of the collection, or if it has the same
+				value as another document for a field with a unique index
 		
 		DELETE
-			perform a delete for a value in a collection
+			perform a delete for a value in a collection, or for a key if one is passed in the payload
 			--> this involes first doing a lookup on the index for the object to be deleted, and then removing both the original element from the
-			collection and all associated indexes
+			collection and all associated indexes, including secondary indexes
 
 		DROP COLLECTION
 			perform a collection drop
@@ -42,162 +174,370 @@ import "github.com/sirgallo/raft/pkg/utils"
 		
 		LIST COLLECTIONS
 			get all available collections on the state machine
-			--> do a lookup on the collection bucket and get all collections names
+			--> do a lookup on the collection bucket and get the metadata for all collections, including the document count
+				and index names
+
+		EXPIRE
+			appended by the leader to delete all documents that expired at or before the timestamp of the log entry
+			--> see StateMachineExpiry.go
+
+		TRANSACTION
+			perform a list of operations atomically, guarded by optional conditions on documents
+			--> transactions are applied in their own bolt transaction, so consecutive operations that are not transactions
+				are grouped into a batch, and batches and transactions are applied in log order
+			--> see StateMachineTransaction.go
+
+		ACQUIRE LOCK, RENEW LOCK, RELEASE LOCK, GET LOCK
+			named locks with a time to live, where the fencing token of a lock is the index of the log entry that acquired it
+			--> see StateMachineLock.go
 */
 
-func (sm *StateMachine) BulkApply(ops []*StateMachineOperation) ([]*StateMachineResponse, error) {
+func (sm *CollectionStore) BulkApply(ops []*StateMachineOperation) ([]*StateMachineResponse, error) {
 	responses := []*StateMachineResponse{}
-	
+
+	for start := 0; start < len(ops); {
+		if ops[start].Action == TRANSACTION {
+			txResp, txErr := sm.applyTransaction(ops[start])
+			if txErr != nil && ! IsCommandError(txErr) { return nil, txErr }
+			if txErr != nil { txResp = &StateMachineResponse{ Error: txErr.Error() } }
+
+			responses = append(responses, txResp)
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(ops) && ops[end].Action != TRANSACTION { end++ }
+
+		batchResps, batchErr := sm.applyBatch(ops[start:end])
+		if batchErr != nil && ! IsCommandError(batchErr) { return nil, batchErr }
+
+		if batchErr != nil { 
+			var individualErr error
+			batchResps, individualErr = sm.applyIndividually(ops[start:end])
+			if individualErr != nil { return nil, individualErr }
+		}
+
+		responses = append(responses, batchResps...)
+		start = end
+	}
+
+	return responses, nil
+}
+
+/*
+	Apply Batch
+		apply a batch of operations, which are not transactions, in a single bolt transaction, along with the index of the
+		last operation as the applied index
+			--> an error from an operation is returned as a command error, while an error from bolt beginning or committing
+				the transaction is returned as is
+*/
+
+func (sm *CollectionStore) applyBatch(ops []*StateMachineOperation) ([]*StateMachineResponse, error) {
+	responses := []*StateMachineResponse{}
+
 	transaction := func(tx *bolt.Tx) error {
 		rootName := []byte(RootBucket)
 		root := tx.Bucket(rootName)
 
 		for _, op := range ops {
-			_, createCollectionErr := sm.createCollection(root, op.Payload.Collection)
-			if createCollectionErr != nil { return createCollectionErr }
+			resp, applyErr := sm.applyOperation(root, op)
+			if applyErr != nil { return &CommandError{ Err: applyErr } }
 
-			if op.Action == INSERT {
-				insertResp, insertErr := sm.insertIntoCollection(root, &op.Payload)
-				if insertErr != nil { return insertErr}
+			responses = append(responses, resp)
+		}
 
-				insertResp.RequestID = op.RequestID
+		return putAppliedIndex(root, ops[len(ops) - 1].index)
+	}
 
-				responses = append(responses, insertResp)
-			} else if op.Action == DELETE {
-				deleteResp, deleteErr := sm.deleteFromCollection(root, &op.Payload)
-				if deleteErr != nil { return deleteErr }
+	bulkInsertErr := sm.timedUpdate(transaction)
+	if bulkInsertErr != nil { return nil, bulkInsertErr }
 
-				deleteResp.RequestID = op.RequestID
+	return responses, nil
+}
+
+/*
+	Apply Individually
+		if a batch fails, the bolt transaction for the whole batch is rolled back, so each operation is applied again in its
+		own bolt transaction. An operation that still fails with a command error is rolled back alone and answered with the
+		error, while the rest of the batch is applied. Every system applies the same operations in the same order, so the
+		same operations fail on every system
+			--> any other error is a failure of the system, so it is returned and the rest of the batch is not applied
+*/
 
-				responses = append(responses, deleteResp)
-			} else if op.Action == DROPCOLLECTION {
-				dropResp, dropErr := sm.dropCollection(root, &op.Payload)
-				if dropErr != nil { return dropErr }
+func (sm *CollectionStore) applyIndividually(ops []*StateMachineOperation) ([]*StateMachineResponse, error) {
+	responses := make([]*StateMachineResponse, len(ops))
 
-				dropResp.RequestID = op.RequestID
+	for idx, op := range ops {
+		resps, applyErr := sm.applyBatch([]*StateMachineOperation{ op })
+		if applyErr != nil && ! IsCommandError(applyErr) { return nil, applyErr }
 
-				responses = append(responses, dropResp)
-			}
+		if applyErr != nil {
+			responses[idx] = &StateMachineResponse{ Collection: op.Payload.Collection, Error: applyErr.Error() }
+			continue
 		}
 
+		responses[idx] = resps[0]
+	}
+
+	return responses, nil
+}
+
+/*
+	Applied Index
+		implements the applied indexer interface for the collection store, returning the log index of the last operation
+		applied, which is written in the same bolt transaction as the operation, or -1 if nothing has been applied
+			--> the db of a snapshot carries the applied index at the time of the snapshot, so it is restored with the snapshot
+*/
+
+func (sm *CollectionStore) AppliedIndex() (int64, error) {
+	appliedIndex := int64(NoAppliedIndex)
+
+	transaction := func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(RootBucket))
+		if root == nil { return ErrMissingRootBucket }
+
+		appliedIndex = getAppliedIndex(root)
 		return nil
 	}
 
-	bulkInsertErr := sm.DB.Update(transaction)
-	if bulkInsertErr != nil { return nil, bulkInsertErr }
+	viewErr := sm.timedView(transaction)
+	if viewErr != nil { return NoAppliedIndex, viewErr }
 
-	return responses, nil
+	return appliedIndex, nil
+}
+
+func getAppliedIndex(root *bolt.Bucket) int64 {
+	val := root.Get([]byte(AppliedIndexKey))
+	if len(val) != 8 { return NoAppliedIndex }
+
+	return int64(binary.BigEndian.Uint64(val))
+}
+
+func putAppliedIndex(root *bolt.Bucket, index int64) error {
+	if index <= getAppliedIndex(root) { return nil }
+
+	val := make([]byte, 8)
+	binary.BigEndian.PutUint64(val, uint64(index))
+
+	return root.Put([]byte(AppliedIndexKey), val)
+}
+
+/*
+	Apply Operation
+		perform a single operation against the root bucket within an open bolt transaction
+*/
+
+func (sm *CollectionStore) applyOperation(root *bolt.Bucket, op *StateMachineOperation) (*StateMachineResponse, error) {
+	if op.Action == LISTCOLLECTIONS { return sm.listCollections(root, &op.Payload) }
+	if op.Action == EXPIRE { return sm.expireDocuments(root, op.timestamp) }
+	if op.Action == CREATECOLLECTION { return sm.createCollection(root, &op.Payload) }
+
+	switch op.Action {
+		case ACQUIRELOCK:
+			return sm.acquireLock(root, &op.Payload, op.timestamp, op.index)
+		case RENEWLOCK:
+			return sm.renewLock(root, &op.Payload, op.timestamp)
+		case RELEASELOCK:
+			return sm.releaseLock(root, &op.Payload)
+		case GETLOCK:
+			return sm.getLock(root, &op.Payload)
+	}
+
+	metadata := sm.getCollectionMetadata(root, op.Payload.Collection)
+	if metadata == nil { return collectionNotFound(op.Payload.Collection), nil }
+
+	switch op.Action {
+		case CREATEINDEX:
+			return sm.createSecondaryIndex(root, &op.Payload)
+		case INSERT:
+			return sm.insertIntoCollection(root, &op.Payload, metadata, op.timestamp)
+		case DELETE:
+			return sm.deleteFromCollection(root, &op.Payload)
+		case DROPCOLLECTION:
+			return sm.dropCollection(root, &op.Payload)
+		case FIND:
+			return sm.searchInCollection(root, &op.Payload)
+		case GET:
+			return sm.getByKey(root, &op.Payload)
+		case PUT, UPDATE, CAS:
+			return sm.putByKey(root, &op.Payload, metadata, op.Action, op.timestamp)
+		case RANGE:
+			return sm.rangeInCollection(root, &op.Payload)
+		default:
+			return &StateMachineResponse{
+				Collection: op.Payload.Collection,
+				Error: "unsupported action: " + op.Action,
+			}, nil
+	}
 }
 
-func (sm *StateMachine) Read(op *StateMachineOperation) (*StateMachineResponse, error) {
+func (sm *CollectionStore) ReadOperation(op *StateMachineOperation) (*StateMachineResponse, error) {
 	var response *StateMachineResponse
 
 	transaction := func(tx *bolt.Tx) error {
 		rootName := []byte(RootBucket)
 		root := tx.Bucket(rootName)
 
+		if op.Action == LISTCOLLECTIONS {
+			listResp, listErr := sm.listCollections(root, &op.Payload)
+			if listErr != nil { return listErr }
+
+			response = listResp
+			return nil
+		}
+
+		if op.Action == GETLOCK {
+			lockResp, lockErr := sm.getLock(root, &op.Payload)
+			if lockErr != nil { return lockErr }
+
+			response = lockResp
+			return nil
+		}
+
+		if op.Action != FIND && op.Action != GET && op.Action != RANGE { return errors.New("unsupported read action: " + op.Action) }
+
+		if sm.getCollectionMetadata(root, op.Payload.Collection) == nil {
+			response = collectionNotFound(op.Payload.Collection)
+			return nil
+		}
+
 		if op.Action == FIND {
 			searchResp, searchErr := sm.searchInCollection(root, &op.Payload)
 			if searchErr != nil { return searchErr }
 
-			searchResp.RequestID = op.RequestID
-
 			response = searchResp
-		} else if op.Action == LISTCOLLECTIONS {
-			listResp, listErr := sm.listCollections(root, &op.Payload)
-			if listErr != nil { return listErr }
+		} else if op.Action == GET {
+			getResp, getErr := sm.getByKey(root, &op.Payload)
+			if getErr != nil { return getErr }
 
-			listResp.RequestID = op.RequestID
+			response = getResp
+		} else {
+			rangeResp, rangeErr := sm.rangeInCollection(root, &op.Payload)
+			if rangeErr != nil { return rangeErr }
 
-			response = listResp
+			response = rangeResp
 		}
 		
 		return nil
 	}
 
-	readErr := sm.DB.View(transaction)
+	readErr := sm.timedView(transaction)
 	if readErr != nil { return nil, readErr }
 
 	return response, nil
 }
 
 /*
-	All functions below are helper functions for each of the above state machine operations
+	Decode Operation
+		commands for the collection store are json encoded state machine operations
+			--> the value in the payload is compacted, so the same json document is always stored and indexed with the same bytes
+			--> for transactions, the values of all operations and guards are compacted as well
 */
 
-func (sm *StateMachine) listCollections(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
-	var collections []string
+func DecodeOperation(command []byte) (*StateMachineOperation, error) {
+	var op *StateMachineOperation
+	
+	decodeErr := json.Unmarshal(command, &op)
+	if decodeErr != nil { return nil, decodeErr }
+	if op == nil { return nil, errors.New("empty state machine operation") }
 
-	collectionBucketName := []byte(CollectionBucket)
-	collectionBucket := bucket.Bucket(collectionBucketName)
+	compactErr := compactOperation(op)
+	if compactErr != nil { return nil, compactErr }
 
-	cursor := collectionBucket.Cursor()
+	return op, nil
+}
 
-	for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
-		collections = append(collections, string(val))
+func compactOperation(op *StateMachineOperation) error {
+	var compactErr error
+
+	op.Payload.Value, compactErr = compactValue(op.Payload.Value)
+	if compactErr != nil { return compactErr }
+
+	for _, guard := range op.Payload.Guards {
+		if guard == nil { return errors.New("empty transaction guard") }
+
+		guard.Value, compactErr = compactValue(guard.Value)
+		if compactErr != nil { return compactErr }
 	}
 
-	return &StateMachineResponse{
-		Value: strings.Join(collections, ", "),
-	}, nil
+	for _, nested := range op.Payload.Operations {
+		if nested == nil { return errors.New("empty state machine operation") }
+
+		compactErr = compactOperation(nested)
+		if compactErr != nil { return compactErr }
+	}
+
+	return nil
 }
 
-func (sm *StateMachine) insertIntoCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
-	collectionName := []byte(payload.Collection)
-	collection := bucket.Bucket(collectionName)
+func compactValue(value json.RawMessage) (json.RawMessage, error) {
+	if len(value) == 0 { return value, nil }
 
-	searchIndexResp, searchErr := sm.searchInIndex(bucket, payload)
-	if searchErr != nil { return nil, searchErr }
+	var compacted bytes.Buffer
+	compactErr := json.Compact(&compacted, value)
+	if compactErr != nil { return nil, compactErr }
 
-	if searchIndexResp.Value != utils.GetZero[string]() { return searchIndexResp, nil }
+	return compacted.Bytes(), nil
+}
+
+func encodeJSONString(value string) json.RawMessage {
+	encoded, _ := json.Marshal(value)
+	return encoded
+}
+
+/*
+	All functions below are helper functions for each of the above state machine operations
+*/
 
-	hash, hashErr := utils.GenerateRandomSHA256Hash()
-	if hashErr != nil { return nil, hashErr }
+func (sm *CollectionStore) insertIntoCollection(
+	bucket *bolt.Bucket, payload *StateMachineOpPayload, metadata *CollectionMetadata, timestamp int64,
+) (*StateMachineResponse, error) {
+	if len(payload.Value) == 0 { return &StateMachineResponse{ Collection: payload.Collection, Error: "value required to insert" }, nil }
 
-	generatedKey := []byte(hash)
-	value := []byte(payload.Value)
+	searchIndexResp, searchErr := sm.searchInIndex(bucket, payload)
+	if searchErr != nil { return nil, searchErr }
 
-	putErr := collection.Put(generatedKey, value)
-	if putErr != nil { return nil, putErr }
+	if searchIndexResp.Key != utils.GetZero[string]() { return searchIndexResp, nil }
 
-	insertIndexResp, insertErr := sm.insertIntoIndex(bucket, payload, generatedKey)
-	if insertErr != nil { return nil, insertErr }
+	expiresAt, ttlErr := documentExpiry(payload, metadata, timestamp)
+	if ttlErr != "" { return &StateMachineResponse{ Collection: payload.Collection, Error: ttlErr }, nil }
 
-	return insertIndexResp, nil
+	generatedKey := generateDocumentKey(payload.Value)
+	return sm.writeDocument(bucket, metadata, generatedKey, payload.Value, nil, false, expiresAt)
 }
 
-func (sm *StateMachine) searchInCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+func (sm *CollectionStore) searchInCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	if payload.Field != utils.GetZero[string]() { return sm.findByField(bucket, payload) }
+
 	indexResp, searchErr := sm.searchInIndex(bucket, payload)
 	if searchErr != nil { return nil, searchErr }
 
 	return indexResp, nil
 }
 
-func (sm *StateMachine) deleteFromCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
-	collectionName := []byte(payload.Collection)
-	collection := bucket.Bucket(collectionName)
+func (sm *CollectionStore) deleteFromCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	if payload.Key != utils.GetZero[string]() { return sm.deleteByKey(bucket, payload) }
 
 	indexResp, searchErr := sm.searchInIndex(bucket, payload)
 	if searchErr != nil { return &StateMachineResponse{ Collection: payload.Collection }, searchErr }
+	if indexResp.Key == utils.GetZero[string]() { return indexResp, nil }
 
-	delErr := collection.Delete([]byte(indexResp.Key))
-	if delErr != nil { return nil, delErr }
-
-	indexDelResp, indexDelErr := sm.deleteFromIndex(bucket, payload)
-	if indexDelErr != nil { return nil, indexDelErr }
-
-	return indexDelResp, nil
+	return sm.removeDocument(bucket, payload.Collection, []byte(indexResp.Key))
 }
 
-func (sm *StateMachine) dropCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+func (sm *CollectionStore) dropCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
 	collectionName := []byte(payload.Collection)
 	indexName := []byte(payload.Collection + IndexSuffix)
 
 	delColErr := bucket.DeleteBucket(collectionName)
-	if delColErr != nil { return nil, delColErr }
+	if delColErr != nil && ! errors.Is(delColErr, bolt.ErrBucketNotFound) { return nil, delColErr }
 
 	delIndexErr := bucket.DeleteBucket(indexName)
-	if delIndexErr != nil { return nil, delIndexErr }
+	if delIndexErr != nil && ! errors.Is(delIndexErr, bolt.ErrBucketNotFound) { return nil, delIndexErr }
+
+	dropSecondaryErr := sm.dropSecondaryIndexes(bucket, payload.Collection)
+	if dropSecondaryErr != nil { return nil, dropSecondaryErr }
 
 	collectionBucketName := []byte(CollectionBucket)
 	collectionBucket := bucket.Bucket(collectionBucketName)
@@ -208,95 +548,46 @@ func (sm *StateMachine) dropCollection(bucket *bolt.Bucket, payload *StateMachin
 	delFromColBucketErr := collectionBucket.Delete(collectionName)
 	if delFromColBucketErr != nil { return nil, delFromColBucketErr }
 
-	delFromIndexBucketErr := indexBucket.Delete(indexBucketName)
+	delFromIndexBucketErr := indexBucket.Delete(indexName)
 	if delFromIndexBucketErr != nil { return nil, delFromIndexBucketErr }
 
 	return &StateMachineResponse{
 		Collection: payload.Collection,
-		Value: "dropped",
-	}, nil
-}
-
-func (sm *StateMachine) searchInIndex(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
-	indexName := []byte(payload.Collection + IndexSuffix)
-	index := bucket.Bucket(indexName)
-	if index == nil { return &StateMachineResponse{ Collection: payload.Collection }, nil }
-
-	indexKey := []byte(payload.Value)
-	val := index.Get(indexKey)
-
-	if val == nil { return &StateMachineResponse{ Collection: payload.Collection }, nil }
-
-	return &StateMachineResponse{
-		Collection: payload.Collection,
-		Key: string(val),
-		Value: payload.Value,
+		Value: encodeJSONString("dropped"),
+		changes: []*Change{ { Type: DropChange, Collection: payload.Collection } },
 	}, nil
 }
 
-func (sm *StateMachine) insertIntoIndex(bucket *bolt.Bucket, payload *StateMachineOpPayload, colKey []byte) (*StateMachineResponse, error) {
+func (sm *CollectionStore) searchInIndex(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
 	indexName := []byte(payload.Collection + IndexSuffix)
 	index := bucket.Bucket(indexName)
 	if index == nil { return &StateMachineResponse{ Collection: payload.Collection }, nil }
 
-	indexKey := []byte(payload.Value)
-	putErr := index.Put(indexKey, colKey)
-	if putErr != nil { return nil, putErr }
+	prefix := wholeValueIndexPrefix(payload.Value)
+	entry, val := index.Cursor().Seek(prefix)
 
-	return &StateMachineResponse{
-		Collection: payload.Collection,
-		Key: string(colKey),
-		Value: payload.Value,
-	}, nil
-}
+	if entry == nil || ! bytes.HasPrefix(entry, prefix) { return &StateMachineResponse{ Collection: payload.Collection }, nil }
 
-func (sm *StateMachine) deleteFromIndex(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
-	indexName := []byte(payload.Collection + IndexSuffix)
-	index := bucket.Bucket(indexName)
-	if index == nil { return &StateMachineResponse{ Collection: payload.Collection }, nil }
-
-	indexKey := []byte(payload.Value)
-	val := index.Get(indexKey)
-	if val == nil { return &StateMachineResponse{ Collection: payload.Collection }, nil }
-
-	delErr := index.Delete(indexKey)
-	if delErr != nil { return nil, delErr }
+	var version, expiresAt int64
+	collection := bucket.Bucket([]byte(payload.Collection))
+	if collection != nil {
+		stored := collection.Get(val)
+		if stored != nil {
+			version, _ = decodeStoredDocument(stored)
+			expiresAt = decodeDocumentExpiry(stored)
+		}
+	}
 
 	return &StateMachineResponse{
 		Collection: payload.Collection,
 		Key: string(val),
 		Value: payload.Value,
+		Version: version,
+		ExpiresAt: expiresAt,
 	}, nil
 }
 
-func (sm *StateMachine) createCollection(bucket *bolt.Bucket, collection string) (bool, error) {
-	collectionName := []byte(collection)
-	collectionBucket := bucket.Bucket(collectionName)
-	
-	if collectionBucket == nil {
-		_, createErr := bucket.CreateBucketIfNotExists(collectionName)
-		if createErr != nil { return false, createErr }
-	
-		indexName, createIndexErr := sm.createIndex(bucket, collection)
-		if createIndexErr != nil { return false, createIndexErr }
-	
-		collectionBucketName := []byte(CollectionBucket)
-		collectionBucket := bucket.Bucket(collectionBucketName)
-	
-		putCollectionErr := collectionBucket.Put(collectionName, collectionName)
-		if putCollectionErr != nil { return false, putCollectionErr }
-	
-		indexBucketName := []byte(IndexBucket)
-		indexBucket := bucket.Bucket(indexBucketName)
-	
-		putIndexErr := indexBucket.Put(indexName, indexName)
-		if putIndexErr != nil { return false, putIndexErr }
-	}
-
-	return true, nil 
-}
-
-func (sm *StateMachine) createIndex(bucket *bolt.Bucket, collection string) ([]byte, error) {
+func (sm *CollectionStore) createIndex(bucket *bolt.Bucket, collection string) ([]byte, error) {
 	indexName := []byte(collection + IndexSuffix)
 	_, createErr := bucket.CreateBucketIfNotExists(indexName)
 	if createErr != nil { return nil, createErr }
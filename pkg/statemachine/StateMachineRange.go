@@ -0,0 +1,196 @@
+package statemachine
+
+import "bytes"
+import "encoding/base64"
+import "encoding/json"
+import "errors"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Range
+
+
+/*
+	Range In Collection
+		since bolt keys are sorted, a range query is a scan over an index of the collection between two bounds
+			--> if a field is passed in the payload, the secondary index on the field is scanned, and bounds are compared by
+				the order of the field values (null < false < true < numbers < strings)
+			--> otherwise, the index on the whole value is scanned, and bounds are compared against the json encoded values
+
+		1.) determine the bounds of the scan from the range options. gt/gte and lt/lte bound the values, and prefix only
+			matches string values starting with the prefix
+		2.) seek to the start of the range, or to the key after the cursor if continuing a previous range
+		3.) collect documents until the end of the range or the limit is reached
+		4.) if the limit was reached before the end of the range, return an opaque cursor which is passed in the range options
+			of the next request to continue from the last returned document
+*/
+
+func (sm *CollectionStore) rangeInCollection(bucket *bolt.Bucket, payload *StateMachineOpPayload) (*StateMachineResponse, error) {
+	response := &StateMachineResponse{ Collection: payload.Collection, Documents: []*Document{} }
+
+	opts := payload.Range
+	if opts == nil { opts = &RangeOpts{} }
+
+	limit := opts.Limit
+	if limit <= 0 { limit = DefaultRangeLimit }
+	if limit > MaxRangeLimit { limit = MaxRangeLimit }
+
+	collectionName := []byte(payload.Collection)
+	collection := bucket.Bucket(collectionName)
+	if collection == nil { return response, nil }
+
+	isSecondary := payload.Field != ""
+
+	indexName := []byte(payload.Collection + IndexSuffix)
+	if isSecondary { indexName = []byte(secondaryIndexName(payload.Collection, payload.Field)) }
+
+	index := bucket.Bucket(indexName)
+	if index == nil {
+		if isSecondary { return &StateMachineResponse{ Collection: payload.Collection, Error: "no index on field: " + payload.Field }, nil }
+		return response, nil
+	}
+
+	bounds, boundsErr := newRangeBounds(opts, isSecondary)
+	if boundsErr != nil { return &StateMachineResponse{ Collection: payload.Collection, Error: boundsErr.Error() }, nil }
+
+	var lastKey []byte
+	cursor := index.Cursor()
+
+	key, val := bounds.seek(cursor)
+	for ; key != nil; key, val = cursor.Next() {
+		if bounds.isPastEnd(key) { break }
+		if ! bounds.isInRange(key) { continue }
+
+		if len(response.Documents) == limit {
+			response.Cursor = base64.RawURLEncoding.EncodeToString(lastKey)
+			break
+		}
+
+		documentValue := collection.Get(val)
+		if documentValue == nil { continue }
+
+		response.Documents = append(response.Documents, newDocument(val, documentValue))
+		lastKey = append([]byte{}, key...)
+	}
+
+	return response, nil
+}
+
+/*
+	New Range Bounds
+		encode the bounds from the range options to index keys
+*/
+
+func newRangeBounds(opts *RangeOpts, isSecondary bool) (*rangeBounds, error) {
+	bounds := &rangeBounds{ isSecondary: isSecondary }
+
+	if len(opts.GreaterThan) > 0 && len(opts.GreaterThanOrEqual) > 0 { return nil, errors.New("only one of gt and gte can be set") }
+	if len(opts.LessThan) > 0 && len(opts.LessThanOrEqual) > 0 { return nil, errors.New("only one of lt and lte can be set") }
+
+	var encodeErr error
+
+	if len(opts.GreaterThan) > 0 {
+		bounds.lower, encodeErr = encodeRangeBound(opts.GreaterThan, isSecondary)
+		bounds.lowerExclusive = true
+	} else if len(opts.GreaterThanOrEqual) > 0 { bounds.lower, encodeErr = encodeRangeBound(opts.GreaterThanOrEqual, isSecondary) }
+	if encodeErr != nil { return nil, encodeErr }
+
+	if len(opts.LessThan) > 0 {
+		bounds.upper, encodeErr = encodeRangeBound(opts.LessThan, isSecondary)
+	} else if len(opts.LessThanOrEqual) > 0 {
+		bounds.upper, encodeErr = encodeRangeBound(opts.LessThanOrEqual, isSecondary)
+		bounds.upperInclusive = true
+	}
+	if encodeErr != nil { return nil, encodeErr }
+
+	if opts.Prefix != nil {
+		if isSecondary {
+			bounds.prefix = encodeIndexStringPrefix(*opts.Prefix)
+		} else {
+			encodedPrefix, encErr := json.Marshal(*opts.Prefix)
+			if encErr != nil { return nil, encErr }
+
+			bounds.prefix = encodedPrefix[:len(encodedPrefix) - 1] // drop the closing quote
+		}
+	}
+
+	if opts.Cursor != "" {
+		after, decodeErr := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if decodeErr != nil || len(after) == 0 { return nil, errors.New("invalid cursor") }
+
+		bounds.after = after
+	}
+
+	return bounds, nil
+}
+
+/*
+	Seek
+		position the cursor at the greatest of the lower bound, the prefix, and the range cursor
+*/
+
+func (bounds *rangeBounds) seek(cursor *bolt.Cursor) ([]byte, []byte) {
+	var start []byte
+	for _, candidate := range [][]byte{ bounds.lower, bounds.prefix, bounds.after } {
+		if candidate != nil && bytes.Compare(candidate, start) > 0 { start = candidate }
+	}
+
+	if start == nil { return cursor.First() }
+	return cursor.Seek(start)
+}
+
+/*
+	Is In Range, Is Past End
+		check an index key against the bounds
+			--> on secondary indexes, keys are the encoded value followed by the document key, so a key is for a value if
+				the encoded value is a prefix of the key
+			--> on the whole value index, keys are the json value followed by a zero byte and the document key, so a key is for
+				a value if the value and the separator are a prefix of the key
+*/
+
+func (bounds *rangeBounds) isInRange(key []byte) bool {
+	if bounds.lower != nil {
+		if bytes.Compare(key, bounds.lower) < 0 { return false }
+		if bounds.lowerExclusive && bounds.isForValue(key, bounds.lower) { return false }
+	}
+
+	if bounds.after != nil && bytes.Compare(key, bounds.after) <= 0 { return false }
+	if bounds.prefix != nil && ! bytes.HasPrefix(key, bounds.prefix) { return false }
+
+	return true
+}
+
+func (bounds *rangeBounds) isPastEnd(key []byte) bool {
+	if bounds.prefix != nil && bytes.Compare(key, bounds.prefix) > 0 && ! bytes.HasPrefix(key, bounds.prefix) { return true }
+
+	if bounds.upper != nil {
+		comparison := bytes.Compare(key, bounds.upper)
+		if bounds.upperInclusive { return comparison > 0 && ! bounds.isForValue(key, bounds.upper) }
+		return comparison >= 0
+	}
+
+	return false
+}
+
+func (bounds *rangeBounds) isForValue(key []byte, encodedValue []byte) bool {
+	if bounds.isSecondary { return bytes.HasPrefix(key, encodedValue) }
+	return bytes.HasPrefix(key, wholeValueIndexPrefix(encodedValue))
+}
+
+func encodeRangeBound(bound json.RawMessage, isSecondary bool) ([]byte, error) {
+	if isSecondary {
+		value, decodeErr := decodeDocument(bound)
+		if decodeErr != nil { return nil, decodeErr }
+
+		encoded, indexable := encodeIndexValue(value)
+		if ! indexable { return nil, errors.New("only null, boolean, number, and string values can be used as range bounds") }
+
+		return encoded, nil
+	}
+
+	var compacted bytes.Buffer
+	compactErr := json.Compact(&compacted, bound)
+	if compactErr != nil { return nil, compactErr }
+
+	return compacted.Bytes(), nil
+}
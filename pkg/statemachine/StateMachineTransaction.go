@@ -0,0 +1,117 @@
+package statemachine
+
+import "bytes"
+import "errors"
+import "strconv"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== State Machine Transaction
+
+
+/*
+	Apply Transaction
+		a transaction is a single command in the replicated log, carrying a list of operations and optional guards, which
+		is applied in its own bolt transaction so that either all operations are applied or none are
+			1.) check all guards against the current state of the collections. If any guard fails, nothing is applied and
+				the failed guard is returned as the error
+			2.) apply each operation in order. Operations see the writes of the operations before them, so reads like get and
+				find can also be included
+			3.) if any operation fails, roll back the bolt transaction and return the error of the failed operation along
+				with the results up to and including the failure, where an error from the operation is returned as a command
+				error
+			4.) otherwise, commit along with the index of the transaction as the applied index, and return the result of each
+				operation, along with the changes of all operations
+*/
+
+func (sm *CollectionStore) applyTransaction(txOp *StateMachineOperation) (*StateMachineResponse, error) {
+	var response *StateMachineResponse
+	payload := &txOp.Payload
+
+	transaction := func(tx *bolt.Tx) error {
+		rootName := []byte(RootBucket)
+		root := tx.Bucket(rootName)
+
+		if len(payload.Operations) == 0 {
+			response = &StateMachineResponse{ Error: "operations required for transaction" }
+			return nil
+		}
+
+		for idx, guard := range payload.Guards {
+			guardErr := sm.checkGuard(root, guard)
+			if guardErr != "" {
+				response = &StateMachineResponse{ Error: "guard " + strconv.Itoa(idx) + " failed: " + guardErr }
+				return nil
+			}
+		}
+
+		results := []*StateMachineResponse{}
+
+		for idx, op := range payload.Operations {
+			if op.Action == TRANSACTION {
+				response = &StateMachineResponse{ Results: results, Error: "operation " + strconv.Itoa(idx) + " failed: nested transactions are not supported" }
+				return ErrTransactionAborted
+			}
+
+			op.timestamp = txOp.timestamp
+			op.index = txOp.index
+
+			resp, applyErr := sm.applyOperation(root, op)
+			if applyErr != nil { return &CommandError{ Err: applyErr } }
+
+			results = append(results, resp)
+
+			if resp.Error != "" {
+				response = &StateMachineResponse{ Results: results, Error: "operation " + strconv.Itoa(idx) + " failed: " + resp.Error }
+				return ErrTransactionAborted
+			}
+		}
+
+		response = &StateMachineResponse{ Results: results }
+		for _, result := range results {
+			response.changes = append(response.changes, result.changes...)
+		}
+
+		return putAppliedIndex(root, txOp.index)
+	}
+
+	txErr := sm.timedUpdate(transaction)
+	if txErr != nil && ! errors.Is(txErr, ErrTransactionAborted) { return nil, txErr }
+
+	return response, nil
+}
+
+/*
+	Check Guard
+		check a guard against the document for its key, returning why the guard failed or an empty string if it passed
+			--> exists: whether the document must exist or not
+			--> version: the current version of the document, where 0 means the document does not exist
+			--> value: the current json value of the document
+*/
+
+func (sm *CollectionStore) checkGuard(bucket *bolt.Bucket, guard *TransactionGuard) string {
+	if sm.getCollectionMetadata(bucket, guard.Collection) == nil { return "collection not found: " + guard.Collection }
+	if guard.Key == "" { return "key required" }
+
+	collectionName := []byte(guard.Collection)
+	collection := bucket.Bucket(collectionName)
+
+	var currentVersion int64
+	var currentValue []byte
+
+	stored := collection.Get([]byte(guard.Key))
+	if stored != nil { currentVersion, currentValue = decodeStoredDocument(stored) }
+
+	if guard.Exists != nil && *guard.Exists != (stored != nil) {
+		if *guard.Exists { return "key does not exist: " + guard.Key }
+		return "key exists: " + guard.Key
+	}
+
+	if guard.Version != nil && *guard.Version != currentVersion {
+		return "version mismatch for key " + guard.Key + ": expected " + strconv.FormatInt(*guard.Version, 10) + ", current " + strconv.FormatInt(currentVersion, 10)
+	}
+
+	if len(guard.Value) > 0 && (stored == nil || ! bytes.Equal(guard.Value, currentValue)) { return "value mismatch for key: " + guard.Key }
+
+	return ""
+}
@@ -1,32 +1,238 @@
 package statemachine
 
+import "encoding/json"
+import "errors"
+import "io"
 import "sync"
+import "time"
 
 import bolt "go.etcd.io/bbolt"
 
 
+/*
+	State Machine:
+		the interface the replicated log applies committed commands to. Commands are opaque to the raft core, so
+		an application can supply any state machine that can apply batches of commands in log order, serve reads,
+		and serialize/deserialize its full state for snapshots
+*/
+
+type StateMachine interface {
+	Apply(commands [][]byte) ([][]byte, error)
+	Read(query []byte) ([]byte, error)
+	Snapshot(writer io.Writer) error
+	Restore(reader io.Reader) error
+}
+
+/*
+	Read Only Classifier:
+		optionally implemented by a state machine so the leader can serve read only commands directly from the
+		state machine instead of appending them to the replicated log
+*/
+
+type ReadOnlyClassifier interface {
+	IsReadOnly(command []byte) bool
+}
+
+/*
+	Command Applier:
+		optionally implemented by a state machine to apply the full commands from the log instead of only their data,
+		so it can use the timestamp the leader stamped on each command, and to report the changes made by each command,
+		which are published to watchers of the state machine along with the index of the log entry for the command
+*/
+
+type CommandApplier interface {
+	ApplyCommands(commands []*Command) ([][]byte, [][]*Change, error)
+}
+
+/*
+	Expirer:
+		optionally implemented by a state machine with data that expires. On an interval, the leader asks the state
+		machine for a command to expire everything that is due by the leader's clock, and appends it to the log. The
+		command is applied with the timestamp of the log entry, so every system expires exactly the same data
+*/
+
+type Expirer interface {
+	ExpireCommand(now int64) []byte
+}
+
+/*
+	Applied Indexer:
+		optionally implemented by a state machine that persists its state between restarts. The state machine stores the
+		index of the last command it applied in the same write as the command, so on startup the system resumes applying
+		from the entry after it, instead of applying entries that the state machine already contains again
+*/
+
+type AppliedIndexer interface {
+	AppliedIndex() (int64, error)
+}
+
+/*
+	Command Error:
+		an error caused by the command being applied, like an invalid operation, which fails the same way on every system
+		that applies the command. State machines return it so a failed command is answered with the error and skipped.
+		Any other error is treated as a failure of the system itself, like a disk error, and applying stops until it is
+		retried, since the command may succeed on other systems
+*/
+
+type CommandError struct {
+	Err error
+}
+
+type Change struct {
+	Type ChangeType `json:"type"`
+	Collection string `json:"collection"`
+	Key string `json:"key,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Version int64 `json:"version,omitempty"`
+}
+
+type Command struct {
+	RequestID string
+	TraceParent string
+	ReadOnly bool
+	Timestamp int64
+	Index int64 // set when the command is applied, to the index of its log entry
+	Data []byte
+}
+
+type Response struct {
+	RequestID string
+	Data []byte
+	Error string
+}
+
 type Action = string
+type ChangeType = string
 
 type StateMachineOpPayload struct {
 	Collection string `json:"collection"`
-	Value	string `json:"value"`
+	Key string `json:"key,omitempty"`
+	Version *int64 `json:"version,omitempty"`
+	TTLSeconds int64 `json:"ttlSeconds,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Token int64 `json:"token,omitempty"`
+	Field string `json:"field,omitempty"`
+	Unique bool `json:"unique,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Range *RangeOpts `json:"range,omitempty"`
+	Options *CollectionOptions `json:"options,omitempty"`
+	Operations []*StateMachineOperation `json:"operations,omitempty"`
+	Guards []*TransactionGuard `json:"guards,omitempty"`
+}
+
+type TransactionGuard struct {
+	Collection string `json:"collection"`
+	Key string `json:"key"`
+	Exists *bool `json:"exists,omitempty"`
+	Version *int64 `json:"version,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type CollectionOptions struct {
+	Indexes []*IndexOptions `json:"indexes,omitempty"`
+	MaxDocumentSize int `json:"maxDocumentSize,omitempty"`
+	DefaultTTLSeconds int64 `json:"defaultTTLSeconds,omitempty"`
+}
+
+type IndexOptions struct {
+	Field string `json:"field"`
+	Unique bool `json:"unique,omitempty"`
+}
+
+type RangeOpts struct {
+	GreaterThan json.RawMessage `json:"gt,omitempty"`
+	GreaterThanOrEqual json.RawMessage `json:"gte,omitempty"`
+	LessThan json.RawMessage `json:"lt,omitempty"`
+	LessThanOrEqual json.RawMessage `json:"lte,omitempty"`
+	Prefix *string `json:"prefix,omitempty"`
+	Limit int `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
 }
 
 type StateMachineOperation struct {
-	RequestID string `json:"-"`
 	Action Action `json:"action"`
 	Payload StateMachineOpPayload `json:"payload"`
+
+	timestamp int64
+	index int64
 }
 
 type StateMachineResponse struct {
-	RequestID string `json:"-"`
 	Collection string `json:"collection"`
 	Key string `json:"key"`
-	Value string `json:"value"`
+	Value json.RawMessage `json:"value"`
+	Version int64 `json:"version,omitempty"`
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	Documents []*Document `json:"documents,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Collections []*CollectionInfo `json:"collections,omitempty"`
+	Results []*StateMachineResponse `json:"results,omitempty"`
+	Lock *Lock `json:"lock,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	changes []*Change
+}
+
+type Document struct {
+	Key string `json:"key"`
+	Value json.RawMessage `json:"value"`
+	Version int64 `json:"version,omitempty"`
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+}
+
+type Lock struct {
+	Name string `json:"name"`
+	Owner string `json:"owner"`
+	Token int64 `json:"token"`
+	TTLSeconds int64 `json:"ttlSeconds"`
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+type rangeBounds struct {
+	lower []byte
+	lowerExclusive bool
+	upper []byte
+	upperInclusive bool
+	prefix []byte
+	after []byte
+	isSecondary bool
+}
+
+type IndexDefinition struct {
+	Collection string `json:"collection"`
+	Field string `json:"field"`
+	Unique bool `json:"unique,omitempty"`
+}
+
+type CollectionMetadata struct {
+	Name string `json:"name"`
+	Options CollectionOptions `json:"options"`
+}
+
+type CollectionInfo struct {
+	Name string `json:"name"`
+	Documents int `json:"documents"`
+	Indexes []string `json:"indexes"`
+	Options CollectionOptions `json:"options"`
+}
+
+type CollectionReport struct {
+	Collection string `json:"collection"`
+	Documents int `json:"documents"`
+	InvalidDocuments []string `json:"invalidDocuments,omitempty"`
+	Indexes []*IndexReport `json:"indexes"`
+	Errors []string `json:"errors,omitempty"`
 }
 
-type StateMachine struct {
-	Mutex sync.Mutex
+type IndexReport struct {
+	Index string `json:"index"`
+	Entries int `json:"entries"`
+	Missing []string `json:"missing,omitempty"`
+	Orphaned []string `json:"orphaned,omitempty"`
+}
+
+type CollectionStore struct {
+	Mutex sync.RWMutex
 	DBFile string
 	DB *bolt.DB
 }
@@ -36,19 +242,86 @@ const NAME = "StateMachine"
 const SubDirectory = "raft/statemachine"
 const FileNamePrefix = "statemachine"
 const DbFileName = FileNamePrefix + ".db"
+const RestoreSuffix = ".restore"
+const PreviousSuffix = ".previous"
+const RestoreOpenTimeout = 1 * time.Second
+const InspectOpenTimeout = 1 * time.Second
 
 const (
 	FIND Action = "find"
 	INSERT Action = "insert"
 	DELETE Action = "delete"
 	CREATECOLLECTION Action = "create collection"
+	CREATEINDEX Action = "create index"
 	DROPCOLLECTION Action = "drop collection"
 	LISTCOLLECTIONS Action = "list collections"
 	RANGE Action = "range"
+	GET Action = "get"
+	PUT Action = "put"
+	UPDATE Action = "update"
+	CAS Action = "compare and swap"
+	TRANSACTION Action = "transaction"
+	EXPIRE Action = "expire"
+	ACQUIRELOCK Action = "acquire lock"
+	RENEWLOCK Action = "renew lock"
+	RELEASELOCK Action = "release lock"
+	GETLOCK Action = "get lock"
+)
+
+const (
+	InsertChange ChangeType = "insert"
+	UpdateChange ChangeType = "update"
+	DeleteChange ChangeType = "delete"
+	DropChange ChangeType = "drop"
+	ExpireChange ChangeType = "expire"
+)
+
+const (
+	TxUpdate = "update"
+	TxView = "view"
 )
 
 const RootBucket = "root"
 const CollectionBucket = "collection"
 const IndexBucket = "index"
+const ExpiryBucket = "expiry"
+const LockBucket = "lock"
+const FormatVersionKey = "format version"
+const AppliedIndexKey = "applied index"
+const NoAppliedIndex = -1
+
+const (
+	DocumentHeaderFormatVersion int64 = 1
+	WholeValueIndexFormatVersion int64 = 2
+	FormatVersion = WholeValueIndexFormatVersion // the current on disk format version
+)
 
 const IndexSuffix = "_index"
+const WholeValueIndexSeparator byte = 0x00
+const SecondaryIndexInfix = "_index_"
+const FieldPathSeparator = "."
+
+const (
+	IndexNullTag byte = 0x01
+	IndexFalseTag byte = 0x02
+	IndexTrueTag byte = 0x03
+	IndexNumberTag byte = 0x04
+	IndexStringTag byte = 0x05
+)
+
+const IndexEscapeByte byte = 0x00
+const IndexEscapedNull byte = 0xFF
+const IndexStringTerminator byte = 0x01
+
+const DocumentHeaderBytes = 16 // version and expiry, 8 bytes each
+const VersionHeaderBytes = 8
+const MaxExpiredPerCommand = 1000
+const DefaultLockTTLSeconds = 30
+
+const DefaultRangeLimit = 100
+const MaxRangeLimit = 1000
+
+var ErrTransactionAborted = errors.New("transaction aborted")
+var ErrMissingRootBucket = errors.New("root buckets not found in state machine db")
+var ErrUnsupportedFormatVersion = errors.New("state machine db was written with a newer format version")
+var ErrFormatMigrationRequired = errors.New("state machine db is an older format version, open it read write to migrate it")
@@ -1,103 +1,103 @@
 package statemachine
 
+import "errors"
 import "io"
 import "os"
-import "path/filepath"
 import bolt "go.etcd.io/bbolt"
 
-import "github.com/sirgallo/raft/pkg/utils"
-
 
 //=========================================== Snapshot Utils
 
 
 /*
-	Snapshot State Machine
-		1.) generate the name for the snapshot file, which is db name and a uuid 
-		2.) open a new file for the snapshot to be written to
-		3.) open up a gzip stream to compress the file
-		4.) create a bolt transaction to write to the gzip stream
-		5.) if successful, return the snapshot path
+	Snapshot
+		implements the state machine interface for the collection store
+			1.) create a read transaction on the db, which gives a consistent view of the db while writes continue
+			2.) write the full db to the writer
 */
 
-func (sm *StateMachine) SnapshotStateMachine() (string, error) {
-	homedir, homeErr := os.UserHomeDir()
-	if homeErr != nil { return utils.GetZero[string](), homeErr }
-
-	snapshotFileName, fileNameErr := sm.generateFilename()
-	if fileNameErr != nil { return utils.GetZero[string](), fileNameErr }
-
-	snapshotPath := filepath.Join(homedir, SubDirectory, snapshotFileName)
-
-	snapshotFile, fCreateErr := os.Create(snapshotPath)
-	if fCreateErr != nil { return utils.GetZero[string](), fCreateErr }
-	
-	defer snapshotFile.Close()
-
+func (sm *CollectionStore) Snapshot(writer io.Writer) error {
 	transaction := func(tx *bolt.Tx) error {
-		_, writeErr := tx.WriteTo(snapshotFile)
+		_, writeErr := tx.WriteTo(writer)
 		if writeErr != nil { return writeErr }
 
 		return nil
 	}
 
-	snapshotErr := sm.DB.View(transaction)
-	if snapshotErr != nil { return utils.GetZero[string](), snapshotErr }
-
-	return snapshotPath, nil
+	return sm.timedView(transaction)
 }
 
 /*
-	Replay Snapshot
-		1.) using the filepath for the latest snapshot, open the file
-		2.) create a gzip reader
-		3.) close the db and remove the original db file
-		4.) recreate the same file and read the snapshot
-		5.) write the content of the snapshot to the newly created db file
-		6.) reopen the db
+	Restore
+		implements the state machine interface for the collection store
+			1.) write the content of the snapshot to a temporary file next to the db file, while reads and writes continue on
+				the current db
+			2.) take the db mutex exclusively, so no transaction is open on the db while it is swapped
+			3.) close the db, move the original db file aside, and move the temporary file in its place
+			4.) reopen the db, migrate it to the current format version if the snapshot was taken with an older version, and
+				remove the original db file
+			--> if the db can not be reopened from the snapshot, move the original db file back and reopen it, so the store
+				is never left closed
 */
 
-func (sm *StateMachine) ReplaySnapshot(snapshotPath string) error {
-	homedir, homeErr := os.UserHomeDir()
-	if homeErr != nil { return homeErr }
+func (sm *CollectionStore) Restore(reader io.Reader) error {
+	tempPath := sm.DBFile + RestoreSuffix
 
-	dbPath := filepath.Join(homedir, SubDirectory, DbFileName)
+	restoreFile, createFileErr := os.Create(tempPath)
+	if createFileErr != nil { return createFileErr }
 
-	snapshotFile, openErr := os.Open(snapshotPath)
-	if openErr != nil { return openErr }
-	defer snapshotFile.Close()
+	_, copyErr := io.Copy(restoreFile, reader)
+	closeFileErr := restoreFile.Close()
+	if copyErr != nil { return copyErr }
+	if closeFileErr != nil { return closeFileErr }
+
+	sm.Mutex.Lock()
+	defer sm.Mutex.Unlock()
 
 	closeErr := sm.DB.Close()
 	if closeErr != nil { return closeErr }
 
-	removeFilerr := os.Remove(dbPath)
-	if removeFilerr != nil && ! os.IsNotExist(removeFilerr) { return removeFilerr }
-	
-	databaseFile, createFileErr := os.Create(dbPath)
-	if createFileErr != nil { return createFileErr }
-	defer databaseFile.Close()
+	previousPath := sm.DBFile + PreviousSuffix
 
-	_, copyErr := io.Copy(databaseFile, snapshotFile)
-	if copyErr != nil { return copyErr }
+	renamePreviousErr := os.Rename(sm.DBFile, previousPath)
+	if renamePreviousErr != nil { return sm.reopen(sm.DBFile, renamePreviousErr) }
+
+	renameErr := os.Rename(tempPath, sm.DBFile)
+	if renameErr != nil { return sm.reopen(previousPath, renameErr) }
 
-	db, openErr := bolt.Open(dbPath, 0600, nil)
-	if openErr != nil { return openErr }
+	db, openErr := bolt.Open(sm.DBFile, 0600, &bolt.Options{ Timeout: RestoreOpenTimeout })
+	if openErr != nil { return sm.reopen(previousPath, openErr) }
+
+	migrateErr := migrateFormat(db)
+	if migrateErr != nil {
+		db.Close()
+		return sm.reopen(previousPath, migrateErr)
+	}
 
 	sm.DB = db
 
+	removeErr := os.Remove(previousPath)
+	if removeErr != nil { Log.Warn("unable to remove previous db file after restore:", removeErr.Error()) }
+
 	return nil
 }
 
 /*
-	generate Filename
-		--> generate the snapshot name, which is dbname_uniqueID
+	Reopen
+		on a failed restore, move the db file at the path back to the db file path if it was moved aside, and reopen it,
+		returning the error from the restore along with any error reopening the db
 */
 
-func (sm *StateMachine) generateFilename() (string, error) {
-	hash, hashErr := utils.GenerateRandomSHA256Hash()
-	if hashErr != nil { return utils.GetZero[string](), hashErr }
+func (sm *CollectionStore) reopen(dbPath string, restoreErr error) error {
+	if dbPath != sm.DBFile {
+		renameErr := os.Rename(dbPath, sm.DBFile)
+		if renameErr != nil { return errors.Join(restoreErr, renameErr) }
+	}
+
+	db, openErr := bolt.Open(sm.DBFile, 0600, &bolt.Options{ Timeout: RestoreOpenTimeout })
+	if openErr != nil { return errors.Join(restoreErr, openErr) }
 
-	snapshotName := func() string { return FileNamePrefix + "_" + hash }()
+	sm.DB = db
 
-	return snapshotName, nil
-}
\ No newline at end of file
+	return restoreErr
+}
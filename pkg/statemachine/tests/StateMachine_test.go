@@ -0,0 +1,954 @@
+package statemachinetest
+
+import "bytes"
+import "encoding/binary"
+import "encoding/json"
+import "errors"
+import "os"
+import "path/filepath"
+import "strings"
+import "sync"
+import "testing"
+import bolt "go.etcd.io/bbolt"
+
+import "github.com/sirgallo/raft/pkg/statemachine"
+
+
+func TestCollectionStoreApplyAndRead(t *testing.T) {
+	var sm statemachine.StateMachine = newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	results, applyErr := sm.Apply([][]byte{
+		encodeOperation(t, statemachine.INSERT, "users", "alice"),
+		[]byte("not json"),
+		encodeOperation(t, statemachine.INSERT, "users", "bob"),
+	})
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+	if len(results) != 3 { t.Fatalf("actual results not equal to expected: actual(%d), expected(%d)\n", len(results), 3) }
+
+	insertResp := decodeResponse(t, results[0])
+	if insertResp.Key == "" || string(insertResp.Value) != `"alice"` { t.Fatalf("unexpected insert response: %+v\n", insertResp) }
+
+	invalidResp := decodeResponse(t, results[1])
+	if invalidResp.Error == "" { t.Fatalf("expected error response for invalid command\n") }
+
+	readResult, readErr := sm.Read(encodeOperation(t, statemachine.FIND, "users", "bob"))
+	if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+
+	findResp := decodeResponse(t, readResult)
+	if string(findResp.Value) != `"bob"` { t.Fatalf("actual value not equal to expected: actual(%s), expected(%s)\n", findResp.Value, `"bob"`) }
+}
+
+func TestCollectionStoreIsReadOnly(t *testing.T) {
+	sm := newTestCollectionStore(t)
+
+	if ! statemachine.IsReadOnly(sm, encodeOperation(t, statemachine.FIND, "users", "alice")) { t.Fatalf("find should be read only\n") }
+	if statemachine.IsReadOnly(sm, encodeOperation(t, statemachine.INSERT, "users", "alice")) { t.Fatalf("insert should not be read only\n") }
+	if statemachine.IsReadOnly(sm, []byte("not json")) { t.Fatalf("invalid command should not be read only\n") }
+}
+
+func TestCollectionStoreSnapshotAndRestore(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	_, applyErr := sm.Apply([][]byte{ encodeOperation(t, statemachine.INSERT, "users", "alice") })
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	var snapshot bytes.Buffer
+	snapshotErr := sm.Snapshot(&snapshot)
+	if snapshotErr != nil { t.Fatalf("error taking snapshot: %s", snapshotErr.Error()) }
+
+	_, dropErr := sm.Apply([][]byte{ encodeOperation(t, statemachine.DROPCOLLECTION, "users", nil) })
+	if dropErr != nil { t.Fatalf("error applying commands: %s", dropErr.Error()) }
+
+	restoreErr := sm.Restore(&snapshot)
+	if restoreErr != nil { t.Fatalf("error restoring snapshot: %s", restoreErr.Error()) }
+
+	readResult, readErr := sm.Read(encodeOperation(t, statemachine.FIND, "users", "alice"))
+	if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+
+	findResp := decodeResponse(t, readResult)
+	if string(findResp.Value) != `"alice"` { t.Fatalf("actual value not equal to expected: actual(%s), expected(%s)\n", findResp.Value, `"alice"`) }
+}
+
+func TestCollectionStoreRestoreConcurrentReads(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	_, applyErr := sm.Apply([][]byte{ encodeOperation(t, statemachine.INSERT, "users", "alice") })
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	var snapshot bytes.Buffer
+	snapshotErr := sm.Snapshot(&snapshot)
+	if snapshotErr != nil { t.Fatalf("error taking snapshot: %s", snapshotErr.Error()) }
+
+	findAlice := encodeOperation(t, statemachine.FIND, "users", "alice")
+	stop := make(chan struct{})
+	readErrs := make(chan error, 4)
+
+	var readers sync.WaitGroup
+	for reader := 0; reader < 4; reader++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+
+			for {
+				select {
+					case <- stop:
+						return
+					default:
+				}
+
+				result, readErr := sm.Read(findAlice)
+				if readErr == nil {
+					resp := &statemachine.StateMachineResponse{}
+					readErr = json.Unmarshal(result, resp)
+					if readErr == nil && string(resp.Value) != `"alice"` { readErr = errors.New("document missing during restore") }
+				}
+
+				if readErr != nil {
+					readErrs <- readErr
+					return
+				}
+			}
+		}()
+	}
+
+	for restore := 0; restore < 20; restore++ {
+		restoreErr := sm.Restore(bytes.NewReader(snapshot.Bytes()))
+		if restoreErr != nil { t.Fatalf("error restoring snapshot: %s", restoreErr.Error()) }
+	}
+
+	invalidErr := sm.Restore(strings.NewReader(strings.Repeat("not a db", 4096)))
+	if invalidErr == nil { t.Fatalf("expected error restoring invalid snapshot\n") }
+
+	close(stop)
+	readers.Wait()
+	close(readErrs)
+
+	for readErr := range readErrs {
+		t.Fatalf("error reading during restore: %s", readErr.Error())
+	}
+
+	readResult, readErr := sm.Read(encodeOperation(t, statemachine.FIND, "users", "alice"))
+	if readErr != nil { t.Fatalf("error reading after invalid restore: %s", readErr.Error()) }
+
+	findResp := decodeResponse(t, readResult)
+	if string(findResp.Value) != `"alice"` { t.Fatalf("actual value not equal to expected: actual(%s), expected(%s)\n", findResp.Value, `"alice"`) }
+}
+
+func TestCollectionStoreSecondaryIndex(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	alice := map[string]interface{}{ "name": "alice", "age": 30, "address": map[string]interface{}{ "city": "boston" } }
+	bob := map[string]interface{}{ "name": "bob", "age": 30, "address": map[string]interface{}{ "city": "denver" } }
+	carol := map[string]interface{}{ "name": "carol", "age": -2.5, "address": map[string]interface{}{ "city": "boston" } }
+
+	_, applyErr := sm.Apply([][]byte{
+		encodeOperation(t, statemachine.INSERT, "users", alice),
+		encodeOperation(t, statemachine.INSERT, "users", bob),
+		encodeFieldOperation(t, statemachine.CREATEINDEX, "users", "address.city", nil),
+		encodeOperation(t, statemachine.INSERT, "users", carol),
+		encodeFieldOperation(t, statemachine.CREATEINDEX, "users", "age", nil),
+	})
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	expectDocuments := func(field string, value interface{}, expected int) []*statemachine.Document {
+		readResult, readErr := sm.Read(encodeFieldOperation(t, statemachine.FIND, "users", field, value))
+		if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+
+		findResp := decodeResponse(t, readResult)
+		if len(findResp.Documents) != expected { 
+			t.Fatalf("actual documents not equal to expected for %s: actual(%d), expected(%d)\n", field, len(findResp.Documents), expected) 
+		}
+
+		return findResp.Documents
+	}
+
+	expectDocuments("address.city", "boston", 2)
+	expectDocuments("age", 30, 2)
+	expectDocuments("age", -2.5, 1)
+	expectDocuments("name", "bob", 1) // no index on name, full scan
+
+	_, deleteErr := sm.Apply([][]byte{ encodeOperation(t, statemachine.DELETE, "users", alice) })
+	if deleteErr != nil { t.Fatalf("error applying commands: %s", deleteErr.Error()) }
+
+	remaining := expectDocuments("address.city", "boston", 1)
+	
+	var remainingDocument map[string]interface{}
+	json.Unmarshal(remaining[0].Value, &remainingDocument)
+	if remainingDocument["name"] != "carol" { t.Fatalf("actual document not equal to expected: actual(%s), expected(%s)\n", remainingDocument["name"], "carol") }
+}
+
+func TestCollectionStoreCorruptIndexDefinition(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	_, applyErr := sm.Apply([][]byte{ encodeFieldOperation(t, statemachine.CREATEINDEX, "users", "age", nil) })
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	corruptErr := sm.DB.Update(func(tx *bolt.Tx) error {
+		indexBucket := tx.Bucket([]byte(statemachine.RootBucket)).Bucket([]byte(statemachine.IndexBucket))
+		return indexBucket.Put([]byte("users" + statemachine.SecondaryIndexInfix + "age"), []byte("not json"))
+	})
+
+	if corruptErr != nil { t.Fatalf("error corrupting index definition: %s", corruptErr.Error()) }
+
+	results, recreateErr := sm.Apply([][]byte{ encodeFieldOperation(t, statemachine.CREATEINDEX, "users", "age", nil) })
+	if recreateErr != nil { t.Fatalf("error applying commands: %s", recreateErr.Error()) }
+	if decodeResponse(t, results[0]).Error == "" { t.Fatalf("expected error creating index with a corrupt definition\n") }
+}
+
+func TestCollectionStoreRange(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	var commands [][]byte
+	for age := 0; age < 10; age++ {
+		name := string(rune('a' + age)) + "user"
+		commands = append(commands, encodeOperation(t, statemachine.INSERT, "users", map[string]interface{}{ "name": name, "age": age }))
+	}
+
+	commands = append(commands, encodeFieldOperation(t, statemachine.CREATEINDEX, "users", "age", nil))
+	commands = append(commands, encodeFieldOperation(t, statemachine.CREATEINDEX, "users", "name", nil))
+
+	_, applyErr := sm.Apply(commands)
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	rangeQuery := func(field string, opts *statemachine.RangeOpts) *statemachine.StateMachineResponse {
+		op := &statemachine.StateMachineOperation{
+			Action: statemachine.RANGE,
+			Payload: statemachine.StateMachineOpPayload{ Collection: "users", Field: field, Range: opts },
+		}
+
+		encoded, encErr := json.Marshal(op)
+		if encErr != nil { t.Fatalf("error encoding operation: %s", encErr.Error()) }
+		if ! statemachine.IsReadOnly(sm, encoded) { t.Fatalf("range should be read only\n") }
+
+		readResult, readErr := sm.Read(encoded)
+		if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+
+		return decodeResponse(t, readResult)
+	}
+
+	ages := func(resp *statemachine.StateMachineResponse) []float64 {
+		var result []float64
+		for _, document := range resp.Documents {
+			var decoded map[string]interface{}
+			json.Unmarshal(document.Value, &decoded)
+			result = append(result, decoded["age"].(float64))
+		}
+
+		return result
+	}
+
+	bounded := rangeQuery("age", &statemachine.RangeOpts{ GreaterThan: json.RawMessage("2"), LessThanOrEqual: json.RawMessage("6") })
+	if got := ages(bounded); len(got) != 4 || got[0] != 3 || got[3] != 6 { t.Fatalf("unexpected range result: %v\n", got) }
+	if bounded.Cursor != "" { t.Fatalf("cursor should not be set when the range is complete\n") }
+
+	var paged []float64
+	opts := &statemachine.RangeOpts{ Limit: 3 }
+	for pages := 0; pages < 10; pages++ {
+		page := rangeQuery("age", opts)
+		paged = append(paged, ages(page)...)
+		
+		if page.Cursor == "" { break }
+		opts.Cursor = page.Cursor
+	}
+
+	if len(paged) != 10 { t.Fatalf("actual paged documents not equal to expected: actual(%d), expected(%d)\n", len(paged), 10) }
+	for idx, age := range paged {
+		if age != float64(idx) { t.Fatalf("paged documents out of order: %v\n", paged) }
+	}
+
+	prefix := "c"
+	prefixed := rangeQuery("name", &statemachine.RangeOpts{ Prefix: &prefix })
+	if got := ages(prefixed); len(got) != 1 || got[0] != 2 { t.Fatalf("unexpected prefix result: %v\n", got) }
+
+	missing := rangeQuery("email", &statemachine.RangeOpts{})
+	if missing.Error == "" { t.Fatalf("expected error for range on field without index\n") }
+}
+
+func TestCollectionStoreCreateCollection(t *testing.T) {
+	sm := newTestCollectionStore(t)
+
+	options := &statemachine.CollectionOptions{
+		Indexes: []*statemachine.IndexOptions{ { Field: "email", Unique: true }, { Field: "team" } },
+		MaxDocumentSize: 64,
+		DefaultTTLSeconds: 3600,
+	}
+
+	createCollection(t, sm, "users", options)
+
+	recreate := applyOperation(t, sm, &statemachine.StateMachineOperation{ 
+		Action: statemachine.CREATECOLLECTION,
+		Payload: statemachine.StateMachineOpPayload{ Collection: "users", Options: options },
+	})
+
+	if recreate.Error != "" { t.Fatalf("recreating with the same options should be a no-op: %s\n", recreate.Error) }
+
+	conflicting := applyOperation(t, sm, &statemachine.StateMachineOperation{ 
+		Action: statemachine.CREATECOLLECTION,
+		Payload: statemachine.StateMachineOpPayload{ Collection: "users" },
+	})
+
+	if conflicting.Error == "" { t.Fatalf("expected error recreating collection with different options\n") }
+
+	results, applyErr := sm.Apply([][]byte{
+		encodeOperation(t, statemachine.INSERT, "users", map[string]interface{}{ "email": "a@x.io", "team": "red" }),
+		encodeOperation(t, statemachine.INSERT, "users", map[string]interface{}{ "email": "b@x.io", "team": "red" }),
+		encodeOperation(t, statemachine.INSERT, "users", map[string]interface{}{ "email": "a@x.io", "team": "blue" }),
+		encodeOperation(t, statemachine.INSERT, "users", map[string]interface{}{ "email": "c@x.io", "team": "this document is larger than the max size" }),
+		encodeOperation(t, statemachine.INSERT, "missing", "value"),
+		encodeOperation(t, statemachine.DELETE, "missing", "value"),
+	})
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	for idx, expectError := range []bool{ false, false, true, true, true, true } {
+		resp := decodeResponse(t, results[idx])
+		if (resp.Error != "") != expectError { t.Fatalf("unexpected response for command %d: %+v\n", idx, resp) }
+	}
+
+	readResult, readErr := sm.Read(encodeOperation(t, statemachine.FIND, "missing", "value"))
+	if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+	if decodeResponse(t, readResult).Error == "" { t.Fatalf("expected error finding in missing collection\n") }
+
+	listResult, listErr := sm.Read(encodeOperation(t, statemachine.LISTCOLLECTIONS, "", nil))
+	if listErr != nil { t.Fatalf("error reading: %s", listErr.Error()) }
+
+	collections := decodeResponse(t, listResult).Collections
+	if len(collections) != 1 { t.Fatalf("actual collections not equal to expected: actual(%d), expected(%d)\n", len(collections), 1) }
+	if collections[0].Documents != 2 { t.Fatalf("actual documents not equal to expected: actual(%d), expected(%d)\n", collections[0].Documents, 2) }
+	if len(collections[0].Indexes) != 3 { t.Fatalf("actual indexes not equal to expected: actual(%v)\n", collections[0].Indexes) }
+	if collections[0].Options.MaxDocumentSize != 64 { t.Fatalf("options not returned with collection: %+v\n", collections[0].Options) }
+}
+
+func TestCollectionStoreKeyedOperations(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", &statemachine.CollectionOptions{ Indexes: []*statemachine.IndexOptions{ { Field: "email", Unique: true } } })
+
+	created := applyOperation(t, sm, keyedOperation(t, statemachine.PUT, "users", "u1", nil, map[string]interface{}{ "email": "a@x.io" }))
+	if created.Error != "" || created.Version != 1 { t.Fatalf("unexpected put response: %+v\n", created) }
+
+	replaced := applyOperation(t, sm, keyedOperation(t, statemachine.PUT, "users", "u1", nil, map[string]interface{}{ "email": "b@x.io" }))
+	if replaced.Error != "" || replaced.Version != 2 { t.Fatalf("unexpected put response: %+v\n", replaced) }
+
+	getResult, getErr := sm.Read(encodeKeyedOperation(t, keyedOperation(t, statemachine.GET, "users", "u1", nil, nil)))
+	if getErr != nil { t.Fatalf("error reading: %s", getErr.Error()) }
+
+	got := decodeResponse(t, getResult)
+	if string(got.Value) != `{"email":"b@x.io"}` || got.Version != 2 { t.Fatalf("unexpected get response: %+v\n", got) }
+
+	findResult, findErr := sm.Read(encodeFieldOperation(t, statemachine.FIND, "users", "email", "a@x.io"))
+	if findErr != nil { t.Fatalf("error reading: %s", findErr.Error()) }
+
+	oldEmail := decodeResponse(t, findResult)
+	if len(oldEmail.Documents) != 0 { t.Fatalf("secondary index not updated on put: %+v\n", oldEmail.Documents) }
+
+	missingUpdate := applyOperation(t, sm, keyedOperation(t, statemachine.UPDATE, "users", "u2", nil, map[string]interface{}{ "email": "c@x.io" }))
+	if missingUpdate.Error == "" { t.Fatalf("expected error updating missing key\n") }
+
+	staleVersion := int64(1)
+	stale := applyOperation(t, sm, keyedOperation(t, statemachine.CAS, "users", "u1", &staleVersion, map[string]interface{}{ "email": "c@x.io" }))
+	if stale.Error == "" || stale.Version != 2 { t.Fatalf("expected version mismatch: %+v\n", stale) }
+
+	currentVersion := int64(2)
+	swapped := applyOperation(t, sm, keyedOperation(t, statemachine.CAS, "users", "u1", &currentVersion, map[string]interface{}{ "email": "c@x.io" }))
+	if swapped.Error != "" || swapped.Version != 3 { t.Fatalf("unexpected compare and swap response: %+v\n", swapped) }
+
+	newVersion := int64(0)
+	createOnly := applyOperation(t, sm, keyedOperation(t, statemachine.CAS, "users", "u2", &newVersion, map[string]interface{}{ "email": "c@x.io" }))
+	if createOnly.Error == "" { t.Fatalf("expected unique index violation for another key\n") }
+
+	deleted := applyOperation(t, sm, keyedOperation(t, statemachine.DELETE, "users", "u1", &staleVersion, nil))
+	if deleted.Error == "" { t.Fatalf("expected version mismatch on delete\n") }
+
+	deleted = applyOperation(t, sm, keyedOperation(t, statemachine.DELETE, "users", "u1", nil, nil))
+	if deleted.Error != "" || deleted.Version != 3 { t.Fatalf("unexpected delete response: %+v\n", deleted) }
+
+	afterDelete := applyOperation(t, sm, keyedOperation(t, statemachine.GET, "users", "u1", nil, nil))
+	if afterDelete.Version != 0 { t.Fatalf("key still exists after delete: %+v\n", afterDelete) }
+
+	first := newTestCollectionStore(t)
+	createCollection(t, first, "users", nil)
+	insertOnFirst := applyOperation(t, first, keyedOperation(t, statemachine.INSERT, "users", "", nil, map[string]interface{}{ "email": "d@x.io" }))
+
+	insertOnSecond := applyOperation(t, sm, keyedOperation(t, statemachine.INSERT, "users", "", nil, map[string]interface{}{ "email": "d@x.io" }))
+	if insertOnFirst.Key == "" || insertOnFirst.Key != insertOnSecond.Key {
+		t.Fatalf("insert keys are not deterministic: first(%s), second(%s)\n", insertOnFirst.Key, insertOnSecond.Key)
+	}
+}
+
+func TestCollectionStoreSharedValueIndex(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	for _, key := range []string{ "u1", "u2" } {
+		put := applyOperation(t, sm, keyedOperation(t, statemachine.PUT, "users", key, nil, "shared"))
+		if put.Error != "" { t.Fatalf("unexpected put response: %+v\n", put) }
+	}
+
+	deleted := applyOperation(t, sm, keyedOperation(t, statemachine.DELETE, "users", "u2", nil, nil))
+	if deleted.Error != "" { t.Fatalf("unexpected delete response: %+v\n", deleted) }
+
+	findResult, findErr := sm.Read(encodeOperation(t, statemachine.FIND, "users", "shared"))
+	if findErr != nil { t.Fatalf("error reading: %s", findErr.Error()) }
+
+	found := decodeResponse(t, findResult)
+	if found.Key != "u1" || string(found.Value) != `"shared"` { t.Fatalf("expected remaining document u1 for shared value: %+v\n", found) }
+
+	ranged := applyOperation(t, sm, &statemachine.StateMachineOperation{
+		Action: statemachine.RANGE,
+		Payload: statemachine.StateMachineOpPayload{ Collection: "users", Range: &statemachine.RangeOpts{ LessThanOrEqual: []byte(`"shared"`) } },
+	})
+
+	if len(ranged.Documents) != 1 || ranged.Documents[0].Key != "u1" { t.Fatalf("unexpected range over shared value: %+v\n", ranged.Documents) }
+
+	report, verifyErr := sm.VerifyCollection("users")
+	if verifyErr != nil { t.Fatalf("error verifying collection: %s", verifyErr.Error()) }
+	if ! report.IsConsistent() { t.Fatalf("expected consistent collection: %+v\n", report.Indexes[0]) }
+}
+
+func TestCollectionStoreTransaction(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "accounts", nil)
+
+	applyOperation(t, sm, keyedOperation(t, statemachine.PUT, "accounts", "a", nil, map[string]interface{}{ "balance": 100 }))
+	applyOperation(t, sm, keyedOperation(t, statemachine.PUT, "accounts", "b", nil, map[string]interface{}{ "balance": 0 }))
+
+	exists := true
+	version := int64(1)
+
+	transfer := &statemachine.StateMachineOperation{
+		Action: statemachine.TRANSACTION,
+		Payload: statemachine.StateMachineOpPayload{
+			Guards: []*statemachine.TransactionGuard{
+				{ Collection: "accounts", Key: "a", Version: &version },
+				{ Collection: "accounts", Key: "b", Exists: &exists, Value: json.RawMessage(`{ "balance": 0 }`) },
+			},
+			Operations: []*statemachine.StateMachineOperation{
+				keyedOperation(t, statemachine.PUT, "accounts", "a", nil, map[string]interface{}{ "balance": 50 }),
+				keyedOperation(t, statemachine.PUT, "accounts", "b", nil, map[string]interface{}{ "balance": 50 }),
+				keyedOperation(t, statemachine.GET, "accounts", "b", nil, nil),
+			},
+		},
+	}
+
+	results, applyErr := sm.Apply([][]byte{
+		encodeKeyedOperation(t, transfer),
+		encodeKeyedOperation(t, transfer),
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "accounts", "c", nil, map[string]interface{}{ "balance": 0 })),
+	})
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	committed := decodeResponse(t, results[0])
+	if committed.Error != "" || len(committed.Results) != 3 { t.Fatalf("unexpected transaction response: %+v\n", committed) }
+	if string(committed.Results[2].Value) != `{"balance":50}` { t.Fatalf("transaction read did not see its own write: %s\n", committed.Results[2].Value) }
+
+	guarded := decodeResponse(t, results[1])
+	if guarded.Error == "" || len(guarded.Results) != 0 { t.Fatalf("expected guard failure: %+v\n", guarded) }
+
+	if decodeResponse(t, results[2]).Error != "" { t.Fatalf("command after failed transaction was not applied\n") }
+
+	aborted := applyOperation(t, sm, &statemachine.StateMachineOperation{
+		Action: statemachine.TRANSACTION,
+		Payload: statemachine.StateMachineOpPayload{
+			Operations: []*statemachine.StateMachineOperation{
+				keyedOperation(t, statemachine.PUT, "accounts", "a", nil, map[string]interface{}{ "balance": 0 }),
+				keyedOperation(t, statemachine.UPDATE, "accounts", "missing", nil, map[string]interface{}{ "balance": 0 }),
+			},
+		},
+	})
+
+	if aborted.Error == "" || len(aborted.Results) != 2 { t.Fatalf("expected failed operation: %+v\n", aborted) }
+
+	account := applyOperation(t, sm, keyedOperation(t, statemachine.GET, "accounts", "a", nil, nil))
+	if string(account.Value) != `{"balance":50}` || account.Version != 2 { t.Fatalf("failed transaction was not rolled back: %+v\n", account) }
+}
+
+func TestCollectionStoreAppliedIndex(t *testing.T) {
+	sm := newTestCollectionStore(t)
+
+	appliedIndex := func(expected int64) {
+		index, indexErr := statemachine.AppliedIndex(sm)
+		if indexErr != nil { t.Fatalf("error getting applied index: %s", indexErr.Error()) }
+		if index != expected { t.Errorf("expected applied index %d, got %d\n", expected, index) }
+	}
+
+	apply := func(index int64, op *statemachine.StateMachineOperation) {
+		_, _, applyErr := statemachine.ApplyCommands(sm, []*statemachine.Command{ { Index: index, Data: encodeKeyedOperation(t, op) } })
+		if applyErr != nil { t.Fatalf("error applying command: %s", applyErr.Error()) }
+	}
+
+	appliedIndex(statemachine.NoAppliedIndex)
+
+	_, _, batchErr := statemachine.ApplyCommands(sm, []*statemachine.Command{
+		{ Index: 3, Data: encodeKeyedOperation(t, &statemachine.StateMachineOperation{ Action: statemachine.CREATECOLLECTION, Payload: statemachine.StateMachineOpPayload{ Collection: "users" } }) },
+		{ Index: 4, Data: encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "users", "a", nil, "alice")) },
+	})
+
+	if batchErr != nil { t.Fatalf("error applying commands: %s", batchErr.Error()) }
+	appliedIndex(4)
+
+	apply(6, &statemachine.StateMachineOperation{
+		Action: statemachine.TRANSACTION,
+		Payload: statemachine.StateMachineOpPayload{
+			Operations: []*statemachine.StateMachineOperation{ keyedOperation(t, statemachine.PUT, "users", "b", nil, "bob") },
+		},
+	})
+
+	appliedIndex(6)
+
+	apply(2, keyedOperation(t, statemachine.PUT, "users", "c", nil, "carol"))
+	appliedIndex(6)
+
+	sm.DB.Close()
+
+	reopened, reopenErr := statemachine.NewCollectionStore()
+	if reopenErr != nil { t.Fatalf("error reopening collection store: %s", reopenErr.Error()) }
+
+	defer reopened.DB.Close()
+
+	index, indexErr := reopened.AppliedIndex()
+	if indexErr != nil { t.Fatalf("error getting applied index: %s", indexErr.Error()) }
+	if index != 6 { t.Errorf("expected applied index 6 after reopening, got %d\n", index) }
+}
+
+func TestCollectionStoreErrorIsolation(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	tooLargeForIndex := strings.Repeat("x", bolt.MaxKeySize)
+
+	results, applyErr := sm.Apply([][]byte{
+		encodeOperation(t, statemachine.INSERT, "users", "first"),
+		encodeOperation(t, statemachine.INSERT, "users", tooLargeForIndex),
+		encodeOperation(t, statemachine.INSERT, "users", "second"),
+		encodeOperation(t, statemachine.DROPCOLLECTION, "missing", nil),
+	})
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	for idx, expectError := range []bool{ false, true, false, true } {
+		resp := decodeResponse(t, results[idx])
+		if (resp.Error != "") != expectError { t.Fatalf("unexpected response for command %d: %+v\n", idx, resp) }
+	}
+
+	for _, value := range []string{ "first", "second" } {
+		readResult, readErr := sm.Read(encodeOperation(t, statemachine.FIND, "users", value))
+		if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+		if decodeResponse(t, readResult).Key == "" { t.Fatalf("command in failed batch was not applied: %s\n", value) }
+	}
+}
+
+func TestCollectionStoreSystemError(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	sm.DB.Close()
+
+	_, applyErr := sm.Apply([][]byte{ encodeOperation(t, statemachine.INSERT, "users", "first") })
+	if applyErr == nil { t.Fatalf("expected error applying to a closed db\n") }
+	if statemachine.IsCommandError(applyErr) { t.Fatalf("expected system error, got command error: %s\n", applyErr.Error()) }
+}
+
+func TestCollectionStoreChanges(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "users", nil)
+
+	_, changes, applyErr := statemachine.ApplyCommands(sm, timestampedCommands(0,
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "users", "u1", nil, "first")),
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "users", "u1", nil, "second")),
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.GET, "users", "u1", nil, nil)),
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.DELETE, "users", "u1", nil, nil)),
+		encodeOperation(t, statemachine.DROPCOLLECTION, "users", nil),
+	))
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	expected := []statemachine.ChangeType{ statemachine.InsertChange, statemachine.UpdateChange, "", statemachine.DeleteChange, statemachine.DropChange }
+	for idx, changeType := range expected {
+		if changeType == "" {
+			if len(changes[idx]) != 0 { t.Fatalf("unexpected changes for read command: %+v\n", changes[idx]) }
+			continue
+		}
+
+		if len(changes[idx]) != 1 || changes[idx][0].Type != changeType { t.Fatalf("unexpected changes for command %d: %+v\n", idx, changes[idx]) }
+	}
+}
+
+func TestCollectionStoreExpiry(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	createCollection(t, sm, "sessions", &statemachine.CollectionOptions{ DefaultTTLSeconds: 60 })
+
+	session := keyedOperation(t, statemachine.PUT, "sessions", "s1", nil, "session")
+	shortSession := keyedOperation(t, statemachine.PUT, "sessions", "s2", nil, "short session")
+	shortSession.Payload.TTLSeconds = 10
+
+	results, _, applyErr := statemachine.ApplyCommands(sm, timestampedCommands(1000,
+		encodeKeyedOperation(t, session),
+		encodeKeyedOperation(t, shortSession),
+	))
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	for idx, expiresAt := range []int64{ 61000, 11000 } {
+		resp := decodeResponse(t, results[idx])
+		if resp.ExpiresAt != expiresAt { t.Fatalf("actual expiry not equal to expected: actual(%d), expected(%d)\n", resp.ExpiresAt, expiresAt) }
+	}
+
+	if statemachine.ExpireCommand(sm, 10999) != nil { t.Fatalf("expire command returned before any document is due\n") }
+
+	expireCommand := statemachine.ExpireCommand(sm, 11000)
+	if expireCommand == nil { t.Fatalf("no expire command returned for due document\n") }
+
+	_, changes, expireErr := statemachine.ApplyCommands(sm, timestampedCommands(11000, expireCommand))
+	if expireErr != nil { t.Fatalf("error applying expire command: %s", expireErr.Error()) }
+	if len(changes[0]) != 1 || changes[0][0].Type != statemachine.ExpireChange || changes[0][0].Key != "s2" {
+		t.Fatalf("unexpected changes for expire command: %+v\n", changes[0])
+	}
+
+	expired := applyOperation(t, sm, keyedOperation(t, statemachine.GET, "sessions", "s2", nil, nil))
+	if expired.Version != 0 { t.Fatalf("expired document still exists: %+v\n", expired) }
+
+	findResult, findErr := sm.Read(encodeOperation(t, statemachine.FIND, "sessions", "short session"))
+	if findErr != nil { t.Fatalf("error reading: %s", findErr.Error()) }
+	if decodeResponse(t, findResult).Key != "" { t.Fatalf("expired document still in index\n") }
+
+	remaining := applyOperation(t, sm, keyedOperation(t, statemachine.GET, "sessions", "s1", nil, nil))
+	if remaining.Version != 1 || remaining.ExpiresAt != 61000 { t.Fatalf("unexpected document expired: %+v\n", remaining) }
+
+	refreshed, _, refreshErr := statemachine.ApplyCommands(sm, timestampedCommands(30000, encodeKeyedOperation(t, session)))
+	if refreshErr != nil { t.Fatalf("error applying commands: %s", refreshErr.Error()) }
+	if decodeResponse(t, refreshed[0]).ExpiresAt != 90000 { t.Fatalf("expiry not refreshed on write: %s\n", refreshed[0]) }
+
+	if statemachine.ExpireCommand(sm, 61000) != nil { t.Fatalf("expire command returned for expiry replaced by a write\n") }
+}
+
+func TestCollectionStoreLocks(t *testing.T) {
+	sm := newTestCollectionStore(t)
+
+	acquire := lockCommand(t, statemachine.ACQUIRELOCK, "leader", "a", 0, 10)
+	acquireOther := lockCommand(t, statemachine.ACQUIRELOCK, "leader", "b", 0, 10)
+
+	acquired := applyLockCommand(t, sm, 1000, 5, acquire)
+	if acquired.Error != "" || acquired.Lock.Token != 5 || acquired.Lock.ExpiresAt != 11000 { t.Fatalf("unexpected acquire response: %+v\n", acquired) }
+
+	held := applyLockCommand(t, sm, 2000, 6, acquireOther)
+	if held.Error == "" || held.Lock.Owner != "a" { t.Fatalf("lock acquired while held by another owner: %+v\n", held) }
+
+	wrongToken := applyLockCommand(t, sm, 3000, 7, lockCommand(t, statemachine.RENEWLOCK, "leader", "a", 4, 0))
+	if wrongToken.Error == "" { t.Fatalf("lock renewed with wrong token: %+v\n", wrongToken) }
+
+	renewed := applyLockCommand(t, sm, 3000, 8, lockCommand(t, statemachine.RENEWLOCK, "leader", "a", 5, 20))
+	if renewed.Error != "" || renewed.Lock.Token != 5 || renewed.Lock.ExpiresAt != 23000 { t.Fatalf("unexpected renew response: %+v\n", renewed) }
+
+	if statemachine.ExpireCommand(sm, 11000) != nil { t.Fatalf("expire command returned for expiry replaced by a renew\n") }
+
+	getResult, getErr := sm.Read(lockCommand(t, statemachine.GETLOCK, "leader", "", 0, 0))
+	if getErr != nil { t.Fatalf("error reading lock: %s", getErr.Error()) }
+	if current := decodeResponse(t, getResult).Lock; current == nil || current.Owner != "a" { t.Fatalf("unexpected lock holder: %+v\n", current) }
+
+	expireCommand := statemachine.ExpireCommand(sm, 23000)
+	if expireCommand == nil { t.Fatalf("no expire command returned for due lock\n") }
+
+	_, changes, expireErr := statemachine.ApplyCommands(sm, []*statemachine.Command{ { Timestamp: 23000, Index: 9, Data: expireCommand } })
+	if expireErr != nil { t.Fatalf("error applying expire command: %s", expireErr.Error()) }
+	if len(changes[0]) != 1 || changes[0][0].Type != statemachine.ExpireChange || changes[0][0].Key != "leader" {
+		t.Fatalf("unexpected changes for expire command: %+v\n", changes[0])
+	}
+
+	reacquired := applyLockCommand(t, sm, 24000, 10, acquireOther)
+	if reacquired.Error != "" || reacquired.Lock.Owner != "b" || reacquired.Lock.Token != 10 { t.Fatalf("unexpected acquire response: %+v\n", reacquired) }
+
+	notOwner := applyLockCommand(t, sm, 25000, 11, lockCommand(t, statemachine.RELEASELOCK, "leader", "a", 0, 0))
+	if notOwner.Error == "" { t.Fatalf("lock released by another owner: %+v\n", notOwner) }
+
+	released := applyLockCommand(t, sm, 25000, 12, lockCommand(t, statemachine.RELEASELOCK, "leader", "b", 10, 0))
+	if released.Error != "" { t.Fatalf("error releasing lock: %s", released.Error) }
+
+	if statemachine.ExpireCommand(sm, 100000) != nil { t.Fatalf("expire command returned for released lock\n") }
+
+	untimed := applyOperation(t, sm, &statemachine.StateMachineOperation{
+		Action: statemachine.ACQUIRELOCK,
+		Payload: statemachine.StateMachineOpPayload{ Key: "leader", Owner: "a" },
+	})
+
+	if untimed.Error == "" { t.Fatalf("lock acquired without a timestamp: %+v\n", untimed) }
+}
+
+func TestCollectionStoreInspectAndImport(t *testing.T) {
+	sm := newTestCollectionStore(t)
+	options := &statemachine.CollectionOptions{ Indexes: []*statemachine.IndexOptions{ { Field: "name", Unique: true } } }
+	createCollection(t, sm, "users", options)
+
+	_, applyErr := sm.Apply([][]byte{
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "users", "alice", nil, map[string]interface{}{ "name": "alice" })),
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "users", "alice", nil, map[string]interface{}{ "name": "alice", "age": 30 })),
+		encodeKeyedOperation(t, keyedOperation(t, statemachine.PUT, "users", "bob", nil, map[string]interface{}{ "name": "bob" })),
+	})
+
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	sm.DB.Close()
+
+	inspected, openErr := statemachine.OpenCollectionStoreFile(sm.DBFile, true)
+	if openErr != nil { t.Fatalf("error opening state machine db: %s", openErr.Error()) }
+
+	collections, listErr := inspected.Collections()
+	if listErr != nil { t.Fatalf("error listing collections: %s", listErr.Error()) }
+	if len(collections) != 1 || collections[0].Name != "users" || len(collections[0].Indexes) != 2 {
+		t.Fatalf("unexpected collections: %+v\n", collections)
+	}
+
+	total, countErr := inspected.CountDocuments("users")
+	if countErr != nil { t.Fatalf("error counting documents: %s", countErr.Error()) }
+	if total != 2 { t.Fatalf("actual documents not equal to expected: actual(%d), expected(%d)\n", total, 2) }
+
+	_, missingErr := inspected.CountDocuments("missing")
+	if missingErr == nil { t.Fatalf("expected error counting documents in a missing collection\n") }
+
+	report, verifyErr := inspected.VerifyCollection("users")
+	if verifyErr != nil { t.Fatalf("error verifying collection: %s", verifyErr.Error()) }
+	if ! report.IsConsistent() || report.Documents != 2 { t.Fatalf("expected consistent collection: %+v\n", report) }
+
+	var export bytes.Buffer
+	exported, exportErr := inspected.ExportCollection("users", &export)
+	if exportErr != nil { t.Fatalf("error exporting collection: %s", exportErr.Error()) }
+	if exported != 2 { t.Fatalf("actual exported not equal to expected: actual(%d), expected(%d)\n", exported, 2) }
+
+	inspected.DB.Close()
+
+	corrupted, reopenErr := statemachine.OpenCollectionStoreFile(sm.DBFile, false)
+	if reopenErr != nil { t.Fatalf("error opening state machine db: %s", reopenErr.Error()) }
+	defer corrupted.DB.Close()
+
+	corruptErr := corrupted.DB.Update(func(tx *bolt.Tx) error {
+		index := tx.Bucket([]byte(statemachine.RootBucket)).Bucket([]byte("users" + statemachine.IndexSuffix))
+		return index.Delete([]byte("{\"name\":\"bob\"}\x00bob"))
+	})
+
+	if corruptErr != nil { t.Fatalf("error corrupting index: %s", corruptErr.Error()) }
+
+	corruptReport, verifyCorruptErr := corrupted.VerifyCollection("users")
+	if verifyCorruptErr != nil { t.Fatalf("error verifying collection: %s", verifyCorruptErr.Error()) }
+	if corruptReport.IsConsistent() || len(corruptReport.Indexes[0].Missing) != 1 || corruptReport.Indexes[0].Missing[0] != "bob" {
+		t.Fatalf("expected missing index entry for bob: %+v\n", corruptReport.Indexes[0])
+	}
+
+	imported, importErr := corrupted.ImportCollection(bytes.NewReader(export.Bytes()), "people")
+	if importErr != nil { t.Fatalf("error importing collection: %s", importErr.Error()) }
+	if imported != 2 { t.Fatalf("actual imported not equal to expected: actual(%d), expected(%d)\n", imported, 2) }
+
+	importReport, verifyImportErr := corrupted.VerifyCollection("people")
+	if verifyImportErr != nil { t.Fatalf("error verifying collection: %s", verifyImportErr.Error()) }
+	if ! importReport.IsConsistent() || len(importReport.Indexes) != 2 || importReport.Indexes[1].Entries != 2 {
+		t.Fatalf("expected consistent imported collection: %+v\n", importReport)
+	}
+
+	var dump bytes.Buffer
+	_, dumpErr := corrupted.DumpCollection("people", &dump)
+	if dumpErr != nil { t.Fatalf("error dumping collection: %s", dumpErr.Error()) }
+
+	var alice *statemachine.Document
+	json.Unmarshal(bytes.SplitN(dump.Bytes(), []byte("\n"), 2)[0], &alice)
+	if alice.Key != "alice" || alice.Version != 2 { t.Fatalf("expected version to be kept on import: %+v\n", alice) }
+
+	duplicate := `{"name":"people","options":{}}` + "\n" + `{"key":"carol","value":{"name":"bob"}}` + "\n"
+	_, duplicateErr := corrupted.ImportCollection(strings.NewReader(duplicate), "people")
+	if duplicateErr == nil { t.Fatalf("expected error importing a collection with different options\n") }
+}
+
+func TestCollectionStoreFormatMigration(t *testing.T) {
+	homedir := t.TempDir()
+	t.Setenv("HOME", homedir)
+
+	mkdirErr := os.MkdirAll(filepath.Join(homedir, statemachine.SubDirectory), 0755)
+	if mkdirErr != nil { t.Fatalf("error creating state machine directory: %s", mkdirErr.Error()) }
+
+	dbPath := filepath.Join(homedir, statemachine.SubDirectory, statemachine.DbFileName)
+
+	header := func(version int64, headerBytes int) []byte {
+		encoded := make([]byte, headerBytes)
+		binary.BigEndian.PutUint64(encoded, uint64(version))
+		return encoded
+	}
+
+	documents := map[string][]byte{
+		"raw": []byte(`{"name":"raw document value"}`),
+		"versioned": append(header(3, statemachine.VersionHeaderBytes), `{"name":"versioned document"}`...),
+		"current": append(header(2, statemachine.DocumentHeaderBytes), `{"name":"current document"}`...),
+	}
+
+	db, openErr := bolt.Open(dbPath, 0600, nil)
+	if openErr != nil { t.Fatalf("error opening db: %s", openErr.Error()) }
+
+	writeErr := db.Update(func(tx *bolt.Tx) error {
+		root, _ := tx.CreateBucketIfNotExists([]byte(statemachine.RootBucket))
+		collectionBucket, _ := root.CreateBucketIfNotExists([]byte(statemachine.CollectionBucket))
+		root.CreateBucketIfNotExists([]byte(statemachine.IndexBucket))
+		collectionBucket.Put([]byte("users"), []byte("users"))
+
+		users, createErr := root.CreateBucketIfNotExists([]byte("users"))
+		if createErr != nil { return createErr }
+
+		for key, stored := range documents {
+			putErr := users.Put([]byte(key), stored)
+			if putErr != nil { return putErr }
+		}
+
+		return nil
+	})
+
+	if writeErr != nil { t.Fatalf("error writing unversioned db: %s", writeErr.Error()) }
+	db.Close()
+
+	_, readOnlyErr := statemachine.OpenCollectionStoreFile(dbPath, true)
+	if readOnlyErr != statemachine.ErrFormatMigrationRequired { t.Fatalf("expected migration required, got: %v\n", readOnlyErr) }
+
+	sm, smErr := statemachine.NewCollectionStore()
+	if smErr != nil { t.Fatalf("error creating collection store: %s", smErr.Error()) }
+
+	expected := map[string]struct{ value string; version int64 }{
+		"raw": { `{"name":"raw document value"}`, 1 },
+		"versioned": { `{"name":"versioned document"}`, 3 },
+		"current": { `{"name":"current document"}`, 2 },
+	}
+
+	for key, document := range expected {
+		result, readErr := sm.Read(encodeKeyedOperation(t, keyedOperation(t, statemachine.GET, "users", key, nil, nil)))
+		if readErr != nil { t.Fatalf("error reading: %s", readErr.Error()) }
+
+		resp := decodeResponse(t, result)
+		if string(resp.Value) != document.value || resp.Version != document.version {
+			t.Errorf("unexpected document for %s after migration: value(%s), version(%d)\n", key, resp.Value, resp.Version)
+		}
+	}
+
+	findResult, findErr := sm.Read(encodeOperation(t, statemachine.FIND, "users", map[string]string{ "name": "raw document value" }))
+	if findErr != nil { t.Fatalf("error reading: %s", findErr.Error()) }
+	if found := decodeResponse(t, findResult); found.Key != "raw" { t.Errorf("expected index rebuilt for migrated documents: %+v\n", found) }
+
+	sm.DB.Close()
+
+	migrated, migratedErr := statemachine.OpenCollectionStoreFile(dbPath, true)
+	if migratedErr != nil { t.Fatalf("error opening migrated db read only: %s", migratedErr.Error()) }
+	migrated.DB.Close()
+}
+
+func createCollection(t *testing.T, sm statemachine.StateMachine, collection string, options *statemachine.CollectionOptions) {
+	resp := applyOperation(t, sm, &statemachine.StateMachineOperation{ 
+		Action: statemachine.CREATECOLLECTION,
+		Payload: statemachine.StateMachineOpPayload{ Collection: collection, Options: options },
+	})
+
+	if resp.Error != "" { t.Fatalf("error creating collection: %s", resp.Error) }
+}
+
+func applyOperation(t *testing.T, sm statemachine.StateMachine, op *statemachine.StateMachineOperation) *statemachine.StateMachineResponse {
+	encoded, encErr := json.Marshal(op)
+	if encErr != nil { t.Fatalf("error encoding operation: %s", encErr.Error()) }
+
+	results, applyErr := sm.Apply([][]byte{ encoded })
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	return decodeResponse(t, results[0])
+}
+
+func newTestCollectionStore(t *testing.T) *statemachine.CollectionStore {
+	homedir := t.TempDir()
+	t.Setenv("HOME", homedir)
+
+	mkdirErr := os.MkdirAll(filepath.Join(homedir, statemachine.SubDirectory), 0755)
+	if mkdirErr != nil { t.Fatalf("error creating state machine directory: %s", mkdirErr.Error()) }
+
+	sm, smErr := statemachine.NewCollectionStore()
+	if smErr != nil { t.Fatalf("error creating collection store: %s", smErr.Error()) }
+
+	t.Cleanup(func() { sm.DB.Close() })
+
+	return sm
+}
+
+func encodeOperation(t *testing.T, action statemachine.Action, collection string, value interface{}) []byte {
+	return encodeFieldOperation(t, action, collection, "", value)
+}
+
+func encodeFieldOperation(t *testing.T, action statemachine.Action, collection string, field string, value interface{}) []byte {
+	op := &statemachine.StateMachineOperation{
+		Action: action,
+		Payload: statemachine.StateMachineOpPayload{ Collection: collection, Field: field },
+	}
+
+	if value != nil {
+		encodedValue, encErr := json.Marshal(value)
+		if encErr != nil { t.Fatalf("error encoding value: %s", encErr.Error()) }
+
+		op.Payload.Value = encodedValue
+	}
+
+	encoded, encErr := json.Marshal(op)
+	if encErr != nil { t.Fatalf("error encoding operation: %s", encErr.Error()) }
+
+	return encoded
+}
+
+func decodeResponse(t *testing.T, result []byte) *statemachine.StateMachineResponse {
+	var resp *statemachine.StateMachineResponse
+
+	decodeErr := json.Unmarshal(result, &resp)
+	if decodeErr != nil { t.Fatalf("error decoding response: %s", decodeErr.Error()) }
+
+	return resp
+}
+
+func keyedOperation(t *testing.T, action statemachine.Action, collection string, key string, version *int64, value interface{}) *statemachine.StateMachineOperation {
+	op := &statemachine.StateMachineOperation{
+		Action: action,
+		Payload: statemachine.StateMachineOpPayload{ Collection: collection, Key: key, Version: version },
+	}
+
+	if value != nil {
+		encodedValue, encErr := json.Marshal(value)
+		if encErr != nil { t.Fatalf("error encoding value: %s", encErr.Error()) }
+
+		op.Payload.Value = encodedValue
+	}
+
+	return op
+}
+
+func encodeKeyedOperation(t *testing.T, op *statemachine.StateMachineOperation) []byte {
+	encoded, encErr := json.Marshal(op)
+	if encErr != nil { t.Fatalf("error encoding operation: %s", encErr.Error()) }
+
+	return encoded
+}
+
+func timestampedCommands(timestamp int64, data ...[]byte) []*statemachine.Command {
+	commands := make([]*statemachine.Command, len(data))
+	for idx, command := range data {
+		commands[idx] = &statemachine.Command{ Timestamp: timestamp, Data: command }
+	}
+
+	return commands
+}
+
+func lockCommand(t *testing.T, action statemachine.Action, name string, owner string, token int64, ttlSeconds int64) []byte {
+	return encodeKeyedOperation(t, &statemachine.StateMachineOperation{
+		Action: action,
+		Payload: statemachine.StateMachineOpPayload{ Key: name, Owner: owner, Token: token, TTLSeconds: ttlSeconds },
+	})
+}
+
+func applyLockCommand(t *testing.T, sm statemachine.StateMachine, timestamp int64, index int64, command []byte) *statemachine.StateMachineResponse {
+	results, _, applyErr := statemachine.ApplyCommands(sm, []*statemachine.Command{ { Timestamp: timestamp, Index: index, Data: command } })
+	if applyErr != nil { t.Fatalf("error applying commands: %s", applyErr.Error()) }
+
+	return decodeResponse(t, results[0])
+}
@@ -3,6 +3,7 @@ package system
 import "sync/atomic"
 
 import "github.com/sirgallo/raft/pkg/logger"
+import "github.com/sirgallo/raft/pkg/metrics"
 import "github.com/sirgallo/raft/pkg/utils"
 
 
@@ -33,9 +34,12 @@ func (sys *System) TransitionToFollower(opts StateTransitionOpts) bool {
 		sys.VotedFor = *opts.VotedFor 
 	} else { resetVotedFor(sys) }
 
-	if opts.CurrentTerm != nil { sys.CurrentTerm = *opts.CurrentTerm }
+	if opts.CurrentTerm != nil && *opts.CurrentTerm != sys.CurrentTerm { 
+		sys.CurrentTerm = *opts.CurrentTerm 
+		sys.recordTermChange()
+	}
 
-	Log.Warn("service with hostname:", sys.Host, "transitioned to follower.")
+	Log.With("host", sys.Host, "term", sys.CurrentTerm).Warn("transitioned to follower.")
 	return true
 }
 
@@ -53,8 +57,9 @@ func (sys *System) TransitionToCandidate() bool {
 	sys.State = Candidate
 	sys.CurrentTerm = sys.CurrentTerm + int64(1)
 	sys.VotedFor = sys.Host
+	sys.recordTermChange()
 
-	Log.Warn("service with hostname:", sys.Host, "transitioned to candidate, starting election.")
+	Log.With("host", sys.Host, "term", sys.CurrentTerm).Warn("transitioned to candidate, starting election.")
 	return true
 }
 
@@ -69,7 +74,7 @@ func (sys *System) TransitionToLeader() bool {
 
 	sys.State = Leader
 
-	Log.Warn("service with hostname:", sys.Host, "has been elected leader.")
+	Log.With("host", sys.Host, "term", sys.CurrentTerm).Warn("has been elected leader.")
 	return true
 }
 
@@ -122,20 +127,73 @@ func (sys *System) UpdateNextIndex(newIndex int64) bool {
 	return true
 }
 
+/*
+	Update Match Index:
+		1.) update the highest log index known to be replicated on a particular system
+			--> the match index only moves forward, so stale responses can not move it back
+*/
+
+func (sys *System) UpdateMatchIndex(newIndex int64) bool {
+	sys.SystemMutex.Lock()
+	defer sys.SystemMutex.Unlock()
+
+	if newIndex > sys.MatchIndex { sys.MatchIndex = newIndex }
+
+	return true
+}
+
+/*
+	Get Match Index:
+		1.) read the match index under the system mutex, since it is updated by the replication go routines
+*/
+
+func (sys *System) GetMatchIndex() int64 {
+	sys.SystemMutex.Lock()
+	defer sys.SystemMutex.Unlock()
+
+	return sys.MatchIndex
+}
+
+/*
+	Reset Match Index:
+		1.) on a new leader being elected, nothing is known to be replicated on the system yet
+*/
+
+func (sys *System) ResetMatchIndex() bool {
+	sys.SystemMutex.Lock()
+	defer sys.SystemMutex.Unlock()
+
+	sys.MatchIndex = DefaultLastLogIndex
+
+	return true
+}
+
+/*
+	Increment Commit Index, Update Commit Index, Update Last Applied:
+		atomically update the commit index and last applied index, recording the entries
+		committed/applied and the lag between the two
+*/
+
 func(sys *System) IncrementCommitIndex() bool {
 	atomic.AddInt64(&sys.CommitIndex, 1)
+	metrics.EntriesCommitted.Inc()
+	sys.recordCommitApplyLag()
 
 	return true
 }
 
 func(sys *System) UpdateCommitIndex(newCommitIndex int64) bool {
-	atomic.StoreInt64(&sys.CommitIndex, newCommitIndex)
+	prevCommitIndex := atomic.SwapInt64(&sys.CommitIndex, newCommitIndex)
+	if newCommitIndex > prevCommitIndex { metrics.EntriesCommitted.Add(float64(newCommitIndex - prevCommitIndex)) }
+	sys.recordCommitApplyLag()
 
 	return true
 }
 
 func(sys *System) UpdateLastApplied(newLastAppliedIndex int64) bool {
-	atomic.StoreInt64(&sys.LastApplied, newLastAppliedIndex)
+	prevLastApplied := atomic.SwapInt64(&sys.LastApplied, newLastAppliedIndex)
+	if newLastAppliedIndex > prevLastApplied { metrics.EntriesApplied.Add(float64(newLastAppliedIndex - prevLastApplied)) }
+	sys.recordCommitApplyLag()
 	
 	return true
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import "sync"
 
 import "github.com/sirgallo/raft/pkg/statemachine"
 import "github.com/sirgallo/raft/pkg/wal"
+import "github.com/sirgallo/raft/pkg/watch"
 
 
 type SystemState string
@@ -21,11 +22,14 @@ type System struct {
 	CurrentLeader string
 
 	WAL *wal.WAL
-	StateMachine *statemachine.StateMachine
+	StateMachine statemachine.StateMachine
+	Changes *watch.ChangeStream
 
 	NextIndex int64
+	MatchIndex int64
 
 	SystemMutex sync.Mutex
+	ApplyMutex sync.Mutex // held while applying entries to the state machine, so snapshots see a state machine at last applied
 }
 
 type StateTransitionOpts struct {
@@ -1,5 +1,9 @@
 package system
 
+import "sync/atomic"
+
+import "github.com/sirgallo/raft/pkg/metrics"
+
 
 //=========================================== System Utils
 
@@ -9,7 +13,9 @@ package system
 		get the last index and term from the replicated log
 		1.) if the log length is greater than 0
 			get the log at the end of the replicated log and return its index and term
-		2.) otherwise
+		2.) otherwise if the log was discarded when a snapshot was installed, return the last included index and term
+			of the snapshot, since the next entry on the system follows the snapshot
+		3.) otherwise
 			we can assume this is a new system, so we default the index to -1 and term to 0
 			to indicate this
 */
@@ -24,9 +30,39 @@ func (sys *System) DetermineLastLogIdxAndTerm() (int64, int64, error) {
 		lastLogIndex = lastLog.Index
 		lastLogTerm = lastLog.Term
 	} else {
-		lastLogIndex = DefaultLastLogIndex // -1 symbolizes empty log
-		lastLogTerm = DefaultLastLogTerm
+		snapshotEntry, snapshotErr := sys.WAL.GetSnapshot()
+		if snapshotErr != nil { return 0, 0, snapshotErr }
+
+		if snapshotEntry != nil {
+			lastLogIndex = snapshotEntry.LastIncludedIndex
+			lastLogTerm = snapshotEntry.LastIncludedTerm
+		} else {
+			lastLogIndex = DefaultLastLogIndex // -1 symbolizes empty log
+			lastLogTerm = DefaultLastLogTerm
+		}
 	}
 
 	return lastLogIndex, lastLogTerm, nil
+}
+
+/*
+	Record Term Change:
+		update the term metrics, called while holding the system mutex on term updates
+*/
+
+func (sys *System) recordTermChange() {
+	metrics.TermChanges.Inc()
+	metrics.CurrentTerm.Set(float64(sys.CurrentTerm))
+}
+
+/*
+	Record Commit Apply Lag:
+		the lag is the number of committed entries that have not yet been applied to the state machine
+*/
+
+func (sys *System) recordCommitApplyLag() {
+	lag := atomic.LoadInt64(&sys.CommitIndex) - atomic.LoadInt64(&sys.LastApplied)
+	if lag < 0 { lag = 0 }
+
+	metrics.CommitApplyLag.Set(float64(lag))
 }
\ No newline at end of file
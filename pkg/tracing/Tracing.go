@@ -0,0 +1,264 @@
+package tracing
+
+import "errors"
+import "math/rand"
+import "os"
+import "strconv"
+import "time"
+
+import "github.com/sirgallo/raft/pkg/logger"
+
+
+//=========================================== Tracing
+
+
+var Log = clog.NewCustomLog(NAME)
+
+/*
+	the tracer is shared by every module in the process
+
+	by default no exporter is configured, in which case tracing is disabled and starting a span
+	returns nil, which is safe to call all span methods on
+*/
+
+var globalTracer = &tracer{ sampleRatio: 1 }
+
+/*
+	Configure:
+		set the exporter for the tracer and start the export loop
+			1.) none --> tracing is disabled
+			2.) file --> finished spans are written as json lines to the file path
+			3.) otlp --> finished spans are sent in batches to an OTLP/HTTP collector
+*/
+
+func Configure(opts TracerOpts) error {
+	exporter, exporterErr := func() (Exporter, error) {
+		switch opts.Exporter {
+			case "", NoExporter:
+				return nil, nil
+			case FileExporterType:
+				return NewFileExporter(opts.FilePath)
+			case OTLPExporterType:
+				return NewOTLPExporter(opts.OTLPEndpoint, opts.ServiceName)
+			default:
+				return nil, errors.New("unknown trace exporter: " + opts.Exporter)
+		}
+	}()
+
+	if exporterErr != nil { return exporterErr }
+
+	sampleRatio := opts.SampleRatio
+	if sampleRatio <= 0 || sampleRatio > 1 { sampleRatio = 1 }
+
+	globalTracer.Mutex.Lock()
+	defer globalTracer.Mutex.Unlock()
+
+	globalTracer.exporter = exporter
+	globalTracer.sampleRatio = sampleRatio
+
+	if exporter != nil && globalTracer.spanChannel == nil {
+		globalTracer.spanChannel = make(chan *Span, SpanBuffSize)
+		globalTracer.flushSignal = make(chan chan bool)
+
+		go globalTracer.exportLoop()
+	}
+
+	return nil
+}
+
+/*
+	Opts From Env:
+		build tracer options from the environment
+			TRACE_EXPORTER --> none, file, or otlp
+			TRACE_FILE --> file path for the file exporter
+			TRACE_OTLP_ENDPOINT --> base url of the OTLP/HTTP collector, for example http://collector:4318
+			TRACE_SERVICE_NAME --> service name reported to the collector
+			TRACE_SAMPLE_RATIO --> fraction of new traces to sample, between 0 and 1
+*/
+
+func OptsFromEnv() (TracerOpts, error) {
+	opts := TracerOpts{
+		Exporter: os.Getenv(TraceExporterEnv),
+		FilePath: os.Getenv(TraceFileEnv),
+		OTLPEndpoint: os.Getenv(TraceOTLPEndpointEnv),
+		ServiceName: os.Getenv(TraceServiceNameEnv),
+		SampleRatio: 1,
+	}
+
+	sampleRatio := os.Getenv(TraceSampleRatioEnv)
+	if sampleRatio != "" {
+		parsedRatio, parseErr := strconv.ParseFloat(sampleRatio, 64)
+		if parseErr != nil { return opts, parseErr }
+
+		opts.SampleRatio = parsedRatio
+	}
+
+	return opts, nil
+}
+
+/*
+	Enabled:
+		tracing is enabled when an exporter has been configured
+*/
+
+func Enabled() bool {
+	globalTracer.Mutex.RLock()
+	defer globalTracer.Mutex.RUnlock()
+
+	return globalTracer.exporter != nil
+}
+
+/*
+	Start Span:
+		1.) if tracing is disabled, return nil
+		2.) if the parent context is valid, the span joins the parent trace and inherits its sampling decision
+		3.) otherwise, start a new trace and decide whether or not to sample it
+*/
+
+func StartSpan(name string, parent SpanContext) *Span {
+	globalTracer.Mutex.RLock()
+	enabled := globalTracer.exporter != nil
+	sampleRatio := globalTracer.sampleRatio
+	globalTracer.Mutex.RUnlock()
+
+	if ! enabled { return nil }
+
+	spanContext := SpanContext{ SpanID: generateID(SpanIDBytes) }
+
+	if parent.IsValid() {
+		spanContext.TraceID = parent.TraceID
+		spanContext.Sampled = parent.Sampled
+	} else {
+		spanContext.TraceID = generateID(TraceIDBytes)
+		spanContext.Sampled = rand.Float64() < sampleRatio
+	}
+
+	return &Span{
+		Name: name,
+		Context: spanContext,
+		ParentSpanID: parent.SpanID,
+		StartTime: time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+}
+
+/*
+	Span Context:
+		get the context of the span to propagate to child spans, the zero context if the span is nil
+*/
+
+func (span *Span) SpanContext() SpanContext {
+	if span == nil { return SpanContext{} }
+	return span.Context
+}
+
+func (span *Span) SetAttribute(key string, value interface{}) {
+	if span == nil { return }
+
+	span.Mutex.Lock()
+	defer span.Mutex.Unlock()
+
+	span.Attributes[key] = value
+}
+
+func (span *Span) SetError(err error) {
+	if span == nil || err == nil { return }
+
+	span.Mutex.Lock()
+	defer span.Mutex.Unlock()
+
+	span.StatusError = err.Error()
+}
+
+/*
+	End:
+		mark the span as finished and queue it for export if sampled
+			--> ending a span more than once is a no-op
+			--> if the export buffer is full, the span is dropped instead of blocking the caller
+*/
+
+func (span *Span) End() {
+	if span == nil { return }
+
+	span.Mutex.Lock()
+	if span.ended {
+		span.Mutex.Unlock()
+		return
+	}
+
+	span.ended = true
+	span.EndTime = time.Now()
+	span.Mutex.Unlock()
+
+	if ! span.Context.Sampled { return }
+
+	globalTracer.Mutex.RLock()
+	spanChannel := globalTracer.spanChannel
+	globalTracer.Mutex.RUnlock()
+
+	if spanChannel == nil { return }
+
+	select {
+		case spanChannel <- span:
+		default:
+	}
+}
+
+/*
+	Flush:
+		block until all spans queued so far have been exported
+*/
+
+func Flush() {
+	globalTracer.Mutex.RLock()
+	flushSignal := globalTracer.flushSignal
+	globalTracer.Mutex.RUnlock()
+
+	if flushSignal == nil { return }
+
+	done := make(chan bool)
+	flushSignal <- done
+	<- done
+}
+
+/*
+	Export Loop:
+		batch finished spans and export when the batch is full or on an interval
+*/
+
+func (tr *tracer) exportLoop() {
+	var batch []*Span
+	ticker := time.NewTicker(ExportInterval)
+
+	export := func() {
+		if len(batch) == 0 { return }
+
+		tr.Mutex.RLock()
+		exporter := tr.exporter
+		tr.Mutex.RUnlock()
+
+		if exporter != nil {
+			exportErr := exporter.Export(batch)
+			if exportErr != nil { Log.Error("error exporting spans:", exportErr.Error()) }
+		}
+
+		batch = nil
+	}
+
+	for {
+		select {
+			case span := <- tr.spanChannel:
+				batch = append(batch, span)
+				if len(batch) >= ExportBatchSize { export() }
+			case <- ticker.C:
+				export()
+			case done := <- tr.flushSignal:
+				for len(tr.spanChannel) > 0 {
+					batch = append(batch, <- tr.spanChannel)
+				}
+
+				export()
+				done <- true
+		}
+	}
+}
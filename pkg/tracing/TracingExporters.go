@@ -0,0 +1,192 @@
+package tracing
+
+import "bytes"
+import "context"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "io"
+import "net/http"
+import "os"
+import "path/filepath"
+import "strconv"
+import "strings"
+
+
+//=========================================== Tracing Exporters
+
+
+/*
+	File Exporter
+		write each finished span as a single json line to a local file, appending if the file exists
+			{"traceId":...,"spanId":...,"parentSpanId":...,"name":...,"start":...,"end":...,"durationMs":...,"attributes":{...}}
+*/
+
+func NewFileExporter(filePath string) (*FileExporter, error) {
+	if filePath == "" { return nil, errors.New("file path required for file exporter") }
+
+	mkdirErr := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if mkdirErr != nil { return nil, mkdirErr }
+
+	file, openErr := os.OpenFile(filePath, os.O_CREATE | os.O_WRONLY | os.O_APPEND, 0644)
+	if openErr != nil { return nil, openErr }
+
+	return NewWriterExporter(file), nil
+}
+
+/*
+	Writer Exporter
+		same as the file exporter, but for any writer
+*/
+
+func NewWriterExporter(writer io.Writer) *FileExporter {
+	return &FileExporter{ writer: writer }
+}
+
+func (fileExporter *FileExporter) Export(spans []*Span) error {
+	fileExporter.Mutex.Lock()
+	defer fileExporter.Mutex.Unlock()
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+
+	for _, span := range spans {
+		span.Mutex.Lock()
+		record := map[string]interface{}{
+			"traceId": span.Context.TraceID,
+			"spanId": span.Context.SpanID,
+			"parentSpanId": span.ParentSpanID,
+			"name": span.Name,
+			"start": span.StartTime,
+			"end": span.EndTime,
+			"durationMs": float64(span.EndTime.Sub(span.StartTime).Microseconds()) / 1000,
+			"attributes": span.Attributes,
+		}
+
+		if span.StatusError != "" { record["error"] = span.StatusError }
+		span.Mutex.Unlock()
+
+		encodeErr := encoder.Encode(record)
+		if encodeErr != nil { return encodeErr }
+	}
+
+	_, writeErr := fileExporter.writer.Write(buffer.Bytes())
+	return writeErr
+}
+
+/*
+	OTLP Exporter
+		send batches of finished spans to an OTLP/HTTP collector using the json protobuf encoding
+			POST <endpoint>/v1/traces
+			{ resourceSpans: [{ resource: {...}, scopeSpans: [{ scope: {...}, spans: [...] }] }] }
+*/
+
+func NewOTLPExporter(endpoint string, serviceName string) (*OTLPExporter, error) {
+	if endpoint == "" { return nil, errors.New("endpoint required for otlp exporter") }
+	if serviceName == "" { serviceName = DefaultServiceName }
+
+	hostname, hostErr := os.Hostname()
+	if hostErr != nil { return nil, hostErr }
+
+	return &OTLPExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/") + OTLPTracesPath,
+		serviceName: serviceName,
+		hostname: hostname,
+		client: &http.Client{ Timeout: ExportTimeout },
+	}, nil
+}
+
+func (otlpExporter *OTLPExporter) Export(spans []*Span) error {
+	var otlpSpans []map[string]interface{}
+
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, transformSpanToOTLP(span))
+	}
+
+	body := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{
+			{
+				"resource": map[string]interface{}{
+					"attributes": []map[string]interface{}{
+						otlpAttribute("service.name", otlpExporter.serviceName),
+						otlpAttribute("host.name", otlpExporter.hostname),
+					},
+				},
+				"scopeSpans": []map[string]interface{}{
+					{
+						"scope": map[string]interface{}{ "name": ScopeName },
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+
+	encoded, encErr := json.Marshal(body)
+	if encErr != nil { return encErr }
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExportTimeout)
+	defer cancel()
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, otlpExporter.endpoint, bytes.NewReader(encoded))
+	if reqErr != nil { return reqErr }
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, postErr := otlpExporter.client.Do(req)
+	if postErr != nil { return postErr }
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 { return fmt.Errorf("otlp collector returned status: %d", resp.StatusCode) }
+	return nil
+}
+
+func transformSpanToOTLP(span *Span) map[string]interface{} {
+	span.Mutex.Lock()
+	defer span.Mutex.Unlock()
+
+	var attributes []map[string]interface{}
+	for key, value := range span.Attributes {
+		attributes = append(attributes, otlpAttribute(key, value))
+	}
+
+	status := map[string]interface{}{ "code": OTLPStatusOk }
+	if span.StatusError != "" { status = map[string]interface{}{ "code": OTLPStatusError, "message": span.StatusError } }
+
+	otlpSpan := map[string]interface{}{
+		"traceId": span.Context.TraceID,
+		"spanId": span.Context.SpanID,
+		"name": span.Name,
+		"kind": OTLPSpanKindInternal,
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		"endTimeUnixNano": strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		"attributes": attributes,
+		"status": status,
+	}
+
+	if span.ParentSpanID != "" { otlpSpan["parentSpanId"] = span.ParentSpanID }
+	return otlpSpan
+}
+
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	otlpValue := func() map[string]interface{} {
+		switch typedValue := value.(type) {
+			case string:
+				return map[string]interface{}{ "stringValue": typedValue }
+			case bool:
+				return map[string]interface{}{ "boolValue": typedValue }
+			case int:
+				return map[string]interface{}{ "intValue": strconv.FormatInt(int64(typedValue), 10) }
+			case int64:
+				return map[string]interface{}{ "intValue": strconv.FormatInt(typedValue, 10) }
+			case float64:
+				return map[string]interface{}{ "doubleValue": typedValue }
+			default:
+				return map[string]interface{}{ "stringValue": fmt.Sprint(typedValue) }
+		}
+	}()
+
+	return map[string]interface{}{ "key": key, "value": otlpValue }
+}
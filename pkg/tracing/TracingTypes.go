@@ -0,0 +1,96 @@
+package tracing
+
+import "io"
+import "net/http"
+import "sync"
+import "time"
+
+
+type SpanContext struct {
+	TraceID string
+	SpanID string
+	Sampled bool
+}
+
+type Span struct {
+	Mutex sync.Mutex
+	Name string
+	Context SpanContext
+	ParentSpanID string
+	StartTime time.Time
+	EndTime time.Time
+	Attributes map[string]interface{}
+	StatusError string
+	ended bool
+}
+
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+type ExporterType = string
+
+type TracerOpts struct {
+	Exporter ExporterType
+	FilePath string
+	OTLPEndpoint string
+	ServiceName string
+	SampleRatio float64
+}
+
+type tracer struct {
+	Mutex sync.RWMutex
+	exporter Exporter
+	sampleRatio float64
+	spanChannel chan *Span
+	flushSignal chan chan bool
+}
+
+type FileExporter struct {
+	Mutex sync.Mutex
+	writer io.Writer
+}
+
+type OTLPExporter struct {
+	endpoint string
+	serviceName string
+	hostname string
+	client *http.Client
+}
+
+
+const NAME = "Tracing"
+
+const (
+	NoExporter ExporterType = "none"
+	FileExporterType ExporterType = "file"
+	OTLPExporterType ExporterType = "otlp"
+)
+
+const TraceIDBytes = 16
+const SpanIDBytes = 8
+
+const TraceParentHeader = "traceparent"
+const TraceParentVersion = "00"
+const SampledFlag = "01"
+const NotSampledFlag = "00"
+
+const ScopeName = "github.com/sirgallo/raft"
+const DefaultServiceName = "raft"
+const OTLPTracesPath = "/v1/traces"
+const OTLPSpanKindInternal = 1
+const OTLPStatusOk = 1
+const OTLPStatusError = 2
+
+const SpanBuffSize = 100000
+const ExportBatchSize = 512
+const ExportInterval = 1 * time.Second
+const ExportTimeout = 5 * time.Second
+
+const (
+	TraceExporterEnv = "TRACE_EXPORTER"
+	TraceFileEnv = "TRACE_FILE"
+	TraceOTLPEndpointEnv = "TRACE_OTLP_ENDPOINT"
+	TraceServiceNameEnv = "TRACE_SERVICE_NAME"
+	TraceSampleRatioEnv = "TRACE_SAMPLE_RATIO"
+)
@@ -0,0 +1,87 @@
+package tracing
+
+import "context"
+import "crypto/rand"
+import "encoding/hex"
+import "strings"
+import "google.golang.org/grpc/metadata"
+
+
+//=========================================== Tracing Utils
+
+
+/*
+	Is Valid:
+		a span context is valid if both the trace id and span id are set
+*/
+
+func (spanContext SpanContext) IsValid() bool {
+	return spanContext.TraceID != "" && spanContext.SpanID != ""
+}
+
+/*
+	Trace Parent:
+		format the span context as a w3c traceparent
+			version-traceid-spanid-flags --> 00-<32 hex>-<16 hex>-01
+*/
+
+func (spanContext SpanContext) TraceParent() string {
+	if ! spanContext.IsValid() { return "" }
+
+	flags := NotSampledFlag
+	if spanContext.Sampled { flags = SampledFlag }
+
+	return strings.Join([]string{ TraceParentVersion, spanContext.TraceID, spanContext.SpanID, flags }, "-")
+}
+
+/*
+	Parse Trace Parent:
+		parse a w3c traceparent back into a span context, the zero context if malformed
+*/
+
+func ParseTraceParent(traceParent string) SpanContext {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) != 4 || len(parts[1]) != TraceIDBytes * 2 || len(parts[2]) != SpanIDBytes * 2 { return SpanContext{} }
+
+	_, traceIDErr := hex.DecodeString(parts[1])
+	_, spanIDErr := hex.DecodeString(parts[2])
+	if traceIDErr != nil || spanIDErr != nil { return SpanContext{} }
+
+	return SpanContext{
+		TraceID: parts[1],
+		SpanID: parts[2],
+		Sampled: parts[3] == SampledFlag,
+	}
+}
+
+/*
+	Inject Metadata:
+		add the span context to outgoing grpc metadata on the context
+*/
+
+func InjectMetadata(ctx context.Context, spanContext SpanContext) context.Context {
+	if ! spanContext.IsValid() { return ctx }
+	return metadata.AppendToOutgoingContext(ctx, TraceParentHeader, spanContext.TraceParent())
+}
+
+/*
+	Extract Metadata:
+		get the span context from incoming grpc metadata, the zero context if not present
+*/
+
+func ExtractMetadata(ctx context.Context) SpanContext {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ! ok { return SpanContext{} }
+
+	values := md.Get(TraceParentHeader)
+	if len(values) == 0 { return SpanContext{} }
+
+	return ParseTraceParent(values[0])
+}
+
+func generateID(numBytes int) string {
+	id := make([]byte, numBytes)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,82 @@
+package tracingtests
+
+import "bufio"
+import "encoding/json"
+import "os"
+import "path/filepath"
+import "testing"
+
+import "github.com/sirgallo/raft/pkg/tracing"
+
+
+func TestTraceParent(t *testing.T) {
+	configureErr := tracing.Configure(tracing.TracerOpts{ Exporter: tracing.FileExporterType, FilePath: filepath.Join(t.TempDir(), "traces.jsonl") })
+	if configureErr != nil { t.Fatalf("error configuring tracer: %s", configureErr.Error()) }
+
+	span := tracing.StartSpan("test", tracing.SpanContext{})
+	traceParent := span.SpanContext().TraceParent()
+
+	parsed := tracing.ParseTraceParent(traceParent)
+	t.Logf("actual: %+v, expected: %+v\n", parsed, span.SpanContext())
+	if parsed != span.SpanContext() { t.Fatalf("parsed span context not equal to original: actual(%+v), expected(%+v)\n", parsed, span.SpanContext()) }
+
+	malformed := []string{ "", "00-abc-def-01", "00-" + parsed.TraceID + "-zzzzzzzzzzzzzzzz-01" }
+	for _, traceParent := range malformed {
+		if tracing.ParseTraceParent(traceParent).IsValid() { t.Fatalf("malformed traceparent parsed as valid: %s\n", traceParent) }
+	}
+
+	child := tracing.StartSpan("child", parsed)
+	t.Logf("actual trace id: %s, expected trace id: %s\n", child.SpanContext().TraceID, parsed.TraceID)
+	if child.SpanContext().TraceID != parsed.TraceID { t.Fatalf("child span did not join parent trace\n") }
+	if child.ParentSpanID != parsed.SpanID { t.Fatalf("child parent span id not equal to parent: actual(%s), expected(%s)\n", child.ParentSpanID, parsed.SpanID) }
+}
+
+func TestFileExporter(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "traces.jsonl")
+	configureErr := tracing.Configure(tracing.TracerOpts{ Exporter: tracing.FileExporterType, FilePath: filePath })
+	if configureErr != nil { t.Fatalf("error configuring tracer: %s", configureErr.Error()) }
+
+	root := tracing.StartSpan("http.command", tracing.SpanContext{})
+	child := tracing.StartSpan("wal.append", root.SpanContext())
+	child.SetAttribute("raft.index", int64(1))
+	child.End()
+	root.End()
+
+	tracing.Flush()
+
+	file, openErr := os.Open(filePath)
+	if openErr != nil { t.Fatalf("error opening trace file: %s", openErr.Error()) }
+	defer file.Close()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		decodeErr := json.Unmarshal(scanner.Bytes(), &record)
+		if decodeErr != nil { t.Fatalf("error decoding span: %s", decodeErr.Error()) }
+
+		records = append(records, record)
+	}
+
+	t.Logf("actual spans: %d, expected spans: %d\n", len(records), 2)
+	if len(records) != 2 { t.Fatalf("actual spans not equal to expected: actual(%d), expected(%d)\n", len(records), 2) }
+
+	if records[0]["name"] != "wal.append" || records[0]["parentSpanId"] != root.SpanContext().SpanID {
+		t.Fatalf("child span not exported with parent: %+v\n", records[0])
+	}
+
+	if records[1]["traceId"] != records[0]["traceId"] { t.Fatalf("spans not exported in the same trace\n") }
+}
+
+func TestDisabled(t *testing.T) {
+	configureErr := tracing.Configure(tracing.TracerOpts{ Exporter: tracing.NoExporter })
+	if configureErr != nil { t.Fatalf("error configuring tracer: %s", configureErr.Error()) }
+
+	span := tracing.StartSpan("test", tracing.SpanContext{})
+	if span != nil { t.Fatalf("span started while tracing disabled\n") }
+
+	span.SetAttribute("key", "value")
+	span.End()
+
+	if span.SpanContext().IsValid() { t.Fatalf("nil span has valid context\n") }
+}
@@ -13,7 +13,7 @@ import "encoding/json"
 	encode a struct of type T to a string (json stringify)
 */
 
-func EncodeStructToString [T comparable](data T) (string, error) {
+func EncodeStructToString [T any](data T) (string, error) {
 	var buf bytes.Buffer
   enc := gob.NewEncoder(&buf)
 	
@@ -29,7 +29,7 @@ func EncodeStructToString [T comparable](data T) (string, error) {
 	encode a struct of type T to a string (json stringify)
 */
 
-func EncodeStructToBytes [T comparable](data T) ([]byte, error) {
+func EncodeStructToBytes [T any](data T) ([]byte, error) {
 	var buf bytes.Buffer
   enc := gob.NewEncoder(&buf)
 	
@@ -45,7 +45,7 @@ func EncodeStructToBytes [T comparable](data T) ([]byte, error) {
 	decode a string to a struct of type T
 */
 
-func DecodeStringToStruct [T comparable](encoded string) (*T, error) {
+func DecodeStringToStruct [T any](encoded string) (*T, error) {
 	decodedBinaryData, binaryErr := base64.StdEncoding.DecodeString(encoded)
 	if binaryErr != nil { return nil, binaryErr }
 	
@@ -61,7 +61,7 @@ func DecodeStringToStruct [T comparable](encoded string) (*T, error) {
 	decode a byte array to a struct of type T
 */
 
-func DecodeBytesToStruct [T comparable](encoded []byte) (*T, error) {
+func DecodeBytesToStruct [T any](encoded []byte) (*T, error) {
 	decodedObj := new(T)
   dec := gob.NewDecoder(bytes.NewReader(encoded))
   decErr := dec.Decode(&decodedObj)
@@ -71,14 +71,14 @@ func DecodeBytesToStruct [T comparable](encoded []byte) (*T, error) {
 }
 
 
-func EncodeStructToJSONString [T comparable](data T) (string, error) {
+func EncodeStructToJSONString [T any](data T) (string, error) {
 	encoded, err := json.Marshal(data)
 	if err != nil { return GetZero[string](), err }
 	
 	return string(encoded), nil
 }
 
-func DecodeJSONStringToStruct [T comparable](encoded string) (*T, error) {
+func DecodeJSONStringToStruct [T any](encoded string) (*T, error) {
 	data := new(T)
 	err := json.Unmarshal([]byte(encoded), data)
 	if err != nil { return nil, err }
@@ -1,7 +1,10 @@
 package wal
 
+import "errors"
 import "os"
 import "path/filepath"
+import "strconv"
+import "time"
 
 import bolt "go.etcd.io/bbolt"
 
@@ -15,50 +18,52 @@ var Log = clog.NewCustomLog(NAME)
 
 /*
 	Write Ahead Log
-		1.) open the db using the filepath 
-		2.) create the replog bucket if it does not already exist
-		4.) also create both a stats bucket and an index bucket sub bucket
-			--> the replog stats bucket contains both the total size of the replicated log and total entries
-			--> the index bucket conains the first known entry for each term, which is used to 
-					reduce the number of failed AppendEntryRPCs when a node is brought into the cluster
-					and being synced back to the leader
-		5.) create the snapshot bucket
+		1.) if the compact threshold is set, compact the db file if enough of it is free pages, see WALCompact.go
+		2.) open the db using the filepath 
+		3.) open the log store for the backend in the options, which holds the entries of the replicated log
+			--> bolt (default): the replicated log is kept in the replog bucket in the db, see WALReplogBucket.go
+			--> segment: the replicated log is kept in append only segment files, see WALSegmentStore.go
+			--> unless the cache size is negative, the log store is wrapped in a cache of the most recent entries, see
+				WALCache.go
+		4.) create the snapshot bucket
 			--> this contains a reference to the filepath for the most up to date snapshot for the cluster
-		6.) create the stats bucket
+		5.) create the stats bucket
 			--> the stats bucket contains a time series of system stats as the system progresses
 */
 
-func NewWAL () (*WAL, error) {
+func NewWAL(opts WALOpts) (*WAL, error) {
 	homedir, homeErr := os.UserHomeDir()
 	if homeErr != nil { return nil, homeErr }
 
 	dbPath := filepath.Join(homedir, SubDirectory, FileName)
+
+	if opts.CompactThreshold > 0 {
+		sizeBefore, sizeAfter, compactErr := CompactDBFile(dbPath, opts.CompactThreshold)
+		if compactErr != nil && ! os.IsNotExist(compactErr) { return nil, compactErr }
+		if sizeAfter < sizeBefore { Log.Info("compacted wal db from", sizeBefore, "to", sizeAfter, "bytes") }
+	}
 	
 	db, openErr := bolt.Open(dbPath, 0600, nil)
 	if openErr != nil { return nil, openErr }
 
-	replogTransaction := func(tx *bolt.Tx) error {
-		bucketName := []byte(Replog)
-		parent, createErr := tx.CreateBucketIfNotExists(bucketName)
-		if createErr != nil { return createErr }
-
-		walBucketName := []byte(ReplogWAL)
-		_, walCreateErr := parent.CreateBucketIfNotExists(walBucketName)
-		if walCreateErr != nil { return createErr }
+	var store LogStore
+	var storeErr error
 
-		statsBucketName := []byte(ReplogStats)
-		_, statsCreateErr := parent.CreateBucketIfNotExists(statsBucketName)
-		if statsCreateErr != nil { return statsCreateErr }
-
-		indexBucketName := []byte(ReplogIndex)
-		_, indexCreateErr := parent.CreateBucketIfNotExists(indexBucketName)
-		if indexCreateErr != nil { return indexCreateErr }
+	switch opts.Backend {
+		case BoltBackend, "":
+			store, storeErr = NewBoltLogStore(db)
+		case SegmentBackend:
+			store, storeErr = NewSegmentLogStore(filepath.Join(homedir, SubDirectory, SegmentSubDirectory), opts)
+		default:
+			storeErr = errors.New("unknown wal backend: " + opts.Backend)
+	}
 
-		return nil
+	if storeErr != nil { 
+		db.Close()
+		return nil, storeErr 
 	}
 
-	bucketErrRepLog := db.Update(replogTransaction)
-	if bucketErrRepLog != nil { return nil, bucketErrRepLog }
+	if opts.CacheSize >= 0 { store = NewCachedLogStore(store, opts.CacheSize) }
 
 	snapshotTransaction := func(tx *bolt.Tx) error {
 		bucketName := []byte(Snapshot)
@@ -83,7 +88,69 @@ func NewWAL () (*WAL, error) {
 	if bucketErrStats != nil { return nil, bucketErrStats }
 
   return &WAL{ 
+		LogStore: store,
 		DBFile: dbPath,
 		DB: db,
 	}, nil
-}
\ No newline at end of file
+}
+
+/*
+	Opts From Env
+		read the wal options from the environment
+			--> WAL_BACKEND: bolt or segment, defaults to bolt
+			--> WAL_SEGMENT_SIZE: the size in bytes at which segment files are rolled over
+			--> WAL_SYNC_INTERVAL: a duration, like 5ms, to fsync segment files on an interval instead of on every append
+			--> WAL_CACHE_SIZE: the number of recent entries to cache in memory, or -1 to disable the cache
+			--> WAL_COMPACT_THRESHOLD: the fraction of the db file, like 0.5, that must be free pages for the db file to be
+				compacted when the wal is opened, where unset disables compaction
+*/
+
+func OptsFromEnv() (WALOpts, error) {
+	opts := WALOpts{ Backend: os.Getenv(WALBackendEnv) }
+
+	segmentSize := os.Getenv(WALSegmentSizeEnv)
+	if segmentSize != "" {
+		parsedSize, parseErr := strconv.ParseInt(segmentSize, 10, 64)
+		if parseErr != nil { return opts, parseErr }
+
+		opts.SegmentSize = parsedSize
+	}
+
+	syncInterval := os.Getenv(WALSyncIntervalEnv)
+	if syncInterval != "" {
+		parsedInterval, parseErr := time.ParseDuration(syncInterval)
+		if parseErr != nil { return opts, parseErr }
+
+		opts.SyncInterval = parsedInterval
+	}
+
+	cacheSize := os.Getenv(WALCacheSizeEnv)
+	if cacheSize != "" {
+		parsedSize, parseErr := strconv.Atoi(cacheSize)
+		if parseErr != nil { return opts, parseErr }
+
+		opts.CacheSize = parsedSize
+	}
+
+	compactThreshold := os.Getenv(WALCompactThresholdEnv)
+	if compactThreshold != "" {
+		parsedThreshold, parseErr := strconv.ParseFloat(compactThreshold, 64)
+		if parseErr != nil { return opts, parseErr }
+
+		opts.CompactThreshold = parsedThreshold
+	}
+
+	return opts, nil
+}
+
+/*
+	Close
+		close the log store and then the db
+*/
+
+func (wal *WAL) Close() error {
+	closeErr := wal.LogStore.Close()
+	if closeErr != nil { return closeErr }
+
+	return wal.DB.Close()
+}
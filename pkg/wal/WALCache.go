@@ -0,0 +1,267 @@
+package wal
+
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/metrics"
+
+
+//=========================================== Write Ahead Log Cache
+
+
+/*
+	New Cached Log Store
+		a bounded ring buffer of the most recent entries in front of a log store, so replication to followers that are
+		caught up, and the lookups of the latest entry on every heartbeat, never read from disk or decode entries
+
+		the cache always holds a contiguous run of entries ending at the latest entry in the log
+			--> appends push the new entries onto the end of the ring, evicting the oldest entries once it is full
+			--> truncate and compaction remove the affected entries from the cache once the log store has removed them
+			--> if the log store fails to append, truncate, or compact, the cache is cleared since the log store may be partially changed
+			--> if the cache is emptied, the latest entry is loaded from the log store the next time it is needed
+
+		entries are copied in and out of the cache, so callers can never modify a cached entry
+*/
+
+func NewCachedLogStore(store LogStore, size int) *CachedLogStore {
+	if size <= 0 { size = DefaultCacheSize }
+
+	return &CachedLogStore{
+		Store: store,
+		entries: make([]*log.LogEntry, size),
+	}
+}
+
+func (cache *CachedLogStore) Append(entry *log.LogEntry) error {
+	return cache.RangeAppend([]*log.LogEntry{ entry })
+}
+
+func (cache *CachedLogStore) RangeAppend(logs []*log.LogEntry) error {
+	cache.Mutex.Lock()
+	defer cache.Mutex.Unlock()
+
+	appendErr := cache.Store.RangeAppend(logs)
+	if appendErr != nil {
+		cache.clear()
+		return appendErr
+	}
+
+	for _, entry := range logs {
+		cache.push(entry)
+	}
+
+	return nil
+}
+
+func (cache *CachedLogStore) Read(index int64) (*log.LogEntry, error) {
+	cache.Mutex.RLock()
+	entry, ok := cache.get(index)
+	cache.Mutex.RUnlock()
+
+	if ok {
+		metrics.WALCacheHits.Inc()
+		return entry, nil
+	}
+
+	metrics.WALCacheMisses.Inc()
+	return cache.Store.Read(index)
+}
+
+/*
+	Get Range
+		served from the cache if the start of the range is cached, since the cache always runs to the latest entry
+*/
+
+func (cache *CachedLogStore) GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, error) {
+	cache.Mutex.RLock()
+
+	if cache.count > 0 && startIndex >= cache.first().Index {
+		var entries []*log.LogEntry
+		for index := startIndex; index <= endIndex; index++ {
+			entry, ok := cache.get(index)
+			if ! ok { break }
+
+			entries = append(entries, entry)
+		}
+
+		cache.Mutex.RUnlock()
+		metrics.WALCacheHits.Inc()
+
+		return entries, nil
+	}
+
+	cache.Mutex.RUnlock()
+	metrics.WALCacheMisses.Inc()
+
+	return cache.Store.GetRange(startIndex, endIndex)
+}
+
+/*
+	Get Latest
+		the latest entry is always the last entry in the cache. If the cache is empty, load the latest entry from the log
+		store and start the cache from it
+*/
+
+func (cache *CachedLogStore) GetLatest() (*log.LogEntry, error) {
+	cache.Mutex.RLock()
+	if cache.count > 0 {
+		latest := copyEntry(cache.last())
+		cache.Mutex.RUnlock()
+
+		return latest, nil
+	}
+
+	cache.Mutex.RUnlock()
+
+	cache.Mutex.Lock()
+	defer cache.Mutex.Unlock()
+
+	if cache.count > 0 { return copyEntry(cache.last()), nil }
+
+	latest, latestErr := cache.Store.GetLatest()
+	if latestErr != nil || latest == nil { return latest, latestErr }
+
+	cache.push(latest)
+	return latest, nil
+}
+
+func (cache *CachedLogStore) GetEarliest() (*log.LogEntry, error) {
+	return cache.Store.GetEarliest()
+}
+
+func (cache *CachedLogStore) DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error) {
+	cache.Mutex.Lock()
+	defer cache.Mutex.Unlock()
+
+	totalBytesRemoved, totalKeysRemoved, deleteErr := cache.Store.DeleteLogsUpToLastIncluded(endIndex)
+	if deleteErr != nil {
+		cache.clear()
+		return totalBytesRemoved, totalKeysRemoved, deleteErr
+	}
+
+	cache.dropUpTo(endIndex)
+	return totalBytesRemoved, totalKeysRemoved, nil
+}
+
+func (cache *CachedLogStore) TruncateFrom(index int64) (int64, int64, error) {
+	cache.Mutex.Lock()
+	defer cache.Mutex.Unlock()
+
+	totalBytesRemoved, totalKeysRemoved, truncateErr := cache.Store.TruncateFrom(index)
+	if truncateErr != nil {
+		cache.clear()
+		return totalBytesRemoved, totalKeysRemoved, truncateErr
+	}
+
+	cache.dropFrom(index)
+	return totalBytesRemoved, totalKeysRemoved, nil
+}
+
+func (cache *CachedLogStore) GetTotal() (int, error) {
+	return cache.Store.GetTotal()
+}
+
+func (cache *CachedLogStore) GetBucketSizeInBytes() (int64, error) {
+	return cache.Store.GetBucketSizeInBytes()
+}
+
+func (cache *CachedLogStore) GetIndexedEntryForTerm(term int64) (*log.LogEntry, error) {
+	return cache.Store.GetIndexedEntryForTerm(term)
+}
+
+func (cache *CachedLogStore) GetLastEntryForTerm(term int64) (*log.LogEntry, error) {
+	return cache.Store.GetLastEntryForTerm(term)
+}
+
+func (cache *CachedLogStore) Close() error {
+	cache.Mutex.Lock()
+	defer cache.Mutex.Unlock()
+
+	cache.clear()
+	return cache.Store.Close()
+}
+
+/*
+	All functions below are helper functions for the ring buffer, and expect the mutex to be held by the caller
+*/
+
+func (cache *CachedLogStore) first() *log.LogEntry {
+	return cache.entries[cache.head]
+}
+
+func (cache *CachedLogStore) last() *log.LogEntry {
+	return cache.entries[(cache.head + cache.count - 1) % len(cache.entries)]
+}
+
+func (cache *CachedLogStore) get(index int64) (*log.LogEntry, bool) {
+	if cache.count == 0 { return nil, false }
+
+	offset := index - cache.first().Index
+	if offset < 0 || offset >= int64(cache.count) { return nil, false }
+
+	return copyEntry(cache.entries[(cache.head + int(offset)) % len(cache.entries)]), true
+}
+
+func (cache *CachedLogStore) push(entry *log.LogEntry) {
+	if cache.count > 0 && entry.Index != cache.last().Index + 1 { cache.clear() }
+
+	if cache.count == len(cache.entries) {
+		cache.entries[cache.head] = nil
+		cache.head = (cache.head + 1) % len(cache.entries)
+		cache.count--
+	}
+
+	cache.entries[(cache.head + cache.count) % len(cache.entries)] = copyEntry(entry)
+	cache.count++
+}
+
+func (cache *CachedLogStore) dropFrom(index int64) {
+	if cache.count == 0 || index > cache.last().Index { return }
+	if index <= cache.first().Index {
+		cache.clear()
+		return
+	}
+
+	keep := int(index - cache.first().Index)
+	for pos := keep; pos < cache.count; pos++ {
+		cache.entries[(cache.head + pos) % len(cache.entries)] = nil
+	}
+
+	cache.count = keep
+}
+
+func (cache *CachedLogStore) dropUpTo(index int64) {
+	if cache.count == 0 || index < cache.first().Index { return }
+	if index >= cache.last().Index {
+		cache.clear()
+		return
+	}
+
+	drop := int(index - cache.first().Index) + 1
+	for pos := 0; pos < drop; pos++ {
+		cache.entries[(cache.head + pos) % len(cache.entries)] = nil
+	}
+
+	cache.head = (cache.head + drop) % len(cache.entries)
+	cache.count -= drop
+}
+
+func (cache *CachedLogStore) clear() {
+	for pos := range cache.entries {
+		cache.entries[pos] = nil
+	}
+
+	cache.head = 0
+	cache.count = 0
+}
+
+/*
+	Copy Entry
+		copy an entry into or out of the cache, including the command data, so neither the caller nor the cache shares the
+		bytes of the command with the other
+*/
+
+func copyEntry(entry *log.LogEntry) *log.LogEntry {
+	copied := *entry
+	if entry.Command.Data != nil { copied.Command.Data = append([]byte{}, entry.Command.Data...) }
+
+	return &copied
+}
@@ -0,0 +1,69 @@
+package wal
+
+import "os"
+import bolt "go.etcd.io/bbolt"
+
+
+//=========================================== Write Ahead Log Compact
+
+
+/*
+	Compact DB File
+		bolt never shrinks its file, so the pages freed when the replicated log is compacted are only reused by later writes.
+		To reclaim the disk space after large deletions, copy the db to a fresh file, which only holds the pages in use, and
+		replace the db file with it
+			1.) open the db and get the size of the free pages, and skip the compaction if the free pages are less than the
+				threshold fraction of the file, where a threshold of 0 always compacts
+			2.) copy every bucket to a temporary file next to the db file
+			3.) replace the db file with the temporary file
+
+		the db must not be open anywhere else, so this is run when the wal is opened, before the log store, or offline
+		against a node that is not running. Returns the size of the file before and after
+*/
+
+func CompactDBFile(dbPath string, threshold float64) (int64, int64, error) {
+	info, statErr := os.Stat(dbPath)
+	if statErr != nil { return 0, 0, statErr }
+
+	src, openErr := bolt.Open(dbPath, 0600, &bolt.Options{ Timeout: InspectOpenTimeout })
+	if openErr != nil { return 0, 0, openErr }
+
+	freeBytes := int64(src.Stats().FreePageN) * int64(src.Info().PageSize)
+	if float64(freeBytes) < threshold * float64(info.Size()) {
+		closeErr := src.Close()
+		return info.Size(), info.Size(), closeErr
+	}
+
+	tempPath := dbPath + CompactSuffix
+
+	removeErr := os.Remove(tempPath)
+	if removeErr != nil && ! os.IsNotExist(removeErr) {
+		src.Close()
+		return 0, 0, removeErr
+	}
+
+	dst, dstErr := bolt.Open(tempPath, 0600, nil)
+	if dstErr != nil {
+		src.Close()
+		return 0, 0, dstErr
+	}
+
+	compactErr := bolt.Compact(dst, src, CompactTxMaxSize)
+	closeDstErr := dst.Close()
+	closeSrcErr := src.Close()
+
+	for _, err := range []error{ compactErr, closeDstErr, closeSrcErr } {
+		if err != nil {
+			os.Remove(tempPath)
+			return 0, 0, err
+		}
+	}
+
+	renameErr := os.Rename(tempPath, dbPath)
+	if renameErr != nil { return 0, 0, renameErr }
+
+	compactedInfo, compactedStatErr := os.Stat(dbPath)
+	if compactedStatErr != nil { return 0, 0, compactedStatErr }
+
+	return info.Size(), compactedInfo.Size(), nil
+}
@@ -0,0 +1,269 @@
+package wal
+
+import "encoding/json"
+import "strconv"
+import bolt "go.etcd.io/bbolt"
+
+import "github.com/sirgallo/raft/pkg/log"
+
+
+//=========================================== Write Ahead Log Inspect
+
+
+/*
+	Open WAL File
+		open the wal db at a path offline, for inspection and repair of the replicated log of a node that is not running
+			--> the db is opened read only unless it is being repaired, and no buckets are created, so a missing bucket is
+				reported instead of hidden
+*/
+
+func OpenWALFile(dbPath string, readOnly bool) (*WAL, error) {
+	db, openErr := bolt.Open(dbPath, 0600, &bolt.Options{ ReadOnly: readOnly, Timeout: InspectOpenTimeout })
+	if openErr != nil { return nil, openErr }
+
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(Replog))
+		if bucket == nil || bucket.Bucket([]byte(ReplogWAL)) == nil || bucket.Bucket([]byte(ReplogStats)) == nil || bucket.Bucket([]byte(ReplogIndex)) == nil {
+			return ErrMissingReplogBucket
+		}
+
+		return nil
+	}
+
+	viewErr := db.View(transaction)
+	if viewErr != nil {
+		db.Close()
+		return nil, viewErr
+	}
+
+	return &WAL{
+		LogStore: &BoltLogStore{ DB: db },
+		DBFile: dbPath,
+		DB: db,
+	}, nil
+}
+
+/*
+	Inspect
+		scan the entire replicated log in a single read transaction and check it for consistency
+			1.) count the entries and their size, to compare against the totals in the replog stats bucket
+			2.) check that each entry decodes and is stored under its own index
+			3.) find gaps in the indexes, where the last valid index is the last entry before the first gap or invalid entry
+			4.) check that the index bucket holds exactly the first entry of each term in the log
+				--> the first entry of the earliest term may have been compacted, in which case the indexed entry for it is
+					at or before the first entry in the log
+*/
+
+func (store *BoltLogStore) Inspect() (*WALReport, error) {
+	report := &WALReport{ FirstIndex: -1, LastIndex: -1, LastValidIndex: -1 }
+
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(Replog))
+		walBucket := bucket.Bucket([]byte(ReplogWAL))
+		statsBucket := bucket.Bucket([]byte(ReplogStats))
+		indexBucket := bucket.Bucket([]byte(ReplogIndex))
+
+		report.StatsEntries = ConvertBytesToInt(statsBucket.Get([]byte(ReplogTotalElementsKey)))
+		report.StatsSizeInBytes = ConvertBytesToInt(statsBucket.Get([]byte(ReplogSizeKey)))
+
+		firstInTerm := map[int64]int64{}
+		var terms []int64
+
+		valid := true
+		cursor := walBucket.Cursor()
+
+		for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+			index := ConvertBytesToInt(key)
+
+			report.Entries++
+			report.SizeInBytes += int64(len(key)) + int64(len(val))
+
+			if report.FirstIndex == -1 {
+				report.FirstIndex = index
+			} else if index != report.LastIndex + 1 {
+				report.Gaps = append(report.Gaps, IndexGap{ From: report.LastIndex + 1, To: index - 1 })
+				valid = false
+			}
+
+			report.LastIndex = index
+
+			entry, transformErr := log.TransformBytesToLogEntry(val)
+			if len(key) != 8 || transformErr != nil || entry.Index != index {
+				report.InvalidEntries = append(report.InvalidEntries, index)
+				valid = false
+				continue
+			}
+
+			if valid { report.LastValidIndex = index }
+
+			if _, ok := firstInTerm[entry.Term]; ! ok {
+				firstInTerm[entry.Term] = index
+				terms = append(terms, entry.Term)
+			}
+		}
+
+		indexedTerms := map[int64]bool{}
+		indexCursor := indexBucket.Cursor()
+
+		for key, val := indexCursor.First(); key != nil; key, val = indexCursor.Next() {
+			term := ConvertBytesToInt(key)
+			indexedTerms[term] = true
+
+			indexed, transformErr := log.TransformBytesToLogEntry(val)
+			if transformErr != nil {
+				report.TermIndexErrors = append(report.TermIndexErrors, "term " + strconv.FormatInt(term, 10) + ": indexed entry does not decode")
+				continue
+			}
+
+			first, ok := firstInTerm[term]
+			if ! ok {
+				report.TermIndexErrors = append(report.TermIndexErrors, "term " + strconv.FormatInt(term, 10) + ": indexed at " + strconv.FormatInt(indexed.Index, 10) + " but no entries in the log")
+				continue
+			}
+
+			isCompacted := len(terms) > 0 && term == terms[0] && first == report.FirstIndex && indexed.Index <= first
+			if indexed.Index != first && ! isCompacted {
+				report.TermIndexErrors = append(report.TermIndexErrors, "term " + strconv.FormatInt(term, 10) + ": indexed at " + strconv.FormatInt(indexed.Index, 10) + " but first entry is " + strconv.FormatInt(first, 10))
+			}
+		}
+
+		for _, term := range terms {
+			if ! indexedTerms[term] {
+				report.TermIndexErrors = append(report.TermIndexErrors, "term " + strconv.FormatInt(term, 10) + ": first entry " + strconv.FormatInt(firstInTerm[term], 10) + " is not indexed")
+			}
+		}
+
+		return nil
+	}
+
+	inspectErr := store.timedView(transaction)
+	if inspectErr != nil { return nil, inspectErr }
+
+	return report, nil
+}
+
+/*
+	Repair
+		repair the replicated log offline
+			1.) rebuild the term index from the entries in the log
+			2.) if truncate is set, remove all entries after the last valid entry, which is the last entry before the first
+				gap or entry that does not decode
+			3.) recount the stats
+*/
+
+func (store *BoltLogStore) Repair(truncate bool) (*WALReport, error) {
+	rebuildErr := store.RebuildTermIndex()
+	if rebuildErr != nil { return nil, rebuildErr }
+
+	if truncate {
+		report, inspectErr := store.Inspect()
+		if inspectErr != nil { return nil, inspectErr }
+
+		if report.LastValidIndex < report.LastIndex {
+			_, _, truncateErr := store.TruncateFrom(report.LastValidIndex + 1)
+			if truncateErr != nil { return nil, truncateErr }
+		}
+	}
+
+	repairErr := store.RepairStats()
+	if repairErr != nil { return nil, repairErr }
+
+	return store.Inspect()
+}
+
+/*
+	Repair Stats
+		recount the entries and size of the replicated log and overwrite the totals in the replog stats bucket
+*/
+
+func (store *BoltLogStore) RepairStats() error {
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(Replog))
+		walBucket := bucket.Bucket([]byte(ReplogWAL))
+		statsBucket := bucket.Bucket([]byte(ReplogStats))
+
+		totalKeys := int64(0)
+		totalBytes := int64(0)
+
+		cursor := walBucket.Cursor()
+		for key, val := cursor.First(); key != nil; key, val = cursor.Next() {
+			totalKeys++
+			totalBytes += int64(len(key)) + int64(len(val))
+		}
+
+		putSizeErr := statsBucket.Put([]byte(ReplogSizeKey), ConvertIntToBytes(totalBytes))
+		if putSizeErr != nil { return putSizeErr }
+
+		return statsBucket.Put([]byte(ReplogTotalElementsKey), ConvertIntToBytes(totalKeys))
+	}
+
+	return store.timedUpdate(transaction)
+}
+
+/*
+	Rebuild Term Index
+		replace the index bucket with the first entry of each term in the replicated log
+*/
+
+func (store *BoltLogStore) RebuildTermIndex() error {
+	transaction := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(Replog))
+		walBucket := bucket.Bucket([]byte(ReplogWAL))
+
+		delErr := bucket.DeleteBucket([]byte(ReplogIndex))
+		if delErr != nil { return delErr }
+
+		indexBucket, createErr := bucket.CreateBucket([]byte(ReplogIndex))
+		if createErr != nil { return createErr }
+
+		latestTerm := int64(-1)
+
+		cursor := walBucket.Cursor()
+		for _, val := cursor.First(); val != nil; _, val = cursor.Next() {
+			entry, transformErr := log.TransformBytesToLogEntry(val)
+			if transformErr != nil { continue }
+			if entry.Term <= latestTerm { continue }
+
+			putErr := indexBucket.Put(ConvertIntToBytes(entry.Term), val)
+			if putErr != nil { return putErr }
+
+			latestTerm = entry.Term
+		}
+
+		return nil
+	}
+
+	return store.timedUpdate(transaction)
+}
+
+/*
+	Dump
+		transform an entry for output, where the command data is included as is if it is json, or as a json string if not
+*/
+
+func Dump(entry *log.LogEntry) *DumpedEntry {
+	dumped := &DumpedEntry{
+		Index: entry.Index,
+		Term: entry.Term,
+		RequestID: entry.Command.RequestID,
+		Timestamp: entry.Command.Timestamp,
+	}
+
+	if len(entry.Command.Data) == 0 { return dumped }
+
+	if json.Valid(entry.Command.Data) {
+		dumped.Data = json.RawMessage(entry.Command.Data)
+	} else { dumped.Data, _ = json.Marshal(string(entry.Command.Data)) }
+
+	return dumped
+}
+
+/*
+	Is Consistent
+		the replicated log has no gaps, invalid entries, or term index errors, and the stats match the log
+*/
+
+func (report *WALReport) IsConsistent() bool {
+	return len(report.Gaps) == 0 && len(report.InvalidEntries) == 0 && len(report.TermIndexErrors) == 0 &&
+		report.Entries == report.StatsEntries && report.SizeInBytes == report.StatsSizeInBytes
+}
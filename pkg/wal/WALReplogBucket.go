@@ -8,6 +8,65 @@ import "github.com/sirgallo/raft/pkg/log"
 
 //=========================================== Write Ahead Log Replog Bucket Ops
 
+
+/*
+	New Bolt Log Store
+		the default log store, which keeps the replicated log in the replog bucket of the wal db
+			1.) create the replog bucket if it does not already exist
+			2.) also create the wal, stats, and index sub buckets
+				--> the replog stats bucket contains both the total size of the replicated log and total entries
+				--> the index bucket conains the first known entry for each term, which is used to 
+						reduce the number of failed AppendEntryRPCs when a node is brought into the cluster
+						and being synced back to the leader
+			3.) create the snapshot bucket, which holds the first index marker for compaction, and finish any compaction
+				that was interrupted
+*/
+
+func NewBoltLogStore(db *bolt.DB) (*BoltLogStore, error) {
+	replogTransaction := func(tx *bolt.Tx) error {
+		bucketName := []byte(Replog)
+		parent, createErr := tx.CreateBucketIfNotExists(bucketName)
+		if createErr != nil { return createErr }
+
+		walBucketName := []byte(ReplogWAL)
+		_, walCreateErr := parent.CreateBucketIfNotExists(walBucketName)
+		if walCreateErr != nil { return walCreateErr }
+
+		statsBucketName := []byte(ReplogStats)
+		_, statsCreateErr := parent.CreateBucketIfNotExists(statsBucketName)
+		if statsCreateErr != nil { return statsCreateErr }
+
+		indexBucketName := []byte(ReplogIndex)
+		_, indexCreateErr := parent.CreateBucketIfNotExists(indexBucketName)
+		if indexCreateErr != nil { return indexCreateErr }
+
+		snapshotBucketName := []byte(Snapshot)
+		_, snapshotCreateErr := tx.CreateBucketIfNotExists(snapshotBucketName)
+		if snapshotCreateErr != nil { return snapshotCreateErr }
+
+		return nil
+	}
+
+	bucketErrRepLog := db.Update(replogTransaction)
+	if bucketErrRepLog != nil { return nil, bucketErrRepLog }
+
+	store := &BoltLogStore{ DB: db }
+
+	_, _, resumeErr := store.deleteLogsUpToFirstIndex()
+	if resumeErr != nil { return nil, resumeErr }
+
+	return store, nil
+}
+
+/*
+	Close
+		the db is shared with the rest of the wal, so it is closed by the wal
+*/
+
+func (store *BoltLogStore) Close() error {
+	return nil
+}
+
 /*
 	Append
 		create a read-write transaction for the bucket to append a single new entry
@@ -16,27 +75,27 @@ import "github.com/sirgallo/raft/pkg/log"
 			3.) put the key and value in the bucket
 */
 
-func (wal *WAL) Append(entry *log.LogEntry) error {
+func (store *BoltLogStore) Append(entry *log.LogEntry) error {
 	transaction := func(tx *bolt.Tx) error {
 		bucketName := []byte(Replog)
 		bucket := tx.Bucket(bucketName)
 
-		latestIndexedLog, getIndexErr := wal.getLatestIndexedEntry(bucket)
+		latestIndexedLog, getIndexErr := store.getLatestIndexedEntry(bucket)
 		if getIndexErr != nil { return getIndexErr}
 
-		totalBytesAdded, totalKeysAdded, appendErr := wal.appendHelper(bucket, entry)
+		totalBytesAdded, totalKeysAdded, appendErr := store.appendHelper(bucket, entry)
 		if appendErr != nil { return appendErr }
 
-		updateErr := wal.UpdateReplogStats(bucket, totalBytesAdded, totalKeysAdded, ADD)
+		updateErr := store.UpdateReplogStats(bucket, totalBytesAdded, totalKeysAdded, ADD)
 		if updateErr != nil { return updateErr }
 
-		_, setIndexErr := wal.setIndexForFirstLogInTerm(bucket, entry, latestIndexedLog)
+		_, setIndexErr := store.setIndexForFirstLogInTerm(bucket, entry, latestIndexedLog)
 		if setIndexErr != nil { return setIndexErr }
 
 		return nil
 	}
 
-	appendErr := wal.DB.Update(transaction)
+	appendErr := store.timedUpdate(transaction)
 	if appendErr != nil { return appendErr }
 
 	return nil
@@ -49,36 +108,36 @@ func (wal *WAL) Append(entry *log.LogEntry) error {
 			2.) iterate over the new entries and perform the same as single Append
 */
 
-func (wal *WAL) RangeAppend(logs []*log.LogEntry) error {
+func (store *BoltLogStore) RangeAppend(logs []*log.LogEntry) error {
 	transaction := func(tx *bolt.Tx) error {
 		bucketName := []byte(Replog)
 		bucket := tx.Bucket(bucketName)
 
-		latestIndexedLog, getIndexErr := wal.getLatestIndexedEntry(bucket)
+		latestIndexedLog, getIndexErr := store.getLatestIndexedEntry(bucket)
 		if getIndexErr != nil { return getIndexErr}
 
 		totalBytesAdded := int64(0)
 		totalKeysAdded := int64(0)
 
 		for _, currLog := range logs {
-			entrySize, keyToAdd, appendErr := wal.appendHelper(bucket, currLog)
+			entrySize, keyToAdd, appendErr := store.appendHelper(bucket, currLog)
 			if appendErr != nil { return appendErr }
 			
 			totalBytesAdded += entrySize
 			totalKeysAdded += keyToAdd
 
-			newIndexedEntry, setIndexErr := wal.setIndexForFirstLogInTerm(bucket, currLog, latestIndexedLog)
+			newIndexedEntry, setIndexErr := store.setIndexForFirstLogInTerm(bucket, currLog, latestIndexedLog)
 			if setIndexErr != nil { return setIndexErr }
 			if newIndexedEntry != nil { latestIndexedLog = newIndexedEntry }
 		}
 
-		updateErr := wal.UpdateReplogStats(bucket, totalBytesAdded, totalKeysAdded, ADD)
+		updateErr := store.UpdateReplogStats(bucket, totalBytesAdded, totalKeysAdded, ADD)
 		if updateErr != nil { return updateErr }
 
 		return nil
 	}
 
-	rangeUpdateErr := wal.DB.Update(transaction)
+	rangeUpdateErr := store.timedUpdate(transaction)
 	if rangeUpdateErr != nil { return rangeUpdateErr }
 
 	return nil
@@ -92,7 +151,7 @@ func (wal *WAL) RangeAppend(logs []*log.LogEntry) error {
 			3.) transform the byte array back to an entry and return
 */
 
-func (wal *WAL) Read(index int64) (*log.LogEntry, error) {
+func (store *BoltLogStore) Read(index int64) (*log.LogEntry, error) {
 	var entry *log.LogEntry
 	
 	transaction := func(tx *bolt.Tx) error {
@@ -115,7 +174,7 @@ func (wal *WAL) Read(index int64) (*log.LogEntry, error) {
 		return nil
 	}
 
-	readErr := wal.DB.View(transaction)
+	readErr := store.timedView(transaction)
 	if readErr != nil { return nil, readErr }
 
 	return entry, nil
@@ -131,7 +190,7 @@ func (wal *WAL) Read(index int64) (*log.LogEntry, error) {
 			5.) return all entries
 */
 
-func (wal *WAL) GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, error) {
+func (store *BoltLogStore) GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, error) {
 	var entries []*log.LogEntry
 
 	transaction := func(tx *bolt.Tx) error {
@@ -162,7 +221,7 @@ func (wal *WAL) GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, err
 		return nil
 	}
 
-	readErr := wal.DB.View(transaction)
+	readErr := store.timedView(transaction)
 	if readErr != nil { return nil, readErr }
 
 	return entries, nil
@@ -176,7 +235,7 @@ func (wal *WAL) GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, err
 			3.) transform the value from byte array to entry and return the entry
 */
 
-func (wal *WAL) GetLatest() (*log.LogEntry, error) {
+func (store *BoltLogStore) GetLatest() (*log.LogEntry, error) {
 	var latestEntry *log.LogEntry
 
 	transaction := func(tx *bolt.Tx) error {
@@ -199,7 +258,7 @@ func (wal *WAL) GetLatest() (*log.LogEntry, error) {
 		return nil
 	}
 	
-	readErr := wal.DB.View(transaction)
+	readErr := store.timedView(transaction)
 	if readErr != nil { return nil, readErr }
 
 	return latestEntry, nil
@@ -213,7 +272,7 @@ func (wal *WAL) GetLatest() (*log.LogEntry, error) {
 			3.) transform the value from byte array to entry and return the entry
 */
 
-func (wal *WAL) GetEarliest() (*log.LogEntry, error) {
+func (store *BoltLogStore) GetEarliest() (*log.LogEntry, error) {
 	var earliestLog *log.LogEntry
 
 	transaction := func(tx *bolt.Tx) error {
@@ -236,7 +295,7 @@ func (wal *WAL) GetEarliest() (*log.LogEntry, error) {
 		return nil
 	}
 	
-	readErr := wal.DB.View(transaction)
+	readErr := store.timedView(transaction)
 	if readErr != nil { return nil, readErr }
 
 	return earliestLog, nil
@@ -244,51 +303,158 @@ func (wal *WAL) GetEarliest() (*log.LogEntry, error) {
 
 /*
 	Delete Logs
-		create a read-write transaction for log compaction in the bucket
-			1.) for all logs up tothe last index, delete the key-value pair
-			2.) for each deleted, update the total keys and the total space removed from the log
-			3.) get latest log (last applied), and remove all indexes up to it
+		compact the log up to and including the end index
+			1.) write the first index marker to the snapshot bucket, so the end of the compaction is durable before any entry
+				is deleted
+			2.) delete the compacted entries in chunks, see delete logs up to first index
+*/
+
+func (store *BoltLogStore) DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error) {
+	transaction := func(tx *bolt.Tx) error {
+		firstIndex, getErr := getFirstIndexMarker(tx)
+		if getErr != nil { return getErr }
+		if endIndex + 1 <= firstIndex { return nil }
+
+		return putFirstIndexMarker(tx, endIndex + 1)
+	}
+
+	markerErr := store.timedUpdate(transaction)
+	if markerErr != nil { return 0, 0, markerErr }
+
+	return store.deleteLogsUpToFirstIndex()
+}
+
+/*
+	Delete Logs Up To First Index
+		delete all entries before the first index marker, starting from the earliest entry in the log, in chunks so a
+		single transaction never holds a large part of the log
+			1.) delete the entries in the chunk from the wal bucket
+			2.) subtract the bytes and keys removed from the replog stats
+			3.) drop the first entry for all terms that are fully compacted, and move the first entry of the term of the new
+				earliest entry up to it
+
+		each chunk is a single read-write transaction, so the log, the stats, and the term index always agree, and if
+		compaction is interrupted, the remaining entries before the marker are deleted the next time the log store is
+		opened
 */
 
-func (wal *WAL) DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error) {
+func (store *BoltLogStore) deleteLogsUpToFirstIndex() (int64, int64, error) {
 	totalBytesRemoved := int64(0)
 	totalKeysRemoved := int64(0)
 
-	chunkSize := 500
+	var firstIndex int64
+	earliestIndex := int64(-1)
 
-	for startIndex := int64(0); startIndex <= endIndex; startIndex += int64(chunkSize) {
-		currentChunkEndIndex := startIndex + int64(chunkSize)
-		if currentChunkEndIndex > endIndex { currentChunkEndIndex = endIndex }
+	transaction := func(tx *bolt.Tx) error {
+		var getErr error
+		firstIndex, getErr = getFirstIndexMarker(tx)
+		if getErr != nil { return getErr }
+
+		walBucket := tx.Bucket([]byte(Replog)).Bucket([]byte(ReplogWAL))
+
+		key, _ := walBucket.Cursor().First()
+		if key != nil { earliestIndex = ConvertBytesToInt(key) }
+
+		return nil
+	}
+
+	viewErr := store.timedView(transaction)
+	if viewErr != nil { return 0, 0, viewErr }
+	if earliestIndex == -1 || earliestIndex >= firstIndex { return 0, 0, nil }
+
+	endIndex := firstIndex - 1
+
+	for startIndex := earliestIndex; startIndex <= endIndex; startIndex += CompactionChunkSize {
+		chunkEndIndex := startIndex + CompactionChunkSize - 1
+		if chunkEndIndex > endIndex { chunkEndIndex = endIndex }
+
+		var chunkBytes, chunkKeys int64
 
 		transaction := func(tx *bolt.Tx) error {
 			bucketName := []byte(Replog)
 			bucket := tx.Bucket(bucketName)
 
-			subTotalBytes, subKeys, subErr := wal.deleteLogsHelper(bucket, startIndex, currentChunkEndIndex)
-			if subErr != nil { return subErr }
+			var deleteErr error
+			chunkBytes, chunkKeys, deleteErr = store.deleteLogsHelper(bucket, startIndex, chunkEndIndex)
+			if deleteErr != nil { return deleteErr }
 
-			totalBytesRemoved += subTotalBytes
-			totalKeysRemoved += subKeys
+			updateErr := store.UpdateReplogStats(bucket, chunkBytes, chunkKeys, SUB)
+			if updateErr != nil { return updateErr }
 
-			return nil
+			return store.compactTermIndex(bucket)
 		}
 
-		delErr := wal.DB.Update(transaction)
+		delErr := store.timedUpdate(transaction)
 		if delErr != nil { return totalBytesRemoved, totalKeysRemoved, delErr }
+
+		totalBytesRemoved += chunkBytes
+		totalKeysRemoved += chunkKeys
 	}
 
+	return totalBytesRemoved, totalKeysRemoved, nil
+}
+
+/*
+	Truncate From
+		create a read-write transaction for removing conflicting entries from the end of the replicated log
+			1.) delete all entries from the index forward, keeping track of the total keys and the total space removed
+			2.) remove the indexed first entry for all terms that start at or after the index, so the latest indexed term
+				is the term of the new last entry in the log
+			3.) update the replog stats
+*/
+
+func (store *BoltLogStore) TruncateFrom(index int64) (int64, int64, error) {
+	totalBytesRemoved := int64(0)
+	totalKeysRemoved := int64(0)
+
 	transaction := func(tx *bolt.Tx) error {
 		bucketName := []byte(Replog)
 		bucket := tx.Bucket(bucketName)
 
-		updateErr := wal.UpdateReplogStats(bucket, totalBytesRemoved, totalKeysRemoved, SUB)
+		walBucketName := []byte(ReplogWAL)
+		walBucket := bucket.Bucket(walBucketName)
+
+		var keysToDelete [][]byte
+
+		cursor := walBucket.Cursor()
+		for key, val := cursor.Seek(ConvertIntToBytes(index)); key != nil; key, val = cursor.Next() {
+			keysToDelete = append(keysToDelete, key)
+			totalBytesRemoved += int64(len(key)) + int64(len(val))
+		}
+
+		for _, key := range keysToDelete {
+			delErr := walBucket.Delete(key)
+			if delErr != nil { return delErr }
+
+			totalKeysRemoved++
+		}
+
+		indexBucketName := []byte(ReplogIndex)
+		indexBucket := bucket.Bucket(indexBucketName)
+
+		var termsToDelete [][]byte
+
+		indexCursor := indexBucket.Cursor()
+		for key, val := indexCursor.First(); key != nil; key, val = indexCursor.Next() {
+			entry, transformErr := log.TransformBytesToLogEntry(val)
+			if transformErr != nil { return transformErr }
+
+			if entry.Index >= index { termsToDelete = append(termsToDelete, key) }
+		}
+
+		for _, key := range termsToDelete {
+			delErr := indexBucket.Delete(key)
+			if delErr != nil { return delErr }
+		}
+
+		updateErr := store.UpdateReplogStats(bucket, totalBytesRemoved, totalKeysRemoved, SUB)
 		if updateErr != nil { return updateErr }
-		
+
 		return nil
 	}
 
-	updateStatsErr := wal.DB.Update(transaction)
-	if updateStatsErr != nil { return totalBytesRemoved, totalKeysRemoved, updateStatsErr }
+	truncateErr := store.timedUpdate(transaction)
+	if truncateErr != nil { return 0, 0, truncateErr }
 
 	return totalBytesRemoved, totalKeysRemoved, nil
 }
@@ -299,7 +465,7 @@ func (wal *WAL) DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error)
 			1.) read from the stats bucket and check the indexed total value
 */
 
-func (wal *WAL) GetTotal() (int, error) {
+func (store *BoltLogStore) GetTotal() (int, error) {
 	totalKeys := 0
 
 	transaction := func(tx *bolt.Tx) error {
@@ -316,7 +482,7 @@ func (wal *WAL) GetTotal() (int, error) {
 		return nil
 	}
 
-	readErr := wal.DB.View(transaction)
+	readErr := store.timedView(transaction)
 	if readErr != nil { return 0, readErr }
 
 	return totalKeys, nil
@@ -328,7 +494,7 @@ func (wal *WAL) GetTotal() (int, error) {
 			1.) read from the stats bucket and check the indexed total size
 */
 
-func (wal *WAL) GetBucketSizeInBytes() (int64, error) {
+func (store *BoltLogStore) GetBucketSizeInBytes() (int64, error) {
 	totalSize := int64(0)
 
 	transaction := func(tx *bolt.Tx) error {
@@ -345,7 +511,7 @@ func (wal *WAL) GetBucketSizeInBytes() (int64, error) {
 		return nil
 	}
 
-	getSizeErr := wal.DB.View(transaction)
+	getSizeErr := store.timedView(transaction)
 	if getSizeErr != nil { return 0, getSizeErr }
 
 	return totalSize, nil
@@ -356,7 +522,7 @@ func (wal *WAL) GetBucketSizeInBytes() (int64, error) {
 		helper function for updating both the indexes for total keys and total size of the replicated log
 */
 
-func (wal *WAL) UpdateReplogStats(bucket *bolt.Bucket, numUpdatedBytes int64, numUpdatedKeys int64, op StatOP) error {
+func (store *BoltLogStore) UpdateReplogStats(bucket *bolt.Bucket, numUpdatedBytes int64, numUpdatedKeys int64, op StatOP) error {
 	statsBucketName := []byte(ReplogStats)
 	statsBucket := bucket.Bucket(statsBucketName)
 	
@@ -399,7 +565,7 @@ func (wal *WAL) UpdateReplogStats(bucket *bolt.Bucket, numUpdatedBytes int64, nu
 		For the given term, check the indexed value and to get the earliest known entry
 */
 
-func (wal *WAL) GetIndexedEntryForTerm(term int64) (*log.LogEntry, error) {
+func (store *BoltLogStore) GetIndexedEntryForTerm(term int64) (*log.LogEntry, error) {
 	var indexedEntry *log.LogEntry
 
 	transaction := func(tx *bolt.Tx) error {
@@ -421,18 +587,69 @@ func (wal *WAL) GetIndexedEntryForTerm(term int64) (*log.LogEntry, error) {
 		return nil
 	}
 
-	getIndexErr := wal.DB.View(transaction)
+	getIndexErr := store.timedView(transaction)
 	if getIndexErr != nil { return nil, getIndexErr }
 
 	return indexedEntry, nil
 }
 
+/*
+	Get Last Entry For Term
+		For the given term, get the latest known entry
+			1.) if the term is not indexed, there are no entries for the term in the replicated log
+			2.) if a later term is indexed, the last entry for the term is the entry before the first entry of the later term
+			3.) otherwise, the term is the latest term and the last entry is the latest entry in the replicated log
+*/
+
+func (store *BoltLogStore) GetLastEntryForTerm(term int64) (*log.LogEntry, error) {
+	var lastEntry *log.LogEntry
+
+	transaction := func(tx *bolt.Tx) error {
+		bucketName := []byte(Replog)
+		bucket := tx.Bucket(bucketName)
+
+		walBucketName := []byte(ReplogWAL)
+		walBucket := bucket.Bucket(walBucketName)
+
+		indexBucketName := []byte(ReplogIndex)
+		indexBucket := bucket.Bucket(indexBucketName)
+
+		if indexBucket.Get(ConvertIntToBytes(term)) == nil { return nil }
+
+		val := func() []byte {
+			_, nextTermVal := indexBucket.Cursor().Seek(ConvertIntToBytes(term + 1))
+			if nextTermVal == nil {
+				_, latestVal := walBucket.Cursor().Last()
+				return latestVal
+			}
+
+			nextTermEntry, transformErr := log.TransformBytesToLogEntry(nextTermVal)
+			if transformErr != nil { return nil }
+
+			return walBucket.Get(ConvertIntToBytes(nextTermEntry.Index - 1))
+		}()
+
+		if val == nil { return nil }
+
+		entry, transformErr := log.TransformBytesToLogEntry(val)
+		if transformErr != nil { return transformErr }
+		if entry.Term == term { lastEntry = entry }
+
+		return nil
+	}
+
+	getEntryErr := store.timedView(transaction)
+	if getEntryErr != nil { return nil, getEntryErr }
+
+	return lastEntry, nil
+}
+
 /*
 	Append Helper
 		shared function for appending entries to the replicated log
 */
 
-func (wal *WAL) appendHelper(bucket *bolt.Bucket, entry *log.LogEntry) (int64, int64, error) {
+func (store *BoltLogStore) appendHelper(bucket *bolt.Bucket, entry *log.LogEntry) (int64, int64, error) {
 	walBucketName := []byte(ReplogWAL)
 	walBucket := bucket.Bucket(walBucketName)
 
@@ -450,7 +667,12 @@ func (wal *WAL) appendHelper(bucket *bolt.Bucket, entry *log.LogEntry) (int64, i
 	return totalBytesAdded, totalKeysAdded, nil
 }
 
-func (wal *WAL) deleteLogsHelper(bucket *bolt.Bucket, startIndex, endIndex int64) (int64, int64, error){
+/*
+	Delete Logs Helper
+		delete the entries between the start and end index, inclusive, from the wal bucket
+*/
+
+func (store *BoltLogStore) deleteLogsHelper(bucket *bolt.Bucket, startIndex, endIndex int64) (int64, int64, error) {
 	totalBytesRemoved := int64(0)
 	totalKeysRemoved := int64(0)
 
@@ -460,47 +682,64 @@ func (wal *WAL) deleteLogsHelper(bucket *bolt.Bucket, startIndex, endIndex int64
 	startKey := ConvertIntToBytes(startIndex)
 	endKey := ConvertIntToBytes(endIndex)
 
-	var firstTermInBatch int64
-	firstEntryToBeDeleted := walBucket.Get(startKey)
-	if firstEntryToBeDeleted != nil { 
-		entry, transformErr := log.TransformBytesToLogEntry(firstEntryToBeDeleted)
-		if transformErr != nil { return totalBytesRemoved, totalKeysRemoved, transformErr }
-
-		firstTermInBatch = entry.Term
-	}
+	var keysToDelete [][]byte
 
 	cursor := walBucket.Cursor()
-	
 	for key, val := cursor.Seek(startKey); key != nil && bytes.Compare(key, endKey) <= 0; key, val = cursor.Next() {
-		delErr := bucket.Delete(key)
-		if delErr != nil { return totalBytesRemoved, totalKeysRemoved, delErr }
-
+		keysToDelete = append(keysToDelete, key)
 		totalBytesRemoved += int64(len(key)) + int64(len(val))
+	}
+
+	for _, key := range keysToDelete {
+		delErr := walBucket.Delete(key)
+		if delErr != nil { return 0, 0, delErr }
+
 		totalKeysRemoved++
 	}
 
-	keyOfNextLog := ConvertIntToBytes(endIndex + 1)
-	val := walBucket.Get(keyOfNextLog)
+	return totalBytesRemoved, totalKeysRemoved, nil
+}
 
-	if val != nil { 
-		entry, transformErr := log.TransformBytesToLogEntry(val)
-		if transformErr != nil { return totalBytesRemoved, totalKeysRemoved, transformErr }
+/*
+	Compact Term Index
+		after entries are removed from the start of the log, remove the indexed first entry for all terms before the term of
+		the earliest entry, and index the earliest entry as the first entry of its term
+			--> if the log is empty, every term is removed from the index
+*/
 
-		indexBucketName := []byte(ReplogIndex)
-		indexBucket := bucket.Bucket(indexBucketName)
+func (store *BoltLogStore) compactTermIndex(bucket *bolt.Bucket) error {
+	walBucketName := []byte(ReplogWAL)
+	walBucket := bucket.Bucket(walBucketName)
 
-		firstTermKey := ConvertIntToBytes(firstTermInBatch)
-		latestTermKey := ConvertIntToBytes(entry.Term)
+	indexBucketName := []byte(ReplogIndex)
+	indexBucket := bucket.Bucket(indexBucketName)
 
-		indexCursor := indexBucket.Cursor()
+	var earliest *log.LogEntry
 
-		for key, _ := indexCursor.Seek(firstTermKey); key != nil && bytes.Compare(key, latestTermKey) < 0; key, _ = indexCursor.Next() {
-			delErr := indexBucket.Delete(key)
-			if delErr != nil { return totalBytesRemoved, totalKeysRemoved, delErr }
-		}
-	} 
+	_, earliestVal := walBucket.Cursor().First()
+	if earliestVal != nil {
+		entry, transformErr := log.TransformBytesToLogEntry(earliestVal)
+		if transformErr != nil { return transformErr }
 
-	return totalBytesRemoved, totalKeysRemoved, nil
+		earliest = entry
+	}
+
+	var termsToDelete [][]byte
+
+	indexCursor := indexBucket.Cursor()
+	for key, _ := indexCursor.First(); key != nil; key, _ = indexCursor.Next() {
+		if earliest != nil && ConvertBytesToInt(key) >= earliest.Term { break }
+		termsToDelete = append(termsToDelete, key)
+	}
+
+	for _, key := range termsToDelete {
+		delErr := indexBucket.Delete(key)
+		if delErr != nil { return delErr }
+	}
+
+	if earliest == nil { return nil }
+
+	return indexBucket.Put(ConvertIntToBytes(earliest.Term), earliestVal)
 }
 
 /*
@@ -508,7 +747,7 @@ func (wal *WAL) deleteLogsHelper(bucket *bolt.Bucket, startIndex, endIndex int64
 		get the earliest known entry for the latest term known in the cluster
 */
 
-func (wal *WAL) getLatestIndexedEntry(bucket *bolt.Bucket) (*log.LogEntry, error) {
+func (store *BoltLogStore) getLatestIndexedEntry(bucket *bolt.Bucket) (*log.LogEntry, error) {
 	indexBucketName := []byte(ReplogIndex)
 	indexBucket := bucket.Bucket(indexBucketName)
 
@@ -531,7 +770,7 @@ func (wal *WAL) getLatestIndexedEntry(bucket *bolt.Bucket) (*log.LogEntry, error
 	When a higher term than previously known is discovered, update the index to include the first entry associated with term
 */
 
-func (wal *WAL) setIndexForFirstLogInTerm(bucket *bolt.Bucket, newEntry *log.LogEntry, previousIndexed *log.LogEntry) (*log.LogEntry, error) {
+func (store *BoltLogStore) setIndexForFirstLogInTerm(bucket *bolt.Bucket, newEntry *log.LogEntry, previousIndexed *log.LogEntry) (*log.LogEntry, error) {
 	if newEntry.Term > previousIndexed.Term {
 		indexBucketName := []byte(ReplogIndex)
 		indexBucket := bucket.Bucket(indexBucketName)
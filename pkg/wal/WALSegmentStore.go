@@ -0,0 +1,781 @@
+package wal
+
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "hash/crc32"
+import "io"
+import "os"
+import "path/filepath"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/metrics"
+
+
+//=========================================== Write Ahead Log Segment Store
+
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+/*
+	New Segment Log Store
+		a log store that keeps the replicated log in append only segment files, instead of as keys in a B+ tree, so an
+		append is a single write to the end of a file followed by an fsync
+
+		each segment file is named by the index of its first entry, and holds records of the form:
+			length of the entry (4 bytes) | crc32 of the rest of the record (4 bytes) | index (8 bytes) | term (8 bytes) | entry
+		all numbers are big endian, and the entry is the gob encoded log entry
+
+		the position of each entry in its segment and the first entry for each term are kept in memory, so reads are a
+		single read at a known offset and no scan of the log is needed outside of startup
+
+		on open
+			1.) read the first index marker, which is the first index not removed by compaction
+			2.) scan each segment in order, verifying each record. A torn or corrupt record at the end of the last segment
+				is from a write that never completed, so the segment is truncated to the last good record. Corruption
+				anywhere else is an error
+			3.) remove segments that are empty or fully compacted, and build the in memory index for the rest
+			4.) if a sync interval is set, start the loop that fsyncs the active segment on the interval
+*/
+
+func NewSegmentLogStore(directory string, opts WALOpts) (*SegmentLogStore, error) {
+	mkdirErr := os.MkdirAll(directory, 0755)
+	if mkdirErr != nil { return nil, mkdirErr }
+
+	segmentSize := opts.SegmentSize
+	if segmentSize <= 0 { segmentSize = DefaultSegmentSize }
+
+	store := &SegmentLogStore{
+		Directory: directory,
+		SegmentSize: segmentSize,
+		SyncInterval: opts.SyncInterval,
+		closed: make(chan struct{}),
+	}
+
+	firstIndex, markerErr := store.readFirstIndex()
+	if markerErr != nil { return nil, markerErr }
+
+	store.firstIndex = firstIndex
+
+	loadErr := store.loadSegments()
+	if loadErr != nil {
+		store.closeSegments()
+		return nil, loadErr
+	}
+
+	if store.SyncInterval > 0 { go store.syncLoop() }
+
+	return store, nil
+}
+
+/*
+	Append, Range Append
+		append entries to the end of the active segment, where all entries passed in are written with a single write and
+		a single fsync, rolling over to a new segment when the active segment reaches the segment size
+			--> entries must follow the latest entry in the log, so conflicting entries are removed with truncate from
+				before appending new ones. If the log is empty, the first entry starts a new segment at its index
+*/
+
+func (store *SegmentLogStore) Append(entry *log.LogEntry) error {
+	return store.RangeAppend([]*log.LogEntry{ entry })
+}
+
+func (store *SegmentLogStore) RangeAppend(logs []*log.LogEntry) error {
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	var batch []byte
+	var batchOffsets []int64
+	var batchTerms []termIndex
+
+	lastIndex, hasEntries := store.lastIndex()
+
+	latestTerm := int64(-1)
+	if len(store.terms) > 0 { latestTerm = store.terms[len(store.terms) - 1].Term }
+
+	for _, entry := range logs {
+		if ! hasEntries {
+			resetErr := store.reset(entry.Index)
+			if resetErr != nil { return resetErr }
+
+			hasEntries = true
+			latestTerm = -1
+		} else if entry.Index != lastIndex + 1 {
+			return errors.New("non contiguous append at index " + strconv.FormatInt(entry.Index, 10) + ", latest index is " + strconv.FormatInt(lastIndex, 10))
+		}
+
+		record, encodeErr := encodeRecord(entry)
+		if encodeErr != nil { return encodeErr }
+
+		active := store.segments[len(store.segments) - 1]
+		activeSize := active.Size + int64(len(batch))
+
+		if activeSize > 0 && activeSize + int64(len(record)) > store.SegmentSize {
+			if len(batch) > 0 {
+				flushErr := store.flush(active, batch, batchOffsets, batchTerms)
+				if flushErr != nil { return flushErr }
+
+				batch, batchOffsets, batchTerms = nil, nil, nil
+			}
+
+			rollErr := store.roll(entry.Index)
+			if rollErr != nil { return rollErr }
+
+			active = store.segments[len(store.segments) - 1]
+		}
+
+		if entry.Term > latestTerm {
+			batchTerms = append(batchTerms, termIndex{ Term: entry.Term, Index: entry.Index })
+			latestTerm = entry.Term
+		}
+
+		batchOffsets = append(batchOffsets, active.Size + int64(len(batch)))
+		batch = append(batch, record...)
+		lastIndex = entry.Index
+	}
+
+	if len(batch) == 0 { return nil }
+
+	return store.flush(store.segments[len(store.segments) - 1], batch, batchOffsets, batchTerms)
+}
+
+/*
+	Read
+		read a single entry at the offset in its segment, or nil if the entry is not in the log
+*/
+
+func (store *SegmentLogStore) Read(index int64) (*log.LogEntry, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	return store.readEntry(index)
+}
+
+/*
+	Get Range
+		read all entries from start to end that are in the log, with one read per segment
+*/
+
+func (store *SegmentLogStore) GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	lastIndex, hasEntries := store.lastIndex()
+	if ! hasEntries { return nil, nil }
+
+	if startIndex < store.firstIndex { startIndex = store.firstIndex }
+	if endIndex > lastIndex { endIndex = lastIndex }
+
+	var entries []*log.LogEntry
+
+	for index := startIndex; index <= endIndex; {
+		seg, pos := store.locate(index)
+
+		endPos := len(seg.Offsets) - 1
+		if segEnd := int(endIndex - seg.FirstIndex); segEnd < endPos { endPos = segEnd }
+
+		records, readErr := seg.readRecords(pos, endPos)
+		if readErr != nil { return nil, readErr }
+
+		for _, record := range records {
+			entry, transformErr := log.TransformBytesToLogEntry(record)
+			if transformErr != nil { return nil, transformErr }
+
+			entries = append(entries, entry)
+		}
+
+		index += int64(len(records))
+	}
+
+	return entries, nil
+}
+
+/*
+	Get Latest, Get Earliest
+		read the last and first entries in the log, or nil if the log is empty
+*/
+
+func (store *SegmentLogStore) GetLatest() (*log.LogEntry, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	lastIndex, hasEntries := store.lastIndex()
+	if ! hasEntries { return nil, nil }
+
+	return store.readEntry(lastIndex)
+}
+
+func (store *SegmentLogStore) GetEarliest() (*log.LogEntry, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	_, hasEntries := store.lastIndex()
+	if ! hasEntries { return nil, nil }
+
+	return store.readEntry(store.firstIndex)
+}
+
+/*
+	Delete Logs
+		compact the log up to and including the end index
+			1.) write the new first index marker, so entries up to the end index are ignored from now on, even if they are
+				still in a segment that is partially compacted
+			2.) delete all segments where every entry is at or before the end index
+			3.) drop the first entry for all terms that are fully compacted, and move the first entry of the term of the new
+				first entry up to it
+*/
+
+func (store *SegmentLogStore) DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error) {
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	lastIndex, hasEntries := store.lastIndex()
+	if ! hasEntries || endIndex < store.firstIndex { return 0, 0, nil }
+	if endIndex > lastIndex { endIndex = lastIndex }
+
+	totalBytesRemoved := store.bytesBetween(store.firstIndex, endIndex)
+	totalKeysRemoved := endIndex - store.firstIndex + 1
+
+	markerErr := store.writeFirstIndex(endIndex + 1)
+	if markerErr != nil { return 0, 0, markerErr }
+
+	store.firstIndex = endIndex + 1
+
+	var remaining []*segment
+	for _, seg := range store.segments {
+		if seg.lastIndex() > endIndex {
+			remaining = append(remaining, seg)
+			continue
+		}
+
+		removeErr := seg.remove()
+		if removeErr != nil { return totalBytesRemoved, totalKeysRemoved, removeErr }
+	}
+
+	store.segments = remaining
+
+	store.terms = compactTerms(store.terms, store.firstIndex)
+	store.totalBytes -= totalBytesRemoved
+
+	return totalBytesRemoved, totalKeysRemoved, nil
+}
+
+/*
+	Truncate From
+		remove all entries from the index forward
+			1.) delete all segments that start at or after the index
+			2.) truncate the segment containing the index to the offset of the entry
+			3.) remove the first entry for all terms that start at or after the index
+*/
+
+func (store *SegmentLogStore) TruncateFrom(index int64) (int64, int64, error) {
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	lastIndex, hasEntries := store.lastIndex()
+	if ! hasEntries || index > lastIndex { return 0, 0, nil }
+	if index < store.firstIndex { index = store.firstIndex }
+
+	totalBytesRemoved := store.bytesBetween(index, lastIndex)
+	totalKeysRemoved := lastIndex - index + 1
+
+	for len(store.segments) > 0 {
+		seg := store.segments[len(store.segments) - 1]
+
+		if seg.FirstIndex >= index {
+			removeErr := seg.remove()
+			if removeErr != nil { return 0, 0, removeErr }
+
+			store.segments = store.segments[:len(store.segments) - 1]
+			continue
+		}
+
+		pos := int(index - seg.FirstIndex)
+		if pos >= len(seg.Offsets) { break }
+
+		size := seg.Offsets[pos]
+
+		truncateErr := seg.File.Truncate(size)
+		if truncateErr != nil { return 0, 0, truncateErr }
+
+		syncErr := seg.sync()
+		if syncErr != nil { return 0, 0, syncErr }
+
+		seg.Offsets = seg.Offsets[:pos]
+		seg.Size = size
+		break
+	}
+
+	terms := store.terms
+	for len(terms) > 0 && terms[len(terms) - 1].Index >= index { terms = terms[:len(terms) - 1] }
+
+	store.terms = terms
+	store.totalBytes -= totalBytesRemoved
+
+	return totalBytesRemoved, totalKeysRemoved, nil
+}
+
+/*
+	Get Total, Get Bucket Size In Bytes
+		the total entries and the total size of the records in the log
+*/
+
+func (store *SegmentLogStore) GetTotal() (int, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	lastIndex, hasEntries := store.lastIndex()
+	if ! hasEntries { return 0, nil }
+
+	return int(lastIndex - store.firstIndex + 1), nil
+}
+
+func (store *SegmentLogStore) GetBucketSizeInBytes() (int64, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	return store.totalBytes, nil
+}
+
+/*
+	Get Indexed Entry For Term, Get Last Entry For Term
+		the first and last entries in the log for a term, or nil if there are none
+*/
+
+func (store *SegmentLogStore) GetIndexedEntryForTerm(term int64) (*log.LogEntry, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	idx, ok := store.findTerm(term)
+	if ! ok { return nil, nil }
+
+	return store.readEntry(store.terms[idx].Index)
+}
+
+func (store *SegmentLogStore) GetLastEntryForTerm(term int64) (*log.LogEntry, error) {
+	store.Mutex.RLock()
+	defer store.Mutex.RUnlock()
+
+	idx, ok := store.findTerm(term)
+	if ! ok { return nil, nil }
+
+	lastIndex, _ := store.lastIndex()
+	if idx + 1 < len(store.terms) { lastIndex = store.terms[idx + 1].Index - 1 }
+
+	entry, readErr := store.readEntry(lastIndex)
+	if readErr != nil || entry == nil || entry.Term != term { return nil, readErr }
+
+	return entry, nil
+}
+
+/*
+	Close
+		stop the sync loop, then fsync and close all segments
+*/
+
+func (store *SegmentLogStore) Close() error {
+	store.Mutex.Lock()
+	defer store.Mutex.Unlock()
+
+	select {
+		case <- store.closed:
+			return nil
+		default:
+			close(store.closed)
+	}
+
+	return store.closeSegments()
+}
+
+/*
+	All functions below are helper functions for the segment store, and expect the mutex to be held by the caller
+*/
+
+func (store *SegmentLogStore) flush(seg *segment, batch []byte, offsets []int64, terms []termIndex) error {
+	_, writeErr := seg.File.WriteAt(batch, seg.Size)
+	if writeErr != nil {
+		seg.File.Truncate(seg.Size)
+		return writeErr
+	}
+
+	seg.Offsets = append(seg.Offsets, offsets...)
+	seg.Size += int64(len(batch))
+
+	store.terms = append(store.terms, terms...)
+	store.totalBytes += int64(len(batch))
+
+	if store.SyncInterval > 0 {
+		store.dirty = true
+		return nil
+	}
+
+	return seg.sync()
+}
+
+func (store *SegmentLogStore) roll(firstIndex int64) error {
+	active := store.segments[len(store.segments) - 1]
+
+	syncErr := active.sync()
+	if syncErr != nil { return syncErr }
+
+	seg, createErr := store.createSegment(firstIndex)
+	if createErr != nil { return createErr }
+
+	store.segments = append(store.segments, seg)
+	return nil
+}
+
+func (store *SegmentLogStore) reset(firstIndex int64) error {
+	for _, seg := range store.segments {
+		removeErr := seg.remove()
+		if removeErr != nil { return removeErr }
+	}
+
+	store.segments = nil
+	store.terms = nil
+	store.totalBytes = 0
+
+	if firstIndex != store.firstIndex {
+		markerErr := store.writeFirstIndex(firstIndex)
+		if markerErr != nil { return markerErr }
+
+		store.firstIndex = firstIndex
+	}
+
+	seg, createErr := store.createSegment(firstIndex)
+	if createErr != nil { return createErr }
+
+	store.segments = []*segment{ seg }
+	return nil
+}
+
+func (store *SegmentLogStore) createSegment(firstIndex int64) (*segment, error) {
+	file, openErr := os.OpenFile(store.segmentPath(firstIndex), os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0600)
+	if openErr != nil { return nil, openErr }
+
+	return &segment{ FirstIndex: firstIndex, File: file }, nil
+}
+
+func (store *SegmentLogStore) readEntry(index int64) (*log.LogEntry, error) {
+	lastIndex, hasEntries := store.lastIndex()
+	if ! hasEntries || index < store.firstIndex || index > lastIndex { return nil, nil }
+
+	seg, pos := store.locate(index)
+
+	records, readErr := seg.readRecords(pos, pos)
+	if readErr != nil { return nil, readErr }
+
+	return log.TransformBytesToLogEntry(records[0])
+}
+
+func (store *SegmentLogStore) lastIndex() (int64, bool) {
+	if len(store.segments) == 0 { return 0, false }
+
+	lastIndex := store.segments[len(store.segments) - 1].lastIndex()
+	return lastIndex, lastIndex >= store.firstIndex
+}
+
+func (store *SegmentLogStore) locate(index int64) (*segment, int) {
+	idx := sort.Search(len(store.segments), func(i int) bool { return store.segments[i].FirstIndex > index }) - 1
+	seg := store.segments[idx]
+
+	return seg, int(index - seg.FirstIndex)
+}
+
+func (store *SegmentLogStore) findTerm(term int64) (int, bool) {
+	idx := sort.Search(len(store.terms), func(i int) bool { return store.terms[i].Term >= term })
+	return idx, idx < len(store.terms) && store.terms[idx].Term == term
+}
+
+func (store *SegmentLogStore) bytesBetween(startIndex int64, endIndex int64) int64 {
+	total := int64(0)
+
+	for index := startIndex; index <= endIndex; {
+		seg, pos := store.locate(index)
+
+		endPos := len(seg.Offsets) - 1
+		if segEnd := int(endIndex - seg.FirstIndex); segEnd < endPos { endPos = segEnd }
+
+		total += seg.endOffset(endPos) - seg.Offsets[pos]
+		index += int64(endPos - pos + 1)
+	}
+
+	return total
+}
+
+func (store *SegmentLogStore) syncLoop() {
+	ticker := time.NewTicker(store.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+			case <- store.closed:
+				return
+			case <- ticker.C:
+				store.Mutex.Lock()
+
+				if store.dirty && len(store.segments) > 0 {
+					syncErr := store.segments[len(store.segments) - 1].sync()
+					if syncErr != nil { Log.Error("error syncing wal segment:", syncErr.Error()) }
+					if syncErr == nil { store.dirty = false }
+				}
+
+				store.Mutex.Unlock()
+		}
+	}
+}
+
+func (store *SegmentLogStore) closeSegments() error {
+	var closeErr error
+
+	for _, seg := range store.segments {
+		syncErr := seg.sync()
+		if syncErr != nil && closeErr == nil { closeErr = syncErr }
+
+		fileCloseErr := seg.File.Close()
+		if fileCloseErr != nil && closeErr == nil { closeErr = fileCloseErr }
+	}
+
+	store.segments = nil
+	return closeErr
+}
+
+/*
+	Load Segments
+		scan all segments in the directory in order of their first index, rebuilding the in memory index
+*/
+
+func (store *SegmentLogStore) loadSegments() error {
+	dirEntries, readDirErr := os.ReadDir(store.Directory)
+	if readDirErr != nil { return readDirErr }
+
+	var segmentNames []string
+	for _, dirEntry := range dirEntries {
+		if strings.HasSuffix(dirEntry.Name(), SegmentExtension) { segmentNames = append(segmentNames, dirEntry.Name()) }
+	}
+
+	for idx, name := range segmentNames {
+		firstIndex, parseErr := strconv.ParseInt(strings.TrimSuffix(name, SegmentExtension), 10, 64)
+		if parseErr != nil { return errors.New("invalid wal segment name: " + name) }
+
+		file, openErr := os.OpenFile(filepath.Join(store.Directory, name), os.O_RDWR, 0600)
+		if openErr != nil { return openErr }
+
+		seg := &segment{ FirstIndex: firstIndex, File: file }
+
+		terms, scanErr := seg.scan(idx == len(segmentNames) - 1)
+		if scanErr != nil {
+			file.Close()
+			return scanErr
+		}
+
+		if len(seg.Offsets) == 0 || seg.lastIndex() < store.firstIndex {
+			removeErr := seg.remove()
+			if removeErr != nil { return removeErr }
+
+			continue
+		}
+
+		if len(store.segments) > 0 && store.segments[len(store.segments) - 1].lastIndex() + 1 != seg.FirstIndex {
+			file.Close()
+			return errors.New("gap in wal segments before index " + strconv.FormatInt(seg.FirstIndex, 10))
+		}
+
+		store.segments = append(store.segments, seg)
+
+		for _, term := range terms {
+			if len(store.terms) > 0 && store.terms[len(store.terms) - 1].Term >= term.Term { continue }
+			store.terms = append(store.terms, term)
+		}
+	}
+
+	if len(store.segments) > 0 {
+		store.terms = compactTerms(store.terms, store.firstIndex)
+
+		if store.segments[0].FirstIndex > store.firstIndex { store.firstIndex = store.segments[0].FirstIndex }
+
+		lastIndex, _ := store.lastIndex()
+		store.totalBytes = store.bytesBetween(store.firstIndex, lastIndex)
+	}
+
+	return nil
+}
+
+func (store *SegmentLogStore) segmentPath(firstIndex int64) string {
+	return filepath.Join(store.Directory, fmt.Sprintf("%020d%s", firstIndex, SegmentExtension))
+}
+
+/*
+	Read First Index, Write First Index
+		the first index marker is written to a temporary file and renamed over the marker, so it is always either the
+		previous or the new value
+*/
+
+func (store *SegmentLogStore) readFirstIndex() (int64, error) {
+	marker, readErr := os.ReadFile(filepath.Join(store.Directory, FirstIndexFileName))
+	if os.IsNotExist(readErr) { return 0, nil }
+	if readErr != nil { return 0, readErr }
+	if len(marker) != 8 { return 0, errors.New("invalid wal first index marker") }
+
+	return ConvertBytesToInt(marker), nil
+}
+
+func (store *SegmentLogStore) writeFirstIndex(firstIndex int64) error {
+	markerPath := filepath.Join(store.Directory, FirstIndexFileName)
+	tmpPath := markerPath + ".tmp"
+
+	file, openErr := os.OpenFile(tmpPath, os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0600)
+	if openErr != nil { return openErr }
+
+	_, writeErr := file.Write(ConvertIntToBytes(firstIndex))
+	if writeErr == nil { writeErr = file.Sync() }
+
+	closeErr := file.Close()
+	if writeErr != nil { return writeErr }
+	if closeErr != nil { return closeErr }
+
+	return os.Rename(tmpPath, markerPath)
+}
+
+/*
+	Compact Terms
+		drop the first entry for all terms that end before the first index, and move the first entry of the term of the
+		first index up to it
+*/
+
+func compactTerms(terms []termIndex, firstIndex int64) []termIndex {
+	var compacted []termIndex
+
+	for idx, term := range terms {
+		if idx + 1 < len(terms) && terms[idx + 1].Index <= firstIndex { continue }
+		if term.Index < firstIndex { term.Index = firstIndex }
+
+		compacted = append(compacted, term)
+	}
+
+	return compacted
+}
+
+/*
+	Segment
+		functions on a single segment file
+*/
+
+func (seg *segment) lastIndex() int64 {
+	return seg.FirstIndex + int64(len(seg.Offsets)) - 1
+}
+
+func (seg *segment) endOffset(pos int) int64 {
+	if pos + 1 < len(seg.Offsets) { return seg.Offsets[pos + 1] }
+	return seg.Size
+}
+
+func (seg *segment) readRecords(startPos int, endPos int) ([][]byte, error) {
+	start := seg.Offsets[startPos]
+
+	buf := make([]byte, seg.endOffset(endPos) - start)
+	_, readErr := seg.File.ReadAt(buf, start)
+	if readErr != nil { return nil, readErr }
+
+	records := make([][]byte, 0, endPos - startPos + 1)
+	for pos := startPos; pos <= endPos; pos++ {
+		record := buf[seg.Offsets[pos] - start:seg.endOffset(pos) - start]
+
+		payload, _, _, decodeErr := decodeRecord(record)
+		if decodeErr != nil { return nil, decodeErr }
+
+		records = append(records, payload)
+	}
+
+	return records, nil
+}
+
+func (seg *segment) scan(isLast bool) ([]termIndex, error) {
+	data, readErr := io.ReadAll(seg.File)
+	if readErr != nil { return nil, readErr }
+
+	var terms []termIndex
+	offset := int64(0)
+
+	for offset < int64(len(data)) {
+		expectedIndex := seg.FirstIndex + int64(len(seg.Offsets))
+
+		recordSize, index, term, decodeErr := decodeRecordAt(data[offset:])
+		if decodeErr == nil && index != expectedIndex { decodeErr = errors.New("unexpected index in wal segment") }
+
+		if decodeErr != nil {
+			if ! isLast { return nil, errors.New("corrupt wal segment " + seg.File.Name() + ": " + decodeErr.Error()) }
+
+			Log.Warn("truncating torn write at the end of wal segment", seg.File.Name(), "at offset", offset)
+
+			truncateErr := seg.File.Truncate(offset)
+			if truncateErr != nil { return nil, truncateErr }
+
+			break
+		}
+
+		if len(terms) == 0 || term > terms[len(terms) - 1].Term { terms = append(terms, termIndex{ Term: term, Index: index }) }
+
+		seg.Offsets = append(seg.Offsets, offset)
+		offset += recordSize
+	}
+
+	seg.Size = offset
+	return terms, nil
+}
+
+func (seg *segment) sync() error {
+	defer metrics.WALFsyncDuration.ObserveSince(time.Now())
+	return seg.File.Sync()
+}
+
+func (seg *segment) remove() error {
+	seg.File.Close()
+	return os.Remove(seg.File.Name())
+}
+
+/*
+	Encode Record, Decode Record
+		records are verified with the crc on every read, so a corrupt entry is returned as an error instead of decoded
+*/
+
+func encodeRecord(entry *log.LogEntry) ([]byte, error) {
+	payload, transformErr := log.TransformLogEntryToBytes(entry)
+	if transformErr != nil { return nil, transformErr }
+
+	record := make([]byte, SegmentHeaderBytes + len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(record[8:16], uint64(entry.Index))
+	binary.BigEndian.PutUint64(record[16:24], uint64(entry.Term))
+	copy(record[SegmentHeaderBytes:], payload)
+
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(record[8:], crcTable))
+
+	return record, nil
+}
+
+func decodeRecord(record []byte) ([]byte, int64, int64, error) {
+	recordSize, index, term, decodeErr := decodeRecordAt(record)
+	if decodeErr != nil { return nil, 0, 0, decodeErr }
+	if recordSize != int64(len(record)) { return nil, 0, 0, errors.New("wal record size mismatch") }
+
+	return record[SegmentHeaderBytes:], index, term, nil
+}
+
+func decodeRecordAt(data []byte) (int64, int64, int64, error) {
+	if len(data) < SegmentHeaderBytes { return 0, 0, 0, errors.New("incomplete wal record header") }
+
+	recordSize := int64(SegmentHeaderBytes) + int64(binary.BigEndian.Uint32(data[0:4]))
+	if int64(len(data)) < recordSize { return 0, 0, 0, errors.New("incomplete wal record") }
+
+	if crc32.Checksum(data[8:recordSize], crcTable) != binary.BigEndian.Uint32(data[4:8]) { return 0, 0, 0, errors.New("wal record checksum mismatch") }
+
+	index := int64(binary.BigEndian.Uint64(data[8:16]))
+	term := int64(binary.BigEndian.Uint64(data[16:24]))
+
+	return recordSize, index, term, nil
+}
@@ -30,7 +30,7 @@ func (wal *WAL) SetSnapshot(snapshot *SnapshotEntry) error {
 		return nil
 	}
 
-	setErr := wal.DB.Update(transaction)
+	setErr := wal.timedUpdate(transaction)
 	if setErr != nil { return setErr }
 
 	return nil
@@ -61,8 +61,33 @@ func (wal *WAL) GetSnapshot() (*SnapshotEntry, error) {
 		return nil
 	}
 
-	getErr := wal.DB.View(transaction)
+	getErr := wal.timedView(transaction)
 	if getErr != nil { return nil, getErr }
 
 	return snapshotEntry, nil
+}
+
+/*
+	Get First Index Marker, Put First Index Marker
+		the first index marker is kept in the snapshot bucket next to the snapshot entry, and is the first index of the
+		replicated log that has not been compacted
+			--> all entries before the marker are deleted by compaction, so a marker of 0 means the log was never compacted
+*/
+
+func getFirstIndexMarker(tx *bolt.Tx) (int64, error) {
+	bucket := tx.Bucket([]byte(Snapshot))
+	if bucket == nil { return 0, nil }
+
+	val := bucket.Get([]byte(FirstIndexKey))
+	if val == nil { return 0, nil }
+	if len(val) != 8 { return 0, ErrInvalidFirstIndexMarker }
+
+	return ConvertBytesToInt(val), nil
+}
+
+func putFirstIndexMarker(tx *bolt.Tx, index int64) error {
+	bucket, createErr := tx.CreateBucketIfNotExists([]byte(Snapshot))
+	if createErr != nil { return createErr }
+
+	return bucket.Put([]byte(FirstIndexKey), ConvertIntToBytes(index))
 }
\ No newline at end of file
@@ -30,7 +30,7 @@ func (wal *WAL) SetStat(statObj stats.Stats) error {
 		return nil
 	}
 
-	setErr := wal.DB.Update(transaction)
+	setErr := wal.timedUpdate(transaction)
 	if setErr != nil { return setErr }
 
 	return nil
@@ -62,7 +62,7 @@ func (wal *WAL) GetStats() ([]stats.Stats, error) {
 		return nil
 	}
 
-	getErr := wal.DB.View(transaction)
+	getErr := wal.timedView(transaction)
 	if getErr != nil { return nil, getErr }
 
 	return statsArr, nil
@@ -100,7 +100,7 @@ func (wal *WAL) DeleteStats() error {
 		return nil
 	}
 
-	deleteErr := wal.DB.Update(transaction)
+	deleteErr := wal.timedUpdate(transaction)
 	if deleteErr != nil { return deleteErr }
 
 	return nil
@@ -1,22 +1,124 @@
 package wal
 
+import "encoding/json"
+import "errors"
+import "os"
 import "sync"
+import "time"
 import bolt "go.etcd.io/bbolt"
 
+import "github.com/sirgallo/raft/pkg/log"
+
+
+type LogStore interface {
+	Append(entry *log.LogEntry) error
+	RangeAppend(logs []*log.LogEntry) error
+	Read(index int64) (*log.LogEntry, error)
+	GetRange(startIndex int64, endIndex int64) ([]*log.LogEntry, error)
+	GetLatest() (*log.LogEntry, error)
+	GetEarliest() (*log.LogEntry, error)
+	DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error)
+	TruncateFrom(index int64) (int64, int64, error)
+	GetTotal() (int, error)
+	GetBucketSizeInBytes() (int64, error)
+	GetIndexedEntryForTerm(term int64) (*log.LogEntry, error)
+	GetLastEntryForTerm(term int64) (*log.LogEntry, error)
+	Close() error
+}
+
+type WALOpts struct {
+	Backend LogBackend
+	SegmentSize int64
+	SyncInterval time.Duration
+	CacheSize int
+	CompactThreshold float64
+}
 
 type WAL struct {
+	LogStore
 	Mutex sync.Mutex
 	DBFile string
 	DB *bolt.DB
 }
 
+type BoltLogStore struct {
+	DB *bolt.DB
+}
+
+type SegmentLogStore struct {
+	Mutex sync.RWMutex
+	Directory string
+	SegmentSize int64
+	SyncInterval time.Duration
+
+	segments []*segment
+	terms []termIndex
+	firstIndex int64
+	totalBytes int64
+	dirty bool
+	closed chan struct{}
+}
+
+type CachedLogStore struct {
+	Mutex sync.RWMutex
+	Store LogStore
+
+	entries []*log.LogEntry
+	head int
+	count int
+}
+
+type WALReport struct {
+	Entries int64 `json:"entries"`
+	SizeInBytes int64 `json:"sizeInBytes"`
+	StatsEntries int64 `json:"statsEntries"`
+	StatsSizeInBytes int64 `json:"statsSizeInBytes"`
+	FirstIndex int64 `json:"firstIndex"`
+	LastIndex int64 `json:"lastIndex"`
+	LastValidIndex int64 `json:"lastValidIndex"`
+	Gaps []IndexGap `json:"gaps,omitempty"`
+	InvalidEntries []int64 `json:"invalidEntries,omitempty"`
+	TermIndexErrors []string `json:"termIndexErrors,omitempty"`
+}
+
+type IndexGap struct {
+	From int64 `json:"from"`
+	To int64 `json:"to"`
+}
+
+type DumpedEntry struct {
+	Index int64 `json:"index"`
+	Term int64 `json:"term"`
+	RequestID string `json:"requestId,omitempty"`
+	Timestamp int64 `json:"timestamp,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type segment struct {
+	FirstIndex int64
+	File *os.File
+	Offsets []int64
+	Size int64
+}
+
+type termIndex struct {
+	Term int64
+	Index int64
+}
+
 type SnapshotEntry struct {
 	LastIncludedIndex int64
 	LastIncludedTerm int64
 	SnapshotFilePath string
+	Codec string
 }
 
 type StatOP = string
+type LogBackend = string
+
+
+var ErrMissingReplogBucket = errors.New("replog buckets not found in wal db")
+var ErrInvalidFirstIndexMarker = errors.New("first index marker in snapshot bucket is not 8 bytes")
 
 
 const NAME = "WAL"
@@ -37,6 +139,36 @@ const (
 
 const Snapshot = "snapshot"
 const SnapshotKey = "currentsnapshot"
+const FirstIndexKey = "firstindex"
+const CompactionChunkSize = 500
+
+const (
+	TxUpdate = "update"
+	TxView = "view"
+)
 
 const Stats = "stats"
-const MaxStats = 1000
\ No newline at end of file
+const MaxStats = 1000
+
+const (
+	BoltBackend LogBackend = "bolt"
+	SegmentBackend LogBackend = "segment"
+)
+
+const SegmentSubDirectory = "segments"
+const SegmentExtension = ".seg"
+const SegmentHeaderBytes = 24
+const FirstIndexFileName = "firstindex"
+const DefaultSegmentSize = 64 << 20
+const DefaultCacheSize = 4096
+const InspectOpenTimeout = 1 * time.Second
+const CompactSuffix = ".compact"
+const CompactTxMaxSize = 64 << 20
+
+const (
+	WALBackendEnv = "WAL_BACKEND"
+	WALSegmentSizeEnv = "WAL_SEGMENT_SIZE"
+	WALSyncIntervalEnv = "WAL_SYNC_INTERVAL"
+	WALCacheSizeEnv = "WAL_CACHE_SIZE"
+	WALCompactThresholdEnv = "WAL_COMPACT_THRESHOLD"
+)
@@ -1,6 +1,10 @@
 package wal
 
 import "encoding/binary"
+import "time"
+import bolt "go.etcd.io/bbolt"
+
+import "github.com/sirgallo/raft/pkg/metrics"
 
 
 //=========================================== Write Ahead Log Utils
@@ -23,4 +27,29 @@ func ConvertBytesToInt(byteArray []byte) int64 {
 
 	uintVal := binary.BigEndian.Uint64(byteArray)
 	return int64(uintVal)
-}
\ No newline at end of file
+}
+
+/*
+	Timed Update, Timed View
+		wrap bolt read-write and read transactions to record the transaction duration
+*/
+
+func (wal *WAL) timedUpdate(transaction func(tx *bolt.Tx) error) error {
+	defer metrics.BoltTxDuration.WithLabelValues(Replog, TxUpdate).ObserveSince(time.Now())
+	return wal.DB.Update(transaction)
+}
+
+func (wal *WAL) timedView(transaction func(tx *bolt.Tx) error) error {
+	defer metrics.BoltTxDuration.WithLabelValues(Replog, TxView).ObserveSince(time.Now())
+	return wal.DB.View(transaction)
+}
+
+func (store *BoltLogStore) timedUpdate(transaction func(tx *bolt.Tx) error) error {
+	defer metrics.BoltTxDuration.WithLabelValues(Replog, TxUpdate).ObserveSince(time.Now())
+	return store.DB.Update(transaction)
+}
+
+func (store *BoltLogStore) timedView(transaction func(tx *bolt.Tx) error) error {
+	defer metrics.BoltTxDuration.WithLabelValues(Replog, TxView).ObserveSince(time.Now())
+	return store.DB.View(transaction)
+}
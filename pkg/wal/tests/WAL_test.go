@@ -1,6 +1,14 @@
 package waltest
 
+import "errors"
+import "os"
+import "path/filepath"
 import "testing"
+import bolt "go.etcd.io/bbolt"
+
+import "github.com/sirgallo/raft/pkg/log"
+import "github.com/sirgallo/raft/pkg/statemachine"
+import "github.com/sirgallo/raft/pkg/wal"
 
 
 func TestNewWAL(t *testing.T) {
@@ -21,4 +29,418 @@ func TestReplay(t *testing.T) {
 
 func TestClose(t *testing.T) {
 	
-}
\ No newline at end of file
+}
+func TestTruncateFrom(t *testing.T) {
+	testWAL := newTestWAL(t)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 10; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 + idx / 4 }) // terms 1, 1, 1, 1, 2, 2, 2, 2, 3, 3
+	}
+
+	appendErr := testWAL.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	sizeBefore, _ := testWAL.GetBucketSizeInBytes()
+
+	_, keysRemoved, truncateErr := testWAL.TruncateFrom(6)
+	if truncateErr != nil { t.Fatalf("error truncating: %s", truncateErr.Error()) }
+
+	t.Logf("actual keys removed: %d, expected keys removed: %d\n", keysRemoved, 4)
+	if keysRemoved != 4 { t.Fatalf("actual keys removed not equal to expected: actual(%d), expected(%d)\n", keysRemoved, 4) }
+
+	total, _ := testWAL.GetTotal()
+	if total != 6 { t.Fatalf("actual total not equal to expected: actual(%d), expected(%d)\n", total, 6) }
+
+	sizeAfter, _ := testWAL.GetBucketSizeInBytes()
+	if sizeAfter >= sizeBefore { t.Fatalf("size not reduced after truncate: before(%d), after(%d)\n", sizeBefore, sizeAfter) }
+
+	latest, _ := testWAL.GetLatest()
+	if latest.Index != 5 { t.Fatalf("actual latest index not equal to expected: actual(%d), expected(%d)\n", latest.Index, 5) }
+
+	removedTerm, _ := testWAL.GetIndexedEntryForTerm(3)
+	if removedTerm != nil { t.Fatalf("term 3 still indexed after truncate\n") }
+
+	keptTerm, _ := testWAL.GetIndexedEntryForTerm(2)
+	if keptTerm == nil || keptTerm.Index != 4 { t.Fatalf("term 2 not indexed at first entry after truncate: %+v\n", keptTerm) }
+
+	appendErr = testWAL.RangeAppend([]*log.LogEntry{ { Index: 6, Term: 4 } })
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	newTerm, _ := testWAL.GetIndexedEntryForTerm(4)
+	if newTerm == nil || newTerm.Index != 6 { t.Fatalf("new term not indexed after append: %+v\n", newTerm) }
+}
+
+func TestGetLastEntryForTerm(t *testing.T) {
+	testWAL := newTestWAL(t)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 10; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 + idx / 4 })
+	}
+
+	appendErr := testWAL.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	expected := map[int64]int64{ 1: 3, 2: 7, 3: 9 }
+	for term, expectedIndex := range expected {
+		entry, getErr := testWAL.GetLastEntryForTerm(term)
+		if getErr != nil { t.Fatalf("error getting last entry for term: %s", getErr.Error()) }
+
+		t.Logf("term: %d, actual index: %d, expected index: %d\n", term, entry.Index, expectedIndex)
+		if entry.Index != expectedIndex { t.Fatalf("actual index not equal to expected: actual(%d), expected(%d)\n", entry.Index, expectedIndex) }
+	}
+
+	missing, _ := testWAL.GetLastEntryForTerm(5)
+	if missing != nil { t.Fatalf("entry found for unknown term: %+v\n", missing) }
+}
+
+func TestSegmentLogStore(t *testing.T) {
+	directory := t.TempDir()
+	opts := wal.WALOpts{ Backend: wal.SegmentBackend, SegmentSize: 512 }
+
+	store := newTestSegmentStore(t, directory, opts)
+
+	for idx := int64(0); idx < 50; idx++ {
+		appendErr := store.Append(&log.LogEntry{ Index: idx, Term: 1 + idx / 20 }) // terms 1 for 0-19, 2 for 20-39, 3 for 40-49
+		if appendErr != nil { t.Fatalf("error appending entry: %s", appendErr.Error()) }
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(directory, "*" + wal.SegmentExtension))
+	if len(segments) < 2 { t.Fatalf("segments not rolled over: %d segments\n", len(segments)) }
+
+	contiguousErr := store.Append(&log.LogEntry{ Index: 52, Term: 3 })
+	if contiguousErr == nil { t.Fatalf("non contiguous append accepted\n") }
+
+	entries, rangeErr := store.GetRange(10, 45)
+	if rangeErr != nil { t.Fatalf("error getting range: %s", rangeErr.Error()) }
+	if len(entries) != 36 || entries[0].Index != 10 || entries[35].Index != 45 { t.Fatalf("unexpected range: %d entries\n", len(entries)) }
+
+	lastForTerm, _ := store.GetLastEntryForTerm(1)
+	if lastForTerm == nil || lastForTerm.Index != 19 { t.Fatalf("unexpected last entry for term 1: %+v\n", lastForTerm) }
+
+	_, keysRemoved, truncateErr := store.TruncateFrom(40)
+	if truncateErr != nil { t.Fatalf("error truncating: %s", truncateErr.Error()) }
+	if keysRemoved != 10 { t.Fatalf("actual keys removed not equal to expected: actual(%d), expected(%d)\n", keysRemoved, 10) }
+
+	removedTerm, _ := store.GetIndexedEntryForTerm(3)
+	if removedTerm != nil { t.Fatalf("term 3 still indexed after truncate\n") }
+
+	_, keysCompacted, deleteErr := store.DeleteLogsUpToLastIncluded(24)
+	if deleteErr != nil { t.Fatalf("error compacting: %s", deleteErr.Error()) }
+	if keysCompacted != 25 { t.Fatalf("actual keys compacted not equal to expected: actual(%d), expected(%d)\n", keysCompacted, 25) }
+
+	sizeBefore, _ := store.GetBucketSizeInBytes()
+
+	closeErr := store.Close()
+	if closeErr != nil { t.Fatalf("error closing store: %s", closeErr.Error()) }
+
+	reopened := newTestSegmentStore(t, directory, opts)
+
+	earliest, _ := reopened.GetEarliest()
+	if earliest == nil || earliest.Index != 25 { t.Fatalf("unexpected earliest entry after reopen: %+v\n", earliest) }
+
+	latest, _ := reopened.GetLatest()
+	if latest == nil || latest.Index != 39 { t.Fatalf("unexpected latest entry after reopen: %+v\n", latest) }
+
+	total, _ := reopened.GetTotal()
+	if total != 15 { t.Fatalf("actual total not equal to expected: actual(%d), expected(%d)\n", total, 15) }
+
+	sizeAfter, _ := reopened.GetBucketSizeInBytes()
+	if sizeAfter != sizeBefore { t.Fatalf("size changed on reopen: before(%d), after(%d)\n", sizeBefore, sizeAfter) }
+
+	compactedTerm, _ := reopened.GetIndexedEntryForTerm(1)
+	if compactedTerm != nil { t.Fatalf("compacted term still indexed after reopen\n") }
+
+	firstInTerm, _ := reopened.GetIndexedEntryForTerm(2)
+	if firstInTerm == nil || firstInTerm.Index != 25 { t.Fatalf("unexpected first entry for term 2 after reopen: %+v\n", firstInTerm) }
+
+	appendErr := reopened.RangeAppend([]*log.LogEntry{ { Index: 40, Term: 4 }, { Index: 41, Term: 4 } })
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	newTerm, _ := reopened.GetIndexedEntryForTerm(4)
+	if newTerm == nil || newTerm.Index != 40 { t.Fatalf("new term not indexed after append: %+v\n", newTerm) }
+}
+
+func TestSegmentLogStoreTornWrite(t *testing.T) {
+	directory := t.TempDir()
+	opts := wal.WALOpts{ Backend: wal.SegmentBackend }
+
+	store := newTestSegmentStore(t, directory, opts)
+
+	for idx := int64(0); idx < 5; idx++ {
+		appendErr := store.Append(&log.LogEntry{ Index: idx, Term: 1 })
+		if appendErr != nil { t.Fatalf("error appending entry: %s", appendErr.Error()) }
+	}
+
+	store.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(directory, "*" + wal.SegmentExtension))
+	if len(segments) != 1 { t.Fatalf("unexpected number of segments: %d\n", len(segments)) }
+
+	info, statErr := os.Stat(segments[0])
+	if statErr != nil { t.Fatalf("error reading segment: %s", statErr.Error()) }
+
+	truncateErr := os.Truncate(segments[0], info.Size() - 3)
+	if truncateErr != nil { t.Fatalf("error truncating segment: %s", truncateErr.Error()) }
+
+	reopened := newTestSegmentStore(t, directory, opts)
+
+	latest, _ := reopened.GetLatest()
+	if latest == nil || latest.Index != 3 { t.Fatalf("torn entry not removed on reopen: %+v\n", latest) }
+
+	appendErr := reopened.Append(&log.LogEntry{ Index: 4, Term: 2 })
+	if appendErr != nil { t.Fatalf("error appending after recovery: %s", appendErr.Error()) }
+
+	entry, _ := reopened.Read(4)
+	if entry == nil || entry.Term != 2 { t.Fatalf("unexpected entry after recovery: %+v\n", entry) }
+}
+
+func TestCachedLogStore(t *testing.T) {
+	store := newTestSegmentStore(t, t.TempDir(), wal.WALOpts{ Backend: wal.SegmentBackend })
+	cache := wal.NewCachedLogStore(store, 8)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 20; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 + idx / 10 })
+	}
+
+	appendErr := cache.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	cached, _ := cache.GetRange(14, 25)
+	if len(cached) != 6 || cached[0].Index != 14 || cached[5].Index != 19 { t.Fatalf("unexpected cached range: %d entries\n", len(cached)) }
+
+	evicted, _ := cache.GetRange(2, 15)
+	if len(evicted) != 14 || evicted[0].Index != 2 { t.Fatalf("unexpected range for evicted entries: %d entries\n", len(evicted)) }
+
+	latest, _ := cache.GetLatest()
+	latest.Term = 100
+
+	unchanged, _ := cache.Read(19)
+	if unchanged.Term != 2 { t.Fatalf("cached entry modified through returned entry: %+v\n", unchanged) }
+
+	appended := &log.LogEntry{ Index: 20, Term: 2, Command: statemachine.Command{ Data: []byte("command") } }
+	appendErr = cache.Append(appended)
+	if appendErr != nil { t.Fatalf("error appending entry: %s", appendErr.Error()) }
+
+	appended.Command.Data[0] = 'X'
+
+	read, _ := cache.Read(20)
+	read.Command.Data[1] = 'X'
+
+	reread, _ := cache.Read(20)
+	if string(reread.Command.Data) != "command" { t.Fatalf("cached command data modified through caller: %s\n", reread.Command.Data) }
+
+	_, _, truncateAppendedErr := cache.TruncateFrom(20)
+	if truncateAppendedErr != nil { t.Fatalf("error truncating: %s", truncateAppendedErr.Error()) }
+
+	_, _, truncateErr := cache.TruncateFrom(17)
+	if truncateErr != nil { t.Fatalf("error truncating: %s", truncateErr.Error()) }
+
+	truncated, _ := cache.Read(17)
+	if truncated != nil { t.Fatalf("truncated entry still readable: %+v\n", truncated) }
+
+	latest, _ = cache.GetLatest()
+	if latest.Index != 16 { t.Fatalf("actual latest index not equal to expected: actual(%d), expected(%d)\n", latest.Index, 16) }
+
+	_, _, deleteErr := cache.DeleteLogsUpToLastIncluded(16)
+	if deleteErr != nil { t.Fatalf("error compacting: %s", deleteErr.Error()) }
+
+	latest, _ = cache.GetLatest()
+	if latest != nil { t.Fatalf("latest entry still returned after compacting all entries: %+v\n", latest) }
+
+	appendErr = cache.Append(&log.LogEntry{ Index: 17, Term: 3 })
+	if appendErr != nil { t.Fatalf("error appending entry: %s", appendErr.Error()) }
+
+	latest, _ = cache.GetLatest()
+	if latest == nil || latest.Index != 17 || latest.Term != 3 { t.Fatalf("unexpected latest entry after append: %+v\n", latest) }
+}
+
+func TestCachedLogStoreStoreFailure(t *testing.T) {
+	store := &failingLogStore{ LogStore: newTestSegmentStore(t, t.TempDir(), wal.WALOpts{ Backend: wal.SegmentBackend }) }
+	cache := wal.NewCachedLogStore(store, 8)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 20; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 })
+	}
+
+	appendErr := cache.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	store.Failing = true
+
+	_, _, truncateErr := cache.TruncateFrom(17)
+	if truncateErr == nil { t.Fatalf("failed truncate returned no error\n") }
+
+	latest, _ := cache.GetLatest()
+	if latest == nil || latest.Index != 19 { t.Fatalf("cache changed by failed truncate: %+v\n", latest) }
+
+	_, _, deleteErr := cache.DeleteLogsUpToLastIncluded(15)
+	if deleteErr == nil { t.Fatalf("failed compaction returned no error\n") }
+
+	cached, _ := cache.GetRange(14, 19)
+	if len(cached) != 6 || cached[0].Index != 14 { t.Fatalf("cache changed by failed compaction: %d entries\n", len(cached)) }
+
+	store.Partial = true
+
+	_, _, truncateErr = cache.TruncateFrom(17)
+	if truncateErr == nil { t.Fatalf("partially failed truncate returned no error\n") }
+
+	truncated, _ := cache.Read(17)
+	if truncated != nil { t.Fatalf("cache returned entry removed by partially failed truncate: %+v\n", truncated) }
+
+	latest, _ = cache.GetLatest()
+	if latest == nil || latest.Index != 16 { t.Fatalf("unexpected latest entry after partially failed truncate: %+v\n", latest) }
+}
+
+func TestInspectAndRepair(t *testing.T) {
+	testWAL := newTestWAL(t)
+
+	var entries []*log.LogEntry
+	for idx := int64(0); idx < 10; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 + idx / 4 })
+	}
+
+	appendErr := testWAL.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	store := testWAL.LogStore.(*wal.CachedLogStore).Store.(*wal.BoltLogStore)
+
+	report, inspectErr := store.Inspect()
+	if inspectErr != nil { t.Fatalf("error inspecting wal: %s", inspectErr.Error()) }
+	if ! report.IsConsistent() { t.Fatalf("new wal reported as inconsistent: %+v\n", report) }
+
+	corrupt := func(tx *bolt.Tx) error {
+		walBucket := tx.Bucket([]byte(wal.Replog)).Bucket([]byte(wal.ReplogWAL))
+		return walBucket.Delete(wal.ConvertIntToBytes(6))
+	}
+
+	corruptErr := testWAL.DB.Update(corrupt)
+	if corruptErr != nil { t.Fatalf("error corrupting wal: %s", corruptErr.Error()) }
+
+	report, _ = store.Inspect()
+	if report.IsConsistent() || len(report.Gaps) != 1 || report.Gaps[0].From != 6 || report.LastValidIndex != 5 {
+		t.Fatalf("gap not reported: %+v\n", report)
+	}
+
+	if report.StatsEntries != 10 || report.Entries != 9 { t.Fatalf("stats mismatch not reported: %+v\n", report) }
+
+	repaired, repairErr := store.Repair(true)
+	if repairErr != nil { t.Fatalf("error repairing wal: %s", repairErr.Error()) }
+	if ! repaired.IsConsistent() || repaired.LastIndex != 5 || repaired.StatsEntries != 6 { t.Fatalf("wal not repaired: %+v\n", repaired) }
+
+	removedTerm, _ := store.GetIndexedEntryForTerm(3)
+	if removedTerm != nil { t.Fatalf("term after truncated entries still indexed\n") }
+}
+
+func TestDeleteLogsUpToLastIncluded(t *testing.T) {
+	testWAL := newTestWAL(t)
+
+	var entries []*log.LogEntry
+	for idx := int64(1); idx <= 1200; idx++ {
+		entries = append(entries, &log.LogEntry{ Index: idx, Term: 1 + idx / 500, Command: statemachine.Command{ Data: []byte("command") } })
+	}
+
+	appendErr := testWAL.RangeAppend(entries)
+	if appendErr != nil { t.Fatalf("error appending entries: %s", appendErr.Error()) }
+
+	bytesRemoved, keysRemoved, deleteErr := testWAL.DeleteLogsUpToLastIncluded(1099)
+	if deleteErr != nil { t.Fatalf("error compacting log: %s", deleteErr.Error()) }
+	if keysRemoved != 1099 || bytesRemoved == 0 { t.Fatalf("unexpected removed totals: bytes(%d), keys(%d)\n", bytesRemoved, keysRemoved) }
+
+	total, _ := testWAL.GetTotal()
+	if total != 101 { t.Fatalf("actual total not equal to expected: actual(%d), expected(%d)\n", total, 101) }
+
+	earliest, _ := testWAL.GetEarliest()
+	if earliest == nil || earliest.Index != 1100 { t.Fatalf("actual earliest entry not equal to expected: actual(%+v), expected(%d)\n", earliest, 1100) }
+
+	compactedTerm, _ := testWAL.GetIndexedEntryForTerm(2)
+	if compactedTerm != nil { t.Fatalf("fully compacted term still indexed\n") }
+
+	firstInTerm, _ := testWAL.GetIndexedEntryForTerm(3)
+	if firstInTerm == nil || firstInTerm.Index != 1100 { t.Fatalf("first entry of term not moved to earliest entry: %+v\n", firstInTerm) }
+
+	store := testWAL.LogStore.(*wal.CachedLogStore).Store.(*wal.BoltLogStore)
+
+	report, inspectErr := store.Inspect()
+	if inspectErr != nil { t.Fatalf("error inspecting wal: %s", inspectErr.Error()) }
+	if ! report.IsConsistent() { t.Fatalf("compacted wal reported as inconsistent: %+v\n", report) }
+
+	interrupt := func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(wal.Snapshot)).Put([]byte(wal.FirstIndexKey), wal.ConvertIntToBytes(1150))
+	}
+
+	interruptErr := testWAL.DB.Update(interrupt)
+	if interruptErr != nil { t.Fatalf("error moving first index marker: %s", interruptErr.Error()) }
+
+	closeErr := testWAL.Close()
+	if closeErr != nil { t.Fatalf("error closing wal: %s", closeErr.Error()) }
+
+	sizeBefore, sizeAfter, compactErr := wal.CompactDBFile(testWAL.DBFile, 0)
+	if compactErr != nil { t.Fatalf("error compacting wal db: %s", compactErr.Error()) }
+	if sizeAfter >= sizeBefore { t.Fatalf("wal db not shrunk: before(%d), after(%d)\n", sizeBefore, sizeAfter) }
+
+	reopened, reopenErr := wal.NewWAL(wal.WALOpts{})
+	if reopenErr != nil { t.Fatalf("error reopening wal: %s", reopenErr.Error()) }
+	defer reopened.Close()
+
+	resumed, _ := reopened.GetEarliest()
+	if resumed == nil || resumed.Index != 1150 { t.Fatalf("interrupted compaction not resumed: %+v\n", resumed) }
+
+	resumedTotal, _ := reopened.GetTotal()
+	if resumedTotal != 51 { t.Fatalf("actual total not equal to expected: actual(%d), expected(%d)\n", resumedTotal, 51) }
+}
+
+func newTestWAL(t *testing.T) *wal.WAL {
+	homedir := t.TempDir()
+	t.Setenv("HOME", homedir)
+
+	mkdirErr := os.MkdirAll(filepath.Join(homedir, wal.SubDirectory), 0755)
+	if mkdirErr != nil { t.Fatalf("error creating wal directory: %s", mkdirErr.Error()) }
+
+	testWAL, walErr := wal.NewWAL(wal.WALOpts{})
+	if walErr != nil { t.Fatalf("error creating wal: %s", walErr.Error()) }
+
+	t.Cleanup(func() { testWAL.DB.Close() })
+
+	return testWAL
+}
+
+func newTestSegmentStore(t *testing.T, directory string, opts wal.WALOpts) *wal.SegmentLogStore {
+	store, storeErr := wal.NewSegmentLogStore(directory, opts)
+	if storeErr != nil { t.Fatalf("error creating segment store: %s", storeErr.Error()) }
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+/*
+	Failing Log Store:
+		a log store that fails to truncate and compact while failing, after first changing the wrapped log store if the
+		failure is partial
+*/
+
+type failingLogStore struct {
+	wal.LogStore
+	Failing bool
+	Partial bool
+}
+
+var errStoreFailed = errors.New("store failed")
+
+func (store *failingLogStore) DeleteLogsUpToLastIncluded(endIndex int64) (int64, int64, error) {
+	if ! store.Failing { return store.LogStore.DeleteLogsUpToLastIncluded(endIndex) }
+	if store.Partial { store.LogStore.DeleteLogsUpToLastIncluded(endIndex) }
+
+	return 0, 0, errStoreFailed
+}
+
+func (store *failingLogStore) TruncateFrom(index int64) (int64, int64, error) {
+	if ! store.Failing { return store.LogStore.TruncateFrom(index) }
+	if store.Partial { store.LogStore.TruncateFrom(index) }
+
+	return 0, 0, errStoreFailed
+}
@@ -0,0 +1,177 @@
+package watch
+
+import "strings"
+
+import "github.com/sirgallo/raft/pkg/statemachine"
+
+
+//=========================================== Watch
+
+
+/*
+	Change Stream
+		the stream of changes applied to the state machine on this system, in log order
+			--> changes are published from the apply path of the replicated log, where each change is tagged with the index
+				of the log entry for the command that made it. Since every system applies the same log, every system publishes
+				the same events in the same order
+			--> the most recent events are kept in memory, so a subscriber can resume from a log index as long as the index
+				is still in the history
+			--> the stream starts at the last applied index of the system, since changes applied before the stream was created
+				were never published, so no subscriber can resume from an index at or before it
+*/
+
+func NewChangeStream(historySize int, lastApplied int64) *ChangeStream {
+	if historySize <= 0 { historySize = DefaultHistorySize }
+
+	return &ChangeStream{
+		HistorySize: historySize,
+		CompactedIndex: lastApplied,
+		Subscribers: make(map[*Subscriber]bool),
+	}
+}
+
+/*
+	Publish
+		1.) tag each change with the log index and append it to the history, evicting the oldest events over the history size.
+			Events are evicted by whole index, so the history never holds only part of an index and the compacted index is
+			always an index with none of its events left in the history
+		2.) send the events to every subscriber that matches them. Publishing never blocks the apply path, so a subscriber
+			that falls behind by more than its buffer is closed, and can resume from the index after the last event it received.
+			All events for an index are sent together, so a subscriber never receives only part of an index
+*/
+
+func (stream *ChangeStream) Publish(index int64, changes []*statemachine.Change) {
+	if len(changes) == 0 { return }
+
+	stream.Mutex.Lock()
+	defer stream.Mutex.Unlock()
+
+	events := make([]*Event, len(changes))
+	for idx, change := range changes {
+		events[idx] = &Event{
+			Index: index,
+			Type: change.Type,
+			Collection: change.Collection,
+			Key: change.Key,
+			Value: change.Value,
+			Version: change.Version,
+		}
+	}
+
+	stream.History = append(stream.History, events...)
+
+	for sub := range stream.Subscribers {
+		var matched []*Event
+		for _, event := range events {
+			if sub.matches(event) { matched = append(matched, event) }
+		}
+
+		if cap(sub.Events) - len(sub.Events) < len(matched) {
+			sub.Overflowed = true
+			stream.unsubscribe(sub)
+			continue
+		}
+
+		for _, event := range matched {
+			sub.Events <- event
+		}
+	}
+
+	if len(stream.History) > stream.HistorySize {
+		evicted := len(stream.History) - stream.HistorySize
+		for evicted < len(stream.History) && stream.History[evicted].Index == stream.History[evicted - 1].Index {
+			evicted++
+		}
+
+		stream.CompactedIndex = stream.History[evicted - 1].Index
+		stream.History = append([]*Event{}, stream.History[evicted:]...)
+	}
+}
+
+/*
+	Subscribe
+		register a subscriber for events on a collection, and optionally only keys starting with a prefix, where drops of
+		the collection are always sent
+			--> without a from index, only events published after subscribing are sent
+			--> if a from index is passed, all events in the history at or after the index are sent first
+			--> if events at the from index have already been evicted from the history, ErrIndexCompacted is returned and the
+				subscriber needs to read the current state again before watching from the current index
+*/
+
+func (stream *ChangeStream) Subscribe(opts SubscribeOpts) (*Subscriber, error) {
+	stream.Mutex.Lock()
+	defer stream.Mutex.Unlock()
+
+	sub := &Subscriber{ opts: opts }
+
+	var backlog []*Event
+
+	if opts.FromIndex != nil {
+		if *opts.FromIndex <= stream.CompactedIndex { return nil, ErrIndexCompacted }
+
+		for _, event := range stream.History {
+			if event.Index >= *opts.FromIndex && sub.matches(event) { backlog = append(backlog, event) }
+		}
+	}
+
+	sub.Events = make(chan *Event, SubscriberBufferSize + len(backlog))
+	for _, event := range backlog {
+		sub.Events <- event
+	}
+
+	stream.Subscribers[sub] = true
+
+	return sub, nil
+}
+
+/*
+	Compact
+		when the state machine is restored from a snapshot, the changes up to the last included index of the snapshot are
+		never published, so the history before the snapshot no longer lines up with the state machine
+			1.) raise the compacted index to the last included index, and drop the events at or before it from the history
+			2.) close every current subscriber, since the events they were sent can not be continued from the snapshot. A
+				subscriber resuming from an index at or before the snapshot is rejected, and needs to read the current state again
+*/
+
+func (stream *ChangeStream) Compact(lastIncludedIndex int64) {
+	stream.Mutex.Lock()
+	defer stream.Mutex.Unlock()
+
+	if lastIncludedIndex <= stream.CompactedIndex { return }
+
+	stream.CompactedIndex = lastIncludedIndex
+
+	retained := []*Event{}
+	for _, event := range stream.History {
+		if event.Index > lastIncludedIndex { retained = append(retained, event) }
+	}
+
+	stream.History = retained
+
+	for sub := range stream.Subscribers {
+		sub.Compacted = true
+		stream.unsubscribe(sub)
+	}
+}
+
+func (stream *ChangeStream) Unsubscribe(sub *Subscriber) {
+	stream.Mutex.Lock()
+	defer stream.Mutex.Unlock()
+
+	stream.unsubscribe(sub)
+}
+
+func (stream *ChangeStream) unsubscribe(sub *Subscriber) {
+	if sub.closed { return }
+
+	delete(stream.Subscribers, sub)
+	sub.closed = true
+	close(sub.Events)
+}
+
+func (sub *Subscriber) matches(event *Event) bool {
+	if sub.opts.Collection != "" && event.Collection != sub.opts.Collection { return false }
+	if sub.opts.Prefix != "" && event.Type != statemachine.DropChange && ! strings.HasPrefix(event.Key, sub.opts.Prefix) { return false }
+
+	return true
+}
@@ -0,0 +1,48 @@
+package watch
+
+import "encoding/json"
+import "errors"
+import "sync"
+
+import "github.com/sirgallo/raft/pkg/statemachine"
+
+
+type ChangeStream struct {
+	Mutex sync.Mutex
+	History []*Event
+	HistorySize int
+	CompactedIndex int64
+	Subscribers map[*Subscriber]bool
+}
+
+type Event struct {
+	Index int64 `json:"index"`
+	Type statemachine.ChangeType `json:"type"`
+	Collection string `json:"collection"`
+	Key string `json:"key,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Version int64 `json:"version,omitempty"`
+}
+
+type SubscribeOpts struct {
+	Collection string
+	Prefix string
+	FromIndex *int64
+}
+
+type Subscriber struct {
+	Events chan *Event
+	Overflowed bool
+	Compacted bool
+
+	opts SubscribeOpts
+	closed bool
+}
+
+
+const NAME = "Watch"
+const DefaultHistorySize = 10000
+const SubscriberBufferSize = 1000
+const DefaultCompactedIndex = -1 // -1 symbolizes no events applied before the stream was created
+
+var ErrIndexCompacted = errors.New("requested index is no longer in the change history")
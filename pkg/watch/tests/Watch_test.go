@@ -0,0 +1,137 @@
+package watchtests
+
+import "errors"
+import "testing"
+
+import "github.com/sirgallo/raft/pkg/statemachine"
+import "github.com/sirgallo/raft/pkg/watch"
+
+
+func TestChangeStreamFilters(t *testing.T) {
+	stream := watch.NewChangeStream(100, watch.DefaultCompactedIndex)
+
+	sub, subErr := stream.Subscribe(watch.SubscribeOpts{ Collection: "users", Prefix: "u" })
+	if subErr != nil { t.Fatalf("error subscribing: %s", subErr.Error()) }
+
+	stream.Publish(1, []*statemachine.Change{
+		{ Type: statemachine.InsertChange, Collection: "users", Key: "u1" },
+		{ Type: statemachine.InsertChange, Collection: "users", Key: "a1" },
+		{ Type: statemachine.InsertChange, Collection: "teams", Key: "u1" },
+	})
+
+	stream.Publish(2, []*statemachine.Change{ { Type: statemachine.DropChange, Collection: "users" } })
+
+	expected := []statemachine.ChangeType{ statemachine.InsertChange, statemachine.DropChange }
+	for idx, changeType := range expected {
+		event :=<- sub.Events
+		if event.Type != changeType || event.Index != int64(idx + 1) { t.Fatalf("unexpected event: %+v\n", event) }
+	}
+
+	if len(sub.Events) != 0 { t.Fatalf("unexpected events not filtered: %d\n", len(sub.Events)) }
+}
+
+func TestChangeStreamResume(t *testing.T) {
+	stream := watch.NewChangeStream(3, watch.DefaultCompactedIndex)
+
+	for index := int64(0); index < 5; index++ {
+		stream.Publish(index, []*statemachine.Change{ { Type: statemachine.InsertChange, Collection: "users", Key: "u" } })
+	}
+
+	fromIndex := int64(3)
+	sub, subErr := stream.Subscribe(watch.SubscribeOpts{ FromIndex: &fromIndex })
+	if subErr != nil { t.Fatalf("error subscribing: %s", subErr.Error()) }
+
+	for _, index := range []int64{ 3, 4 } {
+		event :=<- sub.Events
+		if event.Index != index { t.Fatalf("actual index not equal to expected: actual(%d), expected(%d)\n", event.Index, index) }
+	}
+
+	compactedIndex := int64(1)
+	_, compactedErr := stream.Subscribe(watch.SubscribeOpts{ FromIndex: &compactedIndex })
+	if ! errors.Is(compactedErr, watch.ErrIndexCompacted) { t.Fatalf("expected compacted error, got: %v\n", compactedErr) }
+}
+
+func TestChangeStreamEvictWholeIndex(t *testing.T) {
+	stream := watch.NewChangeStream(3, watch.DefaultCompactedIndex)
+
+	changes := func(count int) []*statemachine.Change {
+		var published []*statemachine.Change
+		for idx := 0; idx < count; idx++ {
+			published = append(published, &statemachine.Change{ Type: statemachine.InsertChange, Collection: "users", Key: "u" })
+		}
+
+		return published
+	}
+
+	stream.Publish(1, changes(2))
+	stream.Publish(2, changes(1))
+	stream.Publish(3, changes(1))
+
+	if stream.CompactedIndex != 1 || len(stream.History) != 2 || stream.History[0].Index != 2 {
+		t.Fatalf("expected all events for index 1 to be evicted together: compacted(%d), history(%d)\n", stream.CompactedIndex, len(stream.History))
+	}
+
+	stream.Publish(4, changes(5))
+
+	if stream.CompactedIndex != 4 || len(stream.History) != 0 {
+		t.Fatalf("expected index larger than the history to be evicted: compacted(%d), history(%d)\n", stream.CompactedIndex, len(stream.History))
+	}
+}
+
+func TestChangeStreamOverflow(t *testing.T) {
+	stream := watch.NewChangeStream(0, watch.DefaultCompactedIndex)
+
+	sub, subErr := stream.Subscribe(watch.SubscribeOpts{})
+	if subErr != nil { t.Fatalf("error subscribing: %s", subErr.Error()) }
+
+	for index := int64(0); index <= watch.SubscriberBufferSize; index++ {
+		stream.Publish(index, []*statemachine.Change{ { Type: statemachine.InsertChange, Collection: "users", Key: "u" } })
+	}
+
+	received := 0
+	for range sub.Events {
+		received++
+	}
+
+	if ! sub.Overflowed || received != watch.SubscriberBufferSize {
+		t.Fatalf("expected subscriber to be closed on overflow: overflowed(%t), received(%d)\n", sub.Overflowed, received)
+	}
+}
+
+func TestChangeStreamCompact(t *testing.T) {
+	stream := watch.NewChangeStream(100, 5)
+
+	lastApplied := int64(5)
+	_, appliedErr := stream.Subscribe(watch.SubscribeOpts{ FromIndex: &lastApplied })
+	if ! errors.Is(appliedErr, watch.ErrIndexCompacted) { t.Fatalf("expected compacted error before the stream was created, got: %v\n", appliedErr) }
+
+	fromIndex := int64(6)
+	sub, subErr := stream.Subscribe(watch.SubscribeOpts{ FromIndex: &fromIndex })
+	if subErr != nil { t.Fatalf("error subscribing: %s", subErr.Error()) }
+
+	for index := int64(6); index < 10; index++ {
+		stream.Publish(index, []*statemachine.Change{ { Type: statemachine.InsertChange, Collection: "users", Key: "u" } })
+	}
+
+	stream.Compact(8)
+
+	received := 0
+	for range sub.Events {
+		received++
+	}
+
+	if ! sub.Compacted || received != 4 {
+		t.Fatalf("expected subscriber to be closed on compaction: compacted(%t), received(%d)\n", sub.Compacted, received)
+	}
+
+	snapshotIndex := int64(8)
+	_, compactedErr := stream.Subscribe(watch.SubscribeOpts{ FromIndex: &snapshotIndex })
+	if ! errors.Is(compactedErr, watch.ErrIndexCompacted) { t.Fatalf("expected compacted error at the snapshot, got: %v\n", compactedErr) }
+
+	afterSnapshot := int64(9)
+	resumed, resumeErr := stream.Subscribe(watch.SubscribeOpts{ FromIndex: &afterSnapshot })
+	if resumeErr != nil { t.Fatalf("error subscribing: %s", resumeErr.Error()) }
+
+	event :=<- resumed.Events
+	if event.Index != 9 || len(resumed.Events) != 0 { t.Fatalf("expected only the event after the snapshot, got: %+v\n", event) }
+}